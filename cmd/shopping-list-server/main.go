@@ -2,13 +2,16 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
@@ -18,18 +21,27 @@ func main() {
 	config := configuration.HandleCommandlineAndExportConfiguration()
 
 	setupLogger(config.Server.Logfile)
+	if flag.NArg() > 0 && flag.Arg(0) == "migrate" {
+		migrate(config, flag.Args()[1:])
+		return
+	}
+	if flag.NArg() > 0 && flag.Arg(0) == "bootstrap-admin" {
+		bootstrapAdmin(config)
+		return
+	}
 	// Fails if database not connected
-	db, err := database.CheckDatabaseOnline(config.Database)
+	store, err := database.NewStore(config.Database)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer store.Close()
 	if config.Database.Reset {
-		resetDatabase()
+		resetDatabase(store)
 	}
-	server.Start(db, config)
+	server.Start(store, config)
 }
 
-func resetDatabase() {
+func resetDatabase(store database.Store) {
 	log.Printf("ACTIVATED RESET OF DATABASE! THIS CANNOT BE REVERTED!")
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Print("Continue [y/N]: ")
@@ -38,12 +50,76 @@ func resetDatabase() {
 	confirmed = strings.TrimSpace(confirmed)
 	if confirmed == "y" || confirmed == "yes" {
 		log.Print("Proceed to reset database...")
-		database.ResetDatabase()
+		store.ResetDatabase()
 		return
 	}
 	log.Print("Reset of database aborted")
 }
 
+// Usage: shopping-list-server [flags] migrate up|down [N]|status
+func migrate(config configuration.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal("Missing migrate command: up, down [N] or status")
+	}
+	store, err := database.OpenSQLStore(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	switch args[0] {
+	case "up":
+		if err := store.MigrateUp(); err != nil {
+			log.Fatalf("Failed to migrate up: %s", err)
+		}
+		log.Print("Database schema is up to date")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatalf("Invalid number of migrations '%s': %s", args[1], err)
+			}
+		}
+		if err := store.MigrateDown(steps); err != nil {
+			log.Fatalf("Failed to migrate down: %s", err)
+		}
+		log.Printf("Reverted up to %d migration(s)", steps)
+	case "status":
+		states, err := store.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %s", err)
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.Applied {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", state.Version, state.Name, appliedAt)
+		}
+	default:
+		log.Fatalf("Unknown migrate command '%s'", args[0])
+	}
+}
+
+// Usage: shopping-list-server [flags] bootstrap-admin
+func bootstrapAdmin(config configuration.Config) {
+	store, err := database.NewStore(config.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	admin, created, err := authentication.BootstrapAdmin(store, config.Admin)
+	if err != nil {
+		log.Fatalf("Failed to create admin: %s", err)
+	}
+	if !created {
+		log.Printf("Admin %d (%s) already exists, nothing created", admin.OnlineID, admin.Username)
+		return
+	}
+	// The id is required for the login
+	log.Printf("Created admin %d (%s)", admin.OnlineID, admin.Username)
+}
+
 func setupLogger(logfile string) {
 	if logfile == "" {
 		log.Fatalf("No log file specified")
@@ -0,0 +1,41 @@
+package authentication
+
+import (
+	"errors"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+// ------------------------------------------------------------
+// Creating the first admin
+// ------------------------------------------------------------
+
+// BootstrapAdmin creates the admin of the configuration if no admin exists yet.
+// Returns the existing admin and false otherwise, so it can run on every deployment.
+func BootstrapAdmin(store database.UserStore, config configuration.AdminConfig) (data.User, bool, error) {
+	admins, err := store.GetUsersWithRole(data.ADMIN)
+	if err != nil {
+		return data.User{}, false, err
+	}
+	if len(admins) > 0 {
+		return admins[0], false, nil
+	}
+	if config.User == "" || config.Password == "" {
+		return data.User{}, false, errors.New("no admin user and password configured")
+	}
+	admin, err := store.CreateUserAccountInDatabase(config.User, config.Password)
+	if err != nil {
+		return data.User{}, false, err
+	}
+	if err := store.SetUserRole(admin.OnlineID, data.ADMIN); err != nil {
+		// Do not leave a regular user with the admin credentials behind
+		if deleteErr := store.DeleteUserAccount(admin.OnlineID); deleteErr != nil {
+			return data.User{}, false, errors.Join(err, deleteErr)
+		}
+		return data.User{}, false, err
+	}
+	admin.Role = data.ADMIN
+	return admin, true, nil
+}
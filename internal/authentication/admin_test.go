@@ -0,0 +1,36 @@
+package authentication
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	store := database.NewMemoryStore()
+	_, _, err := BootstrapAdmin(store, configuration.AdminConfig{User: "admin"})
+	assert.NotNil(t, err)
+
+	config := configuration.AdminConfig{User: "admin", Password: "admin password"}
+	admin, created, err := BootstrapAdmin(store, config)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, data.ADMIN, admin.Role)
+	stored, err := store.GetUser(admin.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ADMIN, stored.Role)
+	assert.Nil(t, VerifyPassword(stored, config.Password))
+
+	// Running again keeps the existing admin
+	existing, created, err := BootstrapAdmin(store, configuration.AdminConfig{User: "second admin", Password: "password"})
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, admin.OnlineID, existing.OnlineID)
+	users, err := store.GetAllUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+}
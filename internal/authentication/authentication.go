@@ -1,13 +1,13 @@
 package authentication
 
 import (
-	"database/sql"
 	"errors"
 	"log"
+	"math"
 	"net/http"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,7 +23,9 @@ import (
 type AuthenticationHandler struct {
 	config       configuration.Config
 	tokenHandler *TokenHandler
-	db           *sql.DB
+	store        database.Store
+	logins       *LoginThrottle
+	oidc         *OIDCProvider // nil unless configured
 }
 
 var (
@@ -35,43 +37,16 @@ var (
 // Setup and configuration
 // ------------------------------------------------------------
 
-func NewAuthenticationHandler(db *sql.DB, config configuration.Config) *AuthenticationHandler {
-	// TODO: Move into database as well
-	//err := SetupWhitelistedIPs()
-	//if err != nil {
-	//	log.Fatalf("Failed to setup whitelisted IPs: %s", err)
-	//}
-	tokenHandler := NewTokenHandler(db, config.JWT)
+func NewAuthenticationHandler(store database.Store, config configuration.Config, tokenHandler *TokenHandler, logins *LoginThrottle, oidc *OIDCProvider) *AuthenticationHandler {
 	return &AuthenticationHandler{
 		config:       config,
 		tokenHandler: tokenHandler,
-		db:           db,
+		store:        store,
+		logins:       logins,
+		oidc:         oidc,
 	}
 }
 
-// ------------------------------------------------------------
-// Helping methods and auxiliary functions
-// ------------------------------------------------------------
-
-func IPWhiteList(whitelist map[string]bool) gin.HandlerFunc {
-	f := func(c *gin.Context) {
-		// If the IP isn't in the whitelist, forbid the request.
-		ip := c.ClientIP()
-		// log.Printf("IP: %s", ip)
-
-		re := regexp.MustCompile(`([\d]+).([\d]+).[\d]+.[\d]+`)
-		ipRange := re.ReplaceAllString(ip, "$1.$2.0.0")
-		// log.Printf("Ip Range: %s", ipRange)
-		if !whitelist[ip] && !whitelist[ipRange] {
-			log.Printf("Unauthorized access from %s", ip)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "request from IP not allowed"})
-			return
-		}
-		c.Next()
-	}
-	return f
-}
-
 // ------------------------------------------------------------
 // Account authentication and login
 // ------------------------------------------------------------
@@ -81,44 +56,32 @@ func (a *AuthenticationHandler) Login(c *gin.Context) {
 	// TODO: Even prevent login if header with credentials is set
 	// c.GetHeader("Authorization")
 
-	var user data.User
+	var user LoginRequest
 	err := c.ShouldBindJSON(&user)
 	if err != nil {
 		log.Printf("Login does not contain user information: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	// database.PrintUserTable("shoppers")
-	// TODO: Move this functionality out of the code and into the data; with a permission column
-	specialUser := user.Username
-	if specialUser == "admin" {
-		log.Print("Admin user logging in, changing login process for debug purposes")
-		if user.Password != "12345" {
-			log.Print("Incorrect password for user 'Admin'")
-			c.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		token, err := a.tokenHandler.GenerateNewJWTToken(user.OnlineID, specialUser)
-		if err != nil {
-			log.Printf("Failed to generate JWT token: %s", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		wireToken := Token{
-			Token: token,
-		}
-		c.JSON(http.StatusOK, wireToken)
+	// Checked before the password, otherwise the attempts would still tell whether the password is correct
+	ip := c.ClientIP()
+	if wait := a.logins.RetryAfter(user.OnlineID, ip); wait > 0 {
+		log.Printf("Too many failed logins for user %d or from %s", user.OnlineID, ip)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatus(http.StatusTooManyRequests)
 		return
 	}
-	dbUser, err := database.GetUser(user.OnlineID)
+	dbUser, err := a.store.GetUser(user.OnlineID)
 	if err != nil {
 		log.Printf("User not found!")
+		a.logins.Failed(0, ip, LoginFailureUnknownUser)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
 	// Username and ID must match
 	if dbUser.OnlineID != user.OnlineID || dbUser.Username != user.Username {
 		log.Print("The stored user does not match the user trying to log in!")
+		a.logins.Failed(dbUser.OnlineID, ip, LoginFailureWrongCredentials)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
@@ -131,12 +94,28 @@ func (a *AuthenticationHandler) Login(c *gin.Context) {
 	}
 	if !match {
 		log.Printf("The given password is incorrect for user %d", user.OnlineID)
+		a.logins.Failed(dbUser.OnlineID, ip, LoginFailureWrongCredentials)
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
+	if !a.verifySecondFactor(c, user, ip) {
+		return
+	}
+	a.logins.Succeeded(dbUser.OnlineID)
+	a.issueTokens(c, dbUser, deviceName(c))
+}
 
+// issueTokens starts a new session of the user and answers with its access and refresh token
+func (a *AuthenticationHandler) issueTokens(c *gin.Context, user data.User, device string) {
+	// Every login is a new session, so other devices stay logged in
+	session, err := a.tokenHandler.StartSession(user.OnlineID, device, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to start session: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
 	// Generate a new token that is valid for a few minutes to make a few requests
-	token, err := a.tokenHandler.GenerateNewJWTToken(user.OnlineID, user.Username)
+	token, err := a.tokenHandler.GenerateNewJWTToken(user, session.SessionId)
 	if err != nil {
 		log.Printf("Failed to generate JWT token: %s", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -144,19 +123,104 @@ func (a *AuthenticationHandler) Login(c *gin.Context) {
 	}
 
 	log.Print("User found and token generated")
-	_, err = database.ModifyLastLogin(user.OnlineID)
+	_, err = a.store.ModifyLastLogin(user.OnlineID)
 	if err != nil {
 		log.Printf("Failed to modify last login: %s", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
 	}
 
+	refreshToken, err := a.tokenHandler.GenerateRefreshToken(user.OnlineID, session.SessionId)
+	if err != nil {
+		log.Printf("Failed to generate refresh token: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
 	wireToken := Token{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
 	}
 	c.JSON(http.StatusOK, wireToken)
 }
 
-func (a *AuthenticationHandler) basicTokenAuthenticationFunction(c *gin.Context) {
+// verifySecondFactor checks the TOTP or recovery code of the login once TOTP is enabled
+func (a *AuthenticationHandler) verifySecondFactor(c *gin.Context, user LoginRequest, ip string) bool {
+	required, err := SecondFactorRequired(a.store, user.OnlineID)
+	if err != nil {
+		log.Printf("Failed to get second factor of user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if !required {
+		return true
+	}
+	if user.TOTPCode == "" && user.RecoveryCode == "" {
+		// Tells the client to ask for the code, the password was correct
+		log.Printf("Login of user %d requires the second factor", user.OnlineID)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "second factor required", "secondFactor": "totp"})
+		return false
+	}
+	err = VerifySecondFactor(a.store, user.OnlineID, data.SecondFactor{Code: user.TOTPCode, RecoveryCode: user.RecoveryCode})
+	if errors.Is(err, ErrInvalidSecondFactor) {
+		log.Printf("Invalid second factor of user %d", user.OnlineID)
+		a.logins.Failed(user.OnlineID, ip, LoginFailureSecondFactor)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return false
+	} else if err != nil {
+		log.Printf("Failed to verify second factor of user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+func (a *AuthenticationHandler) Refresh(c *gin.Context) {
+	var request RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		log.Printf("Refresh does not contain a refresh token: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	replaced, refreshToken, err := a.tokenHandler.RotateRefreshToken(request.RefreshToken)
+	if err != nil {
+		log.Printf("Failed to refresh token: %s", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	user, err := a.store.GetUser(replaced.UserId)
+	if err != nil {
+		log.Printf("User %d of refresh token not found: %s", replaced.UserId, err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	a.touchSession(c, replaced.FamilyId)
+	token, err := a.tokenHandler.GenerateNewJWTToken(user, replaced.FamilyId)
+	if err != nil {
+		log.Printf("Failed to generate JWT token: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, Token{Token: token, RefreshToken: refreshToken})
+}
+
+// deviceName names the session of a login, clients can set it with the device parameter
+func deviceName(c *gin.Context) string {
+	if device := c.Query("device"); device != "" {
+		return device
+	}
+	return c.GetHeader("User-Agent")
+}
+
+func (a *AuthenticationHandler) touchSession(c *gin.Context, sessionId string) {
+	if err := a.store.TouchSession(sessionId, c.ClientIP(), time.Now().UTC()); err != nil {
+		log.Printf("Failed to update last seen time of session: %s", err)
+	}
+}
+
+// authenticateToken sets the user, role and session of a valid access token in the context,
+// otherwise the request is aborted
+func (a *AuthenticationHandler) authenticateToken(c *gin.Context) bool {
 	origin := c.ClientIP()
 	remote := c.RemoteIP()
 	log.Printf("Authenticate client from origin: %s, Remote: %s", origin, remote)
@@ -165,7 +229,7 @@ func (a *AuthenticationHandler) basicTokenAuthenticationFunction(c *gin.Context)
 	if tokenString == "" {
 		log.Print("No token found! Abort")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no token"})
-		return
+		return false
 	}
 	splits := strings.Split(tokenString, " ")
 	var reqToken string
@@ -173,61 +237,63 @@ func (a *AuthenticationHandler) basicTokenAuthenticationFunction(c *gin.Context)
 		if strings.HasPrefix(splits[0], "Authorization") {
 			log.Printf("Token in incorrect format! '%s'", tokenString)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "wrong token format"})
-			return
+			return false
 		}
 		reqToken = splits[0]
 	} else {
 		reqToken = splits[1]
 	}
 	claims := Claims{}
-	token, err := jwt.ParseWithClaims(reqToken, &claims, func(t *jwt.Token) (interface{}, error) {
-		_, ok := t.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, errors.New("unauthorized")
-		}
-
-		if time.Now().After(a.config.JWT.ValidUntil) {
-			log.Print("The given secret under 'JWT.Secret' is no longer valid! Please renew the secret in config.json")
-			return nil, errors.New("token no longer valid")
-		}
-		secretKeyByte := []byte(a.config.JWT.Secret)
-		return secretKeyByte, nil
-	})
+	token, err := jwt.ParseWithClaims(reqToken, &claims, a.tokenHandler.keys.Keyfunc)
 	if err != nil {
 		log.Printf("Error during token parsing: %s", err)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return false
 	}
 	// Checking if user in this form exists
 	parsedClaims, ok := token.Claims.(*Claims)
 	if !ok {
 		log.Print("Received token claims are in incorrect format!")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return false
 	}
-	user, err := database.GetUser(parsedClaims.Id)
+	user, err := a.store.GetUser(parsedClaims.Id)
 	if err != nil {
 		log.Printf("User for id %d not found!", parsedClaims.Id)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return false
 	}
 	if user.Username != parsedClaims.Username {
 		log.Print("The stored user and claimed token user do not match")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return false
 	}
 	// Check if the token was issued
-	if err = a.tokenHandler.IsTokenValid(user.OnlineID, token.Raw); err != nil {
+	if err = a.tokenHandler.IsTokenValid(user.OnlineID, parsedClaims.SessionId, parsedClaims.ID); err != nil {
 		log.Printf("Error with token: %s", err)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return false
 	}
-	if token.Valid {
-		c.Set("userId", claims.Id)
-		c.Next()
-	} else {
+	if !token.Valid {
 		log.Printf("Invalid claims: %v", claims)
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return false
+	}
+	c.Set("userId", claims.Id)
+	c.Set("sessionId", claims.SessionId)
+	c.Set("tokenId", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set("tokenExpires", claims.ExpiresAt.Time)
+	}
+	// The stored role instead of the claim, so revoking the admin role applies to issued tokens
+	c.Set("role", user.Role)
+	a.touchSession(c, claims.SessionId)
+	return true
+}
+
+func (a *AuthenticationHandler) basicTokenAuthenticationFunction(c *gin.Context) {
+	if a.authenticateToken(c) {
+		c.Next()
 	}
 }
 
@@ -243,63 +309,59 @@ func (a *AuthenticationHandler) DebugAuthenticationMiddleware() gin.HandlerFunc
 	return a.debugAuthentication
 }
 
-func (a *AuthenticationHandler) AdminAuthWithoutUserMiddleware() gin.HandlerFunc {
+// RequirePermission only accepts tokens of users whose role grants the permission.
+// Services without a user, e.g. metrics scrapers, send an API key granting it instead.
+func (a *AuthenticationHandler) RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKeyString := c.GetHeader("x-api-key")
-		if apiKeyString == "" {
-			log.Print("No token found! Abort")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no API token"})
+		if apiKeyString != "" && c.GetHeader("Authorization") == "" {
+			apiKeyClaims, err := a.ApiKeyValid(apiKeyString)
+			if err != nil {
+				log.Printf("API Key not valid: %s", err)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+				return
+			}
+			if !apiKeyClaims.Allows(permission) {
+				log.Printf("API key does not grant '%s'", permission)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + permission})
+				return
+			}
+			c.Next()
 			return
 		}
-		// Validate the token to be correct
-		apiKeyClaims, err := a.ApiKeyValid(apiKeyString)
-		if err != nil {
-			log.Printf("API Key not valid: %s", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		if !a.authenticateToken(c) {
 			return
 		}
-		// Validate the user
-		if apiKeyClaims.Admin != true {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		if !data.RoleAllows(c.GetString("role"), permission) {
+			log.Printf("Role of user %d does not grant '%s'", c.GetInt64("userId"), permission)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + permission})
 			return
 		}
-
 		c.Next()
 	}
 }
 
-func (a *AuthenticationHandler) AdminAuthenticationMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		apiKeyString := c.GetHeader("x-api-key")
-		if apiKeyString == "" {
-			log.Print("No token found! Abort")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no API token"})
-			return
-		}
-		// Validate the token to be correct
-		apiKeyClaims, err := a.ApiKeyValid(apiKeyString)
-		if err != nil {
-			log.Printf("API Key not valid: %s", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
-			return
-		}
-		// Validate the user
-		if apiKeyClaims.Admin != true {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
-			return
-		}
-
-		a.basicTokenAuthenticationFunction(c)
-	}
-}
-
 type ApiKey struct {
 	Key        string    `json:"key"`
 	ValidUntil time.Time `json:"validUntil"`
-	Admin      bool      `json:"admin"`
+	Admin      bool      `json:"admin"` // Keys created before permissions existed, only read the metrics
+	// Permissions granted to the holder of the key, see data.Permission*
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
+func (k ApiKey) Allows(permission string) bool {
+	if len(k.Permissions) == 0 {
+		return k.Admin && permission == data.PermissionMetricsRead
+	}
+	for _, granted := range k.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
 type ApiKeySecret struct {
 	Secret     string    `json:"secret"`
 	ValidUntil time.Time `json:"validUntil"`
@@ -308,18 +370,8 @@ type ApiKeySecret struct {
 func (a *AuthenticationHandler) parseApiKeyToClaims(apiKey string) (ApiKey, error) {
 	apiKey = strings.TrimSpace(apiKey)
 	claims := ApiKey{}
-	_, err := jwt.ParseWithClaims(apiKey, &claims, func(t *jwt.Token) (interface{}, error) {
-		_, ok := t.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		if time.Now().After(a.config.API.ValidUntil) {
-			log.Print("The given secret is no longer valid! Please renew the secret")
-			return nil, errors.New("token no longer valid")
-		}
-		secretKeyByte := []byte(a.config.API.Key)
-		return secretKeyByte, nil
-	})
+	// API keys are signed by the same keys, the key claim has to match the configured key
+	_, err := jwt.ParseWithClaims(apiKey, &claims, a.tokenHandler.keys.Keyfunc)
 	if err != nil {
 		return ApiKey{}, err
 	}
@@ -334,9 +386,6 @@ func (a *AuthenticationHandler) ApiKeyValid(apiKey string) (ApiKey, error) {
 	if time.Now().After(httpRequestClaims.ValidUntil) {
 		return ApiKey{}, errors.New("api key no longer valid")
 	}
-	if httpRequestClaims.Admin != true {
-		return ApiKey{}, errors.New("invalid user rights")
-	}
 	if httpRequestClaims.Key != a.config.API.Key {
 		log.Print("Claimed key does not match secret")
 		return ApiKey{}, errors.New("invalid secret")
@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ------------------------------------------------------------
+// Signed invite tokens, the invite itself is kept in the database
+// ------------------------------------------------------------
+
+const inviteSubject = "invite"
+
+var ErrInviteExpired = errors.New("invite token expired")
+
+func (t *TokenHandler) GenerateInviteToken(inviteId string, validUntil time.Time) (string, error) {
+	if inviteId == "" {
+		return "", errors.New("empty invite id")
+	}
+	claims := jwt.RegisteredClaims{
+		ID:        inviteId,
+		Subject:   inviteSubject,
+		Issuer:    "shopping-list-server",
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(validUntil),
+	}
+	return t.keys.Sign(claims)
+}
+
+// ParseInviteToken checks signature and expiry and returns the invite id
+func (t *TokenHandler) ParseInviteToken(token string) (string, error) {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, t.keys.Keyfunc, jwt.WithSubject(inviteSubject), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return "", ErrInviteExpired
+	}
+	if err != nil {
+		return "", err
+	}
+	if claims.ID == "" {
+		return "", errors.New("invite token without id")
+	}
+	return claims.ID, nil
+}
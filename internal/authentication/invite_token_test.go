@@ -0,0 +1,30 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+func TestInviteToken(t *testing.T) {
+	handler := NewTokenHandler(nil, configuration.AuthConfig{}, newTestKeySet(t))
+	token, err := handler.GenerateInviteToken("abc", time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	inviteId, err := handler.ParseInviteToken(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", inviteId)
+
+	// Tampered, expired and foreign tokens are rejected
+	_, err = handler.ParseInviteToken(token + "x")
+	assert.NotNil(t, err)
+	expired, err := handler.GenerateInviteToken("abc", time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	_, err = handler.ParseInviteToken(expired)
+	assert.Equal(t, ErrInviteExpired, err)
+	other := NewTokenHandler(nil, configuration.AuthConfig{}, newTestKeySet(t))
+	_, err = other.ParseInviteToken(token)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sync/atomic"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+// ------------------------------------------------------------
+// Allowed and denied client addresses per route group
+// ------------------------------------------------------------
+
+type ipAccessList struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// IPAccessLists holds the rules of all route groups. Reloading replaces all of them at
+// once, so requests see either the old or the new rules.
+type IPAccessLists struct {
+	file  string
+	lists atomic.Pointer[map[string]ipAccessList]
+}
+
+// NewIPAccessLists loads the rules of the configured file, without file every address is allowed
+func NewIPAccessLists(config configuration.IPAccessConfig) (*IPAccessLists, error) {
+	lists := &IPAccessLists{file: config.File}
+	lists.lists.Store(&map[string]ipAccessList{})
+	if err := lists.Reload(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// Reload reads the file again, the current rules stay in place if it is invalid
+func (l *IPAccessLists) Reload() error {
+	if l.file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(l.file)
+	if err != nil {
+		return err
+	}
+	var rules map[string]configuration.IPAccessRules
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return fmt.Errorf("invalid IP access lists in %s: %w", l.file, err)
+	}
+	if err := l.Set(rules); err != nil {
+		return err
+	}
+	log.Printf("Loaded IP access lists of %d route group(s) from %s", len(rules), l.file)
+	return nil
+}
+
+// Set replaces the rules of all route groups
+func (l *IPAccessLists) Set(rules map[string]configuration.IPAccessRules) error {
+	lists := make(map[string]ipAccessList, len(rules))
+	for group, groupRules := range rules {
+		allow, err := parsePrefixes(groupRules.Allow)
+		if err != nil {
+			return fmt.Errorf("invalid allowed address of group %s: %w", group, err)
+		}
+		deny, err := parsePrefixes(groupRules.Deny)
+		if err != nil {
+			return fmt.Errorf("invalid denied address of group %s: %w", group, err)
+		}
+		lists[group] = ipAccessList{allow: allow, deny: deny}
+	}
+	l.lists.Store(&lists)
+	return nil
+}
+
+// parsePrefixes accepts CIDR ranges and single addresses
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("'%s' is neither an address nor a CIDR range", entry)
+			}
+			addr = addr.Unmap().WithZone("")
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the client address may use the route group, groups without rules allow everyone
+func (l *IPAccessLists) Allowed(group string, ip string) bool {
+	list, exists := (*l.lists.Load())[group]
+	if !exists {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	// IPv4 clients of dual-stack listeners arrive as ::ffff:a.b.c.d
+	addr = addr.Unmap().WithZone("")
+	if containsAddr(list.deny, addr) {
+		return false
+	}
+	return len(list.allow) == 0 || containsAddr(list.allow, addr)
+}
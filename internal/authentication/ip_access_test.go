@@ -0,0 +1,60 @@
+package authentication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+func TestIPAccessAllowAndDeny(t *testing.T) {
+	lists, err := NewIPAccessLists(configuration.IPAccessConfig{})
+	assert.Nil(t, err)
+	assert.True(t, lists.Allowed("admin", "203.0.113.7"))
+
+	err = lists.Set(map[string]configuration.IPAccessRules{
+		"admin":   {Allow: []string{"10.0.0.0/16", "2001:db8::/32", "192.168.1.10"}, Deny: []string{"10.0.5.0/24"}},
+		"metrics": {Deny: []string{"203.0.113.0/24"}},
+	})
+	assert.Nil(t, err)
+	assert.True(t, lists.Allowed("admin", "10.0.200.1"))
+	assert.True(t, lists.Allowed("admin", "::ffff:10.0.1.1"))
+	assert.True(t, lists.Allowed("admin", "2001:db8:1::5"))
+	assert.True(t, lists.Allowed("admin", "192.168.1.10"))
+	assert.False(t, lists.Allowed("admin", "192.168.1.11"))
+	assert.False(t, lists.Allowed("admin", "10.0.5.20"))
+	assert.False(t, lists.Allowed("admin", "10.1.0.1"))
+	assert.False(t, lists.Allowed("admin", "2001:db9::1"))
+	assert.False(t, lists.Allowed("admin", "not an address"))
+	// Deny-only groups allow all other addresses, groups without rules everyone
+	assert.False(t, lists.Allowed("metrics", "203.0.113.7"))
+	assert.True(t, lists.Allowed("metrics", "198.51.100.1"))
+	assert.True(t, lists.Allowed("api", "203.0.113.7"))
+
+	assert.NotNil(t, lists.Set(map[string]configuration.IPAccessRules{"admin": {Allow: []string{"10.0.0.0/33"}}}))
+	assert.NotNil(t, lists.Set(map[string]configuration.IPAccessRules{"admin": {Deny: []string{"10.0.0"}}}))
+}
+
+func TestIPAccessReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ip_access.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"admin": {"Allow": ["10.0.0.0/8"]}}`), 0600))
+	lists, err := NewIPAccessLists(configuration.IPAccessConfig{File: file})
+	assert.Nil(t, err)
+	assert.False(t, lists.Allowed("admin", "192.168.0.1"))
+
+	assert.Nil(t, os.WriteFile(file, []byte(`{"admin": {"Allow": ["192.168.0.0/16"]}}`), 0600))
+	assert.Nil(t, lists.Reload())
+	assert.True(t, lists.Allowed("admin", "192.168.0.1"))
+	assert.False(t, lists.Allowed("admin", "10.0.0.1"))
+
+	// Invalid files keep the current rules
+	assert.Nil(t, os.WriteFile(file, []byte(`{"admin": {"Allow": ["192.168.0.0/99"]}}`), 0600))
+	assert.NotNil(t, lists.Reload())
+	assert.True(t, lists.Allowed("admin", "192.168.0.1"))
+
+	_, err = NewIPAccessLists(configuration.IPAccessConfig{File: filepath.Join(t.TempDir(), "missing.json")})
+	assert.NotNil(t, err)
+}
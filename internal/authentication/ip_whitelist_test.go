@@ -1,13 +0,0 @@
-package authentication
-
-import (
-	"testing"
-)
-
-func TestWhitelistedIPAllowed(t *testing.T) {
-	t.Skip("Not implemented")
-}
-
-func TestNonWhitelistedIPDisallowed(t *testing.T) {
-	t.Skip("Not implemented")
-}
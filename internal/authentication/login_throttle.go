@@ -0,0 +1,207 @@
+package authentication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+// ------------------------------------------------------------
+// Brute-force protection of the login
+// ------------------------------------------------------------
+
+const (
+	// Failed logins before every further attempt has to wait, doubling with every failure
+	freeUserLoginAttempts = 3
+	freeIPLoginAttempts   = 10 // Several users may share an address
+	initialLoginBackoff   = time.Second
+
+	defaultMaxLoginAttempts = 10
+	defaultLockoutDuration  = 30 * time.Minute
+
+	// Pruning the entries of old failures starts once this many addresses or users are tracked
+	loginThrottlePruneSize = 10000
+)
+
+// Reasons of failed logins and scopes of throttled logins passed to the LoginObserver
+const (
+	LoginFailureUnknownUser      = "unknown_user"
+	LoginFailureWrongCredentials = "wrong_credentials"
+	LoginFailureSecondFactor     = "second_factor"
+	LoginScopeUser               = "user"
+	LoginScopeIP                 = "ip"
+)
+
+// LoginObserver is notified about failed and throttled logins, e.g. to count them in the metrics
+type LoginObserver interface {
+	LoginFailed(reason string)
+	LoginThrottled(scope string)
+	AccountLocked(userId int64)
+	AccountUnlocked(userId int64)
+}
+
+type nopLoginObserver struct{}
+
+func (nopLoginObserver) LoginFailed(string)    {}
+func (nopLoginObserver) LoginThrottled(string) {}
+func (nopLoginObserver) AccountLocked(int64)   {}
+func (nopLoginObserver) AccountUnlocked(int64) {}
+
+type loginFailures struct {
+	count        int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	locked       bool // Reached the maximum attempts, only the lockout or an admin ends it
+}
+
+// LoginThrottle tracks failed logins per user and per address. After a few failures every
+// further attempt has to wait exponentially longer, too many failures lock the account.
+// The failures are only tracked in this process, like the events.MemoryHub.
+type LoginThrottle struct {
+	mutex    sync.Mutex
+	users    map[int64]*loginFailures
+	ips      map[string]*loginFailures
+	observer LoginObserver
+
+	maxAttempts     int
+	lockoutDuration time.Duration
+	now             func() time.Time
+}
+
+func NewLoginThrottle(config configuration.AuthConfig, observer LoginObserver) *LoginThrottle {
+	if observer == nil {
+		observer = nopLoginObserver{}
+	}
+	throttle := &LoginThrottle{
+		users:           make(map[int64]*loginFailures),
+		ips:             make(map[string]*loginFailures),
+		observer:        observer,
+		maxAttempts:     config.MaxLoginAttempts,
+		lockoutDuration: time.Duration(config.LockoutMinutes) * time.Minute,
+		now:             time.Now,
+	}
+	if throttle.maxAttempts <= 0 {
+		throttle.maxAttempts = defaultMaxLoginAttempts
+	}
+	if throttle.lockoutDuration <= 0 {
+		throttle.lockoutDuration = defaultLockoutDuration
+	}
+	return throttle
+}
+
+// RetryAfter returns how long the user or address has to wait before the next attempt, 0 if allowed
+func (l *LoginThrottle) RetryAfter(userId int64, ip string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	wait := time.Duration(0)
+	scope := ""
+	if failures, exists := l.users[userId]; exists && failures.blockedUntil.After(now) {
+		wait = failures.blockedUntil.Sub(now)
+		scope = LoginScopeUser
+	}
+	if failures, exists := l.ips[ip]; exists && failures.blockedUntil.Sub(now) > wait {
+		wait = failures.blockedUntil.Sub(now)
+		scope = LoginScopeIP
+	}
+	if wait > 0 {
+		l.observer.LoginThrottled(scope)
+	}
+	return wait
+}
+
+// Failed counts the failed attempt, userId is 0 if the user does not exist
+func (l *LoginThrottle) Failed(userId int64, ip string, reason string) {
+	l.observer.LoginFailed(reason)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.prune(now)
+	ipFailures := failuresOf(l, l.ips, ip, now)
+	ipFailures.blockedUntil = now.Add(l.backoff(ipFailures.count, freeIPLoginAttempts))
+	if userId == 0 {
+		return
+	}
+	userFailures := failuresOf(l, l.users, userId, now)
+	if userFailures.locked {
+		// Concurrent attempts started before the lockout do not extend it
+		return
+	}
+	if userFailures.count >= l.maxAttempts {
+		userFailures.locked = true
+		userFailures.blockedUntil = now.Add(l.lockoutDuration)
+		l.observer.AccountLocked(userId)
+		return
+	}
+	userFailures.blockedUntil = now.Add(l.backoff(userFailures.count, freeUserLoginAttempts))
+}
+
+// failuresOf counts the failure, earlier failures are forgotten after the lockout duration
+// or once the lockout ended
+func failuresOf[K comparable](l *LoginThrottle, entries map[K]*loginFailures, key K, now time.Time) *loginFailures {
+	failures, exists := entries[key]
+	if !exists || l.expired(failures, now) {
+		failures = &loginFailures{}
+		entries[key] = failures
+	}
+	failures.count++
+	failures.lastFailure = now
+	return failures
+}
+
+func (l *LoginThrottle) expired(failures *loginFailures, now time.Time) bool {
+	if failures.locked {
+		return !failures.blockedUntil.After(now)
+	}
+	return !failures.blockedUntil.After(now) && now.Sub(failures.lastFailure) > l.lockoutDuration
+}
+
+func (l *LoginThrottle) backoff(count int, free int) time.Duration {
+	if count < free {
+		return 0
+	}
+	backoff := initialLoginBackoff
+	for i := free; i < count && backoff < l.lockoutDuration; i++ {
+		backoff *= 2
+	}
+	return min(backoff, l.lockoutDuration)
+}
+
+func (l *LoginThrottle) prune(now time.Time) {
+	if len(l.ips) >= loginThrottlePruneSize {
+		for ip, failures := range l.ips {
+			if l.expired(failures, now) {
+				delete(l.ips, ip)
+			}
+		}
+	}
+	if len(l.users) >= loginThrottlePruneSize {
+		for userId, failures := range l.users {
+			if l.expired(failures, now) {
+				delete(l.users, userId)
+			}
+		}
+	}
+}
+
+// Succeeded forgets the failures of the user, those of the address are kept
+// so a valid account cannot be used to reset the counter
+func (l *LoginThrottle) Succeeded(userId int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.users, userId)
+}
+
+// Unlock ends the lockout of the account, returns false if the user was not locked
+func (l *LoginThrottle) Unlock(userId int64) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	failures, exists := l.users[userId]
+	if !exists || !failures.locked || !failures.blockedUntil.After(l.now()) {
+		return false
+	}
+	delete(l.users, userId)
+	l.observer.AccountUnlocked(userId)
+	return true
+}
@@ -0,0 +1,88 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+type countingLoginObserver struct {
+	failures  map[string]int
+	throttled map[string]int
+	locked    int
+	unlocked  int
+}
+
+func (o *countingLoginObserver) LoginFailed(reason string)    { o.failures[reason]++ }
+func (o *countingLoginObserver) LoginThrottled(scope string)  { o.throttled[scope]++ }
+func (o *countingLoginObserver) AccountLocked(userId int64)   { o.locked++ }
+func (o *countingLoginObserver) AccountUnlocked(userId int64) { o.unlocked++ }
+
+func setupLoginThrottle() (*LoginThrottle, *countingLoginObserver, *time.Time) {
+	observer := &countingLoginObserver{failures: map[string]int{}, throttled: map[string]int{}}
+	throttle := NewLoginThrottle(configuration.AuthConfig{MaxLoginAttempts: 5, LockoutMinutes: 10}, observer)
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+	return throttle, observer, &now
+}
+
+func TestLoginBackoffAndLockout(t *testing.T) {
+	throttle, observer, now := setupLoginThrottle()
+	for i := 0; i < freeUserLoginAttempts-1; i++ {
+		throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+		assert.Equal(t, time.Duration(0), throttle.RetryAfter(1, "10.0.0.1"))
+	}
+	// The waiting time doubles with every further failure
+	throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+	assert.Equal(t, time.Second, throttle.RetryAfter(1, "10.0.0.1"))
+	assert.Equal(t, time.Second, throttle.RetryAfter(1, "10.0.0.2"))
+	throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+	assert.Equal(t, 2*time.Second, throttle.RetryAfter(1, "10.0.0.1"))
+	assert.Equal(t, time.Duration(0), throttle.RetryAfter(2, "10.0.0.1"))
+	assert.Equal(t, 0, observer.locked)
+
+	throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+	assert.Equal(t, 10*time.Minute, throttle.RetryAfter(1, "10.0.0.1"))
+	assert.Equal(t, 1, observer.locked)
+	assert.Equal(t, 5, observer.failures[LoginFailureWrongCredentials])
+	assert.Equal(t, 4, observer.throttled[LoginScopeUser])
+
+	// The lockout ends by itself and the failures start again
+	*now = now.Add(10 * time.Minute)
+	assert.Equal(t, time.Duration(0), throttle.RetryAfter(1, "10.0.0.1"))
+	throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+	assert.Equal(t, time.Duration(0), throttle.RetryAfter(1, "10.0.0.1"))
+	throttle.Succeeded(1)
+	assert.False(t, throttle.Unlock(1))
+}
+
+func TestLoginThrottlePerAddress(t *testing.T) {
+	throttle, observer, _ := setupLoginThrottle()
+	// Guessing ids of users that do not exist is only slowed down per address
+	for i := 0; i < freeIPLoginAttempts; i++ {
+		throttle.Failed(0, "10.0.0.1", LoginFailureUnknownUser)
+	}
+	assert.Equal(t, time.Second, throttle.RetryAfter(42, "10.0.0.1"))
+	assert.Equal(t, time.Duration(0), throttle.RetryAfter(42, "10.0.0.2"))
+	assert.Equal(t, 1, observer.throttled[LoginScopeIP])
+	assert.Equal(t, 0, observer.locked)
+
+	// A successful login does not reset the address
+	throttle.Succeeded(42)
+	assert.Equal(t, time.Second, throttle.RetryAfter(42, "10.0.0.1"))
+}
+
+func TestUnlockAccount(t *testing.T) {
+	throttle, observer, _ := setupLoginThrottle()
+	assert.False(t, throttle.Unlock(1))
+	for i := 0; i < 5; i++ {
+		throttle.Failed(1, "10.0.0.1", LoginFailureWrongCredentials)
+	}
+	assert.Equal(t, 10*time.Minute, throttle.RetryAfter(1, "10.0.0.2"))
+	assert.True(t, throttle.Unlock(1))
+	assert.Equal(t, time.Duration(0), throttle.RetryAfter(1, "10.0.0.2"))
+	assert.Equal(t, 1, observer.unlocked)
+}
@@ -0,0 +1,520 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Login with an OpenID Connect provider
+// ------------------------------------------------------------
+
+const (
+	oidcLoginTimeout    = 10 * time.Minute // Time to log in at the provider
+	oidcRequestTimeout  = 10 * time.Second
+	oidcKeyRefreshDelay = time.Minute // Unknown key ids refetch the keys at most this often
+	oidcMaxPendingLogin = 10000
+	// Names taken from the provider are cut to the size of the username column
+	maxOIDCUsernameLength = 128
+	// Binds the state to the browser that started the login
+	oidcStateCookie = "oidc_state"
+)
+
+// ErrInvalidOIDCLogin is returned for logins that were not started here, expired or carry an invalid ID token
+var ErrInvalidOIDCLogin = errors.New("invalid OpenID Connect login")
+
+// OIDCClaims are the claims of the ID token used to link and create the account
+type OIDCClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Email             string `json:"email,omitempty"`
+}
+
+// DisplayName is the name of accounts created on the first login
+func (c OIDCClaims) DisplayName() string {
+	for _, name := range []string{c.PreferredUsername, c.Name, c.Email} {
+		if name != "" {
+			return name
+		}
+	}
+	return "user " + c.Subject
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPendingLogin struct {
+	nonce    string
+	verifier string // PKCE code verifier, only its hash is sent with the authorization request
+	device   string
+	created  time.Time
+}
+
+// OIDCProvider runs the authorization code flow with PKCE. The provider metadata and
+// keys are fetched on the first login, so the server starts while the provider is down.
+// Started logins are only known to this process, like the events.MemoryHub.
+type OIDCProvider struct {
+	config configuration.OIDCConfig
+	client *http.Client
+
+	mutex       sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	pending     map[string]oidcPendingLogin // By state
+	now         func() time.Time
+}
+
+func NewOIDCProvider(config configuration.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		config:  config,
+		client:  &http.Client{Timeout: oidcRequestTimeout},
+		keys:    make(map[string]crypto.PublicKey),
+		pending: make(map[string]oidcPendingLogin),
+		now:     time.Now,
+	}
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.config.Issuer
+}
+
+func randomURLString(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func pkceChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthorizationURL starts a login and returns the URL together with the state of the login,
+// the device names the session created after the callback
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, device string) (string, string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	p.mutex.Lock()
+	p.prunePendingLogins()
+	if len(p.pending) >= oidcMaxPendingLogin {
+		p.mutex.Unlock()
+		return "", "", errors.New("too many pending OpenID Connect logins")
+	}
+	p.pending[state] = oidcPendingLogin{nonce: nonce, verifier: verifier, device: device, created: p.now()}
+	p.mutex.Unlock()
+
+	scopes := append([]string{"openid"}, p.config.Scopes...)
+	if len(p.config.Scopes) == 0 {
+		scopes = append(scopes, "profile")
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", pkceChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// the caller must hold the lock
+func (p *OIDCProvider) prunePendingLogins() {
+	for state, login := range p.pending {
+		if p.now().Sub(login.created) > oidcLoginTimeout {
+			delete(p.pending, state)
+		}
+	}
+}
+
+// Exchange redeems the code of the callback and returns the validated claims of the ID token
+// together with the device of the login. Every state can only be used once.
+func (p *OIDCProvider) Exchange(ctx context.Context, state string, code string) (OIDCClaims, string, error) {
+	p.mutex.Lock()
+	login, exists := p.pending[state]
+	delete(p.pending, state)
+	p.mutex.Unlock()
+	if !exists || p.now().Sub(login.created) > oidcLoginTimeout {
+		return OIDCClaims{}, "", fmt.Errorf("%w: unknown or expired state", ErrInvalidOIDCLogin)
+	}
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	idToken, err := p.redeemCode(ctx, discovery, code, login.verifier)
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	claims, err := p.verifyIDToken(ctx, discovery, idToken)
+	if err != nil {
+		return OIDCClaims{}, "", err
+	}
+	if claims.Nonce != login.nonce {
+		return OIDCClaims{}, "", fmt.Errorf("%w: nonce does not match", ErrInvalidOIDCLogin)
+	}
+	return claims, login.device, nil
+}
+
+func (p *OIDCProvider) redeemCode(ctx context.Context, discovery oidcDiscovery, code string, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusUnauthorized {
+		// Invalid or reused codes, see RFC 6749 section 5.2
+		return "", fmt.Errorf("%w: provider rejected the code with %d", ErrInvalidOIDCLogin, response.StatusCode)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint answered %d", response.StatusCode)
+	}
+	var tokens struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IdToken == "" {
+		return "", errors.New("token endpoint did not return an ID token")
+	}
+	return tokens.IdToken, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, discovery oidcDiscovery, idToken string) (OIDCClaims, error) {
+	var claims OIDCClaims
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		keyId, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, discovery, keyId)
+	}
+	_, err := jwt.ParseWithClaims(idToken, &claims, keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: %w", ErrInvalidOIDCLogin, err)
+	}
+	if claims.Subject == "" {
+		return OIDCClaims{}, fmt.Errorf("%w: ID token without subject", ErrInvalidOIDCLogin)
+	}
+	return claims, nil
+}
+
+// ------------------------------------------------------------
+// Provider metadata and keys
+// ------------------------------------------------------------
+
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, value any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", target, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(value)
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (oidcDiscovery, error) {
+	p.mutex.Lock()
+	cached := p.discovery
+	p.mutex.Unlock()
+	if cached != nil {
+		return *cached, nil
+	}
+	var discovery oidcDiscovery
+	target := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, target, &discovery); err != nil {
+		return oidcDiscovery{}, fmt.Errorf("failed to discover provider: %w", err)
+	}
+	// The ID tokens are only accepted from the configured issuer
+	if discovery.Issuer != p.config.Issuer {
+		return oidcDiscovery{}, fmt.Errorf("provider names issuer '%s' instead of '%s'", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return oidcDiscovery{}, errors.New("provider metadata is incomplete")
+	}
+	p.mutex.Lock()
+	p.discovery = &discovery
+	p.mutex.Unlock()
+	return discovery, nil
+}
+
+// getKey refetches the keys for unknown key ids, so the provider can rotate its keys
+func (p *OIDCProvider) getKey(ctx context.Context, discovery oidcDiscovery, keyId string) (crypto.PublicKey, error) {
+	p.mutex.Lock()
+	key, exists := p.keys[keyId]
+	refresh := !exists && p.now().Sub(p.keysFetched) > oidcKeyRefreshDelay
+	p.mutex.Unlock()
+	if exists {
+		return key, nil
+	}
+	if !refresh {
+		return nil, fmt.Errorf("unknown signing key '%s'", keyId)
+	}
+	var set JSONWebKeySet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			// Keys of unsupported types do not prevent using the others
+			continue
+		}
+		keys[jwk.KeyId] = public
+	}
+	p.mutex.Lock()
+	p.keys = keys
+	p.keysFetched = p.now()
+	p.mutex.Unlock()
+	if key, exists := keys[keyId]; exists {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", keyId)
+}
+
+// PublicKey decodes RSA, P-256 and Ed25519 keys
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch {
+	case k.KeyType == "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case k.KeyType == "EC" && k.Curve == "P-256":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed point: 0x04 followed by X and Y, ecdh checks that it is on the curve
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 key")
+		}
+		if _, err := ecdh.P256().NewPublicKey(append([]byte{4}, append(x, y...)...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", k.KeyType)
+}
+
+// ------------------------------------------------------------
+// Login handlers and account creation
+// ------------------------------------------------------------
+
+// OIDCLogin redirects the client to the login page of the provider
+func (a *AuthenticationHandler) OIDCLogin(c *gin.Context) {
+	target, state, err := a.oidc.AuthorizationURL(c.Request.Context(), deviceName(c))
+	if err != nil {
+		log.Printf("Failed to start OpenID Connect login: %s", err)
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	a.setOIDCStateCookie(c, state, int(oidcLoginTimeout.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// setOIDCStateCookie limits the cookie to the callback, it is sent along with the redirect of the provider
+func (a *AuthenticationHandler) setOIDCStateCookie(c *gin.Context, state string, maxAge int) {
+	callback, err := url.Parse(a.oidc.config.RedirectURL)
+	if err != nil {
+		callback = &url.URL{Path: "/"}
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, callback.Path, "", callback.Scheme == "https", true)
+}
+
+// OIDCCallback receives the code of the provider and answers with the tokens like the password login.
+// Accounts with TOTP enabled have to use the password login, the callback cannot ask for the code.
+func (a *AuthenticationHandler) OIDCCallback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		log.Printf("Provider denied the OpenID Connect login: %s", reason)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		log.Print("OpenID Connect callback without state or code")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	// Otherwise an attacker could log the victim into the account of the attacker
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		log.Print("OpenID Connect callback from a browser that did not start the login")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	a.setOIDCStateCookie(c, "", -1)
+	claims, device, err := a.oidc.Exchange(c.Request.Context(), state, code)
+	if errors.Is(err, ErrInvalidOIDCLogin) {
+		log.Printf("Rejected OpenID Connect login: %s", err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Failed to complete OpenID Connect login: %s", err)
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	user, err := a.oidcUser(claims)
+	if err != nil {
+		log.Printf("Failed to get user of subject '%s': %s", claims.Subject, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	required, err := SecondFactorRequired(a.store, user.OnlineID)
+	if err != nil {
+		log.Printf("Failed to get second factor of user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if required {
+		log.Printf("User %d enabled TOTP and cannot log in with OpenID Connect", user.OnlineID)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "second factor required", "secondFactor": "totp"})
+		return
+	}
+	a.issueTokens(c, user, device)
+}
+
+// oidcUser returns the user linked to the subject, creating the account on the first login
+func (a *AuthenticationHandler) oidcUser(claims OIDCClaims) (data.User, error) {
+	issuer := a.oidc.Issuer()
+	identity, err := a.store.GetOIDCIdentity(issuer, claims.Subject)
+	if err == nil {
+		return a.store.GetUser(identity.UserId)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return data.User{}, err
+	}
+	// The password is never handed out, until it is reset the account can only log in through the provider
+	password, err := randomURLString(32)
+	if err != nil {
+		return data.User{}, err
+	}
+	username := []rune(claims.DisplayName())
+	if len(username) > maxOIDCUsernameLength {
+		username = username[:maxOIDCUsernameLength]
+	}
+	user, err := a.store.CreateUserAccountInDatabase(string(username), password)
+	if err != nil {
+		return data.User{}, err
+	}
+	identity = data.OIDCIdentity{Issuer: issuer, Subject: claims.Subject, UserId: user.OnlineID, Created: time.Now().UTC()}
+	if err := a.store.CreateOIDCIdentity(identity); err != nil {
+		// A concurrent first login of the same subject linked its account in the meantime
+		if deleteErr := a.store.DeleteUserAccount(user.OnlineID); deleteErr != nil {
+			log.Printf("Failed to delete unlinked user %d: %s", user.OnlineID, deleteErr)
+		}
+		existing, lookupErr := a.store.GetOIDCIdentity(issuer, claims.Subject)
+		if lookupErr != nil {
+			return data.User{}, err
+		}
+		return a.store.GetUser(existing.UserId)
+	}
+	log.Printf("Created user %d for subject '%s' of %s", user.OnlineID, claims.Subject, issuer)
+	return user, nil
+}
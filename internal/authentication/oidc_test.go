@@ -0,0 +1,93 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication/oidctest"
+)
+
+const oidcRedirectURL = "https://shopping.example/v1/users/oidc/callback"
+
+func setupOIDCProvider(t *testing.T) (*OIDCProvider, *oidctest.Provider) {
+	stub, err := oidctest.NewProvider("shopping", "secret")
+	assert.Nil(t, err)
+	t.Cleanup(stub.Close)
+	return NewOIDCProvider(stub.Config(oidcRedirectURL)), stub
+}
+
+// authorize runs the browser part of the login and returns the state and code of the callback
+func authorize(t *testing.T, provider *OIDCProvider, device string) (string, string) {
+	target, state, err := provider.AuthorizationURL(context.Background(), device)
+	assert.Nil(t, err)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(target)
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+	callback, err := url.Parse(response.Header.Get("Location"))
+	assert.Nil(t, err)
+	assert.Equal(t, state, callback.Query().Get("state"))
+	return state, callback.Query().Get("code")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	provider, stub := setupOIDCProvider(t)
+	stub.SetUser("1234", "jane")
+	state, code := authorize(t, provider, "Phone")
+	claims, device, err := provider.Exchange(context.Background(), state, code)
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", claims.Subject)
+	assert.Equal(t, "jane", claims.DisplayName())
+	assert.Equal(t, stub.Issuer(), claims.Issuer)
+	assert.Equal(t, "Phone", device)
+
+	// Neither the state nor the code can be used twice
+	_, _, err = provider.Exchange(context.Background(), state, code)
+	assert.True(t, errors.Is(err, ErrInvalidOIDCLogin))
+	state, _ = authorize(t, provider, "Phone")
+	_, _, err = provider.Exchange(context.Background(), state, code)
+	assert.True(t, errors.Is(err, ErrInvalidOIDCLogin))
+
+	// Logins time out
+	state, code = authorize(t, provider, "Phone")
+	provider.now = func() time.Time { return time.Now().Add(oidcLoginTimeout + time.Second) }
+	_, _, err = provider.Exchange(context.Background(), state, code)
+	assert.True(t, errors.Is(err, ErrInvalidOIDCLogin))
+}
+
+func TestOIDCRejectsInvalidIDTokens(t *testing.T) {
+	provider, stub := setupOIDCProvider(t)
+	cases := map[string]func(claims jwt.MapClaims){
+		"nonce":    func(claims jwt.MapClaims) { claims["nonce"] = "replayed" },
+		"audience": func(claims jwt.MapClaims) { claims["aud"] = "other client" },
+		"issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" },
+		"expired":  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"subject":  func(claims jwt.MapClaims) { delete(claims, "sub") },
+	}
+	for name, modify := range cases {
+		stub.SetClaims(modify)
+		state, code := authorize(t, provider, "Phone")
+		_, _, err := provider.Exchange(context.Background(), state, code)
+		assert.True(t, errors.Is(err, ErrInvalidOIDCLogin), name)
+	}
+}
+
+func TestOIDCClientSecret(t *testing.T) {
+	provider, stub := setupOIDCProvider(t)
+	config := stub.Config(oidcRedirectURL)
+	config.ClientSecret = "wrong"
+	provider.config = config
+	state, code := authorize(t, provider, "Phone")
+	_, _, err := provider.Exchange(context.Background(), state, code)
+	assert.True(t, errors.Is(err, ErrInvalidOIDCLogin))
+}
@@ -0,0 +1,108 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Password verification and one-time reset codes
+// ------------------------------------------------------------
+
+const (
+	passwordResetTimeout     = 15 * time.Minute
+	passwordResetCodeDigits  = 8
+	maxPasswordResetAttempts = 5
+)
+
+var (
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrInvalidResetCode = errors.New("invalid password reset code")
+)
+
+// VerifyPassword compares the password with the stored hash of the user
+func VerifyPassword(user data.User, password string) error {
+	match, err := argon2id.ComparePasswordAndHash(password, user.Password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// Codes are typed by hand, therefore only digits
+func randomResetCode() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(passwordResetCodeDigits), nil)
+	code, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", passwordResetCodeDigits, code), nil
+}
+
+// CreatePasswordResetCode replaces a pending reset of the user by a new code
+func (t *TokenHandler) CreatePasswordResetCode(userId int64) (string, data.PasswordReset, error) {
+	code, err := randomResetCode()
+	if err != nil {
+		return "", data.PasswordReset{}, err
+	}
+	now := time.Now().UTC()
+	reset := data.PasswordReset{
+		UserId:     userId,
+		CodeHash:   hashRefreshToken(code), // Short lived, so a plain hash is enough as well
+		ValidUntil: now.Add(passwordResetTimeout),
+		Created:    now,
+	}
+	if err := t.store.CreatePasswordReset(reset); err != nil {
+		return "", data.PasswordReset{}, err
+	}
+	return code, reset, nil
+}
+
+// RedeemPasswordResetCode consumes the code of the user. After too many wrong
+// codes the reset is removed so the short codes cannot be guessed.
+func (t *TokenHandler) RedeemPasswordResetCode(userId int64, code string) error {
+	reset, err := t.store.GetPasswordReset(userId)
+	if err != nil {
+		return ErrInvalidResetCode
+	}
+	if reset.ValidUntil.Before(time.Now().UTC()) {
+		t.removePasswordReset(userId)
+		return ErrInvalidResetCode
+	}
+	if subtle.ConstantTimeCompare([]byte(reset.CodeHash), []byte(hashRefreshToken(code))) != 1 {
+		if reset.Attempts+1 >= maxPasswordResetAttempts {
+			log.Printf("Too many wrong password reset codes for user %d", userId)
+			t.removePasswordReset(userId)
+		} else if err := t.store.IncreasePasswordResetAttempts(userId); err != nil {
+			log.Printf("Failed to count wrong password reset code of user %d: %s", userId, err)
+		}
+		return ErrInvalidResetCode
+	}
+	// Only one concurrent request can remove the reset and use the code
+	removed, err := t.store.DeletePasswordReset(userId)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrInvalidResetCode
+	}
+	return nil
+}
+
+func (t *TokenHandler) removePasswordReset(userId int64) {
+	if _, err := t.store.DeletePasswordReset(userId); err != nil {
+		log.Printf("Failed to remove password reset of user %d: %s", userId, err)
+	}
+}
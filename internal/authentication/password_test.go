@@ -0,0 +1,69 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	_, store, user, _ := setupTokenHandler(t)
+	stored, err := store.GetUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyPassword(stored, "password"))
+	assert.Equal(t, ErrInvalidPassword, VerifyPassword(stored, "wrong"))
+}
+
+func TestPasswordResetCode(t *testing.T) {
+	handler, store, user, _ := setupTokenHandler(t)
+	code, reset, err := handler.CreatePasswordResetCode(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, passwordResetCodeDigits, len(code))
+	assert.NotEqual(t, code, reset.CodeHash)
+
+	// A new code replaces the previous one
+	newCode, _, err := handler.CreatePasswordResetCode(user.OnlineID)
+	assert.Nil(t, err)
+	if code != newCode {
+		assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, code))
+	}
+	assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID+1, newCode))
+	assert.Nil(t, handler.RedeemPasswordResetCode(user.OnlineID, newCode))
+	assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, newCode))
+
+	// Expired codes are removed
+	code, reset, err = handler.CreatePasswordResetCode(user.OnlineID)
+	assert.Nil(t, err)
+	reset.ValidUntil = time.Now().UTC().Add(-time.Minute)
+	assert.Nil(t, store.CreatePasswordReset(reset))
+	assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, code))
+	_, err = store.GetPasswordReset(user.OnlineID)
+	assert.NotNil(t, err)
+}
+
+func TestPasswordResetAttempts(t *testing.T) {
+	handler, store, user, _ := setupTokenHandler(t)
+	code, _, err := handler.CreatePasswordResetCode(user.OnlineID)
+	assert.Nil(t, err)
+	for i := 1; i < maxPasswordResetAttempts; i++ {
+		assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, "wrong"))
+		reset, err := store.GetPasswordReset(user.OnlineID)
+		assert.Nil(t, err)
+		assert.Equal(t, i, reset.Attempts)
+	}
+	// The last wrong attempt invalidates the correct code as well
+	assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, "wrong"))
+	assert.Equal(t, ErrInvalidResetCode, handler.RedeemPasswordResetCode(user.OnlineID, code))
+}
+
+func TestCleanupRemovesExpiredPasswordResets(t *testing.T) {
+	handler, store, user, _ := setupTokenHandler(t)
+	now := time.Now().UTC()
+	assert.Nil(t, store.CreatePasswordReset(data.PasswordReset{UserId: user.OnlineID, CodeHash: "expired", ValidUntil: now.Add(-time.Minute), Created: now}))
+	assert.Nil(t, handler.removeInvalidTokens())
+	_, err := store.GetPasswordReset(user.OnlineID)
+	assert.NotNil(t, err)
+}
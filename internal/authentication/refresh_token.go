@@ -0,0 +1,107 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Rotating refresh tokens
+// ------------------------------------------------------------
+
+const defaultRefreshTimeout = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (t *TokenHandler) refreshTimeout() time.Duration {
+	if t.config.RefreshTimeoutHours <= 0 {
+		return defaultRefreshTimeout
+	}
+	return time.Duration(t.config.RefreshTimeoutHours) * time.Hour
+}
+
+// Refresh tokens are random, therefore a plain hash is enough to not store them readable
+func hashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// GenerateRefreshToken adds a token to the family of the session
+func (t *TokenHandler) GenerateRefreshToken(userId int64, sessionId string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	refreshToken := data.RefreshToken{
+		TokenHash:  hashRefreshToken(token),
+		FamilyId:   sessionId,
+		UserId:     userId,
+		ValidUntil: now.Add(t.refreshTimeout()),
+		Created:    now,
+	}
+	if err := t.store.InsertRefreshToken(refreshToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken replaces the token by a new one of the same family and returns the replaced token.
+// A token that was already replaced was probably stolen, therefore the whole session is revoked.
+func (t *TokenHandler) RotateRefreshToken(token string) (data.RefreshToken, string, error) {
+	stored, err := t.store.GetRefreshToken(hashRefreshToken(token))
+	if err != nil {
+		return data.RefreshToken{}, "", ErrInvalidRefreshToken
+	}
+	if stored.ValidUntil.Before(time.Now().UTC()) {
+		return data.RefreshToken{}, "", ErrInvalidRefreshToken
+	}
+	if stored.Used {
+		t.revokeRefreshTokenFamily(stored)
+		return data.RefreshToken{}, "", ErrRefreshTokenReused
+	}
+	if err := t.store.UseRefreshToken(stored.TokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Used by a concurrent refresh in between
+			t.revokeRefreshTokenFamily(stored)
+			return data.RefreshToken{}, "", ErrRefreshTokenReused
+		}
+		return data.RefreshToken{}, "", err
+	}
+	newToken, err := t.GenerateRefreshToken(stored.UserId, stored.FamilyId)
+	if err != nil {
+		return data.RefreshToken{}, "", err
+	}
+	return stored, newToken, nil
+}
+
+func (t *TokenHandler) revokeRefreshTokenFamily(token data.RefreshToken) {
+	if _, err := t.store.DeleteSession(token.FamilyId); err != nil {
+		log.Printf("Failed to revoke session of user %d: %s", token.UserId, err)
+		return
+	}
+	log.Printf("Refresh token of user %d reused, revoked the session", token.UserId)
+}
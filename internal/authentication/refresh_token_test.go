@@ -0,0 +1,59 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	store := database.NewMemoryStore()
+	user, err := store.CreateUserAccountInDatabase("refresh user", "password")
+	assert.Nil(t, err)
+	handler := NewTokenHandler(store, configuration.AuthConfig{}, newTestKeySet(t))
+
+	session, err := handler.StartSession(user.OnlineID, "Phone", "10.0.0.1")
+	assert.Nil(t, err)
+	first, err := handler.GenerateRefreshToken(user.OnlineID, session.SessionId)
+	assert.Nil(t, err)
+	stored, err := store.GetRefreshToken(hashRefreshToken(first))
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, stored.TokenHash)
+	assert.True(t, stored.ValidUntil.After(time.Now().Add(29*24*time.Hour)))
+
+	replaced, second, err := handler.RotateRefreshToken(first)
+	assert.Nil(t, err)
+	assert.Equal(t, user.OnlineID, replaced.UserId)
+	assert.Equal(t, session.SessionId, replaced.FamilyId)
+	replaced, third, err := handler.RotateRefreshToken(second)
+	assert.Nil(t, err)
+	assert.Equal(t, user.OnlineID, replaced.UserId)
+
+	// Reusing any replaced token revokes the session
+	_, _, err = handler.RotateRefreshToken(first)
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	_, _, err = handler.RotateRefreshToken(third)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	_, err = store.GetSession(session.SessionId)
+	assert.NotNil(t, err)
+	_, _, err = handler.RotateRefreshToken("unknown")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	// Other sessions stay valid
+	otherSession, err := handler.StartSession(user.OnlineID, "Tablet", "10.0.0.2")
+	assert.Nil(t, err)
+	other, err := handler.GenerateRefreshToken(user.OnlineID, otherSession.SessionId)
+	assert.Nil(t, err)
+	expiring := NewTokenHandler(store, configuration.AuthConfig{RefreshTimeoutHours: 1}, handler.Keys())
+	shortLived, err := expiring.GenerateRefreshToken(user.OnlineID, otherSession.SessionId)
+	assert.Nil(t, err)
+	stored, err = store.GetRefreshToken(hashRefreshToken(shortLived))
+	assert.Nil(t, err)
+	assert.True(t, stored.ValidUntil.Before(time.Now().Add(2*time.Hour)))
+	_, _, err = handler.RotateRefreshToken(other)
+	assert.Nil(t, err)
+}
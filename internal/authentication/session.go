@@ -0,0 +1,38 @@
+package authentication
+
+import (
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Sessions of a user on several devices
+// ------------------------------------------------------------
+
+const maxDeviceNameLength = 100
+
+// StartSession creates the session of a new login, the access and refresh
+// tokens are issued for this session
+func (t *TokenHandler) StartSession(userId int64, deviceName string, ip string) (data.Session, error) {
+	sessionId, err := randomToken()
+	if err != nil {
+		return data.Session{}, err
+	}
+	if runes := []rune(deviceName); len(runes) > maxDeviceNameLength {
+		deviceName = string(runes[:maxDeviceNameLength])
+	}
+	now := time.Now().UTC()
+	session := data.Session{
+		SessionId:  sessionId,
+		UserId:     userId,
+		DeviceName: deviceName,
+		IP:         ip,
+		Created:    now,
+		LastSeen:   now,
+	}
+	if err := t.store.CreateSession(session); err != nil {
+		return data.Session{}, err
+	}
+	return session, nil
+}
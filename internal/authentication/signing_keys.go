@@ -0,0 +1,214 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+// ------------------------------------------------------------
+// Asymmetric signing keys with rotation
+// ------------------------------------------------------------
+
+type signingKey struct {
+	id         string
+	method     jwt.SigningMethod
+	private    crypto.Signer // ed25519.PrivateKey or *ecdsa.PrivateKey on P-256
+	validFrom  time.Time
+	validUntil time.Time
+}
+
+func (k signingKey) verifies(now time.Time) bool {
+	return k.validUntil.IsZero() || now.Before(k.validUntil)
+}
+
+func (k signingKey) signs(now time.Time) bool {
+	return !now.Before(k.validFrom) && k.verifies(now)
+}
+
+// KeySet signs with the newest active key and verifies with every key that did not expire.
+// This way new keys can be rolled out while tokens of the previous key stay valid.
+type KeySet struct {
+	keys []signingKey
+}
+
+// JSONWebKey is the public part of a signing key (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"` // RSA keys of OpenID Connect providers
+	E         string `json:"e,omitempty"`
+	KeyId     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadKeySet reads the configured private keys. Without configured keys a random key
+// is created, its tokens become invalid on restart.
+func LoadKeySet(configs []configuration.SigningKeyConfig) (*KeySet, error) {
+	if len(configs) == 0 {
+		log.Print("No signing keys configured, using a random key that only lives as long as the server")
+		return newEphemeralKeySet()
+	}
+	keys := &KeySet{}
+	seen := make(map[string]bool)
+	for _, config := range configs {
+		if seen[config.KeyId] {
+			return nil, fmt.Errorf("duplicate signing key id '%s'", config.KeyId)
+		}
+		seen[config.KeyId] = true
+		key, err := loadSigningKey(config)
+		if err != nil {
+			return nil, err
+		}
+		keys.keys = append(keys.keys, key)
+	}
+	return keys, nil
+}
+
+func newEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyId, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	key, err := newSigningKey(keyId, private, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{keys: []signingKey{key}}, nil
+}
+
+func loadSigningKey(config configuration.SigningKeyConfig) (signingKey, error) {
+	if config.KeyId == "" {
+		return signingKey{}, errors.New("signing key without id")
+	}
+	content, err := os.ReadFile(config.PrivateKeyFile)
+	if err != nil {
+		return signingKey{}, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return signingKey{}, fmt.Errorf("no PEM encoded key in '%s'", config.PrivateKeyFile)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to parse key '%s': %w", config.PrivateKeyFile, err)
+	}
+	return newSigningKey(config.KeyId, private, config.ValidFrom, config.ValidUntil)
+}
+
+func newSigningKey(keyId string, private any, validFrom time.Time, validUntil time.Time) (signingKey, error) {
+	key := signingKey{id: keyId, validFrom: validFrom, validUntil: validUntil}
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.private = private
+	case *ecdsa.PrivateKey:
+		if private.Curve != elliptic.P256() {
+			return signingKey{}, fmt.Errorf("signing key '%s' is not on P-256", keyId)
+		}
+		key.method = jwt.SigningMethodES256
+		key.private = private
+	default:
+		return signingKey{}, fmt.Errorf("signing key '%s' is neither Ed25519 nor ECDSA", keyId)
+	}
+	return key, nil
+}
+
+// signingKey returns the active key that became valid last
+func (k *KeySet) signingKey(now time.Time) (signingKey, error) {
+	var newest *signingKey
+	for i, key := range k.keys {
+		if key.signs(now) && (newest == nil || !key.validFrom.Before(newest.validFrom)) {
+			newest = &k.keys[i]
+		}
+	}
+	if newest == nil {
+		return signingKey{}, errors.New("no active signing key")
+	}
+	return *newest, nil
+}
+
+// Sign signs the claims with the current key and names it in the kid header
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key, err := k.signingKey(time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// Keyfunc returns the public key named by the kid header, it is passed to jwt.Parse
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+	for _, key := range k.keys {
+		if key.id != keyId {
+			continue
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		if !key.verifies(time.Now().UTC()) {
+			return nil, fmt.Errorf("signing key '%s' expired", keyId)
+		}
+		return key.private.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", keyId)
+}
+
+// JWKS returns the public keys that verify tokens, including keys that only sign in the future
+func (k *KeySet) JWKS() (JSONWebKeySet, error) {
+	now := time.Now().UTC()
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(k.keys))}
+	for _, key := range k.keys {
+		if !key.verifies(now) {
+			continue
+		}
+		jwk := JSONWebKey{KeyId: key.id, Algorithm: key.method.Alg(), Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *ecdsa.PublicKey:
+			point, err := public.ECDH()
+			if err != nil {
+				return JSONWebKeySet{}, err
+			}
+			// Uncompressed point: 0x04 followed by X and Y
+			encoded := point.Bytes()
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(encoded[1:33])
+			jwk.Y = base64.RawURLEncoding.EncodeToString(encoded[33:])
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -0,0 +1,116 @@
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+func newTestKeySet(t *testing.T) *KeySet {
+	keys, err := newEphemeralKeySet()
+	assert.Nil(t, err)
+	return keys
+}
+
+func writeTestKey(t *testing.T, private any) string {
+	encoded, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.Nil(t, err)
+	filename := filepath.Join(t.TempDir(), "key.pem")
+	assert.Nil(t, os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}), 0600))
+	return filename
+}
+
+func signedKeyId(t *testing.T, keys *KeySet, signed string) string {
+	token, err := jwt.Parse(signed, keys.Keyfunc)
+	assert.Nil(t, err)
+	keyId, _ := token.Header["kid"].(string)
+	return keyId
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	now := time.Now().UTC()
+	old := configuration.SigningKeyConfig{KeyId: "old", PrivateKeyFile: writeTestKey(t, edKey), ValidFrom: now.Add(-48 * time.Hour), ValidUntil: now.Add(time.Hour)}
+	current := configuration.SigningKeyConfig{KeyId: "current", PrivateKeyFile: writeTestKey(t, ecKey), ValidFrom: now.Add(-time.Hour)}
+	next := configuration.SigningKeyConfig{KeyId: "next", PrivateKeyFile: old.PrivateKeyFile, ValidFrom: now.Add(time.Hour)}
+
+	keys, err := LoadKeySet([]configuration.SigningKeyConfig{old, current, next})
+	assert.Nil(t, err)
+	claims := jwt.RegisteredClaims{Subject: "test", ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))}
+	signed, err := keys.Sign(claims)
+	assert.Nil(t, err)
+	assert.Equal(t, "current", signedKeyId(t, keys, signed))
+
+	// Tokens of the previous key verify until the key expires
+	previous, err := LoadKeySet([]configuration.SigningKeyConfig{old})
+	assert.Nil(t, err)
+	signed, err = previous.Sign(claims)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", signedKeyId(t, keys, signed))
+	old.ValidUntil = now.Add(-time.Minute)
+	expired, err := LoadKeySet([]configuration.SigningKeyConfig{old, current})
+	assert.Nil(t, err)
+	_, err = jwt.Parse(signed, expired.Keyfunc)
+	assert.NotNil(t, err)
+
+	// Unknown keys and other keys claiming a known id are rejected
+	_, err = jwt.Parse(signed, newTestKeySet(t).Keyfunc)
+	assert.NotNil(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "current"
+	forgedToken, err := forged.SignedString([]byte("secret"))
+	assert.Nil(t, err)
+	_, err = jwt.Parse(forgedToken, keys.Keyfunc)
+	assert.NotNil(t, err)
+
+	// The public keys of all keys that did not expire are published
+	jwks, err := keys.JWKS()
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(jwks.Keys)) {
+		assert.Equal(t, JSONWebKey{KeyType: "OKP", Curve: "Ed25519", X: jwks.Keys[0].X, KeyId: "old", Algorithm: "EdDSA", Use: "sig"}, jwks.Keys[0])
+		assert.Equal(t, "EC", jwks.Keys[1].KeyType)
+		assert.Equal(t, "ES256", jwks.Keys[1].Algorithm)
+		assert.Equal(t, 43, len(jwks.Keys[1].X))
+		assert.Equal(t, 43, len(jwks.Keys[1].Y))
+	}
+	jwks, err = expired.JWKS()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(jwks.Keys))
+}
+
+func TestLoadInvalidKeys(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	filename := writeTestKey(t, edKey)
+	_, err = LoadKeySet([]configuration.SigningKeyConfig{{PrivateKeyFile: filename}})
+	assert.NotNil(t, err)
+	_, err = LoadKeySet([]configuration.SigningKeyConfig{{KeyId: "a", PrivateKeyFile: filename}, {KeyId: "a", PrivateKeyFile: filename}})
+	assert.NotNil(t, err)
+	_, err = LoadKeySet([]configuration.SigningKeyConfig{{KeyId: "a", PrivateKeyFile: filename + ".missing"}})
+	assert.NotNil(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.Nil(t, err)
+	_, err = LoadKeySet([]configuration.SigningKeyConfig{{KeyId: "a", PrivateKeyFile: writeTestKey(t, p384)}})
+	assert.NotNil(t, err)
+
+	// Without active key nothing can be signed
+	keys, err := LoadKeySet([]configuration.SigningKeyConfig{{KeyId: "a", PrivateKeyFile: filename, ValidFrom: time.Now().Add(time.Hour)}})
+	assert.Nil(t, err)
+	_, err = keys.Sign(jwt.RegisteredClaims{})
+	assert.NotNil(t, err)
+}
@@ -1,144 +1,198 @@
 package authentication
 
 import (
-	"database/sql"
 	"errors"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type TokenHandler struct {
-	db     *sql.DB
+	store  database.TokenStore
 	config configuration.AuthConfig
+	keys   *KeySet
 }
 
-func NewTokenHandler(db *sql.DB, config configuration.AuthConfig) *TokenHandler {
+func NewTokenHandler(store database.TokenStore, config configuration.AuthConfig, keys *KeySet) *TokenHandler {
 	return &TokenHandler{
-		db:     db,
+		store:  store,
 		config: config,
+		keys:   keys,
 	}
 }
 
+// Keys returns the keys signing and verifying the tokens
+func (t *TokenHandler) Keys() *KeySet {
+	return t.keys
+}
+
 // ------------------------------------------------------------
 // The authentication and login data structures
 // ------------------------------------------------------------
 
 type Claims struct {
-	Id       int64  `json:"id"`
-	Username string `json:"username"`
-	Admin    bool   `json:"admin"`
+	Id        int64  `json:"id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"` // The role at login, requests are authorized with the stored role
+	SessionId string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-type Token struct {
-	Token string `json:"token"`
+// LoginRequest is the user with the second factor, only required once TOTP is enabled
+type LoginRequest struct {
+	data.User
+	TOTPCode     string `json:"totpCode,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
 }
 
-type TokenData struct {
-	UserId     int64     `json:"userId"`
-	Token      string    `json:"token"`
-	ValidUntil time.Time `json:"validUntil"`
+type Token struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
 }
 
 // ------------------------------------------------------------
 
-func (t *TokenHandler) GenerateNewJWTToken(id int64, username string) (string, error) {
+func (t *TokenHandler) GenerateNewJWTToken(user data.User, sessionId string) (string, error) {
 	// Give enough time for a few requests
 	notBefore := time.Now().UTC()
 	expiresAt := notBefore.Add(time.Duration(t.config.KeyTimeoutMs) * time.Millisecond)
+	tokenId, err := randomToken()
+	if err != nil {
+		return "", err
+	}
 	claims := &Claims{
-		Id:       id,
-		Username: username,
-		Admin:    false,
+		Id:        user.OnlineID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			Issuer:    "shopping-list-server",
 			NotBefore: jwt.NewNumericDate(notBefore),
 		},
 	}
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signedToken, err := newToken.SignedString([]byte(t.config.Secret))
+	signedToken, err := t.keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
-	err = t.storeToken(signedToken, id, expiresAt, true)
+	err = t.storeToken(tokenId, user.OnlineID, sessionId, expiresAt, true)
 	if err != nil {
 		return "", err
 	}
 	return signedToken, nil
 }
 
-const insertTokenQuery = "INSERT INTO token (userId, token, validUntil) VALUES (?, ?, ?)"
-
-func (t *TokenHandler) storeToken(token string, userId int64, validUntil time.Time, overwrite bool) error {
-	if token == "" {
-		return errors.New("empty token")
+// storeToken only keeps the id of the token, the signed token itself is not usable from the database
+func (t *TokenHandler) storeToken(tokenId string, userId int64, sessionId string, validUntil time.Time, overwrite bool) error {
+	if tokenId == "" {
+		return errors.New("empty token id")
 	}
 	if overwrite {
-		err := t.clearExistingTokensForUser(userId)
+		err := t.clearExistingTokenForSession(sessionId)
 		if err != nil {
 			return err
 		}
 	}
-	_, err := t.db.Exec(insertTokenQuery, userId, token, validUntil)
-	if err != nil {
+	tokenData := data.TokenData{
+		TokenId:    tokenId,
+		SessionId:  sessionId,
+		UserId:     userId,
+		ValidUntil: validUntil,
+	}
+	if err := t.store.InsertToken(tokenData); err != nil {
 		return err
 	}
 	log.Printf("Updated token for user %d valid until %s", userId, validUntil)
 	return nil
 }
 
-const clearUserTokensQuery = "DELETE FROM token WHERE userId = ?"
+// Only the token of the same session is replaced, other devices stay logged in
+func (t *TokenHandler) clearExistingTokenForSession(sessionId string) error {
+	_, err := t.store.DeleteTokensForSession(sessionId)
+	return err
+}
 
-func (t *TokenHandler) clearExistingTokensForUser(userId int64) error {
-	res, err := t.db.Exec(clearUserTokensQuery, userId)
+// RevokeToken invalidates a single access token by its jti claim
+func (t *TokenHandler) RevokeToken(tokenId string) error {
+	removed, err := t.store.DeleteToken(tokenId)
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := res.RowsAffected()
-	log.Printf("Removed %d tokens for user %d", rowsAffected, userId)
+	if removed == 0 {
+		return errors.New("token not found")
+	}
 	return nil
 }
 
-const removeAllExpiredTokens = "DELETE FROM token WHERE validUntil < ?"
-
 func (t *TokenHandler) removeInvalidTokens() error {
-	res, err := t.db.Exec(removeAllExpiredTokens, time.Now())
+	affectedRows, err := t.store.DeleteExpiredTokens(time.Now().UTC())
 	if err != nil {
 		return err
 	}
-	affectedRows, _ := res.RowsAffected()
 	log.Printf("Removed %d rows because the token was invalid", affectedRows)
+	affectedRows, err = t.store.DeleteExpiredRefreshTokens(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	log.Printf("Removed %d expired refresh tokens", affectedRows)
+	affectedRows, err = t.store.DeleteExpiredPasswordResets(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	log.Printf("Removed %d expired password resets", affectedRows)
 	return nil
 }
 
-const selectUserTokenQuery = "SELECT userId, token, validUntil FROM token WHERE userId = ? ORDER BY validUntil DESC"
+const defaultCleanupInterval = 10 * time.Minute
 
-func (t *TokenHandler) IsTokenValid(userId int64, token string) error {
-	rows, err := t.db.Query(selectUserTokenQuery, userId)
-	if err != nil {
-		return err
+func (t *TokenHandler) cleanupInterval() time.Duration {
+	if t.config.CleanupIntervalMinutes <= 0 {
+		return defaultCleanupInterval
 	}
-	defer rows.Close()
-	var tokenData TokenData
-	for rows.Next() {
-		if err := rows.Scan(&tokenData.UserId, &tokenData.Token, &tokenData.ValidUntil); err != nil {
-			return err
+	return time.Duration(t.config.CleanupIntervalMinutes) * time.Minute
+}
+
+// StartCleanup periodically removes expired tokens until the returned function is called
+func (t *TokenHandler) StartCleanup() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(t.cleanupInterval())
+		defer ticker.Stop()
+		for {
+			if err := t.removeInvalidTokens(); err != nil {
+				log.Printf("Failed to remove expired tokens: %s", err)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
 		}
-		// If there is more than a single entry skip rest
-		break
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (t *TokenHandler) IsTokenValid(userId int64, sessionId string, tokenId string) error {
+	tokenData, err := t.store.GetToken(tokenId)
+	if err != nil {
+		return errors.New("token was not issued or is revoked")
+	}
+	if tokenData.UserId != userId || tokenData.SessionId != sessionId {
+		return errors.New("token belongs to another session")
 	}
 	log.Printf("User token valid until: %s", tokenData.ValidUntil)
 	if tokenData.ValidUntil.Before(time.Now().UTC()) {
 		log.Printf("Stored token only valid until: %s", tokenData.ValidUntil)
 		return errors.New("token no longer valid")
 	}
-	if token != tokenData.Token {
-		log.Printf("Stored token and user token mismatch")
-		return errors.New("given token does not match current user token")
-	}
 	return nil
 }
@@ -2,16 +2,103 @@ package authentication
 
 import (
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 )
 
+func setupTokenHandler(t *testing.T) (*TokenHandler, *database.MemoryStore, data.User, data.Session) {
+	store := database.NewMemoryStore()
+	user, err := store.CreateUserAccountInDatabase("token user", "password")
+	assert.Nil(t, err)
+	handler := NewTokenHandler(store, configuration.AuthConfig{KeyTimeoutMs: 60000}, newTestKeySet(t))
+	session, err := handler.StartSession(user.OnlineID, "Phone", "10.0.0.1")
+	assert.Nil(t, err)
+	return handler, store, user, session
+}
+
+func parseTestToken(t *testing.T, handler *TokenHandler, signedToken string) Claims {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(signedToken, &claims, handler.Keys().Keyfunc)
+	assert.Nil(t, err)
+	return claims
+}
+
 func TestCreatingNewToken(t *testing.T) {
-	t.Skip("Not implemented")
+	handler, store, user, session := setupTokenHandler(t)
+	signedToken, err := handler.GenerateNewJWTToken(user, session.SessionId)
+	assert.Nil(t, err)
+	claims := parseTestToken(t, handler, signedToken)
+	assert.NotEqual(t, "", claims.ID)
+	assert.Equal(t, session.SessionId, claims.SessionId)
+
+	// Only the id of the token is stored
+	tokens, err := store.GetTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(tokens)) {
+		assert.Equal(t, claims.ID, tokens[0].TokenId)
+		assert.Equal(t, claims.ExpiresAt.Unix(), tokens[0].ValidUntil.Unix())
+	}
+
+	// A new token replaces the previous one of the session
+	secondToken, err := handler.GenerateNewJWTToken(user, session.SessionId)
+	assert.Nil(t, err)
+	assert.NotEqual(t, claims.ID, parseTestToken(t, handler, secondToken).ID)
+	tokens, err = store.GetTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tokens))
 }
 
 func TestValidatingValidToken(t *testing.T) {
-	t.Skip("Not implemented")
+	handler, _, user, session := setupTokenHandler(t)
+	signedToken, err := handler.GenerateNewJWTToken(user, session.SessionId)
+	assert.Nil(t, err)
+	claims := parseTestToken(t, handler, signedToken)
+	assert.Nil(t, handler.IsTokenValid(user.OnlineID, session.SessionId, claims.ID))
 }
 
 func TestValidatingInvalidToken(t *testing.T) {
-	t.Skip("Not implemented")
+	handler, store, user, session := setupTokenHandler(t)
+	signedToken, err := handler.GenerateNewJWTToken(user, session.SessionId)
+	assert.Nil(t, err)
+	claims := parseTestToken(t, handler, signedToken)
+
+	assert.NotNil(t, handler.IsTokenValid(user.OnlineID, session.SessionId, "unissued"))
+	assert.NotNil(t, handler.IsTokenValid(user.OnlineID+1, session.SessionId, claims.ID))
+	assert.NotNil(t, handler.IsTokenValid(user.OnlineID, "other session", claims.ID))
+
+	assert.Nil(t, handler.RevokeToken(claims.ID))
+	assert.NotNil(t, handler.RevokeToken(claims.ID))
+	assert.NotNil(t, handler.IsTokenValid(user.OnlineID, session.SessionId, claims.ID))
+
+	expired := data.TokenData{TokenId: "expired", SessionId: session.SessionId, UserId: user.OnlineID, ValidUntil: time.Now().UTC().Add(-time.Minute)}
+	assert.Nil(t, store.InsertToken(expired))
+	assert.NotNil(t, handler.IsTokenValid(user.OnlineID, session.SessionId, expired.TokenId))
+}
+
+func TestCleanupRemovesExpiredTokens(t *testing.T) {
+	handler, store, user, session := setupTokenHandler(t)
+	now := time.Now().UTC()
+	assert.Nil(t, store.InsertToken(data.TokenData{TokenId: "expired", SessionId: session.SessionId, UserId: user.OnlineID, ValidUntil: now.Add(-time.Minute)}))
+	assert.Nil(t, store.InsertToken(data.TokenData{TokenId: "valid", SessionId: session.SessionId, UserId: user.OnlineID, ValidUntil: now.Add(time.Hour)}))
+	assert.Nil(t, store.InsertRefreshToken(data.RefreshToken{TokenHash: "expired", FamilyId: session.SessionId, UserId: user.OnlineID, ValidUntil: now.Add(-time.Minute)}))
+
+	stop := handler.StartCleanup()
+	defer stop()
+	assert.Eventually(t, func() bool {
+		_, err := store.GetToken("expired")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err := store.GetRefreshToken("expired")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	_, err := store.GetToken("valid")
+	assert.Nil(t, err)
+	stop()
 }
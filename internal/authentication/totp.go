@@ -0,0 +1,228 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+// ------------------------------------------------------------
+// Two-factor authentication with TOTP (RFC 6238)
+// ------------------------------------------------------------
+
+const (
+	totpIssuer     = "Shopping List"
+	totpDigits     = 6
+	totpPeriod     = 30 // Seconds
+	totpSkew       = 1  // Steps accepted before and after the current one, phone clocks drift
+	totpSecretSize = 20 // Bytes, the size of the SHA-1 output as recommended by RFC 4226
+
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10 // Characters, split into two groups for typing
+)
+
+var (
+	ErrInvalidSecondFactor = errors.New("invalid second factor")
+	ErrTOTPEnabled         = errors.New("TOTP already enabled")
+	ErrTOTPNotEnabled      = errors.New("TOTP not enabled")
+)
+
+// Authenticator apps expect the secret without padding
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpStep(at time.Time) int64 {
+	return at.Unix() / totpPeriod
+}
+
+// hotp is the HMAC-based one-time password of RFC 4226 for the counter
+func hotp(secret []byte, counter int64) string {
+	mac := hmac.New(sha1.New, secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// TOTPCode returns the code of the base32 encoded secret at the given time
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, totpStep(at)), nil
+}
+
+// ProvisioningURI is shown as QR code to add the account to an authenticator app
+func ProvisioningURI(secret string, username string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// matchTOTPStep returns the time step the code belongs to, false if it matches none around the current time
+func matchTOTPStep(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Recovery codes are typed by hand, they ignore case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func randomRecoveryCode() (string, error) {
+	// Lower case letters and digits without the easily confused ones
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	code := make([]byte, recoveryCodeSize)
+	for i := range code {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[index.Int64()]
+	}
+	return string(code[:recoveryCodeSize/2]) + "-" + string(code[recoveryCodeSize/2:]), nil
+}
+
+// EnrollTOTP creates a new secret for the user, it is only used for the login once enabled
+func EnrollTOTP(store database.TOTPStore, user data.User) (data.TOTPEnrollment, error) {
+	existing, err := store.GetTOTP(user.OnlineID)
+	if err == nil && existing.Enabled {
+		return data.TOTPEnrollment{}, ErrTOTPEnabled
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return data.TOTPEnrollment{}, err
+	}
+	key := make([]byte, totpSecretSize)
+	if _, err := rand.Read(key); err != nil {
+		return data.TOTPEnrollment{}, err
+	}
+	secret := totpEncoding.EncodeToString(key)
+	totp := data.TOTP{UserId: user.OnlineID, Secret: secret, Created: time.Now().UTC()}
+	if err := store.CreateTOTP(totp); err != nil {
+		return data.TOTPEnrollment{}, err
+	}
+	return data.TOTPEnrollment{Secret: secret, ProvisioningURI: ProvisioningURI(secret, user.Username)}, nil
+}
+
+// EnableTOTP verifies the first code of the authenticator app and returns the recovery codes
+func EnableTOTP(store database.TOTPStore, userId int64, code string) ([]string, error) {
+	totp, err := store.GetTOTP(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotEnabled
+	} else if err != nil {
+		return nil, err
+	}
+	if totp.Enabled {
+		return nil, ErrTOTPEnabled
+	}
+	if err := useTOTPCode(store, totp, code); err != nil {
+		return nil, err
+	}
+	if err := store.EnableTOTP(userId); err != nil {
+		return nil, err
+	}
+	return NewRecoveryCodes(store, userId)
+}
+
+// NewRecoveryCodes replaces the recovery codes of the user
+func NewRecoveryCodes(store database.TOTPStore, userId int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRefreshToken(normalizeRecoveryCode(code)))
+	}
+	if err := store.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// SecondFactorRequired reports whether the user enabled TOTP
+func SecondFactorRequired(store database.TOTPStore, userId int64) (bool, error) {
+	totp, err := store.GetTOTP(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return totp.Enabled, nil
+}
+
+// VerifySecondFactor accepts a code of the authenticator app or uses up one of the recovery codes
+func VerifySecondFactor(store database.TOTPStore, userId int64, factor data.SecondFactor) error {
+	totp, err := store.GetTOTP(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTOTPNotEnabled
+	} else if err != nil {
+		return err
+	}
+	if !totp.Enabled {
+		return ErrTOTPNotEnabled
+	}
+	if factor.RecoveryCode != "" {
+		used, err := store.UseRecoveryCode(userId, hashRefreshToken(normalizeRecoveryCode(factor.RecoveryCode)))
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+	return useTOTPCode(store, totp, factor.Code)
+}
+
+// useTOTPCode accepts every code only once, even within its time step
+func useTOTPCode(store database.TOTPStore, totp data.TOTP, code string) error {
+	step, match := matchTOTPStep(totp.Secret, strings.TrimSpace(code), time.Now())
+	if !match {
+		return ErrInvalidSecondFactor
+	}
+	used, err := store.UseTOTPStep(totp.UserId, step)
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
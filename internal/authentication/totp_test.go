@@ -0,0 +1,66 @@
+package authentication
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for at, expected := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		code, err := TOTPCode(secret, time.Unix(at, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, code)
+	}
+	uri := ProvisioningURI(secret, "test user")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Shopping%20List:test%20user?"))
+	assert.Contains(t, uri, "secret="+secret)
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	_, store, user, _ := setupTokenHandler(t)
+	required, err := SecondFactorRequired(store, user.OnlineID)
+	assert.Nil(t, err)
+	assert.False(t, required)
+
+	enrollment, err := EnrollTOTP(store, user)
+	assert.Nil(t, err)
+	assert.Contains(t, enrollment.ProvisioningURI, enrollment.Secret)
+	// Not used before the first code was verified
+	required, err = SecondFactorRequired(store, user.OnlineID)
+	assert.Nil(t, err)
+	assert.False(t, required)
+	_, err = EnableTOTP(store, user.OnlineID, "000000x")
+	assert.Equal(t, ErrInvalidSecondFactor, err)
+
+	code, err := TOTPCode(enrollment.Secret, time.Now())
+	assert.Nil(t, err)
+	recoveryCodes, err := EnableTOTP(store, user.OnlineID, code)
+	assert.Nil(t, err)
+	assert.Equal(t, recoveryCodeCount, len(recoveryCodes))
+	required, err = SecondFactorRequired(store, user.OnlineID)
+	assert.Nil(t, err)
+	assert.True(t, required)
+	_, err = EnrollTOTP(store, user)
+	assert.Equal(t, ErrTOTPEnabled, err)
+
+	// Every code can only be used once
+	assert.Equal(t, ErrInvalidSecondFactor, VerifySecondFactor(store, user.OnlineID, data.SecondFactor{Code: code}))
+	next, err := TOTPCode(enrollment.Secret, time.Now().Add(totpPeriod*time.Second))
+	assert.Nil(t, err)
+	assert.Nil(t, VerifySecondFactor(store, user.OnlineID, data.SecondFactor{Code: next}))
+	assert.Equal(t, ErrInvalidSecondFactor, VerifySecondFactor(store, user.OnlineID, data.SecondFactor{Code: next}))
+
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", " "))
+	assert.Nil(t, VerifySecondFactor(store, user.OnlineID, data.SecondFactor{RecoveryCode: recoveryCode}))
+	assert.Equal(t, ErrInvalidSecondFactor, VerifySecondFactor(store, user.OnlineID, data.SecondFactor{RecoveryCode: recoveryCodes[0]}))
+	left, err := store.CountRecoveryCodes(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, recoveryCodeCount-1, left)
+}
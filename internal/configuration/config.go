@@ -22,6 +22,8 @@ func HandleCommandlineAndExportConfiguration() Config {
 
 	// Database configuration
 	resetDb := flag.Bool("reset", false, "Reset the whole database")
+	dbDriver := flag.String("db", "mysql", "The storage backend (mysql, sqlite, memory)")
+	dbPath := flag.String("dbfile", "resources/shoppinglist.db", "The database file (sqlite only)")
 
 	// TLS Configuration
 	tlsCert := flag.String("cert", "resources/shop.cloudsheeptech.com.crt", "The location of the TLS CertificateFile")
@@ -56,6 +58,27 @@ func HandleCommandlineAndExportConfiguration() Config {
 		config.Database.Host = envDbHost
 	}
 
+	envDbDriver, envExists := os.LookupEnv("DB_DRIVER")
+	if envExists {
+		config.Database.Driver = envDbDriver
+	}
+
+	envDbPath, envExists := os.LookupEnv("DB_FILE")
+	if envExists {
+		config.Database.Path = envDbPath
+	}
+
+	// The first admin is created by the bootstrap-admin command
+	envAdminUser, envExists := os.LookupEnv("ADMIN_USER")
+	if envExists {
+		config.Admin.User = envAdminUser
+	}
+
+	envAdminPassword, envExists := os.LookupEnv("ADMIN_PASSWORD")
+	if envExists {
+		config.Admin.Password = envAdminPassword
+	}
+
 	envProduction, envExists := os.LookupEnv("PRODUCTION")
 	if envExists {
 		envProductionParsed, err := strconv.ParseBool(envProduction)
@@ -79,6 +102,10 @@ func HandleCommandlineAndExportConfiguration() Config {
 			config.Server.Logfile = *logfile
 		case "reset":
 			config.Database.Reset = *resetDb
+		case "db":
+			config.Database.Driver = *dbDriver
+		case "dbfile":
+			config.Database.Path = *dbPath
 		case "cert":
 			config.TLS.CertificateFile = *tlsCert
 		case "key":
@@ -116,12 +143,16 @@ func loadConfigFile(filename string) (Config, error) {
 // It is not meant to create a config file holding a working configuration
 func createDefaultConfiguration(configFile string) {
 	conf := Config{
-		Server:   ServerConfig{},
-		Database: DatabaseConfig{},
-		TLS:      TLSConfig{},
-		JWT:      AuthConfig{},
-		API:      APIKeyConfig{},
-		Admin:    AdminConfig{},
+		Server:    ServerConfig{},
+		Database:  DatabaseConfig{},
+		TLS:       TLSConfig{},
+		JWT:       AuthConfig{},
+		API:       APIKeyConfig{},
+		Admin:     AdminConfig{},
+		Notifier:  NotifierConfig{},
+		RateLimit: RateLimitConfig{},
+		OIDC:      OIDCConfig{},
+		IPAccess:  IPAccessConfig{},
 	}
 	storeConfiguration(configFile, conf)
 }
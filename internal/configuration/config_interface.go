@@ -3,12 +3,16 @@ package configuration
 import "time"
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	TLS      TLSConfig
-	JWT      AuthConfig
-	API      APIKeyConfig
-	Admin    AdminConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	TLS       TLSConfig
+	JWT       AuthConfig
+	API       APIKeyConfig
+	Admin     AdminConfig
+	Notifier  NotifierConfig
+	RateLimit RateLimitConfig
+	OIDC      OIDCConfig
+	IPAccess  IPAccessConfig
 }
 
 type ServerConfig struct {
@@ -16,6 +20,9 @@ type ServerConfig struct {
 	ListenPort string
 	Production bool
 	Logfile    string
+	// Proxies whose X-Forwarded-For and X-Real-IP headers name the client, as addresses
+	// or CIDR ranges. Without proxies the headers are ignored.
+	TrustedProxies []string
 }
 
 type TLSConfig struct {
@@ -25,7 +32,17 @@ type TLSConfig struct {
 	DisableTLS bool
 }
 
+// The storage backends that can be selected via DatabaseConfig.Driver
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
 type DatabaseConfig struct {
+	// Driver selects the storage backend, defaults to mysql if empty
+	Driver string
+
 	User     string
 	Password string
 
@@ -33,22 +50,101 @@ type DatabaseConfig struct {
 	Host        string
 	NetworkType string
 
+	// Path to the database file, only used by sqlite
+	Path string
+
 	Reset bool
 }
 
 type AuthConfig struct {
-	Secret        string
-	ValidUntil    time.Time
+	// Keys signing access tokens, API keys and invites. Without keys a random key is
+	// created on startup, so tokens do not survive a restart.
+	SigningKeys   []SigningKeyConfig
 	JwtSecretFile string
 	KeyTimeoutMs  int // This is only meant for testing; not for production
+	// Validity of refresh tokens, 30 days if not set
+	RefreshTimeoutHours int
+	// Interval of removing expired tokens, 10 minutes if not set
+	CleanupIntervalMinutes int
+	// Failed logins locking the account, 10 if not set. Fewer failures only slow down the next attempts.
+	MaxLoginAttempts int
+	// Duration of the lockout and how long failures are remembered, 30 minutes if not set
+	LockoutMinutes int
+}
+
+// SigningKeyConfig is a PEM encoded PKCS #8 Ed25519 or ECDSA P-256 private key. The newest
+// key that is valid signs, all keys that did not expire verify.
+type SigningKeyConfig struct {
+	KeyId          string
+	PrivateKeyFile string
+	ValidFrom      time.Time
+	ValidUntil     time.Time // Never expires if not set
 }
 
 type APIKeyConfig struct {
-	Key        string
-	ValidUntil time.Time
+	Key string
 }
 
+// AdminConfig is the first admin created by the bootstrap-admin command
 type AdminConfig struct {
 	User     string
 	Password string
 }
+
+// The ways of delivering messages to users that can be selected via NotifierConfig.Type
+const (
+	NotifierLog  = "log"
+	NotifierFile = "file"
+)
+
+type NotifierConfig struct {
+	// Type selects the delivery, defaults to log if empty. Production servers do not start with log.
+	Type string
+	// Path of the file the messages are appended to, only used by file
+	File string
+}
+
+// The ways of identifying the clients of a rate limit that can be selected via RateLimit.Key
+const (
+	RateLimitByIP     = "ip"
+	RateLimitByUser   = "user"   // Falls back to the address before the login
+	RateLimitByAPIKey = "apikey" // Falls back to the user and the address without a key
+)
+
+type RateLimitConfig struct {
+	Disabled bool
+	// Limits of the route groups (accounts, login, api, admin, metrics) replacing the defaults
+	Groups map[string]RateLimit
+}
+
+// RateLimit allows Requests at once, the limit refills completely within IntervalSeconds
+type RateLimit struct {
+	Requests        int
+	IntervalSeconds int
+	// Key selects how clients are identified, defaults to ip if empty
+	Key string
+}
+
+// OIDCConfig enables the login with an OpenID Connect provider, disabled without Issuer
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// URL of /v1/users/oidc/callback as registered at the provider
+	RedirectURL string
+	// Requested in addition to openid, defaults to profile
+	Scopes []string
+}
+
+// IPAccessConfig restricts route groups to client addresses, disabled without File
+type IPAccessConfig struct {
+	// JSON file mapping the route groups to their IPAccessRules, reloaded on SIGHUP
+	File string
+}
+
+// IPAccessRules of a route group as IPv4 and IPv6 addresses or CIDR ranges. Denied
+// addresses are rejected even if allowed, without Allow all other addresses are allowed.
+type IPAccessRules struct {
+	Allow []string
+	Deny  []string
+}
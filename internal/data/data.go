@@ -1,6 +1,7 @@
 package data
 
 import (
+	"sort"
 	"time"
 )
 
@@ -42,25 +43,182 @@ func (u *User) ToWireFormat() User {
 	}
 }
 
+// TokenData is an issued access token, identified by its jti claim
+type TokenData struct {
+	TokenId    string    `json:"tokenId"`
+	SessionId  string    `json:"sessionId"`
+	UserId     int64     `json:"userId"`
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+// Session is the login of a user on a single device
+type Session struct {
+	SessionId  string    `json:"sessionId"`
+	UserId     int64     `json:"userId"`
+	DeviceName string    `json:"deviceName"`
+	IP         string    `json:"ip"`
+	Created    time.Time `json:"created"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Current    bool      `json:"current"` // Set if the session made the request
+}
+
+// RefreshToken is stored with the hash of the token only. All tokens created by
+// refreshing share the family of the token issued at login, which is the session.
+type RefreshToken struct {
+	TokenHash  string    `json:"-"`
+	FamilyId   string    `json:"familyId"`
+	UserId     int64     `json:"userId"`
+	ValidUntil time.Time `json:"validUntil"`
+	Created    time.Time `json:"created"`
+	Used       bool      `json:"used"`
+}
+
+// PasswordReset is the pending one-time code of a forgotten password, only its hash is stored
+type PasswordReset struct {
+	UserId     int64     `json:"userId"`
+	CodeHash   string    `json:"-"`
+	ValidUntil time.Time `json:"validUntil"`
+	Created    time.Time `json:"created"`
+	Attempts   int       `json:"attempts"` // Wrong codes entered so far
+}
+
+// PasswordChange replaces the password of the logged in user
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordResetRequest sends a reset code to the user, the name has to match like on login
+type PasswordResetRequest struct {
+	OnlineID int64  `json:"onlineId"`
+	Username string `json:"username"`
+}
+
+// PasswordResetConfirm sets a new password with the received reset code
+type PasswordResetConfirm struct {
+	OnlineID    int64  `json:"onlineId"`
+	Code        string `json:"code"`
+	NewPassword string `json:"newPassword"`
+}
+
+// TOTP is the second factor of a user, it is only enabled after the first code was verified
+type TOTP struct {
+	UserId       int64     `json:"userId"`
+	Secret       string    `json:"-"` // Base32 encoded, needed to compute the codes
+	Enabled      bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"` // Time step of the last accepted code, codes cannot be used twice
+	Created      time.Time `json:"created"`
+}
+
+// TOTPEnrollment is shown once to add the account to the authenticator app
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type TOTPStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// SecondFactor is the current code of the authenticator app or one of the recovery codes
+type SecondFactor struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+// RecoveryCodes are only shown once, the server only stores their hashes
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// PasswordConfirmation repeats the password before changing the login of the user
+type PasswordConfirmation struct {
+	Password string `json:"password"`
+}
+
+// OIDCIdentity links the account of an OpenID Connect provider to a user
+type OIDCIdentity struct {
+	Issuer  string    `json:"issuer"`
+	Subject string    `json:"subject"`
+	UserId  int64     `json:"userId"`
+	Created time.Time `json:"created"`
+}
+
+// Server wide roles of the users, stored in the role table and included in the access tokens
+const (
+	USER       = "US"
+	ADMIN      = "AD"
+	MODERATOR  = "MO"
+	MONITORING = "MT" // For accounts of monitoring services only reading the metrics
+)
+
+// Permissions required by the admin routes, granted by the roles
 const (
-	USER  = "US"
-	ADMIN = "AD"
+	PermissionUsersRead       = "users:read"
+	PermissionUsersDelete     = "users:delete"
+	PermissionUsersUnlock     = "users:unlock"
+	PermissionRolesManage     = "roles:manage"
+	PermissionListsReadAll    = "lists:read-all"
+	PermissionRecipesModerate = "recipes:moderate"
+	PermissionMetricsRead     = "metrics:read"
 )
 
+var rolePermissions = map[string][]string{
+	USER:       {},
+	MODERATOR:  {PermissionUsersRead, PermissionUsersUnlock, PermissionListsReadAll, PermissionRecipesModerate},
+	MONITORING: {PermissionMetricsRead},
+	ADMIN: {PermissionUsersRead, PermissionUsersDelete, PermissionUsersUnlock, PermissionRolesManage,
+		PermissionListsReadAll, PermissionRecipesModerate, PermissionMetricsRead},
+}
+
+// RoleInfo names the permissions of a role
+type RoleInfo struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// IsValidRole reports whether the role is one of the server wide roles
+func IsValidRole(role string) bool {
+	_, exists := rolePermissions[role]
+	return exists
+}
+
+// IsValidPermission reports whether any role grants the permission
+func IsValidPermission(permission string) bool {
+	return RoleAllows(ADMIN, permission)
+}
+
+// RoleAllows reports whether the role grants the permission
+func RoleAllows(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Roles returns all roles with their permissions, ordered by their code
+func Roles() []RoleInfo {
+	roles := make([]RoleInfo, 0, len(rolePermissions))
+	for role, permissions := range rolePermissions {
+		roles = append(roles, RoleInfo{Role: role, Permissions: append([]string{}, permissions...)})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Role < roles[j].Role })
+	return roles
+}
+
 type Role struct {
 	UserID int64  `json:"userId"`
 	Role   string `json:"role"`
 }
 
 func (r *Role) ToEnumConstant() string {
-	switch r.Role {
-	case "AD":
-		return ADMIN
-	case "US":
-		return USER
-	default:
-		return USER
+	if IsValidRole(r.Role) {
+		return r.Role
 	}
+	return USER
 }
 
 // ------------------------------------------------------------
@@ -86,6 +244,8 @@ type List struct {
 	LastUpdated time.Time   `json:"lastUpdated"`
 	Version     int64       `json:"version"`
 	Items       []ItemWire  `json:"items"`
+	// Names of the items the client removed, only read when merging
+	RemovedItems []string `json:"removedItems,omitempty"`
 }
 
 type Item struct {
@@ -95,11 +255,20 @@ type Item struct {
 }
 
 type ItemWire struct {
+	ItemId   int64  `json:"itemId,omitempty"` // Set by the server, addresses the item in the item level API
 	Name     string `json:"name"`
 	Icon     string `json:"icon"`
 	Quantity int64  `json:"quantity"`
 	Checked  bool   `json:"checked"`
 	AddedBy  int64  `json:"addedBy"`
+	// Updated is used to merge concurrent changes, the server sets the current time if missing
+	Updated *ItemUpdated `json:"updated,omitempty"`
+}
+
+// ItemUpdated holds the time of the last change per field of an item in a list
+type ItemUpdated struct {
+	Quantity time.Time `json:"quantity"`
+	Checked  time.Time `json:"checked"`
 }
 
 type ListItem struct {
@@ -109,19 +278,241 @@ type ListItem struct {
 	Quantity  int64 `json:"quantity,omitempty"`
 	Checked   bool  `json:"checked,omitempty"`
 	AddedBy   int64 `json:"addedBy,omitempty"`
+	Position  int64 `json:"position,omitempty"`
+
+	QuantityUpdated time.Time `json:"quantityUpdated,omitempty"`
+	CheckedUpdated  time.Time `json:"checkedUpdated,omitempty"`
+}
+
+// ListItemPatch only changes the fields which are given
+type ListItemPatch struct {
+	Quantity *int64 `json:"quantity,omitempty"`
+	Checked  *bool  `json:"checked,omitempty"`
+}
+
+// ListItemOrder contains all itemIds of a list in the new order
+type ListItemOrder struct {
+	ItemIds []int64 `json:"itemIds"`
+}
+
+// ListItemChange is the answer to the item level list operations,
+// the version allows the client to stay in sync with the list
+type ListItemChange struct {
+	ListId    int64     `json:"listId"`
+	CreatedBy int64     `json:"createdBy"`
+	Version   int64     `json:"version"`
+	Item      *ItemWire `json:"item,omitempty"`
+}
+
+// ListVersion is the state of a list known to the client
+type ListVersion struct {
+	ListId    int64 `json:"listId"`
+	CreatedBy int64 `json:"createdBy"`
+	Version   int64 `json:"version"`
+}
+
+type ListSyncRequest struct {
+	Lists []ListVersion `json:"lists"`
 }
 
+// ListSyncResponse only contains the differences to the lists known by the client
+type ListSyncResponse struct {
+	Changed []List        `json:"changed"` // Known lists with a newer version on the server
+	Added   []List        `json:"added"`   // Lists unknown to the client, e.g. new shares
+	Removed []ListVersion `json:"removed"` // Known lists that were deleted or unshared
+}
+
+// ListConflict describes a field that was changed on the server and by the client
+// concurrently and which of both values was kept
+type ListConflict struct {
+	Item        string `json:"item,omitempty"` // Empty if the list itself is affected
+	Field       string `json:"field"`
+	ServerValue any    `json:"serverValue"`
+	ClientValue any    `json:"clientValue"`
+	Resolution  string `json:"resolution"`
+}
+
+const (
+	ConflictFieldTitle    = "title"
+	ConflictFieldQuantity = "quantity"
+	ConflictFieldChecked  = "checked"
+	ConflictFieldItem     = "item" // The item only exists on the server and was kept
+
+	ResolutionServer = "server"
+	ResolutionClient = "client"
+)
+
+// ListMergeResult is the answer to a merged list update
+type ListMergeResult struct {
+	List      List           `json:"list"`
+	Conflicts []ListConflict `json:"conflicts"`
+}
+
+// ListEvent is pushed to the owner and all users a list is shared with.
+// Clients react by syncing the list, therefore the content itself is not contained.
+type ListEvent struct {
+	Type      string    `json:"type"`
+	ListId    int64     `json:"listId"`
+	CreatedBy int64     `json:"createdBy"`
+	Version   int64     `json:"version,omitempty"` // Not set for deleted lists
+	Time      time.Time `json:"time"`
+}
+
+const (
+	ListEventUpdated  = "list-updated"
+	ListEventDeleted  = "list-deleted"
+	ListEventShared   = "list-shared"
+	ListEventUnshared = "list-unshared"
+	// Only sent to the recipient of a share request
+	ListEventShareRequest = "list-share-request"
+)
+
 type ListShared struct {
 	ListId       int64     `json:"listId"`
 	CreatedBy    int64     `json:"createdBy"`
 	SharedWithId int64     `json:"sharedWithId"`
 	Created      time.Time `json:"created,omitempty"`
+	Permission   string    `json:"permission"`
+	Status       string    `json:"status"`
+}
+
+// Shares start as pending requests, only accepted shares give access to the list
+const (
+	ShareStatusPending  = "pending"
+	ShareStatusAccepted = "accepted"
+)
+
+// BlockedUser cannot send share requests or invitations to the blocking user
+type BlockedUser struct {
+	UserId   int64     `json:"userId"`
+	Username string    `json:"username"`
+	Created  time.Time `json:"created"`
 }
 
 type ListSharedWire struct {
 	SharedBy   int64     `json:"sharedBy"` // Could also be obtained by the request token or user...?
 	SharedWith []int64   `json:"sharedWith"`
+	Households []int64   `json:"households,omitempty"` // All current members of the households get access
 	Created    time.Time `json:"created,omitempty"`
+	Permission string    `json:"permission,omitempty"` // Applies to all users and households, editor if empty
+}
+
+// Permissions of the users a list is shared with, every level includes the ones before
+const (
+	PermissionViewer  = "viewer"
+	PermissionChecker = "checker" // May only toggle the checked flag of items
+	PermissionEditor  = "editor"
+	PermissionCoOwner = "co-owner" // May additionally share the list
+	PermissionOwner   = "owner"    // Only the creator of the list, cannot be granted
+)
+
+var permissionLevels = map[string]int{
+	PermissionViewer:  1,
+	PermissionChecker: 2,
+	PermissionEditor:  3,
+	PermissionCoOwner: 4,
+	PermissionOwner:   5,
+}
+
+// IsGrantablePermission reports whether the permission can be given when sharing a list
+func IsGrantablePermission(permission string) bool {
+	_, exists := permissionLevels[permission]
+	return exists && permission != PermissionOwner
+}
+
+// PermissionAllows reports whether the granted permission includes the required one
+func PermissionAllows(granted string, required string) bool {
+	grantedLevel, exists := permissionLevels[granted]
+	return exists && grantedLevel >= permissionLevels[required]
+}
+
+// HigherPermission returns the permission that allows more
+func HigherPermission(first string, second string) string {
+	if permissionLevels[first] >= permissionLevels[second] {
+		return first
+	}
+	return second
+}
+
+// ------------------------------------------------------------
+// Households grouping users to share lists and recipes
+// ------------------------------------------------------------
+
+type Household struct {
+	HouseholdId int64             `json:"householdId"`
+	Name        string            `json:"name"`
+	CreatedBy   int64             `json:"createdBy"`
+	Created     time.Time         `json:"created"`
+	Members     []HouseholdMember `json:"members,omitempty"`
+}
+
+type HouseholdMember struct {
+	UserId   int64     `json:"userId"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Joined   time.Time `json:"joined"`
+}
+
+type HouseholdInvitation struct {
+	HouseholdId   int64     `json:"householdId"`
+	HouseholdName string    `json:"householdName"`
+	UserId        int64     `json:"userId"`
+	InvitedBy     int64     `json:"invitedBy"`
+	Created       time.Time `json:"created"`
+}
+
+// Roles of the household members, every role includes the ones before
+const (
+	HouseholdRoleMember = "member" // Sees everything shared with the household
+	HouseholdRoleAdmin  = "admin"  // May invite and remove members
+	HouseholdRoleOwner  = "owner"  // Only the creator, may change roles and delete the household
+)
+
+var householdRoleLevels = map[string]int{
+	HouseholdRoleMember: 1,
+	HouseholdRoleAdmin:  2,
+	HouseholdRoleOwner:  3,
+}
+
+// IsGrantableHouseholdRole reports whether the role can be given to a member
+func IsGrantableHouseholdRole(role string) bool {
+	_, exists := householdRoleLevels[role]
+	return exists && role != HouseholdRoleOwner
+}
+
+// HouseholdRoleAllows reports whether the role includes the required one
+func HouseholdRoleAllows(role string, required string) bool {
+	level, exists := householdRoleLevels[role]
+	return exists && level >= householdRoleLevels[required]
+}
+
+// ------------------------------------------------------------
+// Invite links to share without knowing the user id
+// ------------------------------------------------------------
+
+// Invite grants access to a list, recipe or household to everybody redeeming its token
+type Invite struct {
+	InviteId   string    `json:"inviteId"`
+	Type       string    `json:"type"`
+	ResourceId int64     `json:"resourceId"` // The listId, recipeId or householdId
+	CreatedBy  int64     `json:"createdBy"`  // The creator of the list or recipe
+	InvitedBy  int64     `json:"invitedBy"`
+	Permission string    `json:"permission,omitempty"` // Lists only, editor if empty
+	MaxUses    int       `json:"maxUses"`              // 0 allows unlimited uses
+	Uses       int       `json:"uses"`
+	ValidUntil time.Time `json:"validUntil"`
+	Created    time.Time `json:"created"`
+	Token      string    `json:"token,omitempty"` // Only returned when the invite is created
+}
+
+const (
+	InviteTypeList      = "list"
+	InviteTypeRecipe    = "recipe"
+	InviteTypeHousehold = "household"
+)
+
+type InviteRedemption struct {
+	Token string `json:"token"`
 }
 
 // ------------------------------------------------------------
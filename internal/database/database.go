@@ -9,6 +9,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,32 +21,84 @@ import (
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
-// A small database wrapper allowing to access a MySQL database
+// A small database wrapper allowing to access a MySQL or SQLite database
 
 // ------------------------------------------------------------
-// Configuration File Handling
+// Connection handling
 // ------------------------------------------------------------
 
-var config configuration.DatabaseConfig
-var db *sql.DB
+// SQLStore implements the Store on top of a MySQL / MariaDB or SQLite database.
+// The queries are kept compatible with both dialects.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// Compile time check that the SQLStore fulfills the Store interface
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore wraps an open database, the dialect selects the migrations (mysql, sqlite)
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{
+		db:      db,
+		dialect: dialect,
+	}
+}
 
 // ------------------------------------------------------------
 
-func ResetDatabase() {
-	DropUserTable()
-	ResetSharedListTable()
-	ResetItemTable()
-	ResetItemPerListTable()
-	DropShoppingListTable()
+func (s *SQLStore) ResetDatabase() {
+	s.DropUserTable()
+	s.ResetSharedListTable()
+	s.ResetItemTable()
+	s.ResetItemPerListTable()
+	s.DropShoppingListTable()
 }
 
-func CheckDatabaseOnline(config configuration.DatabaseConfig) (*sql.DB, error) {
-	if config == (configuration.DatabaseConfig{}) {
-		log.Fatalf("Configuration not initialized")
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx, allowing the helpers
+// to run on their own or as part of a larger transaction
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// inTransaction runs fn in a single transaction which is rolled back if fn fails
+func (s *SQLStore) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
-	if db != nil {
-		log.Print("Already connected to database")
-		return db, nil
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Failed to rollback transaction: %s", rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckDatabaseOnline connects to the MySQL database and applies all pending migrations
+func CheckDatabaseOnline(config configuration.DatabaseConfig) (*SQLStore, error) {
+	store, err := ConnectMySQLDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.MigrateUp(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return store, nil
+}
+
+// ConnectMySQLDatabase connects to the MySQL database without touching the schema
+func ConnectMySQLDatabase(config configuration.DatabaseConfig) (*SQLStore, error) {
+	if config == (configuration.DatabaseConfig{}) {
+		return nil, errors.New("database configuration not initialized")
 	}
 	mysqlCfg := mysql.Config{
 		User:                 config.User,
@@ -57,19 +110,18 @@ func CheckDatabaseOnline(config configuration.DatabaseConfig) (*sql.DB, error) {
 		CheckConnLiveness:    true,
 		ParseTime:            true,
 	}
-	var err error
 	configString := mysqlCfg.FormatDSN()
 	// log.Printf("Config string: %s", configString)
-	db, err = sql.Open("mysql", configString)
+	db, err := sql.Open("mysql", configString)
 	if err != nil {
-		log.Fatalf("Cannot connect to database: %s", err)
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
 	}
 	_, pingErr := db.Exec("select 42")
 	if pingErr != nil {
-		log.Fatalf("Database not responding: %s", pingErr)
+		return nil, fmt.Errorf("database not responding: %w", pingErr)
 	}
 	log.Print("Connected to database")
-	return db, nil
+	return NewSQLStore(db, configuration.DriverMySQL), nil
 }
 
 func convertTimeToString(timeToFormat time.Time) string {
@@ -103,25 +155,53 @@ var random = rand.New(rand.NewSource(time.Now().UnixNano()))
 const getUserQuery = "SELECT id,username,passwd,created,lastLogin FROM shoppers WHERE id = ?"
 const getUserRoleQuery = "SELECT role FROM role WHERE user_id = ?"
 
-func GetUser(id int64) (data.User, error) {
-	row := db.QueryRow(getUserQuery, id)
+func (s *SQLStore) GetUser(id int64) (data.User, error) {
+	row := s.db.QueryRow(getUserQuery, id)
 	var user data.User
 	if err := row.Scan(&user.OnlineID, &user.Username, &user.Password, &user.Created, &user.LastLogin); errors.Is(err, sql.ErrNoRows) || err != nil {
 		return data.User{}, err
 	}
-	roleRow := db.QueryRow(getUserRoleQuery, id)
-	var role data.Role
-	if err := roleRow.Scan(&role.Role); err != nil {
+	role, err := s.getUserRole(id)
+	if err != nil {
 		return data.User{}, err
 	}
-	user.Role = role.ToEnumConstant()
+	user.Role = role
 	return user, nil
 }
 
+// The table allows several roles per user, SetUserRole only stores one. For older
+// entries the admin role takes precedence over the others and those over the user role.
+func (s *SQLStore) getUserRole(id int64) (string, error) {
+	rows, err := s.db.Query(getUserRoleQuery, id)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	found := false
+	userRole := data.USER
+	for rows.Next() {
+		var role data.Role
+		if err := rows.Scan(&role.Role); err != nil {
+			return "", err
+		}
+		found = true
+		if userRole == data.USER || role.ToEnumConstant() == data.ADMIN {
+			userRole = role.ToEnumConstant()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", sql.ErrNoRows
+	}
+	return userRole, nil
+}
+
 const getAllUserQuery = "SELECT id,username,created,lastLogin FROM shoppers"
 
-func GetAllUsers() ([]data.User, error) {
-	rows, err := db.Query(getAllUserQuery)
+func (s *SQLStore) GetAllUsers() ([]data.User, error) {
+	rows, err := s.db.Query(getAllUserQuery)
 	if err != nil {
 		return []data.User{}, err
 	}
@@ -140,9 +220,9 @@ func GetAllUsers() ([]data.User, error) {
 
 const getUserFromUsernameSearchString = "SELECT id,username,lastLogin FROM shoppers WHERE username LIKE ?"
 
-func GetUserFromMatchingUsername(name string) ([]data.User, error) {
+func (s *SQLStore) GetUserFromMatchingUsername(name string) ([]data.User, error) {
 	paddedName := "%" + name + "%"
-	rows, err := db.Query(getUserFromUsernameSearchString, paddedName)
+	rows, err := s.db.Query(getUserFromUsernameSearchString, paddedName)
 	if err != nil {
 		return []data.User{}, err
 	}
@@ -164,16 +244,16 @@ func GetUserFromMatchingUsername(name string) ([]data.User, error) {
 	return users, nil
 }
 
-func userExists(id int64) error {
-	_, err := GetUser(id)
+func (s *SQLStore) userExists(id int64) error {
+	_, err := s.GetUser(id)
 	return err
 }
 
 /* The reason why we don't simply use AUTO_INCREMENT is so that randomly generated IDs prevent easy guessing */
-func createNewUserId() int64 {
+func (s *SQLStore) createNewUserId() int64 {
 	userId := random.Int31()
 	for {
-		err := userExists(int64(userId))
+		err := s.userExists(int64(userId))
 		if err == nil { // User already exists
 			userId = rand.Int31()
 			continue
@@ -184,8 +264,7 @@ func createNewUserId() int64 {
 	return int64(userId)
 }
 
-func createUser(username string, passwd string) (data.User, error) {
-	userId := createNewUserId()
+func createUser(userId int64, username string, passwd string) (data.User, error) {
 	hashedPw, err := argon2id.CreateHash(passwd, argon2id.DefaultParams)
 	if err != nil {
 		return data.User{}, err
@@ -208,22 +287,22 @@ func createUser(username string, passwd string) (data.User, error) {
 const createUserQuery = "INSERT INTO shoppers (id,username,passwd,created,lastLogin) VALUES (?, ?, ?, ?, ?)"
 const createUserRoleQuery = "INSERT INTO role (user_id,role) VALUES (?, ?)"
 
-func CreateUserAccountInDatabase(username string, passwd string) (data.User, error) {
-	newUser, err := createUser(username, passwd)
+func (s *SQLStore) CreateUserAccountInDatabase(username string, passwd string) (data.User, error) {
+	newUser, err := createUser(s.createNewUserId(), username, passwd)
 	if err != nil {
 		return data.User{}, err
 	}
 	log.Printf("Creating new user %d: %s", newUser.OnlineID, username)
-	_, err = db.Exec(createUserQuery, newUser.OnlineID, newUser.Username, newUser.Password, newUser.Created, newUser.LastLogin)
+	_, err = s.db.Exec(createUserQuery, newUser.OnlineID, newUser.Username, newUser.Password, newUser.Created, newUser.LastLogin)
 	if err != nil {
 		return data.User{}, err
 	}
 	// User can have more than a single role -> second table
-	_, err = db.Exec(createUserRoleQuery, newUser.OnlineID, newUser.Role)
+	_, err = s.db.Exec(createUserRoleQuery, newUser.OnlineID, newUser.Role)
 	if err != nil {
 		return data.User{}, err
 	}
-	newUser, err = GetUser(newUser.OnlineID)
+	newUser, err = s.GetUser(newUser.OnlineID)
 	if err != nil {
 		return data.User{}, err
 	}
@@ -232,30 +311,30 @@ func CreateUserAccountInDatabase(username string, passwd string) (data.User, err
 
 const updateLoginTimeQuery = "UPDATE shoppers SET lastLogin = CURRENT_TIMESTAMP WHERE id = ?"
 
-func ModifyLastLogin(id int64) (data.User, error) {
+func (s *SQLStore) ModifyLastLogin(id int64) (data.User, error) {
 	log.Printf("Updating the last login time for %d to now", id)
-	err := userExists(id)
+	err := s.userExists(id)
 	if err != nil {
 		return data.User{}, err
 	}
-	_, err = db.Exec(updateLoginTimeQuery, id)
+	_, err = s.db.Exec(updateLoginTimeQuery, id)
 	if err != nil {
 		log.Printf("Failed to update last login for user %d: %s", id, err)
 		return data.User{}, err
 	}
-	user, _ := GetUser(id)
+	user, _ := s.GetUser(id)
 	return user, nil
 }
 
 const updateUsernameQuery = "UPDATE shoppers SET username = ? WHERE id = ?"
 
-func ModifyUserAccountName(id int64, newUsername string) (data.User, error) {
-	user, err := GetUser(id)
+func (s *SQLStore) ModifyUserAccountName(id int64, newUsername string) (data.User, error) {
+	user, err := s.GetUser(id)
 	if err != nil {
 		return data.User{}, err
 	}
 	user.Username = newUsername
-	_, err = db.Exec(updateUsernameQuery, user.Username, user.OnlineID)
+	_, err = s.db.Exec(updateUsernameQuery, user.Username, user.OnlineID)
 	if err != nil {
 		return data.User{}, err
 	}
@@ -264,8 +343,8 @@ func ModifyUserAccountName(id int64, newUsername string) (data.User, error) {
 
 const updatePasswordQuery = "UPDATE shoppers SET passwd = ? WHERE id = ?"
 
-func ModifyUserAccountPassword(id int64, password string) (data.User, error) {
-	user, err := GetUser(id)
+func (s *SQLStore) ModifyUserAccountPassword(id int64, password string) (data.User, error) {
+	user, err := s.GetUser(id)
 	if err != nil {
 		return data.User{}, err
 	}
@@ -275,17 +354,54 @@ func ModifyUserAccountPassword(id int64, password string) (data.User, error) {
 		return data.User{}, err
 	}
 	user.Password = hashedPw
-	_, err = db.Exec(updatePasswordQuery, user.Password, user.OnlineID)
+	_, err = s.db.Exec(updatePasswordQuery, user.Password, user.OnlineID)
 	if err != nil {
 		return data.User{}, err
 	}
 	return user, nil
 }
 
+const deleteUserRolesQuery = "DELETE FROM role WHERE user_id = ?"
+
+func (s *SQLStore) SetUserRole(id int64, role string) error {
+	if !data.IsValidRole(role) {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	if err := s.userExists(id); err != nil {
+		return err
+	}
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteUserRolesQuery, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(createUserRoleQuery, id, role)
+		return err
+	})
+}
+
+const getUsersWithRoleQuery = "SELECT s.id, s.username, s.created, s.lastLogin FROM shoppers s JOIN role r ON r.user_id = s.id WHERE r.role = ? ORDER BY s.id"
+
+func (s *SQLStore) GetUsersWithRole(role string) ([]data.User, error) {
+	rows, err := s.db.Query(getUsersWithRoleQuery, role)
+	if err != nil {
+		return []data.User{}, err
+	}
+	defer rows.Close()
+	users := make([]data.User, 0)
+	for rows.Next() {
+		user := data.User{Role: role}
+		if err := rows.Scan(&user.OnlineID, &user.Username, &user.Created, &user.LastLogin); err != nil {
+			return []data.User{}, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 const deleteUserQuery = "DELETE FROM shoppers WHERE id = ?"
 
-func DeleteUserAccount(id int64) error {
-	_, err := db.Exec(deleteUserQuery, id)
+func (s *SQLStore) DeleteUserAccount(id int64) error {
+	_, err := s.db.Exec(deleteUserQuery, id)
 	if err != nil {
 		return err
 	}
@@ -294,10 +410,10 @@ func DeleteUserAccount(id int64) error {
 
 const dropUserTableQuery = "DELETE FROM shoppers"
 
-func DropUserTable() {
+func (s *SQLStore) DropUserTable() {
 	log.Print("RESETTING ALL USERS. THIS DISABLES LOGIN FOR ALL EXISTING USERS")
 
-	_, err := db.Exec(dropUserTableQuery)
+	_, err := s.db.Exec(dropUserTableQuery)
 	if err != nil {
 		return
 	}
@@ -311,13 +427,13 @@ func DropUserTable() {
 
 const getShoppingListQuery = "SELECT * FROM shopping_list WHERE listId = ? AND createdBy = ?"
 
-func GetRawShoppingListWithId(listId int64, createdBy int64) (data.List, error) {
-	row := db.QueryRow(getShoppingListQuery, listId, createdBy)
+func (s *SQLStore) GetRawShoppingListWithId(listId int64, createdBy int64) (data.List, error) {
+	row := s.db.QueryRow(getShoppingListQuery, listId, createdBy)
 	var list data.List
 	if err := row.Scan(&list.ListId, &list.CreatedBy.ID, &list.Title, &list.CreatedAt, &list.LastUpdated, &list.Version); errors.Is(err, sql.ErrNoRows) {
 		return data.List{}, err
 	}
-	user, err := GetUser(createdBy)
+	user, err := s.GetUser(createdBy)
 	if err != nil {
 		log.Printf("List Creator not found: %s", err)
 		return data.List{}, err
@@ -328,13 +444,13 @@ func GetRawShoppingListWithId(listId int64, createdBy int64) (data.List, error)
 
 const getAllShoppingListForUserQuery = "SELECT * FROM shopping_list WHERE createdBy = ?"
 
-func GetRawShoppingListsForUserId(id int64) ([]data.List, error) {
-	rows, err := db.Query(getAllShoppingListForUserQuery, id)
+func (s *SQLStore) GetRawShoppingListsForUserId(id int64) ([]data.List, error) {
+	rows, err := s.db.Query(getAllShoppingListForUserQuery, id)
 	if err != nil {
 		return []data.List{}, err
 	}
 	defer rows.Close()
-	user, err := GetUser(id)
+	user, err := s.GetUser(id)
 	if err != nil {
 		return []data.List{}, err
 	}
@@ -352,7 +468,7 @@ func GetRawShoppingListsForUserId(id int64) ([]data.List, error) {
 
 const getShoppingListsById = "SELECT * FROM shopping_list WHERE (listId, createdBy) IN ((?, ?))"
 
-func GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
+func (s *SQLStore) GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
 	if len(listIds) == 0 {
 		return []data.List{}, nil
 	}
@@ -366,7 +482,7 @@ func GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
 		getShoppingListsByIdInAppendableFormat := strings.TrimSuffix(getShoppingListsById, ")")
 		query = getShoppingListsByIdInAppendableFormat + strings.Repeat(",(?,?)", len(listIds)-1) + ")"
 	}
-	rows, err := db.Query(query, flattenedListPKs...)
+	rows, err := s.db.Query(query, flattenedListPKs...)
 	if err != nil {
 		return []data.List{}, err
 	}
@@ -377,7 +493,7 @@ func GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
 		if err := rows.Scan(&list.ListId, &list.CreatedBy.ID, &list.Title, &list.CreatedAt, &list.LastUpdated, &list.Version); err != nil {
 			return []data.List{}, err
 		}
-		user, err := GetUser(list.CreatedBy.ID)
+		user, err := s.GetUser(list.CreatedBy.ID)
 		if err != nil {
 			return []data.List{}, err
 		}
@@ -389,8 +505,8 @@ func GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
 
 const getAllShoppingListQuery = "SELECT * FROM shopping_list"
 
-func GetAllRawShoppingLists() ([]data.List, error) {
-	rows, err := db.Query(getAllShoppingListQuery)
+func (s *SQLStore) GetAllRawShoppingLists() ([]data.List, error) {
+	rows, err := s.db.Query(getAllShoppingListQuery)
 	if err != nil {
 		return []data.List{}, err
 	}
@@ -401,7 +517,7 @@ func GetAllRawShoppingLists() ([]data.List, error) {
 		if err := rows.Scan(&list.ListId, &list.CreatedBy.ID, &list.Title, &list.CreatedAt, &list.LastUpdated, &list.Version); err != nil {
 			return []data.List{}, err
 		}
-		user, err := GetUser(list.CreatedBy.ID)
+		user, err := s.GetUser(list.CreatedBy.ID)
 		if err != nil {
 			return []data.List{}, err
 		}
@@ -413,7 +529,7 @@ func GetAllRawShoppingLists() ([]data.List, error) {
 
 const getSharedWithShoppingListQuery = "SELECT * FROM shopping_list WHERE (listId, createdBy) IN ((?, ?))"
 
-func GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.List, error) {
+func (s *SQLStore) GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.List, error) {
 	if len(sharedLists) == 0 {
 		return []data.List{}, errors.New("no shared ids given")
 	}
@@ -432,7 +548,7 @@ func GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.Li
 		query = getSharedWithShoppingListQueryInAppendableFormat + strings.Repeat(",(?,?)", len(sharedLists)-1) + ")"
 	}
 	// log.Printf("Query string: %s", query)
-	rows, err := db.Query(query, listIds...)
+	rows, err := s.db.Query(query, listIds...)
 	if err != nil {
 		sharedWithId := -1
 		if len(sharedLists) > 0 {
@@ -448,7 +564,7 @@ func GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.Li
 		if err := rows.Scan(&list.ListId, &list.CreatedBy.ID, &list.Title, &list.CreatedAt, &list.LastUpdated, &list.Version); err != nil {
 			return []data.List{}, err
 		}
-		creatorInfo, err := GetUser(list.CreatedBy.ID)
+		creatorInfo, err := s.GetUser(list.CreatedBy.ID)
 		if err != nil {
 			log.Printf("Cannot find list creator %d and skip: %s", list.CreatedBy.ID, err)
 			continue
@@ -472,7 +588,41 @@ func checkListCorrect(list data.List) error {
 	return nil
 }
 
-func checkItemCorrect(item data.ItemWire) (data.Item, error) {
+// ItemFailure describes why a single item of a list could not be stored
+type ItemFailure struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ItemsError is returned if items of a list could not be stored.
+// The list write is rolled back as a whole in this case.
+type ItemsError struct {
+	Failures []ItemFailure `json:"failedItems"`
+}
+
+func (e *ItemsError) Error() string {
+	names := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		names = append(names, fmt.Sprintf("'%s' (%s)", failure.Name, failure.Error))
+	}
+	return fmt.Sprintf("failed to store %d item(s): %s", len(e.Failures), strings.Join(names, ", "))
+}
+
+func (e *ItemsError) add(index int, item data.ItemWire, err error) {
+	e.Failures = append(e.Failures, ItemFailure{Index: index, Name: item.Name, Error: err.Error()})
+}
+
+func (e *ItemsError) orNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	sort.SliceStable(e.Failures, func(i, j int) bool { return e.Failures[i].Index < e.Failures[j].Index })
+	return e
+}
+
+// CheckItemCorrect validates an item of a list and returns it with the trimmed name
+func CheckItemCorrect(item data.ItemWire) (data.Item, error) {
 	if item.Name == "" {
 		return data.Item{}, errors.New("invalid field name: is empty")
 	}
@@ -487,39 +637,49 @@ func checkItemCorrect(item data.ItemWire) (data.Item, error) {
 	return converted, nil
 }
 
+const getShoppingListVersionQuery = "SELECT version FROM shopping_list WHERE listId = ? AND createdBy = ?"
 const updateRawShoppingListQuery = "UPDATE shopping_list SET name = ?, lastEdited = CURRENT_TIMESTAMP, version = ? WHERE listId = ? AND createdBy = ?"
 
-func updateRawShoppingList(list data.List) (data.List, error) {
-	existingList, err := GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
-	if err != nil {
+func updateRawShoppingList(q queryer, list data.List) (data.List, error) {
+	var existingVersion int64
+	if err := q.QueryRow(getShoppingListVersionQuery, list.ListId, list.CreatedBy.ID).Scan(&existingVersion); err != nil {
 		return data.List{}, err
 	}
 	if err := checkListCorrect(list); err != nil {
 		log.Printf("List not in correct format for insertion: %s", err)
 		return data.List{}, err
 	}
-	if existingList.Version >= list.Version {
+	if existingVersion >= list.Version {
 		return data.List{}, errors.New("newer list exists")
 	}
-	_, err = db.Exec(updateRawShoppingListQuery, list.Title, list.Version, list.ListId, list.CreatedBy.ID)
+	_, err := q.Exec(updateRawShoppingListQuery, list.Title, list.Version, list.ListId, list.CreatedBy.ID)
 	return list, err
 }
 
 const createRawShoppingListQuery = "INSERT INTO shopping_list (listId,createdBy,name,created,lastEdited,version) VALUES (?, ?, ?, ?, ?, ?)"
 
-func createRawShoppingList(list data.List) error {
+func createRawShoppingList(q queryer, list data.List) error {
 	if err := checkListCorrect(list); err != nil {
 		log.Printf("List not in correct format for insertion: %s", err)
 		return err
 	}
-	result, err := db.Exec(createRawShoppingListQuery, list.ListId, list.CreatedBy.ID, list.Title, list.CreatedAt, list.LastUpdated, list.Version)
-	if err != nil {
+	_, err := q.Exec(createRawShoppingListQuery, list.ListId, list.CreatedBy.ID, list.Title, list.CreatedAt, list.LastUpdated, list.Version)
+	return err
+}
+
+const doesShoppingListExistQuery = "SELECT COUNT(*) FROM shopping_list WHERE listId = ? AND createdBy = ?"
+
+func createOrUpdateRawShoppingList(q queryer, list data.List) error {
+	var count int
+	if err := q.QueryRow(doesShoppingListExistQuery, list.ListId, list.CreatedBy.ID).Scan(&count); err != nil {
 		return err
 	}
-	if _, err := result.LastInsertId(); err != nil {
-		return err
+	if count == 0 {
+		return createRawShoppingList(q, list)
 	}
-	return nil
+	log.Printf("List %d from %d exists, updating", list.ListId, list.CreatedBy.ID)
+	_, err := updateRawShoppingList(q, list)
+	return err
 }
 
 type ItemMapKey struct {
@@ -527,82 +687,156 @@ type ItemMapKey struct {
 	AddedBy int64
 }
 
-func addOrRemoveItemsInShoppingList(list data.List) ([]ItemMapKey, error) {
+func addItemsOfShoppingList(q queryer, list data.List, itemsErr *ItemsError) []ItemMapKey {
 	log.Printf("Adding (%d) items in shopping list to database", len(list.Items))
-	var itemMapKeys []ItemMapKey
-	for _, item := range list.Items {
-		conv, err := checkItemCorrect(item)
+	itemMapKeys := make([]ItemMapKey, len(list.Items))
+	for i, item := range list.Items {
+		conv, err := CheckItemCorrect(item)
 		if err != nil {
-			log.Printf("Failed to insert item '%s': %s", item.Name, err)
-			return []ItemMapKey{}, err
+			itemsErr.add(i, item, err)
+			continue
 		}
-		insertedItem, err := InsertItemStruct(conv)
+		insertedItem, err := insertItemStruct(q, conv)
 		if err != nil {
-			log.Printf("Failed to insert item '%s': %s", conv.Name, err)
-			return []ItemMapKey{}, err
+			itemsErr.add(i, item, err)
+			continue
 		}
-		newMapKey := ItemMapKey{
+		itemMapKeys[i] = ItemMapKey{
 			ItemId:  insertedItem.ItemId,
 			AddedBy: item.AddedBy,
 		}
-		itemMapKeys = append(itemMapKeys, newMapKey)
 	}
-	return itemMapKeys, nil
+	return itemMapKeys
 }
 
-func mapItemsIntoShoppingList(list data.List, itemMapKeys []ItemMapKey) error {
+// mapItemsIntoShoppingList skips the items which could not be added before,
+// these are already part of itemsErr
+func mapItemsIntoShoppingList(q queryer, list data.List, itemMapKeys []ItemMapKey, itemsErr *ItemsError) error {
 	log.Printf("Adding (%d) items to shopping list", len(list.Items))
-	if len(list.Items) == 0 || len(itemMapKeys) == 0 {
-		return nil
-	}
 	if len(list.Items) != len(itemMapKeys) {
 		return errors.New("length of items and ids does not match")
 	}
-	if err := DeleteAllItemsInList(list.ListId, list.CreatedBy.ID); err != nil {
+	// The old items are removed even if none are left, otherwise removing the last item is lost
+	if err := deleteAllItemsInList(q, list.ListId, list.CreatedBy.ID); err != nil {
 		log.Printf("Failed to remove items from list %d for update: %s", list.ListId, err)
 		return err
 	}
+	if len(list.Items) == 0 {
+		return nil
+	}
 	for i, item := range list.Items {
-		converted := data.ListItem{
-			ListId:    list.ListId,
-			ItemId:    itemMapKeys[i].ItemId,
-			Quantity:  item.Quantity,
-			Checked:   item.Checked,
-			CreatedBy: list.CreatedBy.ID,
-			AddedBy:   itemMapKeys[i].AddedBy,
-		}
-		_, err := InsertOrUpdateItemInList(converted)
-		if err != nil {
-			log.Printf("Failed to add '%s' to list '%s': %s", item.Name, list.Title, err)
+		if itemMapKeys[i].ItemId == 0 {
+			continue
+		}
+		converted := listItemFromWire(list, item, itemMapKeys[i].ItemId, int64(i))
+		if _, err := insertOrUpdateItemInList(q, converted); err != nil {
+			itemsErr.add(i, item, err)
 		}
 	}
 	return nil
 }
 
-func CreateOrUpdateShoppingList(list data.List) error {
+// CreateOrUpdateShoppingList stores the list and its items in a single transaction.
+// If items cannot be stored an *ItemsError listing all of them is returned.
+func (s *SQLStore) CreateOrUpdateShoppingList(list data.List) error {
 	log.Printf("Creating or updating shopping list '%s' with id '%d' from %v", list.Title, list.ListId, list.CreatedBy)
-	if err := createRawShoppingList(list); err != nil {
-		log.Printf("Creating new list failed, trying update next")
-		_, err = updateRawShoppingList(list)
-		if err != nil {
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		return storeShoppingList(tx, list)
+	})
+	if err != nil {
+		log.Printf("Failed to store list %d from %d: %s", list.ListId, list.CreatedBy.ID, err)
+		return err
+	}
+	return nil
+}
+
+func storeShoppingList(q queryer, list data.List) error {
+	if err := createOrUpdateRawShoppingList(q, list); err != nil {
+		return err
+	}
+	itemsErr := &ItemsError{}
+	itemMapKeys := addItemsOfShoppingList(q, list, itemsErr)
+	if err := mapItemsIntoShoppingList(q, list, itemMapKeys, itemsErr); err != nil {
+		return err
+	}
+	return itemsErr.orNil()
+}
+
+const getShoppingListStateQuery = "SELECT name, lastEdited, version FROM shopping_list WHERE listId = ? AND createdBy = ?"
+
+// Locks the row of the list until the end of the transaction. Written instead of SELECT ... FOR UPDATE,
+// which SQLite does not know, so that SQLite takes its write lock before reading as well.
+const lockShoppingListQuery = "UPDATE shopping_list SET version = version WHERE listId = ? AND createdBy = ?"
+
+// MergeShoppingList stores the list like CreateOrUpdateShoppingList, but merges outdated versions
+// into the stored list instead of rejecting them. See mergeShoppingList for the rules.
+func (s *SQLStore) MergeShoppingList(list data.List) (data.ListMergeResult, error) {
+	log.Printf("Merging shopping list '%s' with id '%d' from %v", list.Title, list.ListId, list.CreatedBy)
+	conflicts := make([]data.ListConflict, 0)
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		toStore := list
+		// Concurrent merges of the list must read the result of each other
+		if _, err := tx.Exec(lockShoppingListQuery, list.ListId, list.CreatedBy.ID); err != nil {
 			return err
 		}
-		log.Printf("Raw list part updated")
+		var stored data.List
+		err := tx.QueryRow(getShoppingListStateQuery, list.ListId, list.CreatedBy.ID).Scan(&stored.Title, &stored.LastUpdated, &stored.Version)
+		if err == nil {
+			if stored.Items, err = getItemsInList(tx, list.ListId, list.CreatedBy.ID); err != nil {
+				return err
+			}
+			toStore, conflicts = mergeShoppingList(stored, list)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return storeShoppingList(tx, toStore)
+	})
+	if err != nil {
+		log.Printf("Failed to merge list %d from %d: %s", list.ListId, list.CreatedBy.ID, err)
+		return data.ListMergeResult{}, err
 	}
-	itemMapKeys, err := addOrRemoveItemsInShoppingList(list)
+	merged, err := s.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	if err != nil {
-		return err
+		return data.ListMergeResult{}, err
 	}
-	if err := mapItemsIntoShoppingList(list, itemMapKeys); err != nil {
+	if merged.Items, err = s.GetItemsInList(list.ListId, list.CreatedBy.ID); err != nil {
+		return data.ListMergeResult{}, err
+	}
+	return data.ListMergeResult{List: merged, Conflicts: conflicts}, nil
+}
+
+const bumpShoppingListVersionQuery = "UPDATE shopping_list SET version = version + 1, lastEdited = CURRENT_TIMESTAMP WHERE listId = ? AND createdBy = ?"
+
+// BumpListVersion marks the list as changed after an item level update and returns the new version
+func (s *SQLStore) BumpListVersion(listId int64, createdBy int64) (int64, error) {
+	var version int64
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		var err error
+		version, err = bumpListVersion(tx, listId, createdBy)
 		return err
+	})
+	return version, err
+}
+
+func bumpListVersion(q queryer, listId int64, createdBy int64) (int64, error) {
+	result, err := q.Exec(bumpShoppingListVersionQuery, listId, createdBy)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	if updated, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if updated == 0 {
+		return 0, sql.ErrNoRows
+	}
+	var version int64
+	err = q.QueryRow(getShoppingListVersionQuery, listId, createdBy).Scan(&version)
+	return version, err
 }
 
 const deleteShoppingListQuery = "DELETE FROM shopping_list WHERE listId = ? AND createdBy = ?"
 
-func DeleteShoppingList(id int64, createdBy int64) error {
-	_, err := db.Exec(deleteShoppingListQuery, id, createdBy)
+func (s *SQLStore) DeleteShoppingList(id int64, createdBy int64) error {
+	_, err := s.db.Exec(deleteShoppingListQuery, id, createdBy)
 	if err != nil {
 		return err
 	}
@@ -611,8 +845,8 @@ func DeleteShoppingList(id int64, createdBy int64) error {
 
 const deleteAllShoppingListFromQuery = "DELETE FROM shopping_list WHERE createdBy = ?"
 
-func DeleteShoppingListFrom(createdBy int64) error {
-	_, err := db.Exec(deleteAllShoppingListFromQuery, createdBy)
+func (s *SQLStore) DeleteShoppingListFrom(createdBy int64) error {
+	_, err := s.db.Exec(deleteAllShoppingListFromQuery, createdBy)
 	if err != nil {
 		return err
 	}
@@ -621,10 +855,10 @@ func DeleteShoppingListFrom(createdBy int64) error {
 
 const dropShoppingListTableQuery = "DELETE FROM shopping_list"
 
-func DropShoppingListTable() {
+func (s *SQLStore) DropShoppingListTable() {
 	log.Print("DROPPING SHOPPING LIST TABLE. CANNOT BE REVERTED!")
 
-	_, err := db.Exec(dropShoppingListTableQuery)
+	_, err := s.db.Exec(dropShoppingListTableQuery)
 	if err != nil {
 		return
 	}
@@ -634,13 +868,16 @@ func DropShoppingListTable() {
 
 // ------------------------------------------------------------
 
-const listIsSharedWithUser = "SELECT listId, createdBy FROM shared_list WHERE sharedWithId IN (?, -1)"
+const listIsSharedWithUser = "SELECT listId, createdBy FROM shared_list WHERE sharedWithId IN (?, -1) AND status = 'accepted' " +
+	"UNION SELECT sh.listId, sh.createdBy FROM shared_list_household sh INNER JOIN household_members hm ON sh.householdId = hm.householdId WHERE hm.userId = ? AND sh.createdBy != ?"
 
-func GetListIdsSharedWithUser(userId int64) ([]data.ListPK, error) {
-	rows, err := db.Query(listIsSharedWithUser, userId)
+// GetListIdsSharedWithUser includes the lists shared with the households of the user
+func (s *SQLStore) GetListIdsSharedWithUser(userId int64) ([]data.ListPK, error) {
+	rows, err := s.db.Query(listIsSharedWithUser, userId, userId, userId)
 	if err != nil {
 		return []data.ListPK{}, err
 	}
+	defer rows.Close()
 	var list []data.ListPK
 	for rows.Next() {
 		var shared data.ListPK
@@ -652,10 +889,43 @@ func GetListIdsSharedWithUser(userId int64) ([]data.ListPK, error) {
 	return list, nil
 }
 
-const isListSharedWithUserQuery = "SELECT * FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ?"
+const usersSharingListQuery = "SELECT sharedWithId FROM shared_list WHERE listId = ? AND createdBy = ? AND status = 'accepted' " +
+	"UNION SELECT hm.userId FROM shared_list_household sh INNER JOIN household_members hm ON sh.householdId = hm.householdId WHERE sh.listId = ? AND sh.createdBy = ? AND hm.userId != sh.createdBy"
+
+func (s *SQLStore) GetUsersSharingList(listId int64, createdBy int64) ([]int64, error) {
+	rows, err := s.db.Query(usersSharingListQuery, listId, createdBy, listId, createdBy)
+	if err != nil {
+		return []int64{}, err
+	}
+	defer rows.Close()
+	userIds := make([]int64, 0)
+	for rows.Next() {
+		var userId int64
+		if err := rows.Scan(&userId); err != nil {
+			return []int64{}, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
+
+const isListSharedWithUserQuery = "SELECT listId,createdBy,sharedWithId,created FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ? AND status = 'accepted'"
+
+// IsListSharedWithUser includes the sharing with the households of the user
+func (s *SQLStore) IsListSharedWithUser(listId int64, createdBy int64, userId int64) error {
+	err := s.isListSharedDirectly(listId, createdBy, userId)
+	if err == nil {
+		return nil
+	}
+	permissions, householdErr := getHouseholdPermissions(s.db, listId, createdBy, userId)
+	if householdErr != nil || len(permissions) == 0 {
+		return err
+	}
+	return nil
+}
 
-func IsListSharedWithUser(listId int64, createdBy int64, userId int64) error {
-	rows, err := db.Query(isListSharedWithUserQuery, listId, createdBy, userId)
+func (s *SQLStore) isListSharedDirectly(listId int64, createdBy int64, userId int64) error {
+	rows, err := s.db.Query(isListSharedWithUserQuery, listId, createdBy, userId)
 	if err != nil {
 		log.Printf("The list %d is not shared with the user %d: %s", listId, userId, err)
 		return err
@@ -682,10 +952,57 @@ func IsListSharedWithUser(listId int64, createdBy int64, userId int64) error {
 	return nil
 }
 
+const getSharePermissionQuery = "SELECT permission FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ? AND status = 'accepted'"
+
+// GetSharePermission returns sql.ErrNoRows if the list is not shared with the user or not accepted yet.
+// If the list is shared with the user and the households of the user, the highest permission counts.
+func (s *SQLStore) GetSharePermission(listId int64, createdBy int64, userId int64) (string, error) {
+	return getSharePermission(s.db, listId, createdBy, userId)
+}
+
+func getSharePermission(q queryer, listId int64, createdBy int64, userId int64) (string, error) {
+	var permission string
+	err := q.QueryRow(getSharePermissionQuery, listId, createdBy, userId).Scan(&permission)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	householdPermissions, err := getHouseholdPermissions(q, listId, createdBy, userId)
+	if err != nil {
+		return "", err
+	}
+	for _, householdPermission := range householdPermissions {
+		permission = data.HigherPermission(permission, householdPermission)
+	}
+	if permission == "" {
+		return "", sql.ErrNoRows
+	}
+	return permission, nil
+}
+
+const getHouseholdPermissionsQuery = "SELECT sh.permission FROM shared_list_household sh INNER JOIN household_members hm ON sh.householdId = hm.householdId WHERE sh.listId = ? AND sh.createdBy = ? AND hm.userId = ?"
+
+// getHouseholdPermissions returns the permissions of all households of the user the list is shared with
+func getHouseholdPermissions(q queryer, listId int64, createdBy int64, userId int64) ([]string, error) {
+	rows, err := q.Query(getHouseholdPermissionsQuery, listId, createdBy, userId)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	permissions := make([]string, 0)
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return []string{}, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
 const isListCreatedByUserIdQuery = "SELECT * FROM shopping_list WHERE listId = ? AND createdBy = ?"
 
-func IsListCreatedBy(listId int64, userId int64) error {
-	row := db.QueryRow(isListCreatedByUserIdQuery, listId, userId)
+func (s *SQLStore) IsListCreatedBy(listId int64, userId int64) error {
+	row := s.db.QueryRow(isListCreatedByUserIdQuery, listId, userId)
 	var list data.List
 	err := row.Scan(&list.ListId, &list.CreatedBy.ID, &list.Title, &list.CreatedAt, &list.LastUpdated, &list.Version)
 	if err != nil {
@@ -697,47 +1014,79 @@ func IsListCreatedBy(listId int64, userId int64) error {
 	return nil
 }
 
-func CheckUserAndListExist(listId int64, createdBy int64, sharedWith int64) error {
-	_, err := GetUser(createdBy)
+func (s *SQLStore) CheckUserAndListExist(listId int64, createdBy int64, sharedWith int64) error {
+	_, err := s.GetUser(createdBy)
 	if err != nil {
 		return errors.New("list owner does not exist")
 	}
-	_, err = GetUser(sharedWith)
+	_, err = s.GetUser(sharedWith)
 	if err != nil {
 		return errors.New("shared with user does not exist")
 	}
-	_, err = GetRawShoppingListWithId(listId, createdBy)
+	_, err = s.GetRawShoppingListWithId(listId, createdBy)
 	if err != nil {
 		return errors.New("shared list does not exist")
 	}
 	return nil
 }
 
-const createShoppingListSharingForUserQuery = "INSERT INTO shared_list (listId,createdBy,sharedWithId,created) VALUES (?,?,?,CURRENT_TIMESTAMP)"
+const createShoppingListSharingForUserQuery = "INSERT INTO shared_list (listId,createdBy,sharedWithId,created,permission,status) VALUES (?,?,?,CURRENT_TIMESTAMP,?,?)"
+const updateSharePermissionQuery = "UPDATE shared_list SET permission = ?, status = ? WHERE listId = ? AND createdBy = ? AND sharedWithId = ?"
+
+// CreateOrUpdateSharedList shares the list or changes the permission of an existing share
+func (s *SQLStore) CreateOrUpdateSharedList(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error) {
+	return s.createOrUpdateShare(listId, createdBy, sharedWith, permission, data.ShareStatusAccepted)
+}
 
-func CreateOrUpdateSharedList(listId int64, createdBy int64, sharedWith int64) (data.ListShared, error) {
-	err := IsListSharedWithUser(listId, createdBy, sharedWith)
+// CreateShareRequest keeps the status of an existing share
+func (s *SQLStore) CreateShareRequest(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error) {
+	return s.createOrUpdateShare(listId, createdBy, sharedWith, permission, data.ShareStatusPending)
+}
+
+func (s *SQLStore) createOrUpdateShare(listId int64, createdBy int64, sharedWith int64, permission string, status string) (data.ListShared, error) {
+	if !data.IsGrantablePermission(permission) {
+		return data.ListShared{}, fmt.Errorf("invalid permission '%s'", permission)
+	}
+	existingStatus, err := s.getShareStatus(listId, createdBy, sharedWith)
 	if err == nil {
-		log.Printf("Shared of list %d for user %d exists", listId)
-		return data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now()}, nil
+		log.Printf("Shared of list %d for user %d exists, setting permission %s", listId, sharedWith, permission)
+		if status == data.ShareStatusPending {
+			status = existingStatus
+		}
+		if _, err := s.db.Exec(updateSharePermissionQuery, permission, status, listId, createdBy, sharedWith); err != nil {
+			log.Printf("Failed to update sharing permission: %s", err)
+			return data.ListShared{}, err
+		}
+		return data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now(), Permission: permission, Status: status}, nil
 	}
-	if err := CheckUserAndListExist(listId, createdBy, sharedWith); err != nil {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return data.ListShared{}, err
+	}
+	if err := s.CheckUserAndListExist(listId, createdBy, sharedWith); err != nil {
 		log.Printf("User or list does not exist: %s", err)
 		return data.ListShared{}, err
 	}
-	_, err = db.Exec(createShoppingListSharingForUserQuery, listId, createdBy, sharedWith)
+	_, err = s.db.Exec(createShoppingListSharingForUserQuery, listId, createdBy, sharedWith, permission, status)
 	if err != nil {
 		log.Printf("Failed to insert sharing into database: %s", err)
 		return data.ListShared{}, err
 	}
-	newShared := data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now()}
+	newShared := data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now(), Permission: permission, Status: status}
 	return newShared, nil
 }
 
 const deleteSharingOfShoppingListQuery = "DELETE FROM shared_list WHERE listId = ? AND createdBy = ?"
+const deleteHouseholdSharingOfShoppingListQuery = "DELETE FROM shared_list_household WHERE listId = ? AND createdBy = ?"
 
-func DeleteSharingOfList(listId int64, createdBy int64) error {
-	_, err := db.Exec(deleteSharingOfShoppingListQuery, listId, createdBy)
+// DeleteSharingOfList removes the sharing with users and households
+func (s *SQLStore) DeleteSharingOfList(listId int64, createdBy int64) error {
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteSharingOfShoppingListQuery, listId, createdBy); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteHouseholdSharingOfShoppingListQuery, listId, createdBy)
+		return err
+	})
 	if err != nil {
 		log.Printf("Failed to delete sharing of list %d: %s", listId, err)
 		return err
@@ -747,8 +1096,8 @@ func DeleteSharingOfList(listId int64, createdBy int64) error {
 
 const deleteShoppingListSharingForUserQuery = "DELETE FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ?"
 
-func DeleteSharingForUser(listId int64, createdBy int64, userId int64) error {
-	_, err := db.Exec(deleteShoppingListSharingForUserQuery, listId, createdBy, userId)
+func (s *SQLStore) DeleteSharingForUser(listId int64, createdBy int64, userId int64) error {
+	_, err := s.db.Exec(deleteShoppingListSharingForUserQuery, listId, createdBy, userId)
 	if err != nil {
 		log.Printf("Failed to delete sharing for user %d of list %d: %s", userId, listId, err)
 		return err
@@ -758,10 +1107,10 @@ func DeleteSharingForUser(listId int64, createdBy int64, userId int64) error {
 
 const dropShoppingListSharedTable = "DELETE FROM shared_list"
 
-func ResetSharedListTable() {
+func (s *SQLStore) ResetSharedListTable() {
 	log.Print("RESETTING SHARING LIST. CANNOT BE REVERTED!")
 
-	_, err := db.Exec(dropShoppingListSharedTable)
+	_, err := s.db.Exec(dropShoppingListSharedTable)
 	if err != nil {
 		log.Printf("Failed to remove all sharing from table: %s", err)
 		return
@@ -772,21 +1121,32 @@ func ResetSharedListTable() {
 
 // ------------------------------------------------------------
 
-const doesItemMappingExistQuery = "SELECT * FROM items_per_list WHERE listId = ? AND createdBy = ? AND itemId = ?"
+const doesItemMappingExistQuery = "SELECT listId,createdBy,itemId,quantity,checked,COALESCE(addedBy, 0),position,quantityEdited,checkedEdited FROM items_per_list WHERE listId = ? AND createdBy = ? AND itemId = ?"
 
-func IsItemInList(listId int64, createdBy int64, itemId int64) (data.ListItem, error) {
-	row := db.QueryRow(doesItemMappingExistQuery, listId, itemId, createdBy)
+func (s *SQLStore) IsItemInList(listId int64, createdBy int64, itemId int64) (data.ListItem, error) {
+	return isItemInList(s.db, listId, createdBy, itemId)
+}
+
+func isItemInList(q queryer, listId int64, createdBy int64, itemId int64) (data.ListItem, error) {
+	row := q.QueryRow(doesItemMappingExistQuery, listId, createdBy, itemId)
 	var mapping data.ListItem
-	if err := row.Scan(&mapping.ListId, &mapping.CreatedBy, &mapping.ItemId, &mapping.Quantity, &mapping.Checked, &mapping.AddedBy); errors.Is(err, sql.ErrNoRows) {
+	var quantityEdited, checkedEdited sql.NullTime
+	if err := row.Scan(&mapping.ListId, &mapping.CreatedBy, &mapping.ItemId, &mapping.Quantity, &mapping.Checked, &mapping.AddedBy, &mapping.Position, &quantityEdited, &checkedEdited); errors.Is(err, sql.ErrNoRows) {
 		return data.ListItem{}, err
 	}
+	mapping.QuantityUpdated = quantityEdited.Time
+	mapping.CheckedUpdated = checkedEdited.Time
 	return mapping, nil
 }
 
-const getItemsInListQuery = "SELECT it.name,it.icon,map.quantity,map.checked,map.addedBy FROM items_per_list map INNER JOIN items it ON map.itemId = it.id WHERE listId = ? AND createdBy = ?"
+const getItemsInListQuery = "SELECT it.id,it.name,it.icon,map.quantity,map.checked,COALESCE(map.addedBy, 0),map.quantityEdited,map.checkedEdited FROM items_per_list map INNER JOIN items it ON map.itemId = it.id WHERE listId = ? AND createdBy = ? ORDER BY map.position, map.itemId"
+
+func (s *SQLStore) GetItemsInList(listId int64, createdBy int64) ([]data.ItemWire, error) {
+	return getItemsInList(s.db, listId, createdBy)
+}
 
-func GetItemsInList(listId int64, createdBy int64) ([]data.ItemWire, error) {
-	rows, err := db.Query(getItemsInListQuery, listId, createdBy)
+func getItemsInList(q queryer, listId int64, createdBy int64) ([]data.ItemWire, error) {
+	rows, err := q.Query(getItemsInListQuery, listId, createdBy)
 	if err != nil {
 		log.Printf("Failed to query for items contained in list %d: %s", listId, err)
 		return []data.ItemWire{}, nil
@@ -795,41 +1155,65 @@ func GetItemsInList(listId int64, createdBy int64) ([]data.ItemWire, error) {
 	var list []data.ItemWire
 	for rows.Next() {
 		var item data.ItemWire
-		if err := rows.Scan(&item.Name, &item.Icon, &item.Quantity, &item.Checked, &item.AddedBy); err != nil {
+		var quantityEdited, checkedEdited sql.NullTime
+		if err := rows.Scan(&item.ItemId, &item.Name, &item.Icon, &item.Quantity, &item.Checked, &item.AddedBy, &quantityEdited, &checkedEdited); err != nil {
 			return []data.ItemWire{}, err
 		}
+		item.Updated = &data.ItemUpdated{Quantity: quantityEdited.Time, Checked: checkedEdited.Time}
 		list = append(list, item)
 	}
 	return list, nil
 }
 
-const updateItemMappingQuery = "UPDATE items_per_list SET quantity = ?, checked = ?, addedBy = ? WHERE listId = ? AND createdBy = ? AND itemId = ?"
-const insertItemMappingQuery = "INSERT INTO items_per_list (listId,createdBy,itemId,quantity,checked,addedBy) VALUES (?, ?, ?, ?, ?, ?)"
+const updateItemMappingQuery = "UPDATE items_per_list SET quantity = ?, checked = ?, addedBy = ?, quantityEdited = ?, checkedEdited = ? WHERE listId = ? AND createdBy = ? AND itemId = ?"
+const insertItemMappingQuery = "INSERT INTO items_per_list (listId,createdBy,itemId,quantity,checked,addedBy,position,quantityEdited,checkedEdited) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func (s *SQLStore) InsertOrUpdateItemInList(mapping data.ListItem) (data.ListItem, error) {
+	return insertOrUpdateItemInList(s.db, mapping)
+}
 
-func InsertOrUpdateItemInList(mapping data.ListItem) (data.ListItem, error) {
+func insertOrUpdateItemInList(q queryer, mapping data.ListItem) (data.ListItem, error) {
+	mapping = withEditTimes(mapping, time.Now().UTC())
 	update := false
-	existingItemMapping, err := IsItemInList(mapping.ListId, mapping.CreatedBy, mapping.ItemId)
+	existingItemMapping, err := isItemInList(q, mapping.ListId, mapping.CreatedBy, mapping.ItemId)
 	if err == nil {
 		update = true
 	}
 	if update {
-		_, err := db.Exec(updateItemMappingQuery, mapping.Quantity, mapping.Checked, mapping.AddedBy, mapping.ListId, mapping.CreatedBy, existingItemMapping.ItemId)
+		_, err := q.Exec(updateItemMappingQuery, mapping.Quantity, mapping.Checked, mapping.AddedBy, mapping.QuantityUpdated, mapping.CheckedUpdated, mapping.ListId, mapping.CreatedBy, existingItemMapping.ItemId)
 		if err != nil {
 			return data.ListItem{}, err
 		}
 		return mapping, nil
 	}
-	_, err = db.Exec(insertItemMappingQuery, mapping.ListId, mapping.CreatedBy, mapping.ItemId, mapping.Quantity, mapping.Checked, mapping.AddedBy)
+	_, err = q.Exec(insertItemMappingQuery, mapping.ListId, mapping.CreatedBy, mapping.ItemId, mapping.Quantity, mapping.Checked, mapping.AddedBy, mapping.Position, mapping.QuantityUpdated, mapping.CheckedUpdated)
 	if err != nil {
 		return data.ListItem{}, err
 	}
 	return mapping, nil
 }
 
-const deleteShoppingListMappingQuery = "DELETE FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ?"
+// ChangeItemInList stores the mapping and bumps the version of the list in the same transaction
+func (s *SQLStore) ChangeItemInList(mapping data.ListItem) (data.ListItem, int64, error) {
+	var version int64
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		var err error
+		if mapping, err = insertOrUpdateItemInList(tx, mapping); err != nil {
+			return err
+		}
+		version, err = bumpListVersion(tx, mapping.ListId, mapping.CreatedBy)
+		return err
+	})
+	if err != nil {
+		return data.ListItem{}, 0, err
+	}
+	return mapping, version, nil
+}
 
-func DeleteItemInList(listId int64, createdBy int64, itemId int64) error {
-	_, err := db.Exec(deleteShoppingListMappingQuery, listId, createdBy, itemId)
+const deleteItemInListQuery = "DELETE FROM items_per_list WHERE listId = ? AND createdBy = ? AND itemId = ?"
+
+func (s *SQLStore) DeleteItemInList(listId int64, createdBy int64, itemId int64) error {
+	_, err := s.db.Exec(deleteItemInListQuery, listId, createdBy, itemId)
 	if err != nil {
 		log.Printf("Failed to delete item %d in list: %s", itemId, err)
 		return err
@@ -837,10 +1221,32 @@ func DeleteItemInList(listId int64, createdBy int64, itemId int64) error {
 	return nil
 }
 
+// RemoveItemFromList deletes the item and bumps the version of the list in the same transaction
+func (s *SQLStore) RemoveItemFromList(listId int64, createdBy int64, itemId int64) (int64, error) {
+	var version int64
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteItemInListQuery, listId, createdBy, itemId); err != nil {
+			return err
+		}
+		var err error
+		version, err = bumpListVersion(tx, listId, createdBy)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to remove item %d from list %d: %s", itemId, listId, err)
+		return 0, err
+	}
+	return version, nil
+}
+
 const deleteAllShoppingListMappingsForListQuery = "DELETE FROM items_per_list WHERE listId = ? AND createdBy = ?"
 
-func DeleteAllItemsInList(listId int64, createdBy int64) error {
-	_, err := db.Exec(deleteAllShoppingListMappingsForListQuery, listId, createdBy)
+func (s *SQLStore) DeleteAllItemsInList(listId int64, createdBy int64) error {
+	return deleteAllItemsInList(s.db, listId, createdBy)
+}
+
+func deleteAllItemsInList(q queryer, listId int64, createdBy int64) error {
+	_, err := q.Exec(deleteAllShoppingListMappingsForListQuery, listId, createdBy)
 	if err != nil {
 		log.Printf("Failed to delete list %d: %s", listId, err)
 		return err
@@ -848,12 +1254,64 @@ func DeleteAllItemsInList(listId int64, createdBy int64) error {
 	return nil
 }
 
+const getItemIdsInListQuery = "SELECT itemId FROM items_per_list WHERE listId = ? AND createdBy = ?"
+const updateItemPositionQuery = "UPDATE items_per_list SET position = ? WHERE listId = ? AND createdBy = ? AND itemId = ?"
+
+// ReorderItemsInList expects all items of the list exactly once and returns the bumped version of the list
+func (s *SQLStore) ReorderItemsInList(listId int64, createdBy int64, itemIds []int64) (int64, error) {
+	var version int64
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(getItemIdsInListQuery, listId, createdBy)
+		if err != nil {
+			return err
+		}
+		existing := make([]int64, 0)
+		for rows.Next() {
+			var itemId int64
+			if err := rows.Scan(&itemId); err != nil {
+				rows.Close()
+				return err
+			}
+			existing = append(existing, itemId)
+		}
+		rows.Close()
+		if err := checkItemOrder(existing, itemIds); err != nil {
+			return err
+		}
+		for position, itemId := range itemIds {
+			if _, err := tx.Exec(updateItemPositionQuery, position, listId, createdBy, itemId); err != nil {
+				return err
+			}
+		}
+		version, err = bumpListVersion(tx, listId, createdBy)
+		return err
+	})
+	return version, err
+}
+
+func checkItemOrder(existing []int64, itemIds []int64) error {
+	if len(existing) != len(itemIds) {
+		return fmt.Errorf("order contains %d items but list has %d", len(itemIds), len(existing))
+	}
+	inList := make(map[int64]bool)
+	for _, itemId := range existing {
+		inList[itemId] = true
+	}
+	for _, itemId := range itemIds {
+		if !inList[itemId] {
+			return fmt.Errorf("item %d is not in list or given twice", itemId)
+		}
+		delete(inList, itemId)
+	}
+	return nil
+}
+
 const dropItemPerListTable = "DELETE FROM items_per_list"
 
-func ResetItemPerListTable() {
+func (s *SQLStore) ResetItemPerListTable() {
 	log.Print("RESETTING ALL ITEMS PER LIST. CANNOT BE REVERTED!")
 
-	_, err := db.Exec(dropItemPerListTable)
+	_, err := s.db.Exec(dropItemPerListTable)
 	if err != nil {
 		log.Printf("Failed to remove mappings from table: %s", err)
 		return
@@ -868,12 +1326,12 @@ func ResetItemPerListTable() {
 
 const getItemQuery = "SELECT * FROM items WHERE id = ?"
 
-func GetItem(id int64) (data.Item, error) {
+func (s *SQLStore) GetItem(id int64) (data.Item, error) {
 	if id < 0 {
 		err := errors.New("items with id < 0 do not exist")
 		return data.Item{}, err
 	}
-	row := db.QueryRow(getItemQuery, id)
+	row := s.db.QueryRow(getItemQuery, id)
 	var item data.Item
 	if err := row.Scan(&item.ItemId, &item.Name, &item.Icon); err != nil {
 		return data.Item{}, err
@@ -883,8 +1341,8 @@ func GetItem(id int64) (data.Item, error) {
 
 const getAllItemsQuery = "SELECT * FROM items"
 
-func GetAllItems() ([]data.Item, error) {
-	rows, err := db.Query(getAllItemsQuery)
+func (s *SQLStore) GetAllItems() ([]data.Item, error) {
+	rows, err := s.db.Query(getAllItemsQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -904,10 +1362,11 @@ func GetAllItems() ([]data.Item, error) {
 	return items, nil
 }
 
-const getAllItemsFromNameQuery = "SELECT * FROM items WHERE name LIKE '%?%'"
+const getAllItemsFromNameQuery = "SELECT * FROM items WHERE name LIKE ?"
 
-func GetAllItemsFromName(name string) ([]data.Item, error) {
-	rows, err := db.Query(getAllItemsFromNameQuery, name)
+func (s *SQLStore) GetAllItemsFromName(name string) ([]data.Item, error) {
+	paddedName := "%" + name + "%"
+	rows, err := s.db.Query(getAllItemsFromNameQuery, paddedName)
 	if err != nil {
 		log.Printf("Failed to query database for items: %s", err)
 		return nil, err
@@ -928,34 +1387,45 @@ func GetAllItemsFromName(name string) ([]data.Item, error) {
 	return items, nil
 }
 
-func InsertItem(name string, icon string) (data.Item, error) {
+func (s *SQLStore) InsertItem(name string, icon string) (data.Item, error) {
 	item := data.Item{
 		Name: name,
 		Icon: icon,
 	}
-	return InsertItemStruct(item)
+	return s.InsertItemStruct(item)
 }
 
 const getItemFromNameQuery = "SELECT id,name,icon FROM items WHERE name = ?"
 const insertItemQuery = "INSERT INTO items (name, icon) SELECT ?,? WHERE NOT EXISTS (SELECT 1 FROM items WHERE name = ?);"
 
-func InsertItemStruct(item data.Item) (data.Item, error) {
+func (s *SQLStore) InsertItemStruct(item data.Item) (data.Item, error) {
+	return insertItemStruct(s.db, item)
+}
+
+func insertItemStruct(q queryer, item data.Item) (data.Item, error) {
 	trimmedName := strings.TrimSpace(item.Name)
 	trimmedIcon := strings.TrimSpace(item.Icon)
-	result, err := db.Exec(insertItemQuery, trimmedName, trimmedIcon, trimmedName)
+	result, err := q.Exec(insertItemQuery, trimmedName, trimmedIcon, trimmedName)
 	if err != nil {
 		return item, err
 	}
-	id, err := result.LastInsertId()
+	// SQLite reports the last inserted id even if no row was inserted,
+	// so check if the item was actually inserted first
+	inserted, err := result.RowsAffected()
 	if err != nil {
 		log.Printf("Failed to insert item into database: %s", err)
 		return item, err
 	}
-	if id > 0 {
+	if inserted > 0 {
+		id, err := result.LastInsertId()
+		if err != nil {
+			log.Printf("Failed to insert item into database: %s", err)
+			return item, err
+		}
 		item.ItemId = id
 		return item, nil
 	}
-	row := db.QueryRow(getItemFromNameQuery, item.Name)
+	row := q.QueryRow(getItemFromNameQuery, trimmedName)
 	var insertedItem data.Item
 	if err := row.Scan(&insertedItem.ItemId, &insertedItem.Name, &insertedItem.Icon); err != nil {
 		return item, err
@@ -965,8 +1435,8 @@ func InsertItemStruct(item data.Item) (data.Item, error) {
 
 const updateItemNameQuery = "UPDATE items SET name = ?, icon = ? WHERE id = ?"
 
-func ModifyItem(id int64, name string, icon string) (data.Item, error) {
-	item, err := GetItem(id)
+func (s *SQLStore) ModifyItem(id int64, name string, icon string) (data.Item, error) {
+	item, err := s.GetItem(id)
 	if err != nil {
 		return data.Item{}, err
 	}
@@ -976,22 +1446,17 @@ func ModifyItem(id int64, name string, icon string) (data.Item, error) {
 	if icon != "" {
 		item.Icon = icon
 	}
-	result, err := db.Exec(updateItemNameQuery, item.Name, item.Icon, item.ItemId)
+	_, err = s.db.Exec(updateItemNameQuery, item.Name, item.Icon, item.ItemId)
 	if err != nil {
 		return data.Item{}, err
 	}
-	item.ItemId, err = result.RowsAffected()
-	if err != nil {
-		log.Printf("Problem with ID during insertion of item: %s", err)
-		return data.Item{}, err
-	}
-	return item, err
+	return item, nil
 }
 
 const deleteItemQuery = "DELETE FROM items WHERE id = ?"
 
-func DeleteItem(id int64) error {
-	_, err := db.Exec(deleteItemQuery, id)
+func (s *SQLStore) DeleteItem(id int64) error {
+	_, err := s.db.Exec(deleteItemQuery, id)
 	if err != nil {
 		return err
 	}
@@ -1000,10 +1465,10 @@ func DeleteItem(id int64) error {
 
 const dropItemTable = "DELETE FROM items"
 
-func ResetItemTable() {
+func (s *SQLStore) ResetItemTable() {
 	log.Print("RESETTING ALL ITEMS. CANNOT BE REVERTED!")
 
-	_, err := db.Exec(dropItemTable)
+	_, err := s.db.Exec(dropItemTable)
 	if err != nil {
 		log.Printf("Failed to remove all items from table: %s", err)
 		return
@@ -1018,28 +1483,36 @@ func ResetItemTable() {
 
 const createRawRecipeQuery = "INSERT INTO recipe (recipeId,createdBy,name,createdAt,lastUpdate,version,defaultPortion) VALUES (?,?,?,?,?,?,?)"
 
-func CreateRecipe(recipe data.Recipe) error {
-	_, err := db.Exec(createRawRecipeQuery, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Name, recipe.CreatedAt, recipe.LastUpdate, recipe.Version, recipe.DefaultPortion)
-	if err != nil {
-		log.Printf("Failed to insert values into database: %s", err)
-		return err
-	}
-	err = insertDescriptions(recipe.RecipeId, recipe.CreatedBy.ID, recipe.Description)
-	if err != nil {
-		log.Printf("Failed to create recipe '%s' because of descriptions: %s", recipe.Name, err)
-		return err
-	}
-	err = insertIngredients(recipe.RecipeId, recipe.CreatedBy.ID, recipe.Ingredients)
-	if err != nil {
-		log.Printf("Failed to create recipe '%s' because of ingredients: %s", recipe.Name, err)
-		return err
-	}
-	return nil
+// CreateRecipe stores the recipe with its ingredients, descriptions and image filenames in a single transaction
+func (s *SQLStore) CreateRecipe(recipe data.Recipe, imageFilenames []string) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(createRawRecipeQuery, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Name, recipe.CreatedAt, recipe.LastUpdate, recipe.Version, recipe.DefaultPortion)
+		if err != nil {
+			log.Printf("Failed to insert values into database: %s", err)
+			return err
+		}
+		err = insertDescriptions(tx, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Description)
+		if err != nil {
+			log.Printf("Failed to create recipe '%s' because of descriptions: %s", recipe.Name, err)
+			return err
+		}
+		err = insertIngredients(tx, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Ingredients)
+		if err != nil {
+			log.Printf("Failed to create recipe '%s' because of ingredients: %s", recipe.Name, err)
+			return err
+		}
+		recipePK := data.RecipePK{RecipeId: recipe.RecipeId, CreatedBy: recipe.CreatedBy.ID}
+		if err := storeRecipeImageFilenames(tx, imageFilenames, recipePK); err != nil {
+			log.Printf("Failed to create recipe '%s' because of images: %s", recipe.Name, err)
+			return err
+		}
+		return nil
+	})
 }
 
-const insertRecipeDescriptionQuery = "INSERT INTO description_per_recipe (recipeId,createdBy,descriptionOrder,description) VALUE (?,?,?,?)"
+const insertRecipeDescriptionQuery = "INSERT INTO description_per_recipe (recipeId,createdBy,descriptionOrder,description) VALUES (?,?,?,?)"
 
-func insertDescriptions(recipeId int64, createdBy int64, descriptions []data.RecipeDescription) error {
+func insertDescriptions(q queryer, recipeId int64, createdBy int64, descriptions []data.RecipeDescription) error {
 	log.Printf("Inserting %d recipe descriptions", len(descriptions))
 	if len(descriptions) == 0 {
 		return nil
@@ -1055,13 +1528,13 @@ func insertDescriptions(recipeId int64, createdBy int64, descriptions []data.Rec
 		flattenedParameter = append(flattenedParameter, v.Order)
 		flattenedParameter = append(flattenedParameter, v.Step)
 	}
-	_, err := db.Exec(query, flattenedParameter...)
+	_, err := q.Exec(query, flattenedParameter...)
 	return err
 }
 
 const insertRecipeIngredientsQuery = "INSERT INTO ingredient_per_recipe (recipeId,createdBy,itemId,quantity,quantityType) VALUES (?,?,?,?,?)"
 
-func insertIngredients(recipeId int64, createdBy int64, ingredients []data.Ingredient) error {
+func insertIngredients(q queryer, recipeId int64, createdBy int64, ingredients []data.Ingredient) error {
 	log.Printf("Insert %d recipe ingredients", len(ingredients))
 	// We need to check if an item exists and reference this item rather than creating a new one
 	if len(ingredients) == 0 {
@@ -1073,7 +1546,7 @@ func insertIngredients(recipeId int64, createdBy int64, ingredients []data.Ingre
 	}
 	flattenedParameter := make([]interface{}, 0)
 	for _, v := range ingredients {
-		item, err := InsertItem(v.Name, v.Icon)
+		item, err := insertItemStruct(q, data.Item{Name: v.Name, Icon: v.Icon})
 		if err != nil {
 			return err
 		}
@@ -1083,14 +1556,14 @@ func insertIngredients(recipeId int64, createdBy int64, ingredients []data.Ingre
 		flattenedParameter = append(flattenedParameter, v.Quantity)
 		flattenedParameter = append(flattenedParameter, v.QuantityType)
 	}
-	_, err := db.Exec(query, flattenedParameter...)
+	_, err := q.Exec(query, flattenedParameter...)
 	return err
 }
 
 const getIngredientsForRecipeQuery = "SELECT it.name,it.icon,map.quantity,map.quantityType FROM ingredient_per_recipe map JOIN items it ON map.itemId = it.id WHERE map.recipeId = ? AND map.createdBy = ?"
 
-func GetIngredientsForRecipe(recipeId int64, createdBy int64) ([]data.Ingredient, error) {
-	rows, err := db.Query(getIngredientsForRecipeQuery, recipeId, createdBy)
+func (s *SQLStore) GetIngredientsForRecipe(recipeId int64, createdBy int64) ([]data.Ingredient, error) {
+	rows, err := s.db.Query(getIngredientsForRecipeQuery, recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to retrieve ingredients for recipe %d from %d", recipeId, createdBy)
 		return []data.Ingredient{}, err
@@ -1109,8 +1582,8 @@ func GetIngredientsForRecipe(recipeId int64, createdBy int64) ([]data.Ingredient
 
 const getDescriptionsForRecipeQuery = "SELECT descriptionOrder,description FROM description_per_recipe WHERE recipeId = ? AND createdBy = ?"
 
-func GetDescriptionsForRecipe(recipeId int64, createdBy int64) ([]data.RecipeDescription, error) {
-	rows, err := db.Query(getDescriptionsForRecipeQuery, recipeId, createdBy)
+func (s *SQLStore) GetDescriptionsForRecipe(recipeId int64, createdBy int64) ([]data.RecipeDescription, error) {
+	rows, err := s.db.Query(getDescriptionsForRecipeQuery, recipeId, createdBy)
 	if err != nil {
 		return []data.RecipeDescription{}, err
 	}
@@ -1128,28 +1601,28 @@ func GetDescriptionsForRecipe(recipeId int64, createdBy int64) ([]data.RecipeDes
 
 const getRawRecipeQuery = "SELECT recipeId,createdBy,name,createdAt,lastUpdate,version,defaultPortion FROM recipe WHERE recipeId = ? AND createdBy = ?"
 
-func GetRecipe(recipeId int64, createdBy int64) (data.Recipe, error) {
-	row := db.QueryRow(getRawRecipeQuery, recipeId, createdBy)
+func (s *SQLStore) GetRecipe(recipeId int64, createdBy int64) (data.Recipe, error) {
+	row := s.db.QueryRow(getRawRecipeQuery, recipeId, createdBy)
 	var recipe data.Recipe
 	err := row.Scan(&recipe.RecipeId, &recipe.CreatedBy.ID, &recipe.Name, &recipe.CreatedAt, &recipe.LastUpdate, &recipe.Version, &recipe.DefaultPortion)
 	if err != nil {
 		log.Printf("Failed to get recipe %d from %d: %s", recipeId, createdBy, err)
 		return data.Recipe{}, err
 	}
-	recipeCreator, err := GetUser(recipe.CreatedBy.ID)
+	recipeCreator, err := s.GetUser(recipe.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get recipe creator %d for recipe %d: %s", recipe.CreatedBy.ID, recipeId, err)
 		return data.Recipe{}, err
 	}
 	recipe.CreatedBy.Name = recipeCreator.Username
-	ingredients, err := GetIngredientsForRecipe(recipeId, createdBy)
+	ingredients, err := s.GetIngredientsForRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to get ingredient for recipe: %s", err)
 		return data.Recipe{}, err
 	}
 	recipe.Ingredients = ingredients
 
-	descriptions, err := GetDescriptionsForRecipe(recipeId, createdBy)
+	descriptions, err := s.GetDescriptionsForRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to retrieve recipe %d from %d", recipeId, createdBy)
 		return data.Recipe{}, nil
@@ -1160,9 +1633,9 @@ func GetRecipe(recipeId int64, createdBy int64) (data.Recipe, error) {
 
 const getRecipesForUserIdQuery = "SELECT recipeId,createdBy FROM recipe WHERE createdBy = ?"
 
-func GetRecipeForUserId(userId int64) ([]int64, error) {
+func (s *SQLStore) GetRecipeForUserId(userId int64) ([]int64, error) {
 	log.Printf("Loading all recipes ids for user %d", userId)
-	rows, err := db.Query(getRecipesForUserIdQuery, userId)
+	rows, err := s.db.Query(getRecipesForUserIdQuery, userId)
 	if err != nil {
 		return []int64{}, err
 	}
@@ -1179,11 +1652,13 @@ func GetRecipeForUserId(userId int64) ([]int64, error) {
 	return ownRecipeIds, nil
 }
 
-const getRecipeSharedWithUserIdQuery = "SELECT recipeId, createdBy FROM shared_recipe WHERE sharedWith = ?"
+const getRecipeSharedWithUserIdQuery = "SELECT recipeId, createdBy FROM shared_recipe WHERE sharedWith = ? " +
+	"UNION SELECT sh.recipeId, sh.createdBy FROM shared_recipe_household sh INNER JOIN household_members hm ON sh.householdId = hm.householdId WHERE hm.userId = ? AND sh.createdBy != ?"
 
-func GetRecipeIdsSharedWithUserId(userId int64) ([]int64, []int64, error) {
+// GetRecipeIdsSharedWithUserId includes the recipes shared with the households of the user
+func (s *SQLStore) GetRecipeIdsSharedWithUserId(userId int64) ([]int64, []int64, error) {
 	log.Printf("Loading all recipes ids shared with user %d", userId)
-	rows, err := db.Query(getRecipeSharedWithUserIdQuery, userId)
+	rows, err := s.db.Query(getRecipeSharedWithUserIdQuery, userId, userId, userId)
 	if err != nil {
 		return []int64{}, []int64{}, err
 	}
@@ -1204,9 +1679,16 @@ func GetRecipeIdsSharedWithUserId(userId int64) ([]int64, []int64, error) {
 
 const getSpecificRecipeSharedWithUser = "SELECT recipeId, createdBy, sharedWith FROM shared_recipe WHERE recipeId = ? AND createdBy = ? AND sharedWith = ?"
 
-func IsRecipeSharedWithUser(userId int64, recipeId int64, createdBy int64) error {
+const countRecipeSharedWithHouseholdsOfUserQuery = "SELECT COUNT(*) FROM shared_recipe_household sh INNER JOIN household_members hm ON sh.householdId = hm.householdId WHERE sh.recipeId = ? AND sh.createdBy = ? AND hm.userId = ?"
+
+// IsRecipeSharedWithUser includes the sharing with the households of the user
+func (s *SQLStore) IsRecipeSharedWithUser(userId int64, recipeId int64, createdBy int64) error {
 	log.Printf("Checking if recipe %d from %d is shared with %d", recipeId, createdBy, userId)
-	row := db.QueryRow(getSpecificRecipeSharedWithUser, recipeId, createdBy, userId)
+	var householdShares int
+	if err := s.db.QueryRow(countRecipeSharedWithHouseholdsOfUserQuery, recipeId, createdBy, userId).Scan(&householdShares); err == nil && householdShares > 0 {
+		return nil
+	}
+	row := s.db.QueryRow(getSpecificRecipeSharedWithUser, recipeId, createdBy, userId)
 	var storedRecipeId int64
 	var storedCreatedBy int64
 	var storedSharedWith int64
@@ -1223,8 +1705,8 @@ func IsRecipeSharedWithUser(userId int64, recipeId int64, createdBy int64) error
 
 const getAllRawRecipesQuery = "SELECT recipeId,createdBy,name,createdAt,lastUpdate,version,defaultPortion FROM recipe"
 
-func GetAllRecipes() ([]data.Recipe, error) {
-	rows, err := db.Query(getAllRawRecipesQuery)
+func (s *SQLStore) GetAllRecipes() ([]data.Recipe, error) {
+	rows, err := s.db.Query(getAllRawRecipesQuery)
 	if err != nil {
 		log.Printf("Failed to retrieve all recipes: %s", err)
 		return nil, err
@@ -1236,14 +1718,14 @@ func GetAllRecipes() ([]data.Recipe, error) {
 		if err := rows.Scan(&recipe.RecipeId, &recipe.CreatedBy.ID, &recipe.Name, &recipe.CreatedAt, &recipe.LastUpdate, &recipe.Version, &recipe.DefaultPortion); err != nil {
 			return nil, err
 		}
-		ingredients, err := GetIngredientsForRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
+		ingredients, err := s.GetIngredientsForRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
 		if err != nil {
 			log.Printf("Failed to retrieve ingredients for recipe %s: %s", recipe.Name, err)
 			recipes = append(recipes, recipe)
 			continue
 		}
 		recipe.Ingredients = ingredients
-		descriptions, err := GetDescriptionsForRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
+		descriptions, err := s.GetDescriptionsForRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
 		if err != nil {
 			log.Printf("Failed to retrieve descriptions for recipe %s: %s", recipe.Name, err)
 			recipes = append(recipes, recipe)
@@ -1255,107 +1737,118 @@ func GetAllRecipes() ([]data.Recipe, error) {
 	return recipes, nil
 }
 
-func updateIngredients(recipeId int64, createdBy int64, ingredients []data.Ingredient) error {
-	err := deleteIngredients(recipeId, createdBy)
+func updateIngredients(q queryer, recipeId int64, createdBy int64, ingredients []data.Ingredient) error {
+	err := deleteIngredients(q, recipeId, createdBy)
 	if err != nil {
 		return err
 	}
-	err = insertIngredients(recipeId, createdBy, ingredients)
+	err = insertIngredients(q, recipeId, createdBy, ingredients)
 	return err
 }
 
-func updateDescriptions(recipeId int64, createdBy int64, descriptions []data.RecipeDescription) error {
-	err := deleteDescriptions(recipeId, createdBy)
+func updateDescriptions(q queryer, recipeId int64, createdBy int64, descriptions []data.RecipeDescription) error {
+	err := deleteDescriptions(q, recipeId, createdBy)
 	if err != nil {
 		return err
 	}
-	err = insertDescriptions(recipeId, createdBy, descriptions)
+	err = insertDescriptions(q, recipeId, createdBy, descriptions)
 	return err
 }
 
+const getRecipeVersionQuery = "SELECT version FROM recipe WHERE recipeId = ? AND createdBy = ?"
 const updateRawRecipeQuery = "UPDATE recipe SET version = ?, name = ?, lastUpdate = CURRENT_TIMESTAMP WHERE recipeId = ? AND createdBy = ?"
 
-func UpdateRecipe(recipe data.Recipe) error {
-	log.Printf("Updating recipe '%s'", recipe.Name)
-	existingRecipe, err := GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
-	if err != nil {
-		log.Printf("The recipe to update was not found: %s", err)
-		return err
-	}
-	if existingRecipe.Version >= recipe.Version {
-		return errors.New(" recipe to update has the same or lower version than existing recipe")
-	}
-	_, err = db.Exec(updateRawRecipeQuery, recipe.Version, recipe.Name, recipe.RecipeId, recipe.CreatedBy.ID)
+func updateRecipe(q queryer, recipe data.Recipe) error {
+	_, err := q.Exec(updateRawRecipeQuery, recipe.Version, recipe.Name, recipe.RecipeId, recipe.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to update recipe version: %s", err)
 		return err
 	}
-	if err := updateDescriptions(recipe.RecipeId, recipe.CreatedBy.ID, recipe.Description); err != nil {
+	if err := updateDescriptions(q, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Description); err != nil {
 		log.Printf("Failed to update descriptions: %s", err)
 		return err
 	}
-	if err := updateIngredients(recipe.RecipeId, recipe.CreatedBy.ID, recipe.Ingredients); err != nil {
+	if err := updateIngredients(q, recipe.RecipeId, recipe.CreatedBy.ID, recipe.Ingredients); err != nil {
 		log.Printf("Failed to update ingredients: %s", err)
 		return err
 	}
 	return nil
 }
 
-func UpdateRecipeWithoutComparingVersion(recipeToUpdate data.Recipe) error {
+// UpdateRecipe replaces the recipe, its ingredients, descriptions and image filenames in a single transaction
+func (s *SQLStore) UpdateRecipe(recipe data.Recipe, imageFilenames []string) error {
+	log.Printf("Updating recipe '%s'", recipe.Name)
+	return s.inTransaction(func(tx *sql.Tx) error {
+		var existingVersion int64
+		if err := tx.QueryRow(getRecipeVersionQuery, recipe.RecipeId, recipe.CreatedBy.ID).Scan(&existingVersion); err != nil {
+			log.Printf("The recipe to update was not found: %s", err)
+			return err
+		}
+		if existingVersion >= int64(recipe.Version) {
+			return errors.New(" recipe to update has the same or lower version than existing recipe")
+		}
+		if err := updateRecipe(tx, recipe); err != nil {
+			return err
+		}
+		if err := removeImagesForRecipe(tx, recipe.RecipeId, recipe.CreatedBy.ID); err != nil {
+			log.Printf("Failed to remove old images: %s", err)
+			return err
+		}
+		recipePK := data.RecipePK{RecipeId: recipe.RecipeId, CreatedBy: recipe.CreatedBy.ID}
+		if err := storeRecipeImageFilenames(tx, imageFilenames, recipePK); err != nil {
+			log.Printf("Failed to update images: %s", err)
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) UpdateRecipeWithoutComparingVersion(recipeToUpdate data.Recipe) error {
 	log.Printf("Updating recipe %d from %d to version %d without compare", recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID, recipeToUpdate.Version)
-	_, err := db.Exec(updateRawRecipeQuery, recipeToUpdate.Version, recipeToUpdate.Name, recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID)
-	if err != nil {
-		log.Printf("Failed to update recipe version: %s", err)
-		return err
-	}
-	if err := updateDescriptions(recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID, recipeToUpdate.Description); err != nil {
-		log.Printf("Failed to update descriptions: %s", err)
-		return err
-	}
-	if err := updateIngredients(recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID, recipeToUpdate.Ingredients); err != nil {
-		log.Printf("Failed to update ingredients: %s", err)
-		return err
-	}
-	return nil
+	return s.inTransaction(func(tx *sql.Tx) error {
+		return updateRecipe(tx, recipeToUpdate)
+	})
 }
 
 const deleteIngredientsForRecipeQuery = "DELETE FROM ingredient_per_recipe WHERE recipeId = ? AND createdBy = ?"
 
-func deleteIngredients(recipeId int64, createdBy int64) error {
-	_, err := db.Exec(deleteIngredientsForRecipeQuery, recipeId, createdBy)
+func deleteIngredients(q queryer, recipeId int64, createdBy int64) error {
+	_, err := q.Exec(deleteIngredientsForRecipeQuery, recipeId, createdBy)
 	return err
 }
 
 const deleteDescriptionsForRecipeQuery = "DELETE FROM description_per_recipe WHERE recipeId = ? AND createdBy = ?"
 
-func deleteDescriptions(recipeId int64, createdBy int64) error {
-	_, err := db.Exec(deleteDescriptionsForRecipeQuery, recipeId, createdBy)
+func deleteDescriptions(q queryer, recipeId int64, createdBy int64) error {
+	_, err := q.Exec(deleteDescriptionsForRecipeQuery, recipeId, createdBy)
 	return err
 }
 
 const deleteRawRecipeQuery = "DELETE FROM recipe WHERE recipeId = ? AND createdBy = ?"
 
-func DeleteRecipe(recipeId int64, createdBy int64) error {
-	if err := deleteDescriptions(recipeId, createdBy); err != nil {
-		return err
-	}
-	if err := deleteIngredients(recipeId, createdBy); err != nil {
-		return err
-	}
-	_, err := db.Exec(deleteRawRecipeQuery, recipeId, createdBy)
-	if err != nil {
-		log.Printf("Failed to delete recipe %d from %d: %s", recipeId, createdBy, err)
-		return err
-	}
-	return nil
+func (s *SQLStore) DeleteRecipe(recipeId int64, createdBy int64) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if err := deleteDescriptions(tx, recipeId, createdBy); err != nil {
+			return err
+		}
+		if err := deleteIngredients(tx, recipeId, createdBy); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteRawRecipeQuery, recipeId, createdBy)
+		if err != nil {
+			log.Printf("Failed to delete recipe %d from %d: %s", recipeId, createdBy, err)
+			return err
+		}
+		return nil
+	})
 }
 
 const dropRecipeTable = "DELETE FROM recipe"
 
-func ResetRecipeTables() {
+func (s *SQLStore) ResetRecipeTables() {
 	log.Print("RESETTING ALL RECIPES. CANNOT BE REVERTED!")
 
-	_, err := db.Exec(dropRecipeTable)
+	_, err := s.db.Exec(dropRecipeTable)
 	if err != nil {
 		log.Printf("Failed to remove all recipes: %s", err)
 		return
@@ -1370,9 +1863,9 @@ func ResetRecipeTables() {
 
 const createRecipeSharingQuery = "INSERT INTO shared_recipe (recipeId,createdBy,sharedWith) VALUES (?,?,?)"
 
-func CreateRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
+func (s *SQLStore) CreateRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
 	log.Printf("Creating new sharing for %d of recipe %d from %d", sharedWith, recipeId, createdBy)
-	_, err := db.Exec(createRecipeSharingQuery, recipeId, createdBy, sharedWith)
+	_, err := s.db.Exec(createRecipeSharingQuery, recipeId, createdBy, sharedWith)
 	if err != nil {
 		log.Printf("Failed to insert sharing for user %d into database: %s", sharedWith, err)
 		return err
@@ -1382,9 +1875,9 @@ func CreateRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) erro
 
 const deleteRecipeSharingForIdQuery = "DELETE FROM shared_recipe WHERE recipeId = ? AND createdBy = ? AND sharedWith = ?"
 
-func DeleteRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
+func (s *SQLStore) DeleteRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
 	log.Printf("Deleting sharing for %d of recipe %d from %d", sharedWith, recipeId, createdBy)
-	_, err := db.Exec(deleteRecipeSharingForIdQuery, recipeId, createdBy, sharedWith)
+	_, err := s.db.Exec(deleteRecipeSharingForIdQuery, recipeId, createdBy, sharedWith)
 	if err != nil {
 		log.Printf("Failed to delete sharing for user %d from recipe %d: %s", sharedWith, recipeId, err)
 		return err
@@ -1393,10 +1886,18 @@ func DeleteRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) erro
 }
 
 const deleteRecipeSharingForAllQuery = "DELETE FROM shared_recipe WHERE recipeId = ? AND createdBy = ?"
+const deleteRecipeHouseholdSharingForAllQuery = "DELETE FROM shared_recipe_household WHERE recipeId = ? AND createdBy = ?"
 
-func DeleteAllSharingForRecipe(recipeId int64, createdBy int64) error {
+// DeleteAllSharingForRecipe removes the sharing with users and households
+func (s *SQLStore) DeleteAllSharingForRecipe(recipeId int64, createdBy int64) error {
 	log.Printf("Deleting all sharing for recipe %d from %d", recipeId, createdBy)
-	_, err := db.Exec(deleteRecipeSharingForAllQuery, recipeId, createdBy)
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteRecipeSharingForAllQuery, recipeId, createdBy); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteRecipeHouseholdSharingForAllQuery, recipeId, createdBy)
+		return err
+	})
 	if err != nil {
 		log.Printf("Failed to delete all sharing for recipe %d from %d: %s", recipeId, createdBy, err)
 		return err
@@ -1410,33 +1911,48 @@ func DeleteAllSharingForRecipe(recipeId int64, createdBy int64) error {
 
 const createImagePerRecipeQuery = "INSERT INTO images_per_recipe (recipeId,createdBy,filename) VALUES (?, ?, ?)"
 
-func UpdateAndReplaceImagesForRecipe(ctx *gin.Context, recipePK data.RecipePK) error {
-	temporaryFilespaths, err := MarkImagesForDeletion(recipePK.RecipeId, recipePK.CreatedBy)
+// UpdateAndReplaceImagesForRecipe stores the uploaded images and passes their filenames to write,
+// which is expected to update the database. The previous images are restored if anything fails.
+func UpdateAndReplaceImagesForRecipe(store Store, ctx *gin.Context, recipePK data.RecipePK, write func(filenames []string) error) error {
+	temporaryFilespaths, err := MarkImagesForDeletion(store, recipePK.RecipeId, recipePK.CreatedBy)
 	if err != nil {
 		return err
 	}
-	_, err = StoreImagesForRecipe(ctx, recipePK)
+	err = StoreImagesForRecipe(ctx, recipePK, write)
 	if err != nil {
-		_ = RestoreImagesMarkedForDeletion(temporaryFilespaths, recipePK)
+		_ = RestoreImagesMarkedForDeletion(temporaryFilespaths)
 		return err
 	}
-	err = DeleteImagesFromFilepaths("recipes", temporaryFilespaths)
+	_ = DeleteImagesFromFilepaths("recipes", temporaryFilespaths)
 	return nil
 }
 
-func StoreImagesForRecipe(ctx *gin.Context, recipePK data.RecipePK) ([]string, error) {
+// StoreImagesForRecipe stores the uploaded images and passes their filenames to write,
+// which is expected to update the database. The images are removed again if write fails.
+func StoreImagesForRecipe(ctx *gin.Context, recipePK data.RecipePK, write func(filenames []string) error) error {
 	filenames, err := storeImages(ctx, recipePK.RecipeId, recipePK.CreatedBy, "content", "recipes")
 	if err != nil {
-		return []string{}, err
+		return err
 	}
-	return storeRecipeImageFilepathsInDatabase(filenames, recipePK)
+	if err := write(filenames); err != nil {
+		_ = DeleteImagesFromFilepaths("recipes", filenames)
+		return err
+	}
+	return nil
 }
 
-func storeRecipeImageFilepathsInDatabase(filenames []string, recipePK data.RecipePK) ([]string, error) {
+func (s *SQLStore) StoreRecipeImageFilenames(filenames []string, recipePK data.RecipePK) ([]string, error) {
 	if len(filenames) == 0 {
 		log.Printf("No images for recipe %d found", recipePK.RecipeId)
 		return []string{}, nil
 	}
+	return filenames, storeRecipeImageFilenames(s.db, filenames, recipePK)
+}
+
+func storeRecipeImageFilenames(q queryer, filenames []string, recipePK data.RecipePK) error {
+	if len(filenames) == 0 {
+		return nil
+	}
 	query := createImagePerRecipeQuery
 	if len(filenames) > 1 {
 		query = createImagePerRecipeQuery + strings.Repeat(",(?,?,?)", len(filenames)-1)
@@ -1447,8 +1963,8 @@ func storeRecipeImageFilepathsInDatabase(filenames []string, recipePK data.Recip
 		flattenedParameters = append(flattenedParameters, recipePK.CreatedBy)
 		flattenedParameters = append(flattenedParameters, filename)
 	}
-	_, err := db.Exec(query, flattenedParameters...)
-	return filenames, err
+	_, err := q.Exec(query, flattenedParameters...)
+	return err
 }
 
 func storeImages(ctx *gin.Context, recipeId int64, createdBy int64, imageFieldName string, filePathPrefix string) ([]string, error) {
@@ -1471,6 +1987,7 @@ func storeImages(ctx *gin.Context, recipeId int64, createdBy int64, imageFieldNa
 		fileStoreLocation := filepath.Join("images", filePathPrefix, filename)
 		log.Printf("Storing image %s in %s", file.Filename, fileStoreLocation)
 		if err := ctx.SaveUploadedFile(file, fileStoreLocation); err != nil {
+			_ = DeleteImagesFromFilepaths(filePathPrefix, filenames)
 			return []string{}, err
 		}
 		filenames = append(filenames, filename)
@@ -1480,8 +1997,8 @@ func storeImages(ctx *gin.Context, recipeId int64, createdBy int64, imageFieldNa
 
 const getImageNamesForRecipeQuery = "SELECT filename FROM images_per_recipe WHERE recipeId = ? AND createdBy = ?"
 
-func GetImageNamesForRecipe(recipeId int64, createdBy int64) ([]string, error) {
-	rows, err := db.Query(getImageNamesForRecipeQuery, recipeId, createdBy)
+func (s *SQLStore) GetImageNamesForRecipe(recipeId int64, createdBy int64) ([]string, error) {
+	rows, err := s.db.Query(getImageNamesForRecipeQuery, recipeId, createdBy)
 	if err != nil {
 		return []string{}, err
 	}
@@ -1550,8 +2067,17 @@ func DeleteImagesFromFilepaths(folder string, filenames []string) error {
 
 const removeImagesForRecipeQuery = "DELETE FROM images_per_recipe WHERE recipeId = ? AND createdBy = ?"
 
-func MarkImagesForDeletion(recipeId int64, createdBy int64) ([]string, error) {
-	existingImages, err := GetImageNamesForRecipe(recipeId, createdBy)
+func (s *SQLStore) RemoveImagesForRecipe(recipeId int64, createdBy int64) error {
+	return removeImagesForRecipe(s.db, recipeId, createdBy)
+}
+
+func removeImagesForRecipe(q queryer, recipeId int64, createdBy int64) error {
+	_, err := q.Exec(removeImagesForRecipeQuery, recipeId, createdBy)
+	return err
+}
+
+func MarkImagesForDeletion(store Store, recipeId int64, createdBy int64) ([]string, error) {
+	existingImages, err := store.GetImageNamesForRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to load existing images: %s", err)
 		return []string{}, err
@@ -1561,27 +2087,23 @@ func MarkImagesForDeletion(recipeId int64, createdBy int64) ([]string, error) {
 		log.Printf("Failed to rename images: %s", err)
 		return []string{}, err
 	}
-	_, err = db.Exec(removeImagesForRecipeQuery, recipeId, createdBy)
-	if err != nil {
-		log.Printf("Removing images marked for deleting from database failed: %s", err)
-		return []string{}, err
-	}
 	return renamedFiles, nil
 }
 
-func RestoreImagesMarkedForDeletion(fileLocations []string, recipePK data.RecipePK) error {
-	log.Printf("Restoring images marked for deletion for recipe %d from %d", recipePK.RecipeId, recipePK.CreatedBy)
-	restoredFiles, err := RenameImagesFromFilepaths("recipes", fileLocations, "_del", true)
+// RestoreImagesMarkedForDeletion only renames the files, the database
+// still references the original filenames because the update was rolled back
+func RestoreImagesMarkedForDeletion(fileLocations []string) error {
+	log.Printf("Restoring %d images marked for deletion", len(fileLocations))
+	_, err := RenameImagesFromFilepaths("recipes", fileLocations, "_del", true)
 	if err != nil {
 		log.Printf("Failed to restore images: %s", err)
 		return err
 	}
-	_, err = storeRecipeImageFilepathsInDatabase(restoredFiles, recipePK)
-	return err
+	return nil
 }
 
-func DeleteImagesForRecipe(recipeId int64, createdBy int64) error {
-	existingImages, err := GetImageNamesForRecipe(recipeId, createdBy)
+func DeleteImagesForRecipe(store Store, recipeId int64, createdBy int64) error {
+	existingImages, err := store.GetImageNamesForRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to load existing images: %s", err)
 		return err
@@ -1591,7 +2113,7 @@ func DeleteImagesForRecipe(recipeId int64, createdBy int64) error {
 		log.Printf("Failed to delete existing images: %s", err)
 		return err
 	}
-	_, err = db.Exec(removeImagesForRecipeQuery, recipeId, createdBy)
+	err = store.RemoveImagesForRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Failed to remove existing images for recipe %d from %d: %s", recipeId, createdBy, err)
 		return err
@@ -1599,12 +2121,94 @@ func DeleteImagesForRecipe(recipeId int64, createdBy int64) error {
 	return nil
 }
 
+// ------------------------------------------------------------
+// Token handling
+// ------------------------------------------------------------
+
+const insertTokenQuery = "INSERT INTO token (tokenId, sessionId, userId, validUntil) VALUES (?, ?, ?, ?)"
+
+func (s *SQLStore) InsertToken(token data.TokenData) error {
+	_, err := s.db.Exec(insertTokenQuery, token.TokenId, token.SessionId, token.UserId, token.ValidUntil)
+	return err
+}
+
+const selectTokenQuery = "SELECT tokenId, sessionId, userId, validUntil FROM token WHERE tokenId = ?"
+
+func (s *SQLStore) GetToken(tokenId string) (data.TokenData, error) {
+	var tokenData data.TokenData
+	err := s.db.QueryRow(selectTokenQuery, tokenId).Scan(&tokenData.TokenId, &tokenData.SessionId, &tokenData.UserId, &tokenData.ValidUntil)
+	return tokenData, err
+}
+
+const clearTokenQuery = "DELETE FROM token WHERE tokenId = ?"
+
+func (s *SQLStore) DeleteToken(tokenId string) (int64, error) {
+	res, err := s.db.Exec(clearTokenQuery, tokenId)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected, nil
+}
+
+const clearSessionTokensQuery = "DELETE FROM token WHERE sessionId = ?"
+
+func (s *SQLStore) DeleteTokensForSession(sessionId string) (int64, error) {
+	res, err := s.db.Exec(clearSessionTokensQuery, sessionId)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected, nil
+}
+
+const clearUserTokensQuery = "DELETE FROM token WHERE userId = ?"
+
+func (s *SQLStore) DeleteTokensForUser(userId int64) (int64, error) {
+	res, err := s.db.Exec(clearUserTokensQuery, userId)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected, nil
+}
+
+const removeAllExpiredTokens = "DELETE FROM token WHERE validUntil < ?"
+
+func (s *SQLStore) DeleteExpiredTokens(before time.Time) (int64, error) {
+	res, err := s.db.Exec(removeAllExpiredTokens, before)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+const selectUserTokenQuery = "SELECT tokenId, sessionId, userId, validUntil FROM token WHERE userId = ? ORDER BY validUntil DESC"
+
+func (s *SQLStore) GetTokensForUser(userId int64) ([]data.TokenData, error) {
+	rows, err := s.db.Query(selectUserTokenQuery, userId)
+	if err != nil {
+		return []data.TokenData{}, err
+	}
+	defer rows.Close()
+	tokens := make([]data.TokenData, 0)
+	for rows.Next() {
+		var tokenData data.TokenData
+		if err := rows.Scan(&tokenData.TokenId, &tokenData.SessionId, &tokenData.UserId, &tokenData.ValidUntil); err != nil {
+			return []data.TokenData{}, err
+		}
+		tokens = append(tokens, tokenData)
+	}
+	return tokens, nil
+}
+
 // ------------------------------------------------------------
 // Debug printout and functionality
 // ------------------------------------------------------------
 
-func PrintUserTable(tableName string) {
-	rows, err := db.Query("SELECT * FROM shoppers")
+func (s *SQLStore) PrintUserTable(tableName string) {
+	rows, err := s.db.Query("SELECT * FROM shoppers")
 	if err != nil {
 		log.Printf("Failed to print table %s: %s", tableName, err)
 		return
@@ -1623,8 +2227,8 @@ func PrintUserTable(tableName string) {
 
 const printShoppingListTableQuery = "SELECT * FROM shopping_list"
 
-func PrintShoppingListTable() {
-	rows, err := db.Query(printShoppingListTableQuery)
+func (s *SQLStore) PrintShoppingListTable() {
+	rows, err := s.db.Query(printShoppingListTableQuery)
 	if err != nil {
 		return
 	}
@@ -1641,8 +2245,8 @@ func PrintShoppingListTable() {
 
 const printItemTableQuery = "SELECT * FROM items"
 
-func PrintItemTable() {
-	rows, err := db.Query(printItemTableQuery)
+func (s *SQLStore) PrintItemTable() {
+	rows, err := s.db.Query(printItemTableQuery)
 	if err != nil {
 		return
 	}
@@ -1657,10 +2261,10 @@ func PrintItemTable() {
 	log.Print("---------------------------------------")
 }
 
-const printItemToShoppingListMappingTableQuery = "SELECT * FROM items_per_list"
+const printItemToShoppingListMappingTableQuery = "SELECT listId,createdBy,itemId,quantity,checked,COALESCE(addedBy, 0),position FROM items_per_list"
 
-func PrintItemPerListTable() {
-	rows, err := db.Query(printItemToShoppingListMappingTableQuery)
+func (s *SQLStore) PrintItemPerListTable() {
+	rows, err := s.db.Query(printItemToShoppingListMappingTableQuery)
 	if err != nil {
 		return
 	}
@@ -1668,17 +2272,17 @@ func PrintItemPerListTable() {
 	log.Print("------------- Item Table -------------")
 	for rows.Next() {
 		var mapping data.ListItem
-		if err := rows.Scan(&mapping.ListId, &mapping.CreatedBy, &mapping.ItemId, &mapping.Quantity, &mapping.Checked, &mapping.AddedBy); err != nil {
+		if err := rows.Scan(&mapping.ListId, &mapping.CreatedBy, &mapping.ItemId, &mapping.Quantity, &mapping.Checked, &mapping.AddedBy, &mapping.Position); err != nil {
 		}
 		log.Printf("%v", mapping)
 	}
 	log.Print("---------------------------------------")
 }
 
-const printShoppingListSharingTableQuery = "SELECT * FROM shared_list"
+const printShoppingListSharingTableQuery = "SELECT listId,createdBy,sharedWithId,created,permission FROM shared_list"
 
-func PrintSharingTable() {
-	rows, err := db.Query(printShoppingListSharingTableQuery)
+func (s *SQLStore) PrintSharingTable() {
+	rows, err := s.db.Query(printShoppingListSharingTableQuery)
 	if err != nil {
 		return
 	}
@@ -1686,7 +2290,7 @@ func PrintSharingTable() {
 	log.Print("------------- Sharing Table -------------")
 	for rows.Next() {
 		var sharing data.ListShared
-		if err := rows.Scan(&sharing.ListId, &sharing.CreatedBy, &sharing.SharedWithId, &sharing.Created); err != nil {
+		if err := rows.Scan(&sharing.ListId, &sharing.CreatedBy, &sharing.SharedWithId, &sharing.Created, &sharing.Permission); err != nil {
 		}
 		log.Printf("%v", sharing)
 	}
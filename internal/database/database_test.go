@@ -2,24 +2,22 @@ package database
 
 import (
 	"testing"
-
-	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
 )
 
 // ------------------------------------------------------------
 // Connect the test to the database: required
 // ------------------------------------------------------------
 
+// The tests run against the in-memory store so no MySQL instance is required
+var store *MemoryStore
+
 func connectDatabase() {
-	cfg := configuration.Config{
-		Database: "../resources/db.json",
-	}
-	CheckDatabaseOnline(cfg)
+	store = NewMemoryStore()
 }
 
 func TestPrinting(t *testing.T) {
 	connectDatabase()
-	PrintShoppingListTable()
+	store.PrintShoppingListTable()
 }
 
 // ------------------------------------------------------------
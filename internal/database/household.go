@@ -0,0 +1,297 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Households
+// ------------------------------------------------------------
+
+const createHouseholdQuery = "INSERT INTO households (name,createdBy,created) VALUES (?, ?, ?)"
+const addHouseholdMemberQuery = "INSERT INTO household_members (householdId,userId,role,joined) VALUES (?, ?, ?, ?)"
+
+func (s *SQLStore) CreateHousehold(name string, createdBy int64) (data.Household, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return data.Household{}, errors.New("household name is empty")
+	}
+	household := data.Household{Name: name, CreatedBy: createdBy, Created: time.Now().UTC()}
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(createHouseholdQuery, household.Name, household.CreatedBy, household.Created)
+		if err != nil {
+			return err
+		}
+		household.HouseholdId, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(addHouseholdMemberQuery, household.HouseholdId, createdBy, data.HouseholdRoleOwner, household.Created)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to create household '%s' for %d: %s", name, createdBy, err)
+		return data.Household{}, err
+	}
+	return s.GetHousehold(household.HouseholdId)
+}
+
+const getHouseholdQuery = "SELECT id,name,createdBy,created FROM households WHERE id = ?"
+
+func (s *SQLStore) GetHousehold(householdId int64) (data.Household, error) {
+	var household data.Household
+	err := s.db.QueryRow(getHouseholdQuery, householdId).Scan(&household.HouseholdId, &household.Name, &household.CreatedBy, &household.Created)
+	if err != nil {
+		return data.Household{}, err
+	}
+	household.Members, err = s.getHouseholdMembers(householdId)
+	if err != nil {
+		return data.Household{}, err
+	}
+	return household, nil
+}
+
+const getHouseholdMembersQuery = "SELECT hm.userId,s.username,hm.role,hm.joined FROM household_members hm INNER JOIN shoppers s ON hm.userId = s.id WHERE hm.householdId = ? ORDER BY hm.joined, hm.userId"
+
+func (s *SQLStore) getHouseholdMembers(householdId int64) ([]data.HouseholdMember, error) {
+	rows, err := s.db.Query(getHouseholdMembersQuery, householdId)
+	if err != nil {
+		return []data.HouseholdMember{}, err
+	}
+	defer rows.Close()
+	members := make([]data.HouseholdMember, 0)
+	for rows.Next() {
+		var member data.HouseholdMember
+		if err := rows.Scan(&member.UserId, &member.Username, &member.Role, &member.Joined); err != nil {
+			return []data.HouseholdMember{}, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+const getHouseholdIdsForUserQuery = "SELECT householdId FROM household_members WHERE userId = ? ORDER BY householdId"
+
+func (s *SQLStore) GetHouseholdsForUser(userId int64) ([]data.Household, error) {
+	rows, err := s.db.Query(getHouseholdIdsForUserQuery, userId)
+	if err != nil {
+		return []data.Household{}, err
+	}
+	householdIds := make([]int64, 0)
+	for rows.Next() {
+		var householdId int64
+		if err := rows.Scan(&householdId); err != nil {
+			rows.Close()
+			return []data.Household{}, err
+		}
+		householdIds = append(householdIds, householdId)
+	}
+	rows.Close()
+	households := make([]data.Household, 0, len(householdIds))
+	for _, householdId := range householdIds {
+		household, err := s.GetHousehold(householdId)
+		if err != nil {
+			return []data.Household{}, err
+		}
+		households = append(households, household)
+	}
+	return households, nil
+}
+
+const renameHouseholdQuery = "UPDATE households SET name = ? WHERE id = ?"
+
+func (s *SQLStore) RenameHousehold(householdId int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("household name is empty")
+	}
+	_, err := s.db.Exec(renameHouseholdQuery, name, householdId)
+	return err
+}
+
+const deleteHouseholdQuery = "DELETE FROM households WHERE id = ?"
+
+// DeleteHousehold cascades to the members, invitations and all sharing with the household
+func (s *SQLStore) DeleteHousehold(householdId int64) error {
+	_, err := s.db.Exec(deleteHouseholdQuery, householdId)
+	if err != nil {
+		log.Printf("Failed to delete household %d: %s", householdId, err)
+	}
+	return err
+}
+
+const getHouseholdRoleQuery = "SELECT role FROM household_members WHERE householdId = ? AND userId = ?"
+
+func (s *SQLStore) GetHouseholdRole(householdId int64, userId int64) (string, error) {
+	var role string
+	if err := s.db.QueryRow(getHouseholdRoleQuery, householdId, userId).Scan(&role); err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+const setHouseholdRoleQuery = "UPDATE household_members SET role = ? WHERE householdId = ? AND userId = ?"
+
+// SetHouseholdRole changes the role of a member, the owner role cannot be given
+func (s *SQLStore) SetHouseholdRole(householdId int64, userId int64, role string) error {
+	if !data.IsGrantableHouseholdRole(role) {
+		return fmt.Errorf("invalid household role '%s'", role)
+	}
+	if _, err := s.GetHouseholdRole(householdId, userId); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(setHouseholdRoleQuery, role, householdId, userId)
+	return err
+}
+
+const removeHouseholdMemberQuery = "DELETE FROM household_members WHERE householdId = ? AND userId = ?"
+
+func (s *SQLStore) RemoveHouseholdMember(householdId int64, userId int64) error {
+	_, err := s.db.Exec(removeHouseholdMemberQuery, householdId, userId)
+	if err != nil {
+		log.Printf("Failed to remove member %d from household %d: %s", userId, householdId, err)
+	}
+	return err
+}
+
+// ------------------------------------------------------------
+// Household invitations
+// ------------------------------------------------------------
+
+const createHouseholdInvitationQuery = "INSERT INTO household_invitations (householdId,userId,invitedBy,created) VALUES (?, ?, ?, ?)"
+
+func (s *SQLStore) CreateHouseholdInvitation(householdId int64, userId int64, invitedBy int64) (data.HouseholdInvitation, error) {
+	household, err := s.GetHousehold(householdId)
+	if err != nil {
+		return data.HouseholdInvitation{}, errors.New("household does not exist")
+	}
+	if _, err := s.GetUser(userId); err != nil {
+		return data.HouseholdInvitation{}, errors.New("invited user does not exist")
+	}
+	if _, err := s.GetHouseholdRole(householdId, userId); err == nil {
+		return data.HouseholdInvitation{}, errors.New("user is already a member")
+	}
+	invitation := data.HouseholdInvitation{
+		HouseholdId:   householdId,
+		HouseholdName: household.Name,
+		UserId:        userId,
+		InvitedBy:     invitedBy,
+		Created:       time.Now().UTC(),
+	}
+	_, err = s.db.Exec(createHouseholdInvitationQuery, householdId, userId, invitedBy, invitation.Created)
+	if err != nil {
+		log.Printf("Failed to invite %d into household %d: %s", userId, householdId, err)
+		return data.HouseholdInvitation{}, err
+	}
+	return invitation, nil
+}
+
+const getHouseholdInvitationsForUserQuery = "SELECT hi.householdId,h.name,hi.userId,hi.invitedBy,hi.created FROM household_invitations hi INNER JOIN households h ON hi.householdId = h.id WHERE hi.userId = ? ORDER BY hi.householdId"
+
+func (s *SQLStore) GetHouseholdInvitationsForUser(userId int64) ([]data.HouseholdInvitation, error) {
+	rows, err := s.db.Query(getHouseholdInvitationsForUserQuery, userId)
+	if err != nil {
+		return []data.HouseholdInvitation{}, err
+	}
+	defer rows.Close()
+	invitations := make([]data.HouseholdInvitation, 0)
+	for rows.Next() {
+		var invitation data.HouseholdInvitation
+		if err := rows.Scan(&invitation.HouseholdId, &invitation.HouseholdName, &invitation.UserId, &invitation.InvitedBy, &invitation.Created); err != nil {
+			return []data.HouseholdInvitation{}, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+const deleteHouseholdInvitationQuery = "DELETE FROM household_invitations WHERE householdId = ? AND userId = ?"
+
+func (s *SQLStore) AcceptHouseholdInvitation(householdId int64, userId int64) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(deleteHouseholdInvitationQuery, householdId, userId)
+		if err != nil {
+			return err
+		}
+		if removed, err := result.RowsAffected(); err != nil || removed == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.Exec(addHouseholdMemberQuery, householdId, userId, data.HouseholdRoleMember, time.Now().UTC())
+		return err
+	})
+}
+
+func (s *SQLStore) DeleteHouseholdInvitation(householdId int64, userId int64) error {
+	_, err := s.db.Exec(deleteHouseholdInvitationQuery, householdId, userId)
+	return err
+}
+
+// ------------------------------------------------------------
+// Sharing with households
+// ------------------------------------------------------------
+
+const doesListHouseholdShareExistQuery = "SELECT COUNT(*) FROM shared_list_household WHERE listId = ? AND createdBy = ? AND householdId = ?"
+const createListHouseholdShareQuery = "INSERT INTO shared_list_household (listId,createdBy,householdId,permission,created) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)"
+const updateListHouseholdShareQuery = "UPDATE shared_list_household SET permission = ? WHERE listId = ? AND createdBy = ? AND householdId = ?"
+
+// ShareListWithHousehold shares the list or changes the permission of an existing share
+func (s *SQLStore) ShareListWithHousehold(listId int64, createdBy int64, householdId int64, permission string) error {
+	if !data.IsGrantablePermission(permission) {
+		return fmt.Errorf("invalid permission '%s'", permission)
+	}
+	return s.inTransaction(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(doesListHouseholdShareExistQuery, listId, createdBy, householdId).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			_, err := tx.Exec(updateListHouseholdShareQuery, permission, listId, createdBy, householdId)
+			return err
+		}
+		_, err := tx.Exec(createListHouseholdShareQuery, listId, createdBy, householdId, permission)
+		return err
+	})
+}
+
+const getListsSharedWithHouseholdQuery = "SELECT listId, createdBy FROM shared_list_household WHERE householdId = ? ORDER BY createdBy, listId"
+
+func (s *SQLStore) GetListsSharedWithHousehold(householdId int64) ([]data.ListPK, error) {
+	rows, err := s.db.Query(getListsSharedWithHouseholdQuery, householdId)
+	if err != nil {
+		return []data.ListPK{}, err
+	}
+	defer rows.Close()
+	lists := make([]data.ListPK, 0)
+	for rows.Next() {
+		var list data.ListPK
+		if err := rows.Scan(&list.ListID, &list.CreatedBy); err != nil {
+			return []data.ListPK{}, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+const createRecipeHouseholdShareQuery = "INSERT INTO shared_recipe_household (recipeId,createdBy,householdId,created) VALUES (?, ?, ?, CURRENT_TIMESTAMP)"
+
+func (s *SQLStore) ShareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error {
+	_, err := s.db.Exec(createRecipeHouseholdShareQuery, recipeId, createdBy, householdId)
+	if err != nil {
+		log.Printf("Failed to share recipe %d from %d with household %d: %s", recipeId, createdBy, householdId, err)
+	}
+	return err
+}
+
+const deleteRecipeHouseholdShareQuery = "DELETE FROM shared_recipe_household WHERE recipeId = ? AND createdBy = ? AND householdId = ?"
+
+func (s *SQLStore) UnshareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error {
+	_, err := s.db.Exec(deleteRecipeHouseholdShareQuery, recipeId, createdBy, householdId)
+	return err
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkHouseholds runs against every backend, lists and recipes shared with a household
+// must be visible to the current members only
+func checkHouseholds(t *testing.T, householdStore Store) {
+	owner, err := householdStore.CreateUserAccountInDatabase("household owner", "password")
+	assert.Nil(t, err)
+	member, err := householdStore.CreateUserAccountInDatabase("household member", "password")
+	assert.Nil(t, err)
+
+	household, err := householdStore.CreateHousehold(" Family ", owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Family", household.Name)
+	assert.Equal(t, 1, len(household.Members))
+	assert.Equal(t, data.HouseholdRoleOwner, household.Members[0].Role)
+	assert.Equal(t, owner.Username, household.Members[0].Username)
+	_, err = householdStore.CreateHousehold("", owner.OnlineID)
+	assert.NotNil(t, err)
+
+	list := createListBase("household list", owner.OnlineID)
+	assert.Nil(t, householdStore.CreateOrUpdateShoppingList(list))
+	assert.Nil(t, householdStore.ShareListWithHousehold(list.ListId, owner.OnlineID, household.HouseholdId, data.PermissionChecker))
+	assert.NotNil(t, householdStore.ShareListWithHousehold(list.ListId, owner.OnlineID, household.HouseholdId, data.PermissionOwner))
+	recipe := data.Recipe{
+		RecipeId:   1,
+		Name:       "household recipe",
+		CreatedBy:  data.ListCreator{ID: owner.OnlineID},
+		CreatedAt:  time.Now().UTC(),
+		LastUpdate: time.Now().UTC(),
+		Version:    1,
+	}
+	assert.Nil(t, householdStore.CreateRecipe(recipe, nil))
+	assert.Nil(t, householdStore.ShareRecipeWithHousehold(recipe.RecipeId, owner.OnlineID, household.HouseholdId))
+
+	// The owner does not see the own list as shared
+	ownShared, err := householdStore.GetListIdsSharedWithUser(owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ownShared))
+	sharedIds, err := householdStore.GetListIdsSharedWithUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sharedIds))
+
+	// Joining the household gives access
+	invitation, err := householdStore.CreateHouseholdInvitation(household.HouseholdId, member.OnlineID, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Family", invitation.HouseholdName)
+	_, err = householdStore.CreateHouseholdInvitation(household.HouseholdId, owner.OnlineID, owner.OnlineID)
+	assert.NotNil(t, err)
+	invitations, err := householdStore.GetHouseholdInvitationsForUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(invitations))
+	assert.Nil(t, householdStore.AcceptHouseholdInvitation(household.HouseholdId, member.OnlineID))
+	assert.Equal(t, sql.ErrNoRows, householdStore.AcceptHouseholdInvitation(household.HouseholdId, member.OnlineID))
+	invitations, err = householdStore.GetHouseholdInvitationsForUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(invitations))
+
+	role, err := householdStore.GetHouseholdRole(household.HouseholdId, member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.HouseholdRoleMember, role)
+	households, err := householdStore.GetHouseholdsForUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(households))
+	assert.Equal(t, 2, len(households[0].Members))
+
+	sharedIds, err = householdStore.GetListIdsSharedWithUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []data.ListPK{{ListID: list.ListId, CreatedBy: owner.OnlineID}}, sharedIds)
+	assert.Nil(t, householdStore.IsListSharedWithUser(list.ListId, owner.OnlineID, member.OnlineID))
+	users, err := householdStore.GetUsersSharingList(list.ListId, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{member.OnlineID}, users)
+	recipeIds, createdBys, err := householdStore.GetRecipeIdsSharedWithUserId(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{recipe.RecipeId}, recipeIds)
+	assert.Equal(t, []int64{owner.OnlineID}, createdBys)
+	assert.Nil(t, householdStore.IsRecipeSharedWithUser(member.OnlineID, recipe.RecipeId, owner.OnlineID))
+
+	// The highest permission of the direct and the household sharing counts
+	permission, err := householdStore.GetSharePermission(list.ListId, owner.OnlineID, member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionChecker, permission)
+	_, err = householdStore.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, member.OnlineID, data.PermissionViewer)
+	assert.Nil(t, err)
+	permission, err = householdStore.GetSharePermission(list.ListId, owner.OnlineID, member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionChecker, permission)
+	assert.Nil(t, householdStore.ShareListWithHousehold(list.ListId, owner.OnlineID, household.HouseholdId, data.PermissionEditor))
+	permission, err = householdStore.GetSharePermission(list.ListId, owner.OnlineID, member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionEditor, permission)
+	assert.Nil(t, householdStore.DeleteSharingForUser(list.ListId, owner.OnlineID, member.OnlineID))
+
+	assert.Nil(t, householdStore.SetHouseholdRole(household.HouseholdId, member.OnlineID, data.HouseholdRoleAdmin))
+	assert.NotNil(t, householdStore.SetHouseholdRole(household.HouseholdId, member.OnlineID, data.HouseholdRoleOwner))
+	role, err = householdStore.GetHouseholdRole(household.HouseholdId, member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.HouseholdRoleAdmin, role)
+
+	// Leaving the household removes the access again
+	assert.Nil(t, householdStore.RemoveHouseholdMember(household.HouseholdId, member.OnlineID))
+	sharedIds, err = householdStore.GetListIdsSharedWithUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sharedIds))
+	assert.NotNil(t, householdStore.IsListSharedWithUser(list.ListId, owner.OnlineID, member.OnlineID))
+	_, err = householdStore.GetSharePermission(list.ListId, owner.OnlineID, member.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	recipeIds, _, err = householdStore.GetRecipeIdsSharedWithUserId(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(recipeIds))
+	assert.NotNil(t, householdStore.IsRecipeSharedWithUser(member.OnlineID, recipe.RecipeId, owner.OnlineID))
+
+	lists, err := householdStore.GetListsSharedWithHousehold(household.HouseholdId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(lists))
+	assert.Nil(t, householdStore.DeleteSharingOfList(list.ListId, owner.OnlineID))
+	lists, err = householdStore.GetListsSharedWithHousehold(household.HouseholdId)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lists))
+
+	// Deleting the household removes the members and the remaining sharing
+	assert.Nil(t, householdStore.RenameHousehold(household.HouseholdId, "Renamed"))
+	household, err = householdStore.GetHousehold(household.HouseholdId)
+	assert.Nil(t, err)
+	assert.Equal(t, "Renamed", household.Name)
+	assert.Nil(t, householdStore.DeleteHousehold(household.HouseholdId))
+	_, err = householdStore.GetHousehold(household.HouseholdId)
+	assert.NotNil(t, err)
+	_, err = householdStore.GetHouseholdRole(household.HouseholdId, owner.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.NotNil(t, householdStore.ShareRecipeWithHousehold(recipe.RecipeId, owner.OnlineID, household.HouseholdId))
+}
+
+func TestHouseholds(t *testing.T) {
+	connectDatabase()
+	checkHouseholds(t, store)
+}
+
+func TestDeletingOwnerDeletesHousehold(t *testing.T) {
+	connectDatabase()
+	owner, err := createUserDb("household owner")
+	assert.Nil(t, err)
+	member, err := createUserDb("household member")
+	assert.Nil(t, err)
+	household, err := store.CreateHousehold("Family", owner.OnlineID)
+	assert.Nil(t, err)
+	_, err = store.CreateHouseholdInvitation(household.HouseholdId, member.OnlineID, owner.OnlineID)
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.DeleteUserAccount(owner.OnlineID))
+	_, err = store.GetHousehold(household.HouseholdId)
+	assert.NotNil(t, err)
+	invitations, err := store.GetHouseholdInvitationsForUser(member.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(invitations))
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Invite links
+// ------------------------------------------------------------
+
+const createInviteQuery = "INSERT INTO invites (inviteId,type,resourceId,createdBy,invitedBy,permission,maxUses,uses,validUntil,created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func (s *SQLStore) CreateInvite(invite data.Invite) error {
+	_, err := s.db.Exec(createInviteQuery, invite.InviteId, invite.Type, invite.ResourceId, invite.CreatedBy, invite.InvitedBy,
+		invite.Permission, invite.MaxUses, invite.Uses, invite.ValidUntil, invite.Created)
+	if err != nil {
+		log.Printf("Failed to create invite for %s %d: %s", invite.Type, invite.ResourceId, err)
+	}
+	return err
+}
+
+const inviteColumns = "inviteId,type,resourceId,createdBy,invitedBy,permission,maxUses,uses,validUntil,created"
+
+func scanInvite(row interface{ Scan(dest ...any) error }) (data.Invite, error) {
+	var invite data.Invite
+	err := row.Scan(&invite.InviteId, &invite.Type, &invite.ResourceId, &invite.CreatedBy, &invite.InvitedBy,
+		&invite.Permission, &invite.MaxUses, &invite.Uses, &invite.ValidUntil, &invite.Created)
+	return invite, err
+}
+
+const getInviteQuery = "SELECT " + inviteColumns + " FROM invites WHERE inviteId = ?"
+
+func (s *SQLStore) GetInvite(inviteId string) (data.Invite, error) {
+	return scanInvite(s.db.QueryRow(getInviteQuery, inviteId))
+}
+
+const getPendingInvitesQuery = "SELECT " + inviteColumns + " FROM invites WHERE invitedBy = ? AND validUntil > ? AND (maxUses = 0 OR uses < maxUses) ORDER BY created, inviteId"
+
+func (s *SQLStore) GetPendingInvites(invitedBy int64, now time.Time) ([]data.Invite, error) {
+	rows, err := s.db.Query(getPendingInvitesQuery, invitedBy, now)
+	if err != nil {
+		return []data.Invite{}, err
+	}
+	defer rows.Close()
+	invites := make([]data.Invite, 0)
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return []data.Invite{}, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// ErrInviterNotAllowed is returned by RedeemInvite once the inviting user lost the permission to share
+var ErrInviterNotAllowed = errors.New("inviting user may no longer share the resource")
+
+// The condition is part of the update, so that concurrent redemptions cannot exceed the uses
+const useInviteQuery = "UPDATE invites SET uses = uses + 1 WHERE inviteId = ? AND validUntil > ? AND (maxUses = 0 OR uses < maxUses)"
+
+// RedeemInvite checks the inviting user, counts the use and grants the access in the same
+// transaction, so that a failed grant does not use up the invite
+func (s *SQLStore) RedeemInvite(invite data.Invite, userId int64, now time.Time) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec(useInviteQuery, invite.InviteId, now)
+		if err != nil {
+			return err
+		}
+		if used, err := result.RowsAffected(); err != nil || used == 0 {
+			return sql.ErrNoRows
+		}
+		allowed, err := inviterMayShare(tx, invite)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrInviterNotAllowed
+		}
+		switch invite.Type {
+		case data.InviteTypeList:
+			return redeemListInvite(tx, invite, userId)
+		case data.InviteTypeRecipe:
+			return redeemRecipeInvite(tx, invite, userId)
+		case data.InviteTypeHousehold:
+			return redeemHouseholdInvite(tx, invite, userId, now)
+		}
+		return fmt.Errorf("unknown invite type '%s'", invite.Type)
+	})
+}
+
+// inviterMayShare repeats the permission check of the invite creation
+func inviterMayShare(q queryer, invite data.Invite) (bool, error) {
+	switch invite.Type {
+	case data.InviteTypeList:
+		if invite.InvitedBy == invite.CreatedBy {
+			return true, nil
+		}
+		permission, err := getSharePermission(q, invite.ResourceId, invite.CreatedBy, invite.InvitedBy)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return data.PermissionAllows(permission, data.PermissionCoOwner), nil
+	case data.InviteTypeRecipe:
+		return invite.InvitedBy == invite.CreatedBy, nil
+	case data.InviteTypeHousehold:
+		var role string
+		err := q.QueryRow(getHouseholdRoleQuery, invite.ResourceId, invite.InvitedBy).Scan(&role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return data.HouseholdRoleAllows(role, data.HouseholdRoleAdmin), nil
+	}
+	return false, nil
+}
+
+// redeemListInvite accepts the share, never lowering an existing permission
+func redeemListInvite(tx queryer, invite data.Invite, userId int64) error {
+	permission := invite.Permission
+	var status string
+	err := tx.QueryRow(getShareStatusQuery, invite.ResourceId, invite.CreatedBy, userId).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.Exec(createShoppingListSharingForUserQuery, invite.ResourceId, invite.CreatedBy, userId, permission, data.ShareStatusAccepted)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	var existing string
+	err = tx.QueryRow(getSharePermissionQuery, invite.ResourceId, invite.CreatedBy, userId).Scan(&existing)
+	if err == nil {
+		permission = data.HigherPermission(existing, permission)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, err = tx.Exec(updateSharePermissionQuery, permission, data.ShareStatusAccepted, invite.ResourceId, invite.CreatedBy, userId)
+	return err
+}
+
+const countRecipeSharedWithUserQuery = "SELECT COUNT(*) FROM shared_recipe WHERE recipeId = ? AND createdBy = ? AND sharedWith = ?"
+
+func redeemRecipeInvite(tx queryer, invite data.Invite, userId int64) error {
+	var shares int
+	if err := tx.QueryRow(countRecipeSharedWithUserQuery, invite.ResourceId, invite.CreatedBy, userId).Scan(&shares); err != nil {
+		return err
+	}
+	if shares > 0 {
+		return nil
+	}
+	_, err := tx.Exec(createRecipeSharingQuery, invite.ResourceId, invite.CreatedBy, userId)
+	return err
+}
+
+// redeemHouseholdInvite accepts an existing invitation of the user as well
+func redeemHouseholdInvite(tx queryer, invite data.Invite, userId int64, now time.Time) error {
+	var role string
+	err := tx.QueryRow(getHouseholdRoleQuery, invite.ResourceId, userId).Scan(&role)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if _, err := tx.Exec(deleteHouseholdInvitationQuery, invite.ResourceId, userId); err != nil {
+		return err
+	}
+	_, err = tx.Exec(addHouseholdMemberQuery, invite.ResourceId, userId, data.HouseholdRoleMember, now)
+	return err
+}
+
+const deleteInviteQuery = "DELETE FROM invites WHERE inviteId = ?"
+
+func (s *SQLStore) DeleteInvite(inviteId string) error {
+	_, err := s.db.Exec(deleteInviteQuery, inviteId)
+	return err
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func createInviteBase(inviteId string, invitedBy int64, maxUses int, validUntil time.Time) data.Invite {
+	return data.Invite{
+		InviteId:   inviteId,
+		Type:       data.InviteTypeList,
+		ResourceId: 1,
+		CreatedBy:  invitedBy,
+		InvitedBy:  invitedBy,
+		Permission: data.PermissionViewer,
+		MaxUses:    maxUses,
+		ValidUntil: validUntil,
+		Created:    time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// checkInvites runs against every backend, invites can only be used until
+// they are expired, used up or revoked
+func checkInvites(t *testing.T, inviteStore Store) {
+	user, err := inviteStore.CreateUserAccountInDatabase("inviting user", "password")
+	assert.Nil(t, err)
+	redeeming, err := inviteStore.CreateUserAccountInDatabase("redeeming user", "password")
+	assert.Nil(t, err)
+	assert.Nil(t, inviteStore.CreateOrUpdateShoppingList(createListBase("invited list", user.OnlineID)))
+	now := time.Now().UTC()
+	validUntil := now.Add(time.Hour).Truncate(time.Second)
+
+	single := createInviteBase("single", user.OnlineID, 1, validUntil)
+	assert.Nil(t, inviteStore.CreateInvite(single))
+	assert.NotNil(t, inviteStore.CreateInvite(single))
+	assert.Nil(t, inviteStore.CreateInvite(createInviteBase("unlimited", user.OnlineID, 0, validUntil)))
+	assert.Nil(t, inviteStore.CreateInvite(createInviteBase("expired", user.OnlineID, 0, now.Add(-time.Hour))))
+	assert.NotNil(t, inviteStore.CreateInvite(createInviteBase("unknown user", user.OnlineID+100, 0, validUntil)))
+
+	stored, err := inviteStore.GetInvite("single")
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, stored.Permission)
+	assert.Equal(t, validUntil.Unix(), stored.ValidUntil.Unix())
+	pending, err := inviteStore.GetPendingInvites(user.OnlineID, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pending))
+
+	// Single use invites are gone after the first use
+	assert.Nil(t, inviteStore.RedeemInvite(single, redeeming.OnlineID, now))
+	permission, err := inviteStore.GetSharePermission(1, user.OnlineID, redeeming.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+	assert.Equal(t, sql.ErrNoRows, inviteStore.RedeemInvite(single, redeeming.OnlineID, now))
+	assert.Equal(t, sql.ErrNoRows, inviteStore.RedeemInvite(createInviteBase("expired", user.OnlineID, 0, now), redeeming.OnlineID, now))
+	unlimited := createInviteBase("unlimited", user.OnlineID, 0, validUntil)
+	for range 3 {
+		assert.Nil(t, inviteStore.RedeemInvite(unlimited, redeeming.OnlineID, now))
+	}
+	// A failed grant does not use up the invite
+	assert.NotNil(t, inviteStore.RedeemInvite(unlimited, redeeming.OnlineID+100, now))
+	// Invites stop working once the inviting user may no longer share
+	editor, err := inviteStore.CreateUserAccountInDatabase("inviting editor", "password")
+	assert.Nil(t, err)
+	_, err = inviteStore.CreateOrUpdateSharedList(1, user.OnlineID, editor.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+	demoted := createInviteBase("demoted", user.OnlineID, 0, validUntil)
+	demoted.InvitedBy = editor.OnlineID
+	assert.Nil(t, inviteStore.CreateInvite(demoted))
+	assert.Equal(t, ErrInviterNotAllowed, inviteStore.RedeemInvite(demoted, redeeming.OnlineID, now))
+	stored, err = inviteStore.GetInvite("demoted")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stored.Uses)
+
+	stored, err = inviteStore.GetInvite("unlimited")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stored.Uses)
+	pending, err = inviteStore.GetPendingInvites(user.OnlineID, now)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(pending)) {
+		assert.Equal(t, "unlimited", pending[0].InviteId)
+	}
+
+	assert.Nil(t, inviteStore.DeleteInvite("unlimited"))
+	_, err = inviteStore.GetInvite("unlimited")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, inviteStore.RedeemInvite(unlimited, redeeming.OnlineID, now))
+
+	// Invites are removed together with the inviting user
+	assert.Nil(t, inviteStore.DeleteUserAccount(user.OnlineID))
+	_, err = inviteStore.GetInvite("single")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestInvites(t *testing.T) {
+	connectDatabase()
+	checkInvites(t, store)
+}
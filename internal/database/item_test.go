@@ -19,24 +19,24 @@ func TestGetAllItems(t *testing.T) {
 		Name:   "New Item",
 		Icon:   "Abc",
 	}
-	_, err := InsertItemStruct(item)
+	_, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item for testing")
 		t.FailNow()
 	}
-	items, err := GetAllItems()
+	items, err := store.GetAllItems()
 	if err != nil {
 		log.Print("Failed to get all items from database")
 		t.FailNow()
 	}
 	if len(items) != 1 {
 		log.Printf("The number of all items (%d) does not match the expected (1)!", len(items))
-		ResetItemTable()
+		store.ResetItemTable()
 		t.FailNow()
 	}
 	log.Printf("All items: %v", items)
 	log.Print("GetAllItems successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
 
 func TestGetAllItemsFromName(t *testing.T) {
@@ -46,48 +46,52 @@ func TestGetAllItemsFromName(t *testing.T) {
 		Name:   "New Item A",
 		Icon:   "Abc",
 	}
-	_, err := InsertItemStruct(item)
+	_, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item for testing")
 		t.FailNow()
 	}
-	PrintItemTable()
-	items, err := GetAllItemsFromName(strings.Split(item.Name, " ")[0])
+	store.PrintItemTable()
+	items, err := store.GetAllItemsFromName(strings.Split(item.Name, " ")[0])
 	if err != nil {
 		log.Print("Failed to get items from database")
 		t.FailNow()
 	}
 	if len(items) != 1 {
 		log.Printf("The number of all items (%d) does not match the expected (1)!", len(items))
-		ResetItemTable()
+		store.ResetItemTable()
 		t.FailNow()
 	}
 	log.Printf("All items: %v", items)
-	items, err = GetAllItemsFromName("Not contained")
+	items, err = store.GetAllItemsFromName("Not contained")
 	if err != nil {
 		log.Print("Failed to get items from database")
 		t.FailNow()
 	}
 	if len(items) != 0 {
 		log.Printf("The number of all items (%d) does not match the expected (0)!", len(items))
-		ResetItemTable()
+		store.ResetItemTable()
 		t.FailNow()
 	}
 	log.Printf("All items: %v", items)
 	// Testing a SQL injection attack
 	item.Name = "') > 0; INSERT INTO items (name, icon) VALUES ('abc', 'abc'); --"
-	items, err = GetAllItemsFromName(item.Name)
-	if err == nil {
-		log.Print("Executed injection attack!")
+	items, err = store.GetAllItemsFromName(item.Name)
+	if err != nil {
+		log.Printf("Failed to get items from database: %s", err)
 		t.FailNow()
 	}
 	if len(items) != 0 {
 		log.Print("Got items for query")
 		t.FailNow()
 	}
-	PrintItemTable()
+	if injected, _ := store.GetAllItemsFromName("abc"); len(injected) != 0 {
+		log.Print("Executed injection attack!")
+		t.FailNow()
+	}
+	store.PrintItemTable()
 	log.Print("GetAllItems successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
 
 func TestInsertItem(t *testing.T) {
@@ -97,17 +101,17 @@ func TestInsertItem(t *testing.T) {
 		Name:   "New Item",
 		Icon:   "Abc",
 	}
-	created, err := InsertItemStruct(item)
+	created, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item: %s", err)
 		t.FailNow()
 	}
 	if created.ItemId == 0 {
-		log.Printf("Item ID (%d) not correct but zero", created)
+		log.Printf("Item ID (%d) not correct but zero", created.ItemId)
 		t.FailNow()
 	}
-	PrintItemTable()
-	getItem, err := GetItem(created.ItemId)
+	store.PrintItemTable()
+	getItem, err := store.GetItem(created.ItemId)
 	if err != nil {
 		log.Printf("Failed to get new item")
 		t.FailNow()
@@ -122,7 +126,7 @@ func TestInsertItem(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("InsertItem successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
 
 func TestModifyItemName(t *testing.T) {
@@ -132,12 +136,12 @@ func TestModifyItemName(t *testing.T) {
 		Name:   "Old Item",
 		Icon:   "Abc",
 	}
-	created, err := InsertItemStruct(item)
+	created, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item")
 		t.FailNow()
 	}
-	getItem, err := GetItem(created.ItemId)
+	getItem, err := store.GetItem(created.ItemId)
 	if err != nil {
 		log.Printf("Failed to get new item")
 		t.FailNow()
@@ -152,7 +156,7 @@ func TestModifyItemName(t *testing.T) {
 		t.FailNow()
 	}
 	updatedName := "New Item"
-	newItem, err := ModifyItem(created.ItemId, updatedName, created.Icon)
+	newItem, err := store.ModifyItem(created.ItemId, updatedName, created.Icon)
 	if err != nil {
 		log.Printf("Failed to modify item name: %s", err)
 		t.FailNow()
@@ -161,9 +165,9 @@ func TestModifyItemName(t *testing.T) {
 		log.Print("Name information not correctly stored")
 		t.FailNow()
 	}
-	PrintItemTable()
+	store.PrintItemTable()
 	log.Print("ModifyItem successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
 
 func TestModifyItemIcon(t *testing.T) {
@@ -173,12 +177,12 @@ func TestModifyItemIcon(t *testing.T) {
 		Name:   "Old Item",
 		Icon:   "Abc",
 	}
-	created, err := InsertItemStruct(item)
+	created, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item")
 		t.FailNow()
 	}
-	getItem, err := GetItem(created.ItemId)
+	getItem, err := store.GetItem(created.ItemId)
 	if err != nil {
 		log.Printf("Failed to get new item")
 		t.FailNow()
@@ -191,7 +195,7 @@ func TestModifyItemIcon(t *testing.T) {
 		log.Print("Information cannot be retrieved correctly")
 		t.FailNow()
 	}
-	newItem, err := ModifyItem(created.ItemId, created.Name, "New Icon")
+	newItem, err := store.ModifyItem(created.ItemId, created.Name, "New Icon")
 	if err != nil {
 		log.Printf("Failed to modify item icon: %s", err)
 		t.FailNow()
@@ -200,9 +204,9 @@ func TestModifyItemIcon(t *testing.T) {
 		log.Print("Icon information not correctly stored")
 		t.FailNow()
 	}
-	PrintItemTable()
+	store.PrintItemTable()
 	log.Print("ModifyItemIcon successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
 
 func TestDeleteItem(t *testing.T) {
@@ -212,13 +216,13 @@ func TestDeleteItem(t *testing.T) {
 		Name:   "New Item",
 		Icon:   "Abc",
 	}
-	created, err := InsertItemStruct(item)
+	created, err := store.InsertItemStruct(item)
 	if err != nil {
 		log.Printf("Failed to create new item")
 		t.FailNow()
 	}
-	PrintItemTable()
-	getItem, err := GetItem(created.ItemId)
+	store.PrintItemTable()
+	getItem, err := store.GetItem(created.ItemId)
 	if err != nil {
 		log.Printf("Failed to get new item")
 		t.FailNow()
@@ -231,17 +235,17 @@ func TestDeleteItem(t *testing.T) {
 		log.Print("Information cannot be retrieved correctly")
 		t.FailNow()
 	}
-	err = DeleteItem(created.ItemId)
+	err = store.DeleteItem(created.ItemId)
 	if err != nil {
 		log.Printf("Failed to delete item: %s", err)
 		t.FailNow()
 	}
-	getItem, err = GetItem(created.ItemId)
+	getItem, err = store.GetItem(created.ItemId)
 	if err == nil || getItem.ItemId != 0 {
 		log.Printf("Can still retrieve item!")
 		t.FailNow()
 	}
-	PrintItemTable()
+	store.PrintItemTable()
 	log.Print("DeleteItem successfully completed")
-	ResetItemTable()
+	store.ResetItemTable()
 }
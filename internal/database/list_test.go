@@ -5,6 +5,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
@@ -13,7 +15,7 @@ import (
 // ------------------------------------------------------------
 
 func createUserDb(name string) (data.User, error) {
-	user, err := CreateUserAccountInDatabase("test user", "123")
+	user, err := store.CreateUserAccountInDatabase(name, "123")
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		return data.User{}, err
@@ -46,12 +48,12 @@ func TestCreatingList(t *testing.T) {
 	}
 	list := createListBase("list base", user.OnlineID)
 	list.CreatedBy.ID = user.OnlineID
-	err = CreateOrUpdateShoppingList(list)
+	err = store.CreateOrUpdateShoppingList(list)
 	if err != nil {
 		log.Printf("Failed to create new list: %s", err)
 		t.FailNow()
 	}
-	getList, err := GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	getList, err := store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get newly created shopping list: %s", err)
 		t.FailNow()
@@ -60,10 +62,10 @@ func TestCreatingList(t *testing.T) {
 		log.Printf("IDs do not match")
 		t.FailNow()
 	}
-	PrintShoppingListTable()
+	store.PrintShoppingListTable()
 	log.Print("TestCreatingList successfully completed")
-	DropShoppingListTable()
-	DropUserTable()
+	store.DropShoppingListTable()
+	store.DropUserTable()
 }
 
 func TestUpdatingList(t *testing.T) {
@@ -76,12 +78,13 @@ func TestUpdatingList(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		list := createListBase("list base 1", user.OnlineID)
 		list.CreatedBy.ID = user.OnlineID
-		err = CreateOrUpdateShoppingList(list)
+		list.Version = int64(i)
+		err = store.CreateOrUpdateShoppingList(list)
 		if err != nil {
 			log.Printf("Failed to create new list: %s", err)
 			t.FailNow()
 		}
-		getList, err := GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+		getList, err := store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 		if err != nil {
 			log.Printf("Failed to get newly created shopping list: %s", err)
 			t.FailNow()
@@ -91,7 +94,7 @@ func TestUpdatingList(t *testing.T) {
 			t.FailNow()
 		}
 	}
-	lists, err := GetRawShoppingListsForUserId(user.OnlineID)
+	lists, err := store.GetRawShoppingListsForUserId(user.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get lists for user: %s", err)
 		t.FailNow()
@@ -101,8 +104,8 @@ func TestUpdatingList(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("TestUpdatingList successfully completed")
-	DropShoppingListTable()
-	DropUserTable()
+	store.DropShoppingListTable()
+	store.DropUserTable()
 }
 
 func TestModifyListName(t *testing.T) {
@@ -113,12 +116,12 @@ func TestModifyListName(t *testing.T) {
 		t.FailNow()
 	}
 	list := createListBase("base list", user.OnlineID)
-	err = CreateOrUpdateShoppingList(list)
+	err = store.CreateOrUpdateShoppingList(list)
 	if err != nil {
 		log.Printf("Failed to create new list: %s", err)
 		t.FailNow()
 	}
-	getList, err := GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	getList, err := store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get newly created shopping list")
 		t.FailNow()
@@ -131,12 +134,13 @@ func TestModifyListName(t *testing.T) {
 	oldName := getList.Title
 	updatedName := "New List Name"
 	updatedList.Title = updatedName
-	err = CreateOrUpdateShoppingList(updatedList)
+	updatedList.Version = list.Version + 1
+	err = store.CreateOrUpdateShoppingList(updatedList)
 	if err != nil {
 		log.Printf("Failed to modify shopping list name: %s", err)
 		t.FailNow()
 	}
-	getList, err = GetRawShoppingListWithId(updatedList.ListId, updatedList.CreatedBy.ID)
+	getList, err = store.GetRawShoppingListWithId(updatedList.ListId, updatedList.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get list: %s", err)
 		t.FailNow()
@@ -150,8 +154,8 @@ func TestModifyListName(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("TestModifyListName successfully completed")
-	DropShoppingListTable()
-	DropUserTable()
+	store.DropShoppingListTable()
+	store.DropUserTable()
 }
 
 func TestDeletingList(t *testing.T) {
@@ -162,13 +166,13 @@ func TestDeletingList(t *testing.T) {
 		t.FailNow()
 	}
 	list := createListBase("list base", user.OnlineID)
-	err = CreateOrUpdateShoppingList(list)
+	err = store.CreateOrUpdateShoppingList(list)
 	if err != nil {
 		log.Printf("Failed to create new list: %s", err)
 		t.FailNow()
 	}
-	PrintShoppingListTable()
-	getList, err := GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	store.PrintShoppingListTable()
+	getList, err := store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get newly created shopping list")
 		t.FailNow()
@@ -177,17 +181,159 @@ func TestDeletingList(t *testing.T) {
 		log.Printf("IDs do not match")
 		t.FailNow()
 	}
-	err = DeleteShoppingList(list.ListId, user.OnlineID)
+	err = store.DeleteShoppingList(list.ListId, user.OnlineID)
 	if err != nil {
 		log.Printf("Failed to delete shopping list: %s", err)
 		t.FailNow()
 	}
-	getList, err = GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	getList, err = store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	if err == nil || getList.ListId == list.ListId {
 		log.Printf("Can get delete list!")
 		t.FailNow()
 	}
-	PrintShoppingListTable()
+	store.PrintShoppingListTable()
 	log.Print("TestDeletingList successfully completed")
-	DropShoppingListTable()
+	store.DropShoppingListTable()
+}
+
+// checkListWriteIsAtomic runs against every store implementation
+func checkListWriteIsAtomic(t *testing.T, listStore Store, user data.User) {
+	list := createListBase("atomic list", user.OnlineID)
+	list.Items = []data.ItemWire{
+		{Name: "Milk", Icon: "ic_milk", Quantity: 1, AddedBy: user.OnlineID},
+	}
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(list))
+
+	list.Version++
+	list.Title = "must not be stored"
+	list.Items = []data.ItemWire{
+		{Name: "Bread", Icon: "ic_bread", Quantity: 1, AddedBy: user.OnlineID},
+		{Name: "Butter", Icon: "ic_butter", Quantity: 0, AddedBy: user.OnlineID},
+		{Name: "Cheese", Icon: "ic_cheese", Quantity: 1, AddedBy: 424242},
+	}
+	err := listStore.CreateOrUpdateShoppingList(list)
+	var itemsErr *ItemsError
+	if !assert.ErrorAs(t, err, &itemsErr) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2, len(itemsErr.Failures))
+	assert.Equal(t, 1, itemsErr.Failures[0].Index)
+	assert.Equal(t, "Butter", itemsErr.Failures[0].Name)
+	assert.Equal(t, 2, itemsErr.Failures[1].Index)
+	assert.Equal(t, "Cheese", itemsErr.Failures[1].Name)
+
+	// Neither the list nor the items must have changed
+	stored, err := listStore.GetRawShoppingListWithId(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Create List Name", stored.Title)
+	assert.Equal(t, list.Version-1, stored.Version)
+	items, err := listStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "Milk", items[0].Name)
+	bread, err := listStore.GetAllItemsFromName("Bread")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bread))
+
+	// The same version can be written once the items are correct
+	list.Items = list.Items[:1]
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(list))
+	items, err = listStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "Bread", items[0].Name)
+}
+
+func TestListWriteIsAtomic(t *testing.T) {
+	connectDatabase()
+	user, err := createUserDb("atomic user")
+	if err != nil {
+		t.FailNow()
+	}
+	checkListWriteIsAtomic(t, store, user)
+}
+
+// checkListMerge runs against every store implementation
+func checkListMerge(t *testing.T, listStore Store, user data.User) {
+	created := time.Now().UTC().Add(-time.Hour)
+	list := createListBase("merged list", user.OnlineID)
+	list.Items = []data.ItemWire{
+		{Name: "Milk", Quantity: 1, AddedBy: user.OnlineID, Updated: &data.ItemUpdated{Quantity: created, Checked: created}},
+	}
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(list))
+
+	// Another client checks the milk in the meantime
+	other := list
+	other.Version++
+	other.Items = []data.ItemWire{{Name: "Milk", Quantity: 1, Checked: true, AddedBy: user.OnlineID}}
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(other))
+
+	outdated := list
+	outdated.Version++
+	outdated.Items = []data.ItemWire{
+		{Name: "Milk", Quantity: 3, AddedBy: user.OnlineID, Updated: &data.ItemUpdated{Quantity: time.Now().UTC().Add(time.Minute), Checked: created}},
+		{Name: "Bread", Quantity: 1, AddedBy: user.OnlineID},
+	}
+	assert.NotNil(t, listStore.CreateOrUpdateShoppingList(outdated))
+	result, err := listStore.MergeShoppingList(outdated)
+	assert.Nil(t, err)
+	assert.Equal(t, other.Version+1, result.List.Version)
+	assert.Equal(t, 2, len(result.List.Items))
+	assert.Equal(t, int64(3), result.List.Items[0].Quantity)
+	assert.True(t, result.List.Items[0].Checked)
+	assert.Equal(t, "Bread", result.List.Items[1].Name)
+	assert.Equal(t, 2, len(result.Conflicts))
+
+	items, err := listStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, result.List.Items, items)
+
+	// Items removed by the client are deleted even though its version is outdated
+	removing := outdated
+	removing.LastUpdated = time.Now().UTC()
+	removing.Items = []data.ItemWire{{Name: "Milk", Quantity: 3, Checked: true, AddedBy: user.OnlineID}}
+	removing.RemovedItems = []string{"Bread"}
+	result, err = listStore.MergeShoppingList(removing)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, 1, len(result.List.Items))
+	assert.Equal(t, "Milk", result.List.Items[0].Name)
+	assert.Nil(t, result.List.RemovedItems)
+
+	// Removing the last item leaves an empty list
+	last := createListBase("last item", user.OnlineID)
+	last.ListId = 3
+	last.Items = []data.ItemWire{{Name: "Salt", Quantity: 1, AddedBy: user.OnlineID, Updated: &data.ItemUpdated{Quantity: created, Checked: created}}}
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(last))
+	renamed := last
+	renamed.Version++
+	renamed.Title = "renamed"
+	assert.Nil(t, listStore.CreateOrUpdateShoppingList(renamed))
+	emptied := renamed
+	emptied.LastUpdated = time.Now().UTC()
+	emptied.Items = []data.ItemWire{}
+	emptied.RemovedItems = []string{"Salt"}
+	result, err = listStore.MergeShoppingList(emptied)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Conflicts)
+	assert.Empty(t, result.List.Items)
+	items, err = listStore.GetItemsInList(last.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+
+	// Unknown lists are simply created
+	unknown := createListBase("unknown list", user.OnlineID)
+	unknown.ListId = 2
+	result, err = listStore.MergeShoppingList(unknown)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Conflicts)
+}
+
+func TestListMerge(t *testing.T) {
+	connectDatabase()
+	user, err := createUserDb("merge user")
+	if err != nil {
+		t.FailNow()
+	}
+	checkListMerge(t, store, user)
 }
@@ -4,6 +4,8 @@ import (
 	"log"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
@@ -22,10 +24,34 @@ func createDefaultMapping() data.ListItem {
 	}
 }
 
+// createMappingDependencies creates the user, list and item a mapping refers to
+func createMappingDependencies(t *testing.T) data.ListItem {
+	user, err := createUserDb("mapping user")
+	if err != nil {
+		t.FailNow()
+	}
+	list := createListBase("mapping list", user.OnlineID)
+	if err := store.CreateOrUpdateShoppingList(list); err != nil {
+		log.Printf("Failed to create list for mapping: %s", err)
+		t.FailNow()
+	}
+	item, err := store.InsertItem("mapping item", "icon")
+	if err != nil {
+		log.Printf("Failed to create item for mapping: %s", err)
+		t.FailNow()
+	}
+	mapping := createDefaultMapping()
+	mapping.ListId = list.ListId
+	mapping.CreatedBy = user.OnlineID
+	mapping.AddedBy = user.OnlineID
+	mapping.ItemId = item.ItemId
+	return mapping
+}
+
 func TestInsertMapping(t *testing.T) {
 	connectDatabase()
-	mapping := createDefaultMapping()
-	created, err := InsertOrUpdateItemInList(mapping)
+	mapping := createMappingDependencies(t)
+	created, err := store.InsertOrUpdateItemInList(mapping)
 	if err != nil {
 		log.Printf("Failed to insert mapping into database: %s", err)
 		t.FailNow()
@@ -34,7 +60,7 @@ func TestInsertMapping(t *testing.T) {
 		log.Print("Mapping not correctly inserted")
 		t.FailNow()
 	}
-	getMapping, err := GetItemsInList(mapping.ListId, 0)
+	getMapping, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("The mapping or item for the mapping cannot be found")
 		t.FailNow()
@@ -48,16 +74,16 @@ func TestInsertMapping(t *testing.T) {
 		log.Printf("Wrongly inserted. Attributes do not match")
 		t.FailNow()
 	}
-	PrintItemPerListTable()
+	store.PrintItemPerListTable()
 	log.Print("InsertMapping successfully completed")
-	ResetItemPerListTable()
+	store.ResetItemPerListTable()
 }
 
 func TestInsertDoubleMapping(t *testing.T) {
 	connectDatabase()
-	mapping := createDefaultMapping()
+	mapping := createMappingDependencies(t)
 	for i := 0; i < 3; i++ {
-		created, err := InsertOrUpdateItemInList(mapping)
+		created, err := store.InsertOrUpdateItemInList(mapping)
 		if err != nil {
 			log.Printf("Failed to insert mapping into database: %s", err)
 			t.FailNow()
@@ -66,7 +92,7 @@ func TestInsertDoubleMapping(t *testing.T) {
 			log.Print("Mapping not correctly inserted")
 			t.FailNow()
 		}
-		getMapping, err := GetItemsInList(mapping.ListId, created.ItemId)
+		getMapping, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 		if err != nil {
 			log.Printf("The mapping or item for the mapping cannot be found")
 			t.FailNow()
@@ -81,7 +107,7 @@ func TestInsertDoubleMapping(t *testing.T) {
 			t.FailNow()
 		}
 	}
-	allMappings, err := GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	allMappings, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("Failed to get items but there should be 1: %s", err)
 		t.FailNow()
@@ -90,15 +116,15 @@ func TestInsertDoubleMapping(t *testing.T) {
 		log.Printf("Found more than a single mapping which is incorrect!")
 		t.FailNow()
 	}
-	PrintItemPerListTable()
+	store.PrintItemPerListTable()
 	log.Print("InsertMapping successfully completed")
-	ResetItemPerListTable()
+	store.ResetItemPerListTable()
 }
 
 func TestUpdatingMapping(t *testing.T) {
 	connectDatabase()
-	mapping := createDefaultMapping()
-	created, err := InsertOrUpdateItemInList(mapping)
+	mapping := createMappingDependencies(t)
+	created, err := store.InsertOrUpdateItemInList(mapping)
 	if err != nil {
 		log.Printf("Failed to insert mapping into database: %s", err)
 		t.FailNow()
@@ -107,7 +133,7 @@ func TestUpdatingMapping(t *testing.T) {
 		log.Print("Mapping not correctly inserted")
 		t.FailNow()
 	}
-	getMapping, err := GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	getMapping, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("The mapping or item for the mapping cannot be found")
 		t.FailNow()
@@ -124,13 +150,17 @@ func TestUpdatingMapping(t *testing.T) {
 	// Update the mapping
 	mapping.Checked = !mapping.Checked
 	mapping.Quantity = mapping.Quantity + 1
-	mapping.AddedBy = 12345
-	_, err = InsertOrUpdateItemInList(mapping)
+	otherUser, err := createUserDb("other mapping user")
+	if err != nil {
+		t.FailNow()
+	}
+	mapping.AddedBy = otherUser.OnlineID
+	_, err = store.InsertOrUpdateItemInList(mapping)
 	if err != nil {
 		log.Printf("Failed to update mapping into database: %s", err)
 		t.FailNow()
 	}
-	updatedMapping, err := GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	updatedMapping, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("The mapping or item for the mapping cannot be found")
 		t.FailNow()
@@ -144,15 +174,15 @@ func TestUpdatingMapping(t *testing.T) {
 		log.Printf("Wrongly updated. Attributes do not match")
 		t.FailNow()
 	}
-	PrintItemPerListTable()
+	store.PrintItemPerListTable()
 	log.Print("InsertMapping successfully completed")
-	ResetItemPerListTable()
+	store.ResetItemPerListTable()
 }
 
 func TestDeleteMapping(t *testing.T) {
 	connectDatabase()
-	mapping := createDefaultMapping()
-	created, err := InsertOrUpdateItemInList(mapping)
+	mapping := createMappingDependencies(t)
+	created, err := store.InsertOrUpdateItemInList(mapping)
 	if err != nil {
 		log.Printf("Failed to insert mapping into database: %s", err)
 		t.FailNow()
@@ -161,7 +191,7 @@ func TestDeleteMapping(t *testing.T) {
 		log.Print("Mapping not correctly inserted")
 		t.FailNow()
 	}
-	getMapping, err := GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	getMapping, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("The mapping or item for the mapping cannot be found")
 		t.FailNow()
@@ -170,13 +200,13 @@ func TestDeleteMapping(t *testing.T) {
 		log.Printf("The list is longer than expected")
 		t.FailNow()
 	}
-	PrintItemPerListTable()
-	err = DeleteItemInList(created.ListId, created.CreatedBy, created.ItemId)
+	store.PrintItemPerListTable()
+	err = store.DeleteItemInList(created.ListId, created.CreatedBy, created.ItemId)
 	if err != nil {
 		log.Printf("Failed to delete mapping")
 		t.FailNow()
 	}
-	getMapping, err = GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	getMapping, err = store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
 	if err != nil {
 		log.Printf("The mapping or item for the mapping cannot be found")
 		t.FailNow()
@@ -185,7 +215,37 @@ func TestDeleteMapping(t *testing.T) {
 		log.Printf("The list is longer than expected")
 		t.FailNow()
 	}
-	PrintItemPerListTable()
+	store.PrintItemPerListTable()
 	log.Print("DeleteMapping successfully completed")
-	ResetItemPerListTable()
+	store.ResetItemPerListTable()
+}
+
+// Item level changes bump the version of the list together with the change
+func TestChangeItemInListBumpsVersion(t *testing.T) {
+	connectDatabase()
+	mapping := createMappingDependencies(t)
+	list, err := store.GetRawShoppingListWithId(mapping.ListId, mapping.CreatedBy)
+	assert.Nil(t, err)
+
+	_, version, err := store.ChangeItemInList(mapping)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+1, version)
+
+	// Failing changes leave the version untouched
+	unknown := mapping
+	unknown.ItemId = mapping.ItemId + 1000
+	_, _, err = store.ChangeItemInList(unknown)
+	assert.NotNil(t, err)
+	stored, err := store.GetRawShoppingListWithId(mapping.ListId, mapping.CreatedBy)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+1, stored.Version)
+
+	version, err = store.RemoveItemFromList(mapping.ListId, mapping.CreatedBy, mapping.ItemId)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+2, version)
+	items, err := store.GetItemsInList(mapping.ListId, mapping.CreatedBy)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+	_, err = store.RemoveItemFromList(mapping.ListId+1, mapping.CreatedBy, mapping.ItemId)
+	assert.NotNil(t, err)
 }
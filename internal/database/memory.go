@@ -0,0 +1,2613 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/alexedwards/argon2id"
+)
+
+// A Store keeping everything in memory. Meant for testing and local development.
+// The semantics follow the MySQL implementation and the schema in
+// setup/create_mysql_db.sql, including the composite (id, createdBy) keys,
+// the foreign key checks and the cascading deletes.
+
+// ------------------------------------------------------------
+// Data structures
+// ------------------------------------------------------------
+
+type listItemKey struct {
+	ListId    int64
+	CreatedBy int64
+	ItemId    int64
+}
+
+type listSharedKey struct {
+	ListId       int64
+	CreatedBy    int64
+	SharedWithId int64
+}
+
+type recipeSharedKey struct {
+	RecipeId   int64
+	CreatedBy  int64
+	SharedWith int64
+}
+
+type householdMemberKey struct {
+	HouseholdId int64
+	UserId      int64
+}
+
+type listHouseholdKey struct {
+	ListId      int64
+	CreatedBy   int64
+	HouseholdId int64
+}
+
+type recipeHouseholdKey struct {
+	RecipeId    int64
+	CreatedBy   int64
+	HouseholdId int64
+}
+
+type blockedUserKey struct {
+	UserId    int64
+	BlockedId int64
+}
+
+type ingredientRow struct {
+	ItemId       int64
+	Quantity     int
+	QuantityType string
+}
+
+type MemoryStore struct {
+	mutex sync.RWMutex
+
+	users       map[int64]data.User
+	items       map[int64]data.Item
+	nextItemId  int64
+	lists       map[data.ListPK]data.List
+	listItems   map[listItemKey]data.ListItem
+	sharedLists map[listSharedKey]data.ListShared
+
+	recipes            map[data.RecipePK]data.Recipe
+	recipeIngredients  map[data.RecipePK][]ingredientRow
+	recipeDescriptions map[data.RecipePK][]data.RecipeDescription
+	recipeImages       map[data.RecipePK][]string
+	sharedRecipes      map[recipeSharedKey]bool
+
+	households           map[int64]data.Household
+	nextHouseholdId      int64
+	householdMembers     map[householdMemberKey]data.HouseholdMember
+	householdInvitations map[householdMemberKey]data.HouseholdInvitation
+	householdLists       map[listHouseholdKey]string // The permission of the share
+	householdRecipes     map[recipeHouseholdKey]bool
+
+	invites map[string]data.Invite
+
+	blockedUsers map[blockedUserKey]time.Time
+
+	sessions      map[string]data.Session
+	tokens        map[string]data.TokenData
+	refreshTokens map[string]data.RefreshToken
+
+	passwordResets map[int64]data.PasswordReset
+
+	totps         map[int64]data.TOTP
+	recoveryCodes map[int64]map[string]bool
+
+	oidcIdentities map[oidcIdentityKey]data.OIDCIdentity
+}
+
+type oidcIdentityKey struct {
+	issuer  string
+	subject string
+}
+
+// Compile time check that the MemoryStore fulfills the Store interface
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{}
+	store.clear()
+	return store
+}
+
+func (m *MemoryStore) clear() {
+	m.users = make(map[int64]data.User)
+	m.items = make(map[int64]data.Item)
+	m.nextItemId = 1
+	m.lists = make(map[data.ListPK]data.List)
+	m.listItems = make(map[listItemKey]data.ListItem)
+	m.sharedLists = make(map[listSharedKey]data.ListShared)
+	m.recipes = make(map[data.RecipePK]data.Recipe)
+	m.recipeIngredients = make(map[data.RecipePK][]ingredientRow)
+	m.recipeDescriptions = make(map[data.RecipePK][]data.RecipeDescription)
+	m.recipeImages = make(map[data.RecipePK][]string)
+	m.sharedRecipes = make(map[recipeSharedKey]bool)
+	m.households = make(map[int64]data.Household)
+	m.nextHouseholdId = 1
+	m.householdMembers = make(map[householdMemberKey]data.HouseholdMember)
+	m.householdInvitations = make(map[householdMemberKey]data.HouseholdInvitation)
+	m.householdLists = make(map[listHouseholdKey]string)
+	m.householdRecipes = make(map[recipeHouseholdKey]bool)
+	m.invites = make(map[string]data.Invite)
+	m.blockedUsers = make(map[blockedUserKey]time.Time)
+	m.sessions = make(map[string]data.Session)
+	m.tokens = make(map[string]data.TokenData)
+	m.refreshTokens = make(map[string]data.RefreshToken)
+	m.passwordResets = make(map[int64]data.PasswordReset)
+	m.totps = make(map[int64]data.TOTP)
+	m.recoveryCodes = make(map[int64]map[string]bool)
+	m.oidcIdentities = make(map[oidcIdentityKey]data.OIDCIdentity)
+}
+
+func (m *MemoryStore) ResetDatabase() {
+	m.DropUserTable()
+	m.ResetSharedListTable()
+	m.ResetItemTable()
+	m.ResetItemPerListTable()
+	m.DropShoppingListTable()
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// ------------------------------------------------------------
+// Cascading deletes (the caller must hold the lock)
+// ------------------------------------------------------------
+
+func (m *MemoryStore) deleteUserCascading(id int64) {
+	delete(m.users, id)
+	m.deleteSessions(func(session data.Session) bool { return session.UserId == id })
+	delete(m.passwordResets, id)
+	delete(m.totps, id)
+	delete(m.recoveryCodes, id)
+	for key, identity := range m.oidcIdentities {
+		if identity.UserId == id {
+			delete(m.oidcIdentities, key)
+		}
+	}
+	for pk := range m.lists {
+		if pk.CreatedBy == id {
+			m.deleteListCascading(pk)
+		}
+	}
+	for key, mapping := range m.listItems {
+		if mapping.AddedBy == id {
+			// ON DELETE SET NULL
+			mapping.AddedBy = 0
+			m.listItems[key] = mapping
+		}
+	}
+	for key := range m.sharedLists {
+		if key.SharedWithId == id {
+			delete(m.sharedLists, key)
+		}
+	}
+	for pk := range m.recipes {
+		if pk.CreatedBy == id {
+			m.deleteRecipeCascading(pk)
+		}
+	}
+	for key := range m.sharedRecipes {
+		if key.SharedWith == id {
+			delete(m.sharedRecipes, key)
+		}
+	}
+	for householdId, household := range m.households {
+		if household.CreatedBy == id {
+			m.deleteHouseholdCascading(householdId)
+		}
+	}
+	for key := range m.householdMembers {
+		if key.UserId == id {
+			delete(m.householdMembers, key)
+		}
+	}
+	for key, invitation := range m.householdInvitations {
+		if key.UserId == id || invitation.InvitedBy == id {
+			delete(m.householdInvitations, key)
+		}
+	}
+	for inviteId, invite := range m.invites {
+		if invite.InvitedBy == id {
+			delete(m.invites, inviteId)
+		}
+	}
+	for key := range m.blockedUsers {
+		if key.UserId == id || key.BlockedId == id {
+			delete(m.blockedUsers, key)
+		}
+	}
+}
+
+func (m *MemoryStore) deleteListCascading(pk data.ListPK) {
+	delete(m.lists, pk)
+	m.deleteItemsOfList(pk)
+	for key := range m.sharedLists {
+		if key.ListId == pk.ListID && key.CreatedBy == pk.CreatedBy {
+			delete(m.sharedLists, key)
+		}
+	}
+	for key := range m.householdLists {
+		if key.ListId == pk.ListID && key.CreatedBy == pk.CreatedBy {
+			delete(m.householdLists, key)
+		}
+	}
+}
+
+func (m *MemoryStore) deleteItemsOfList(pk data.ListPK) {
+	for key := range m.listItems {
+		if key.ListId == pk.ListID && key.CreatedBy == pk.CreatedBy {
+			delete(m.listItems, key)
+		}
+	}
+}
+
+func (m *MemoryStore) deleteItemCascading(id int64) {
+	delete(m.items, id)
+	for key := range m.listItems {
+		if key.ItemId == id {
+			delete(m.listItems, key)
+		}
+	}
+	for pk, ingredients := range m.recipeIngredients {
+		remaining := make([]ingredientRow, 0, len(ingredients))
+		for _, ingredient := range ingredients {
+			if ingredient.ItemId != id {
+				remaining = append(remaining, ingredient)
+			}
+		}
+		m.recipeIngredients[pk] = remaining
+	}
+}
+
+func (m *MemoryStore) deleteRecipeCascading(pk data.RecipePK) {
+	delete(m.recipes, pk)
+	delete(m.recipeIngredients, pk)
+	delete(m.recipeDescriptions, pk)
+	delete(m.recipeImages, pk)
+	for key := range m.sharedRecipes {
+		if key.RecipeId == pk.RecipeId && key.CreatedBy == pk.CreatedBy {
+			delete(m.sharedRecipes, key)
+		}
+	}
+	for key := range m.householdRecipes {
+		if key.RecipeId == pk.RecipeId && key.CreatedBy == pk.CreatedBy {
+			delete(m.householdRecipes, key)
+		}
+	}
+}
+
+func (m *MemoryStore) deleteHouseholdCascading(householdId int64) {
+	delete(m.households, householdId)
+	for key := range m.householdMembers {
+		if key.HouseholdId == householdId {
+			delete(m.householdMembers, key)
+		}
+	}
+	for key := range m.householdInvitations {
+		if key.HouseholdId == householdId {
+			delete(m.householdInvitations, key)
+		}
+	}
+	for key := range m.householdLists {
+		if key.HouseholdId == householdId {
+			delete(m.householdLists, key)
+		}
+	}
+	for key := range m.householdRecipes {
+		if key.HouseholdId == householdId {
+			delete(m.householdRecipes, key)
+		}
+	}
+}
+
+// ------------------------------------------------------------
+// User handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) GetUser(id int64) (data.User, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getUser(id)
+}
+
+func (m *MemoryStore) getUser(id int64) (data.User, error) {
+	user, exists := m.users[id]
+	if !exists {
+		return data.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) GetAllUsers() ([]data.User, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var users []data.User
+	for _, user := range m.users {
+		users = append(users, data.User{
+			OnlineID:  user.OnlineID,
+			Username:  user.Username,
+			Created:   user.Created,
+			LastLogin: user.LastLogin,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].OnlineID < users[j].OnlineID })
+	return users, nil
+}
+
+func (m *MemoryStore) GetUserFromMatchingUsername(name string) ([]data.User, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var users []data.User
+	for _, user := range m.users {
+		// LIKE is case-insensitive with the default collation
+		if strings.Contains(strings.ToLower(user.Username), strings.ToLower(name)) {
+			users = append(users, data.User{
+				OnlineID:  user.OnlineID,
+				Username:  user.Username,
+				LastLogin: user.LastLogin,
+			})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].OnlineID < users[j].OnlineID })
+	return users, nil
+}
+
+func (m *MemoryStore) createNewUserId() int64 {
+	userId := int64(random.Int31())
+	for {
+		if _, exists := m.users[userId]; !exists {
+			return userId
+		}
+		userId = int64(random.Int31())
+	}
+}
+
+func (m *MemoryStore) CreateUserAccountInDatabase(username string, passwd string) (data.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	newUser, err := createUser(m.createNewUserId(), username, passwd)
+	if err != nil {
+		return data.User{}, err
+	}
+	log.Printf("Creating new user %d: %s", newUser.OnlineID, username)
+	m.users[newUser.OnlineID] = newUser
+	return newUser, nil
+}
+
+func (m *MemoryStore) ModifyLastLogin(id int64) (data.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	log.Printf("Updating the last login time for %d to now", id)
+	user, err := m.getUser(id)
+	if err != nil {
+		return data.User{}, err
+	}
+	user.LastLogin = time.Now().UTC()
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *MemoryStore) ModifyUserAccountName(id int64, newUsername string) (data.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	user, err := m.getUser(id)
+	if err != nil {
+		return data.User{}, err
+	}
+	user.Username = newUsername
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *MemoryStore) ModifyUserAccountPassword(id int64, password string) (data.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	user, err := m.getUser(id)
+	if err != nil {
+		return data.User{}, err
+	}
+	hashedPw, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	if err != nil {
+		log.Printf("Failed to hash given password: %s", err)
+		return data.User{}, err
+	}
+	user.Password = hashedPw
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *MemoryStore) SetUserRole(id int64, role string) error {
+	if !data.IsValidRole(role) {
+		return fmt.Errorf("invalid role '%s'", role)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	user, err := m.getUser(id)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	m.users[id] = user
+	return nil
+}
+
+func (m *MemoryStore) GetUsersWithRole(role string) ([]data.User, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	users := make([]data.User, 0)
+	for _, user := range m.users {
+		if user.Role == role {
+			users = append(users, data.User{
+				OnlineID:  user.OnlineID,
+				Username:  user.Username,
+				Role:      user.Role,
+				Created:   user.Created,
+				LastLogin: user.LastLogin,
+			})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].OnlineID < users[j].OnlineID })
+	return users, nil
+}
+
+func (m *MemoryStore) DeleteUserAccount(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteUserCascading(id)
+	return nil
+}
+
+func (m *MemoryStore) DropUserTable() {
+	log.Print("RESETTING ALL USERS. THIS DISABLES LOGIN FOR ALL EXISTING USERS")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id := range m.users {
+		m.deleteUserCascading(id)
+	}
+	log.Print("USER TABLE DROPPED")
+}
+
+// ------------------------------------------------------------
+// The shopping list handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) listWithCreatorName(list data.List) (data.List, error) {
+	user, err := m.getUser(list.CreatedBy.ID)
+	if err != nil {
+		return data.List{}, err
+	}
+	list.CreatedBy.Name = user.Username
+	list.Items = nil
+	return list, nil
+}
+
+func sortLists(lists []data.List) {
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].CreatedBy.ID != lists[j].CreatedBy.ID {
+			return lists[i].CreatedBy.ID < lists[j].CreatedBy.ID
+		}
+		return lists[i].ListId < lists[j].ListId
+	})
+}
+
+func (m *MemoryStore) GetRawShoppingListWithId(listId int64, createdBy int64) (data.List, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getRawShoppingList(listId, createdBy)
+}
+
+func (m *MemoryStore) getRawShoppingList(listId int64, createdBy int64) (data.List, error) {
+	list, exists := m.lists[data.ListPK{ListID: listId, CreatedBy: createdBy}]
+	if !exists {
+		return data.List{}, sql.ErrNoRows
+	}
+	list, err := m.listWithCreatorName(list)
+	if err != nil {
+		log.Printf("List Creator not found: %s", err)
+		return data.List{}, err
+	}
+	return list, nil
+}
+
+func (m *MemoryStore) GetRawShoppingListsForUserId(id int64) ([]data.List, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if _, err := m.getUser(id); err != nil {
+		return []data.List{}, err
+	}
+	var lists []data.List
+	for pk, list := range m.lists {
+		if pk.CreatedBy != id {
+			continue
+		}
+		list, err := m.listWithCreatorName(list)
+		if err != nil {
+			return []data.List{}, err
+		}
+		lists = append(lists, list)
+	}
+	sortLists(lists)
+	return lists, nil
+}
+
+func (m *MemoryStore) GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error) {
+	if len(listIds) == 0 {
+		return []data.List{}, nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var lists []data.List
+	seen := make(map[data.ListPK]bool)
+	for _, pk := range listIds {
+		list, exists := m.lists[pk]
+		if !exists || seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		list, err := m.listWithCreatorName(list)
+		if err != nil {
+			return []data.List{}, err
+		}
+		lists = append(lists, list)
+	}
+	sortLists(lists)
+	return lists, nil
+}
+
+func (m *MemoryStore) GetAllRawShoppingLists() ([]data.List, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var lists []data.List
+	for _, list := range m.lists {
+		list, err := m.listWithCreatorName(list)
+		if err != nil {
+			return []data.List{}, err
+		}
+		lists = append(lists, list)
+	}
+	sortLists(lists)
+	return lists, nil
+}
+
+func (m *MemoryStore) GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.List, error) {
+	if len(sharedLists) == 0 {
+		return []data.List{}, errors.New("no shared ids given")
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var lists []data.List
+	seen := make(map[data.ListPK]bool)
+	for _, shared := range sharedLists {
+		pk := data.ListPK{ListID: shared.ListId, CreatedBy: shared.CreatedBy}
+		list, exists := m.lists[pk]
+		if !exists || seen[pk] {
+			continue
+		}
+		seen[pk] = true
+		list, err := m.listWithCreatorName(list)
+		if err != nil {
+			log.Printf("Cannot find list creator %d and skip: %s", pk.CreatedBy, err)
+			continue
+		}
+		lists = append(lists, list)
+	}
+	sortLists(lists)
+	return lists, nil
+}
+
+func (m *MemoryStore) BumpListVersion(listId int64, createdBy int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.bumpListVersion(listId, createdBy)
+}
+
+func (m *MemoryStore) bumpListVersion(listId int64, createdBy int64) (int64, error) {
+	pk := data.ListPK{ListID: listId, CreatedBy: createdBy}
+	stored, exists := m.lists[pk]
+	if !exists {
+		return 0, sql.ErrNoRows
+	}
+	stored.Version++
+	stored.LastUpdated = time.Now().UTC()
+	m.lists[pk] = stored
+	return stored.Version, nil
+}
+
+func (m *MemoryStore) updateRawShoppingList(list data.List) (data.List, error) {
+	existingList, err := m.getRawShoppingList(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		return data.List{}, err
+	}
+	if err := checkListCorrect(list); err != nil {
+		log.Printf("List not in correct format for insertion: %s", err)
+		return data.List{}, err
+	}
+	if existingList.Version >= list.Version {
+		return data.List{}, errors.New("newer list exists")
+	}
+	pk := data.ListPK{ListID: list.ListId, CreatedBy: list.CreatedBy.ID}
+	stored := m.lists[pk]
+	stored.Title = list.Title
+	stored.LastUpdated = time.Now().UTC()
+	stored.Version = list.Version
+	m.lists[pk] = stored
+	return list, nil
+}
+
+func (m *MemoryStore) createRawShoppingList(list data.List) error {
+	if err := checkListCorrect(list); err != nil {
+		log.Printf("List not in correct format for insertion: %s", err)
+		return err
+	}
+	pk := data.ListPK{ListID: list.ListId, CreatedBy: list.CreatedBy.ID}
+	if _, exists := m.lists[pk]; exists {
+		return fmt.Errorf("duplicate entry for list %d from %d", list.ListId, list.CreatedBy.ID)
+	}
+	if _, err := m.getUser(list.CreatedBy.ID); err != nil {
+		return fmt.Errorf("list creator %d does not exist", list.CreatedBy.ID)
+	}
+	stored := list
+	stored.CreatedBy = data.ListCreator{ID: list.CreatedBy.ID}
+	stored.Items = nil
+	stored.RemovedItems = nil
+	m.lists[pk] = stored
+	return nil
+}
+
+// checkListItems validates all items before anything is written
+// so that a failing item leaves the store untouched
+func (m *MemoryStore) checkListItems(list data.List) ([]data.Item, error) {
+	itemsErr := &ItemsError{}
+	converted := make([]data.Item, len(list.Items))
+	for i, item := range list.Items {
+		conv, err := CheckItemCorrect(item)
+		if err != nil {
+			itemsErr.add(i, item, err)
+			continue
+		}
+		if _, exists := m.users[item.AddedBy]; !exists {
+			itemsErr.add(i, item, fmt.Errorf("user %d who added the item does not exist", item.AddedBy))
+			continue
+		}
+		converted[i] = conv
+	}
+	return converted, itemsErr.orNil()
+}
+
+func (m *MemoryStore) CreateOrUpdateShoppingList(list data.List) error {
+	log.Printf("Creating or updating shopping list '%s' with id '%d' from %v", list.Title, list.ListId, list.CreatedBy)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.createOrUpdateShoppingList(list)
+}
+
+func (m *MemoryStore) createOrUpdateShoppingList(list data.List) error {
+	pk := data.ListPK{ListID: list.ListId, CreatedBy: list.CreatedBy.ID}
+	if err := checkListCorrect(list); err != nil {
+		log.Printf("List not in correct format for insertion: %s", err)
+		return err
+	}
+	existingList, exists := m.lists[pk]
+	if !exists {
+		if _, err := m.getUser(list.CreatedBy.ID); err != nil {
+			return fmt.Errorf("list creator %d does not exist", list.CreatedBy.ID)
+		}
+	} else if existingList.Version >= list.Version {
+		return errors.New("newer list exists")
+	}
+	converted, err := m.checkListItems(list)
+	if err != nil {
+		log.Printf("Failed to store list %d from %d: %s", list.ListId, list.CreatedBy.ID, err)
+		return err
+	}
+	if !exists {
+		if err := m.createRawShoppingList(list); err != nil {
+			return err
+		}
+	} else if _, err := m.updateRawShoppingList(list); err != nil {
+		return err
+	}
+	log.Printf("Adding (%d) items to shopping list", len(list.Items))
+	// Like the SQLStore the old items are removed even if none are left
+	m.deleteItemsOfList(pk)
+	now := time.Now().UTC()
+	for i, item := range list.Items {
+		insertedItem := m.insertItem(converted[i])
+		key := listItemKey{ListId: list.ListId, CreatedBy: list.CreatedBy.ID, ItemId: insertedItem.ItemId}
+		mapping := withEditTimes(listItemFromWire(list, item, insertedItem.ItemId, int64(i)), now)
+		// Items given twice keep their first position, like the UPDATE in the SQLStore
+		if existing, exists := m.listItems[key]; exists {
+			mapping.Position = existing.Position
+		}
+		m.listItems[key] = mapping
+	}
+	return nil
+}
+
+func (m *MemoryStore) MergeShoppingList(list data.List) (data.ListMergeResult, error) {
+	log.Printf("Merging shopping list '%s' with id '%d' from %v", list.Title, list.ListId, list.CreatedBy)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pk := data.ListPK{ListID: list.ListId, CreatedBy: list.CreatedBy.ID}
+	toStore := list
+	conflicts := make([]data.ListConflict, 0)
+	if stored, exists := m.lists[pk]; exists {
+		stored.Items = m.getItemsInList(list.ListId, list.CreatedBy.ID)
+		toStore, conflicts = mergeShoppingList(stored, list)
+	}
+	if err := m.createOrUpdateShoppingList(toStore); err != nil {
+		log.Printf("Failed to merge list %d from %d: %s", list.ListId, list.CreatedBy.ID, err)
+		return data.ListMergeResult{}, err
+	}
+	merged, err := m.getRawShoppingList(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		return data.ListMergeResult{}, err
+	}
+	merged.Items = m.getItemsInList(list.ListId, list.CreatedBy.ID)
+	return data.ListMergeResult{List: merged, Conflicts: conflicts}, nil
+}
+
+func (m *MemoryStore) DeleteShoppingList(id int64, createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteListCascading(data.ListPK{ListID: id, CreatedBy: createdBy})
+	return nil
+}
+
+func (m *MemoryStore) DeleteShoppingListFrom(createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for pk := range m.lists {
+		if pk.CreatedBy == createdBy {
+			m.deleteListCascading(pk)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DropShoppingListTable() {
+	log.Print("DROPPING SHOPPING LIST TABLE. CANNOT BE REVERTED!")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for pk := range m.lists {
+		m.deleteListCascading(pk)
+	}
+	log.Print("DROPPED SHOPPING TABLE")
+}
+
+// ------------------------------------------------------------
+// The sharing of lists
+// ------------------------------------------------------------
+
+func (m *MemoryStore) GetListIdsSharedWithUser(userId int64) ([]data.ListPK, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var list []data.ListPK
+	contained := make(map[data.ListPK]bool)
+	for key, shared := range m.sharedLists {
+		if shared.Status != data.ShareStatusAccepted {
+			continue
+		}
+		// -1 means the list is shared with everybody
+		if key.SharedWithId == userId || key.SharedWithId == -1 {
+			contained[data.ListPK{ListID: key.ListId, CreatedBy: key.CreatedBy}] = true
+		}
+	}
+	for key := range m.householdLists {
+		if m.isHouseholdMember(key.HouseholdId, userId) && key.CreatedBy != userId {
+			contained[data.ListPK{ListID: key.ListId, CreatedBy: key.CreatedBy}] = true
+		}
+	}
+	for pk := range contained {
+		list = append(list, pk)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedBy != list[j].CreatedBy {
+			return list[i].CreatedBy < list[j].CreatedBy
+		}
+		return list[i].ListID < list[j].ListID
+	})
+	return list, nil
+}
+
+func (m *MemoryStore) GetUsersSharingList(listId int64, createdBy int64) ([]int64, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	contained := make(map[int64]bool)
+	for key, shared := range m.sharedLists {
+		if key.ListId == listId && key.CreatedBy == createdBy && shared.Status == data.ShareStatusAccepted {
+			contained[key.SharedWithId] = true
+		}
+	}
+	for key := range m.householdLists {
+		if key.ListId != listId || key.CreatedBy != createdBy {
+			continue
+		}
+		for memberKey := range m.householdMembers {
+			if memberKey.HouseholdId == key.HouseholdId && memberKey.UserId != createdBy {
+				contained[memberKey.UserId] = true
+			}
+		}
+	}
+	userIds := make([]int64, 0, len(contained))
+	for userId := range contained {
+		userIds = append(userIds, userId)
+	}
+	sort.Slice(userIds, func(i, j int) bool { return userIds[i] < userIds[j] })
+	return userIds, nil
+}
+
+func (m *MemoryStore) IsListSharedWithUser(listId int64, createdBy int64, userId int64) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if err := m.isListSharedWithUser(listId, createdBy, userId); err != nil {
+		if len(m.getHouseholdPermissions(listId, createdBy, userId)) > 0 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *MemoryStore) isListSharedWithUser(listId int64, createdBy int64, userId int64) error {
+	if shared, exists := m.sharedLists[listSharedKey{ListId: listId, CreatedBy: createdBy, SharedWithId: userId}]; !exists || shared.Status != data.ShareStatusAccepted {
+		return errors.New("list is not shared with user")
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSharePermission(listId int64, createdBy int64, userId int64) (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getSharePermission(listId, createdBy, userId)
+}
+
+func (m *MemoryStore) getSharePermission(listId int64, createdBy int64, userId int64) (string, error) {
+	permission := ""
+	if shared := m.sharedLists[listSharedKey{ListId: listId, CreatedBy: createdBy, SharedWithId: userId}]; shared.Status == data.ShareStatusAccepted {
+		permission = shared.Permission
+	}
+	for _, householdPermission := range m.getHouseholdPermissions(listId, createdBy, userId) {
+		permission = data.HigherPermission(permission, householdPermission)
+	}
+	if permission == "" {
+		return "", sql.ErrNoRows
+	}
+	return permission, nil
+}
+
+func (m *MemoryStore) getHouseholdPermissions(listId int64, createdBy int64, userId int64) []string {
+	permissions := make([]string, 0)
+	for key, permission := range m.householdLists {
+		if key.ListId == listId && key.CreatedBy == createdBy && m.isHouseholdMember(key.HouseholdId, userId) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+func (m *MemoryStore) IsListCreatedBy(listId int64, userId int64) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if _, exists := m.lists[data.ListPK{ListID: listId, CreatedBy: userId}]; !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *MemoryStore) CheckUserAndListExist(listId int64, createdBy int64, sharedWith int64) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.checkUserAndListExist(listId, createdBy, sharedWith)
+}
+
+func (m *MemoryStore) checkUserAndListExist(listId int64, createdBy int64, sharedWith int64) error {
+	if _, err := m.getUser(createdBy); err != nil {
+		return errors.New("list owner does not exist")
+	}
+	if _, err := m.getUser(sharedWith); err != nil {
+		return errors.New("shared with user does not exist")
+	}
+	if _, err := m.getRawShoppingList(listId, createdBy); err != nil {
+		return errors.New("shared list does not exist")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateOrUpdateSharedList(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error) {
+	return m.createOrUpdateShare(listId, createdBy, sharedWith, permission, data.ShareStatusAccepted)
+}
+
+func (m *MemoryStore) CreateShareRequest(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error) {
+	return m.createOrUpdateShare(listId, createdBy, sharedWith, permission, data.ShareStatusPending)
+}
+
+func (m *MemoryStore) createOrUpdateShare(listId int64, createdBy int64, sharedWith int64, permission string, status string) (data.ListShared, error) {
+	if !data.IsGrantablePermission(permission) {
+		return data.ListShared{}, fmt.Errorf("invalid permission '%s'", permission)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := listSharedKey{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith}
+	if existing, exists := m.sharedLists[key]; exists {
+		log.Printf("Shared of list %d for user %d exists, setting permission %s", listId, sharedWith, permission)
+		if status == data.ShareStatusPending {
+			status = existing.Status
+		}
+		existing.Permission = permission
+		existing.Status = status
+		m.sharedLists[key] = existing
+		return data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now(), Permission: permission, Status: status}, nil
+	}
+	if err := m.checkUserAndListExist(listId, createdBy, sharedWith); err != nil {
+		log.Printf("User or list does not exist: %s", err)
+		return data.ListShared{}, err
+	}
+	newShared := data.ListShared{ListId: listId, CreatedBy: createdBy, SharedWithId: sharedWith, Created: time.Now(), Permission: permission, Status: status}
+	m.sharedLists[key] = newShared
+	return newShared, nil
+}
+
+func (m *MemoryStore) DeleteSharingOfList(listId int64, createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key := range m.sharedLists {
+		if key.ListId == listId && key.CreatedBy == createdBy {
+			delete(m.sharedLists, key)
+		}
+	}
+	for key := range m.householdLists {
+		if key.ListId == listId && key.CreatedBy == createdBy {
+			delete(m.householdLists, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteSharingForUser(listId int64, createdBy int64, userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sharedLists, listSharedKey{ListId: listId, CreatedBy: createdBy, SharedWithId: userId})
+	return nil
+}
+
+func (m *MemoryStore) ResetSharedListTable() {
+	log.Print("RESETTING SHARING LIST. CANNOT BE REVERTED!")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sharedLists = make(map[listSharedKey]data.ListShared)
+	log.Print("RESET SHARING TABLE")
+}
+
+// ------------------------------------------------------------
+// Share requests and blocked users
+// ------------------------------------------------------------
+
+func (m *MemoryStore) AcceptShareRequest(listId int64, createdBy int64, userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := listSharedKey{ListId: listId, CreatedBy: createdBy, SharedWithId: userId}
+	shared, exists := m.sharedLists[key]
+	if !exists || shared.Status != data.ShareStatusPending {
+		return sql.ErrNoRows
+	}
+	shared.Status = data.ShareStatusAccepted
+	m.sharedLists[key] = shared
+	return nil
+}
+
+// getShares returns the matching shares ordered like the SQLStore
+func (m *MemoryStore) getShares(matches func(shared data.ListShared) bool) []data.ListShared {
+	shares := make([]data.ListShared, 0)
+	for _, shared := range m.sharedLists {
+		if matches(shared) {
+			shares = append(shares, shared)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].CreatedBy != shares[j].CreatedBy {
+			return shares[i].CreatedBy < shares[j].CreatedBy
+		}
+		if shares[i].ListId != shares[j].ListId {
+			return shares[i].ListId < shares[j].ListId
+		}
+		return shares[i].SharedWithId < shares[j].SharedWithId
+	})
+	return shares
+}
+
+func (m *MemoryStore) GetSharesOfList(listId int64, createdBy int64) ([]data.ListShared, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getShares(func(shared data.ListShared) bool {
+		return shared.ListId == listId && shared.CreatedBy == createdBy
+	}), nil
+}
+
+func (m *MemoryStore) GetIncomingShareRequests(userId int64) ([]data.ListShared, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getShares(func(shared data.ListShared) bool {
+		return shared.SharedWithId == userId && shared.Status == data.ShareStatusPending
+	}), nil
+}
+
+func (m *MemoryStore) GetOutgoingShareRequests(createdBy int64) ([]data.ListShared, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getShares(func(shared data.ListShared) bool {
+		return shared.CreatedBy == createdBy && shared.Status == data.ShareStatusPending
+	}), nil
+}
+
+func (m *MemoryStore) BlockUser(userId int64, blockedId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(userId); err != nil {
+		return err
+	}
+	if _, err := m.getUser(blockedId); err != nil {
+		return err
+	}
+	key := blockedUserKey{UserId: userId, BlockedId: blockedId}
+	if _, exists := m.blockedUsers[key]; !exists {
+		m.blockedUsers[key] = time.Now().UTC()
+	}
+	for key, shared := range m.sharedLists {
+		if key.CreatedBy == blockedId && key.SharedWithId == userId && shared.Status == data.ShareStatusPending {
+			delete(m.sharedLists, key)
+		}
+	}
+	for key, invitation := range m.householdInvitations {
+		if key.UserId == userId && invitation.InvitedBy == blockedId {
+			delete(m.householdInvitations, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) UnblockUser(userId int64, blockedId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.blockedUsers, blockedUserKey{UserId: userId, BlockedId: blockedId})
+	return nil
+}
+
+func (m *MemoryStore) GetBlockedUsers(userId int64) ([]data.BlockedUser, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	blocked := make([]data.BlockedUser, 0)
+	for key, created := range m.blockedUsers {
+		if key.UserId == userId {
+			blocked = append(blocked, data.BlockedUser{UserId: key.BlockedId, Username: m.users[key.BlockedId].Username, Created: created})
+		}
+	}
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].UserId < blocked[j].UserId })
+	return blocked, nil
+}
+
+func (m *MemoryStore) IsUserBlocked(userId int64, blockedId int64) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	_, exists := m.blockedUsers[blockedUserKey{UserId: userId, BlockedId: blockedId}]
+	return exists, nil
+}
+
+// ------------------------------------------------------------
+// The items in lists
+// ------------------------------------------------------------
+
+func (m *MemoryStore) IsItemInList(listId int64, createdBy int64, itemId int64) (data.ListItem, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	mapping, exists := m.listItems[listItemKey{ListId: listId, CreatedBy: createdBy, ItemId: itemId}]
+	if !exists {
+		return data.ListItem{}, sql.ErrNoRows
+	}
+	return mapping, nil
+}
+
+func (m *MemoryStore) GetItemsInList(listId int64, createdBy int64) ([]data.ItemWire, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getItemsInList(listId, createdBy), nil
+}
+
+func (m *MemoryStore) getItemsInList(listId int64, createdBy int64) []data.ItemWire {
+	var mappings []data.ListItem
+	for key, mapping := range m.listItems {
+		if key.ListId == listId && key.CreatedBy == createdBy {
+			mappings = append(mappings, mapping)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Position != mappings[j].Position {
+			return mappings[i].Position < mappings[j].Position
+		}
+		return mappings[i].ItemId < mappings[j].ItemId
+	})
+	var list []data.ItemWire
+	for _, mapping := range mappings {
+		item := m.items[mapping.ItemId]
+		list = append(list, data.ItemWire{
+			ItemId:   item.ItemId,
+			Name:     item.Name,
+			Icon:     item.Icon,
+			Quantity: mapping.Quantity,
+			Checked:  mapping.Checked,
+			AddedBy:  mapping.AddedBy,
+			Updated:  &data.ItemUpdated{Quantity: mapping.QuantityUpdated, Checked: mapping.CheckedUpdated},
+		})
+	}
+	return list
+}
+
+func (m *MemoryStore) InsertOrUpdateItemInList(mapping data.ListItem) (data.ListItem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.insertOrUpdateItemInList(mapping)
+}
+
+func (m *MemoryStore) insertOrUpdateItemInList(mapping data.ListItem) (data.ListItem, error) {
+	if _, exists := m.lists[data.ListPK{ListID: mapping.ListId, CreatedBy: mapping.CreatedBy}]; !exists {
+		return data.ListItem{}, fmt.Errorf("list %d from %d does not exist", mapping.ListId, mapping.CreatedBy)
+	}
+	if _, exists := m.items[mapping.ItemId]; !exists {
+		return data.ListItem{}, fmt.Errorf("item %d does not exist", mapping.ItemId)
+	}
+	if _, exists := m.users[mapping.AddedBy]; !exists {
+		return data.ListItem{}, fmt.Errorf("user %d who added the item does not exist", mapping.AddedBy)
+	}
+	mapping = withEditTimes(mapping, time.Now().UTC())
+	key := listItemKey{ListId: mapping.ListId, CreatedBy: mapping.CreatedBy, ItemId: mapping.ItemId}
+	// The position is only set on insert, like in the SQLStore
+	if existing, exists := m.listItems[key]; exists {
+		mapping.Position = existing.Position
+	}
+	m.listItems[key] = mapping
+	return mapping, nil
+}
+
+func (m *MemoryStore) ChangeItemInList(mapping data.ListItem) (data.ListItem, int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	mapping, err := m.insertOrUpdateItemInList(mapping)
+	if err != nil {
+		return data.ListItem{}, 0, err
+	}
+	version, err := m.bumpListVersion(mapping.ListId, mapping.CreatedBy)
+	if err != nil {
+		return data.ListItem{}, 0, err
+	}
+	return mapping, version, nil
+}
+
+func (m *MemoryStore) ReorderItemsInList(listId int64, createdBy int64, itemIds []int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	existing := make([]int64, 0)
+	for key := range m.listItems {
+		if key.ListId == listId && key.CreatedBy == createdBy {
+			existing = append(existing, key.ItemId)
+		}
+	}
+	if err := checkItemOrder(existing, itemIds); err != nil {
+		return 0, err
+	}
+	if _, exists := m.lists[data.ListPK{ListID: listId, CreatedBy: createdBy}]; !exists {
+		return 0, sql.ErrNoRows
+	}
+	for position, itemId := range itemIds {
+		key := listItemKey{ListId: listId, CreatedBy: createdBy, ItemId: itemId}
+		mapping := m.listItems[key]
+		mapping.Position = int64(position)
+		m.listItems[key] = mapping
+	}
+	return m.bumpListVersion(listId, createdBy)
+}
+
+func (m *MemoryStore) DeleteItemInList(listId int64, createdBy int64, itemId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.listItems, listItemKey{ListId: listId, CreatedBy: createdBy, ItemId: itemId})
+	return nil
+}
+
+func (m *MemoryStore) RemoveItemFromList(listId int64, createdBy int64, itemId int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.lists[data.ListPK{ListID: listId, CreatedBy: createdBy}]; !exists {
+		return 0, sql.ErrNoRows
+	}
+	delete(m.listItems, listItemKey{ListId: listId, CreatedBy: createdBy, ItemId: itemId})
+	return m.bumpListVersion(listId, createdBy)
+}
+
+func (m *MemoryStore) DeleteAllItemsInList(listId int64, createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteItemsOfList(data.ListPK{ListID: listId, CreatedBy: createdBy})
+	return nil
+}
+
+func (m *MemoryStore) ResetItemPerListTable() {
+	log.Print("RESETTING ALL ITEMS PER LIST. CANNOT BE REVERTED!")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.listItems = make(map[listItemKey]data.ListItem)
+	log.Print("RESET ITEM MAPPING TABLE")
+}
+
+// ------------------------------------------------------------
+// Item Handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) GetItem(id int64) (data.Item, error) {
+	if id < 0 {
+		return data.Item{}, errors.New("items with id < 0 do not exist")
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	item, exists := m.items[id]
+	if !exists {
+		return data.Item{}, sql.ErrNoRows
+	}
+	return item, nil
+}
+
+func (m *MemoryStore) sortedItems(filter func(data.Item) bool) []data.Item {
+	var items []data.Item
+	for _, item := range m.items {
+		if filter(item) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ItemId < items[j].ItemId })
+	return items
+}
+
+func (m *MemoryStore) GetAllItems() ([]data.Item, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.sortedItems(func(data.Item) bool { return true }), nil
+}
+
+func (m *MemoryStore) GetAllItemsFromName(name string) ([]data.Item, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	lowerName := strings.ToLower(name)
+	return m.sortedItems(func(item data.Item) bool {
+		return strings.Contains(strings.ToLower(item.Name), lowerName)
+	}), nil
+}
+
+func (m *MemoryStore) InsertItem(name string, icon string) (data.Item, error) {
+	item := data.Item{
+		Name: name,
+		Icon: icon,
+	}
+	return m.InsertItemStruct(item)
+}
+
+func (m *MemoryStore) InsertItemStruct(item data.Item) (data.Item, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.insertItem(item), nil
+}
+
+// insertItem only creates a new item if no item with the same name exists
+func (m *MemoryStore) insertItem(item data.Item) data.Item {
+	trimmedName := strings.TrimSpace(item.Name)
+	trimmedIcon := strings.TrimSpace(item.Icon)
+	for _, existing := range m.items {
+		if existing.Name == trimmedName {
+			return existing
+		}
+	}
+	inserted := data.Item{
+		ItemId: m.nextItemId,
+		Name:   trimmedName,
+		Icon:   trimmedIcon,
+	}
+	m.items[inserted.ItemId] = inserted
+	m.nextItemId++
+	return inserted
+}
+
+func (m *MemoryStore) ModifyItem(id int64, name string, icon string) (data.Item, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	item, exists := m.items[id]
+	if !exists {
+		return data.Item{}, sql.ErrNoRows
+	}
+	if name != "" {
+		item.Name = name
+	}
+	if icon != "" {
+		item.Icon = icon
+	}
+	m.items[id] = item
+	return item, nil
+}
+
+func (m *MemoryStore) DeleteItem(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteItemCascading(id)
+	return nil
+}
+
+func (m *MemoryStore) ResetItemTable() {
+	log.Print("RESETTING ALL ITEMS. CANNOT BE REVERTED!")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id := range m.items {
+		m.deleteItemCascading(id)
+	}
+	log.Print("RESET ITEMS TABLE")
+}
+
+// ------------------------------------------------------------
+// Recipes Handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreateRecipe(recipe data.Recipe, imageFilenames []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pk := data.RecipePK{RecipeId: recipe.RecipeId, CreatedBy: recipe.CreatedBy.ID}
+	if _, exists := m.recipes[pk]; exists {
+		return fmt.Errorf("duplicate entry for recipe %d from %d", recipe.RecipeId, recipe.CreatedBy.ID)
+	}
+	if _, err := m.getUser(recipe.CreatedBy.ID); err != nil {
+		log.Printf("Failed to insert values into database: %s", err)
+		return fmt.Errorf("recipe creator %d does not exist", recipe.CreatedBy.ID)
+	}
+	descriptions, err := checkDescriptions(recipe.Description)
+	if err != nil {
+		log.Printf("Failed to create recipe '%s' because of descriptions: %s", recipe.Name, err)
+		return err
+	}
+	if err := checkIngredients(recipe.Ingredients); err != nil {
+		log.Printf("Failed to create recipe '%s' because of ingredients: %s", recipe.Name, err)
+		return err
+	}
+	images, err := checkImageFilenames(imageFilenames)
+	if err != nil {
+		log.Printf("Failed to create recipe '%s' because of images: %s", recipe.Name, err)
+		return err
+	}
+	ingredients := m.convertIngredients(recipe.Ingredients)
+	stored := recipe
+	stored.CreatedBy = data.ListCreator{ID: recipe.CreatedBy.ID}
+	stored.Ingredients = nil
+	stored.Description = nil
+	m.recipes[pk] = stored
+	m.recipeDescriptions[pk] = descriptions
+	m.recipeIngredients[pk] = ingredients
+	m.recipeImages[pk] = images
+	return nil
+}
+
+// checkDescriptions mirrors the primary key (recipeId, createdBy, descriptionOrder)
+func checkDescriptions(descriptions []data.RecipeDescription) ([]data.RecipeDescription, error) {
+	seen := make(map[int]bool)
+	checked := make([]data.RecipeDescription, 0, len(descriptions))
+	for _, description := range descriptions {
+		if seen[description.Order] {
+			return nil, fmt.Errorf("duplicate description order %d", description.Order)
+		}
+		seen[description.Order] = true
+		checked = append(checked, description)
+	}
+	return checked, nil
+}
+
+// checkIngredients mirrors the primary key (recipeId, createdBy, itemId).
+// Items are identified by their trimmed name, see insertItem
+func checkIngredients(ingredients []data.Ingredient) error {
+	seen := make(map[string]bool)
+	for _, ingredient := range ingredients {
+		name := strings.TrimSpace(ingredient.Name)
+		if seen[name] {
+			return fmt.Errorf("duplicate ingredient '%s'", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// checkImageFilenames mirrors the primary key (recipeId, createdBy, filename)
+func checkImageFilenames(filenames []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		if seen[filename] {
+			return nil, fmt.Errorf("duplicate image '%s'", filename)
+		}
+		seen[filename] = true
+	}
+	return append([]string{}, filenames...), nil
+}
+
+// convertIngredients must only be called after checkIngredients succeeded
+func (m *MemoryStore) convertIngredients(ingredients []data.Ingredient) []ingredientRow {
+	rows := make([]ingredientRow, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		item := m.insertItem(data.Item{Name: ingredient.Name, Icon: ingredient.Icon})
+		rows = append(rows, ingredientRow{
+			ItemId:       item.ItemId,
+			Quantity:     ingredient.Quantity,
+			QuantityType: ingredient.QuantityType,
+		})
+	}
+	return rows
+}
+
+func (m *MemoryStore) GetIngredientsForRecipe(recipeId int64, createdBy int64) ([]data.Ingredient, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getIngredients(data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy}), nil
+}
+
+func (m *MemoryStore) getIngredients(pk data.RecipePK) []data.Ingredient {
+	ingredients := make([]data.Ingredient, 0)
+	for _, row := range m.recipeIngredients[pk] {
+		item := m.items[row.ItemId]
+		ingredients = append(ingredients, data.Ingredient{
+			Name:         item.Name,
+			Icon:         item.Icon,
+			Quantity:     row.Quantity,
+			QuantityType: row.QuantityType,
+		})
+	}
+	return ingredients
+}
+
+func (m *MemoryStore) GetDescriptionsForRecipe(recipeId int64, createdBy int64) ([]data.RecipeDescription, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getDescriptions(data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy}), nil
+}
+
+func (m *MemoryStore) getDescriptions(pk data.RecipePK) []data.RecipeDescription {
+	descriptions := make([]data.RecipeDescription, 0)
+	descriptions = append(descriptions, m.recipeDescriptions[pk]...)
+	return descriptions
+}
+
+func (m *MemoryStore) GetRecipe(recipeId int64, createdBy int64) (data.Recipe, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getRecipe(data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy})
+}
+
+func (m *MemoryStore) getRecipe(pk data.RecipePK) (data.Recipe, error) {
+	recipe, exists := m.recipes[pk]
+	if !exists {
+		log.Printf("Failed to get recipe %d from %d: %s", pk.RecipeId, pk.CreatedBy, sql.ErrNoRows)
+		return data.Recipe{}, sql.ErrNoRows
+	}
+	recipeCreator, err := m.getUser(pk.CreatedBy)
+	if err != nil {
+		log.Printf("Failed to get recipe creator %d for recipe %d: %s", pk.CreatedBy, pk.RecipeId, err)
+		return data.Recipe{}, err
+	}
+	recipe.CreatedBy.Name = recipeCreator.Username
+	recipe.Ingredients = m.getIngredients(pk)
+	recipe.Description = m.getDescriptions(pk)
+	return recipe, nil
+}
+
+func (m *MemoryStore) GetRecipeForUserId(userId int64) ([]int64, error) {
+	log.Printf("Loading all recipes ids for user %d", userId)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	ownRecipeIds := make([]int64, 0)
+	for pk := range m.recipes {
+		if pk.CreatedBy == userId {
+			ownRecipeIds = append(ownRecipeIds, pk.RecipeId)
+		}
+	}
+	sort.Slice(ownRecipeIds, func(i, j int) bool { return ownRecipeIds[i] < ownRecipeIds[j] })
+	return ownRecipeIds, nil
+}
+
+func (m *MemoryStore) GetRecipeIdsSharedWithUserId(userId int64) ([]int64, []int64, error) {
+	log.Printf("Loading all recipes ids shared with user %d", userId)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	contained := make(map[data.RecipePK]bool)
+	for key := range m.sharedRecipes {
+		if key.SharedWith == userId {
+			contained[data.RecipePK{RecipeId: key.RecipeId, CreatedBy: key.CreatedBy}] = true
+		}
+	}
+	for key := range m.householdRecipes {
+		if m.isHouseholdMember(key.HouseholdId, userId) && key.CreatedBy != userId {
+			contained[data.RecipePK{RecipeId: key.RecipeId, CreatedBy: key.CreatedBy}] = true
+		}
+	}
+	shared := make([]data.RecipePK, 0, len(contained))
+	for pk := range contained {
+		shared = append(shared, pk)
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].CreatedBy != shared[j].CreatedBy {
+			return shared[i].CreatedBy < shared[j].CreatedBy
+		}
+		return shared[i].RecipeId < shared[j].RecipeId
+	})
+	sharedWithRecipeIds := make([]int64, 0)
+	sharedWithCreatedBy := make([]int64, 0)
+	for _, key := range shared {
+		sharedWithRecipeIds = append(sharedWithRecipeIds, key.RecipeId)
+		sharedWithCreatedBy = append(sharedWithCreatedBy, key.CreatedBy)
+	}
+	return sharedWithRecipeIds, sharedWithCreatedBy, nil
+}
+
+func (m *MemoryStore) IsRecipeSharedWithUser(userId int64, recipeId int64, createdBy int64) error {
+	log.Printf("Checking if recipe %d from %d is shared with %d", recipeId, createdBy, userId)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for key := range m.householdRecipes {
+		if key.RecipeId == recipeId && key.CreatedBy == createdBy && m.isHouseholdMember(key.HouseholdId, userId) {
+			return nil
+		}
+	}
+	if !m.sharedRecipes[recipeSharedKey{RecipeId: recipeId, CreatedBy: createdBy, SharedWith: userId}] {
+		log.Printf("Recipe %d from %d is not shared with %d", recipeId, createdBy, userId)
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetAllRecipes() ([]data.Recipe, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	recipes := make([]data.Recipe, 0)
+	for pk, recipe := range m.recipes {
+		recipe.Ingredients = m.getIngredients(pk)
+		recipe.Description = m.getDescriptions(pk)
+		recipes = append(recipes, recipe)
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		if recipes[i].CreatedBy.ID != recipes[j].CreatedBy.ID {
+			return recipes[i].CreatedBy.ID < recipes[j].CreatedBy.ID
+		}
+		return recipes[i].RecipeId < recipes[j].RecipeId
+	})
+	return recipes, nil
+}
+
+func (m *MemoryStore) UpdateRecipe(recipe data.Recipe, imageFilenames []string) error {
+	log.Printf("Updating recipe '%s'", recipe.Name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pk := data.RecipePK{RecipeId: recipe.RecipeId, CreatedBy: recipe.CreatedBy.ID}
+	existingRecipe, err := m.getRecipe(pk)
+	if err != nil {
+		log.Printf("The recipe to update was not found: %s", err)
+		return err
+	}
+	if existingRecipe.Version >= recipe.Version {
+		return errors.New(" recipe to update has the same or lower version than existing recipe")
+	}
+	images, err := checkImageFilenames(imageFilenames)
+	if err != nil {
+		log.Printf("Failed to update images: %s", err)
+		return err
+	}
+	if err := m.updateRecipe(pk, recipe); err != nil {
+		return err
+	}
+	m.recipeImages[pk] = images
+	return nil
+}
+
+func (m *MemoryStore) UpdateRecipeWithoutComparingVersion(recipeToUpdate data.Recipe) error {
+	log.Printf("Updating recipe %d from %d to version %d without compare", recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID, recipeToUpdate.Version)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pk := data.RecipePK{RecipeId: recipeToUpdate.RecipeId, CreatedBy: recipeToUpdate.CreatedBy.ID}
+	return m.updateRecipe(pk, recipeToUpdate)
+}
+
+func (m *MemoryStore) updateRecipe(pk data.RecipePK, recipe data.Recipe) error {
+	stored, exists := m.recipes[pk]
+	if !exists {
+		// The UPDATE statement simply does not match any row
+		return nil
+	}
+	descriptions, err := checkDescriptions(recipe.Description)
+	if err != nil {
+		log.Printf("Failed to update descriptions: %s", err)
+		return err
+	}
+	if err := checkIngredients(recipe.Ingredients); err != nil {
+		log.Printf("Failed to update ingredients: %s", err)
+		return err
+	}
+	ingredients := m.convertIngredients(recipe.Ingredients)
+	stored.Version = recipe.Version
+	stored.Name = recipe.Name
+	stored.LastUpdate = time.Now().UTC()
+	m.recipes[pk] = stored
+	m.recipeDescriptions[pk] = descriptions
+	m.recipeIngredients[pk] = ingredients
+	return nil
+}
+
+func (m *MemoryStore) DeleteRecipe(recipeId int64, createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteRecipeCascading(data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy})
+	return nil
+}
+
+func (m *MemoryStore) ResetRecipeTables() {
+	log.Print("RESETTING ALL RECIPES. CANNOT BE REVERTED!")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for pk := range m.recipes {
+		m.deleteRecipeCascading(pk)
+	}
+	log.Print("RESET RECIPE TABLES")
+}
+
+// ------------------------------------------------------------
+// Recipe Sharing Handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreateRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
+	log.Printf("Creating new sharing for %d of recipe %d from %d", sharedWith, recipeId, createdBy)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := recipeSharedKey{RecipeId: recipeId, CreatedBy: createdBy, SharedWith: sharedWith}
+	if m.sharedRecipes[key] {
+		return fmt.Errorf("duplicate sharing of recipe %d from %d with %d", recipeId, createdBy, sharedWith)
+	}
+	if _, exists := m.recipes[data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy}]; !exists {
+		return fmt.Errorf("recipe %d from %d does not exist", recipeId, createdBy)
+	}
+	if _, err := m.getUser(sharedWith); err != nil {
+		return fmt.Errorf("user %d to share with does not exist", sharedWith)
+	}
+	m.sharedRecipes[key] = true
+	return nil
+}
+
+func (m *MemoryStore) DeleteRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error {
+	log.Printf("Deleting sharing for %d of recipe %d from %d", sharedWith, recipeId, createdBy)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sharedRecipes, recipeSharedKey{RecipeId: recipeId, CreatedBy: createdBy, SharedWith: sharedWith})
+	return nil
+}
+
+func (m *MemoryStore) DeleteAllSharingForRecipe(recipeId int64, createdBy int64) error {
+	log.Printf("Deleting all sharing for recipe %d from %d", recipeId, createdBy)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key := range m.sharedRecipes {
+		if key.RecipeId == recipeId && key.CreatedBy == createdBy {
+			delete(m.sharedRecipes, key)
+		}
+	}
+	for key := range m.householdRecipes {
+		if key.RecipeId == recipeId && key.CreatedBy == createdBy {
+			delete(m.householdRecipes, key)
+		}
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// Households
+// ------------------------------------------------------------
+
+func (m *MemoryStore) isHouseholdMember(householdId int64, userId int64) bool {
+	_, exists := m.householdMembers[householdMemberKey{HouseholdId: householdId, UserId: userId}]
+	return exists
+}
+
+func (m *MemoryStore) CreateHousehold(name string, createdBy int64) (data.Household, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return data.Household{}, errors.New("household name is empty")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(createdBy); err != nil {
+		log.Printf("Failed to create household '%s' for %d: %s", name, createdBy, err)
+		return data.Household{}, err
+	}
+	household := data.Household{HouseholdId: m.nextHouseholdId, Name: name, CreatedBy: createdBy, Created: time.Now().UTC()}
+	m.nextHouseholdId++
+	m.households[household.HouseholdId] = household
+	m.householdMembers[householdMemberKey{HouseholdId: household.HouseholdId, UserId: createdBy}] = data.HouseholdMember{
+		UserId: createdBy,
+		Role:   data.HouseholdRoleOwner,
+		Joined: household.Created,
+	}
+	return m.getHousehold(household.HouseholdId)
+}
+
+func (m *MemoryStore) GetHousehold(householdId int64) (data.Household, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getHousehold(householdId)
+}
+
+func (m *MemoryStore) getHousehold(householdId int64) (data.Household, error) {
+	household, exists := m.households[householdId]
+	if !exists {
+		return data.Household{}, sql.ErrNoRows
+	}
+	household.Members = make([]data.HouseholdMember, 0)
+	for key, member := range m.householdMembers {
+		if key.HouseholdId != householdId {
+			continue
+		}
+		member.Username = m.users[key.UserId].Username
+		household.Members = append(household.Members, member)
+	}
+	sort.Slice(household.Members, func(i, j int) bool {
+		if !household.Members[i].Joined.Equal(household.Members[j].Joined) {
+			return household.Members[i].Joined.Before(household.Members[j].Joined)
+		}
+		return household.Members[i].UserId < household.Members[j].UserId
+	})
+	return household, nil
+}
+
+func (m *MemoryStore) GetHouseholdsForUser(userId int64) ([]data.Household, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	households := make([]data.Household, 0)
+	for key := range m.householdMembers {
+		if key.UserId != userId {
+			continue
+		}
+		household, err := m.getHousehold(key.HouseholdId)
+		if err != nil {
+			return []data.Household{}, err
+		}
+		households = append(households, household)
+	}
+	sort.Slice(households, func(i, j int) bool { return households[i].HouseholdId < households[j].HouseholdId })
+	return households, nil
+}
+
+func (m *MemoryStore) RenameHousehold(householdId int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("household name is empty")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	household, exists := m.households[householdId]
+	if !exists {
+		return nil
+	}
+	household.Name = name
+	m.households[householdId] = household
+	return nil
+}
+
+func (m *MemoryStore) DeleteHousehold(householdId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deleteHouseholdCascading(householdId)
+	return nil
+}
+
+func (m *MemoryStore) GetHouseholdRole(householdId int64, userId int64) (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	member, exists := m.householdMembers[householdMemberKey{HouseholdId: householdId, UserId: userId}]
+	if !exists {
+		return "", sql.ErrNoRows
+	}
+	return member.Role, nil
+}
+
+func (m *MemoryStore) SetHouseholdRole(householdId int64, userId int64, role string) error {
+	if !data.IsGrantableHouseholdRole(role) {
+		return fmt.Errorf("invalid household role '%s'", role)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := householdMemberKey{HouseholdId: householdId, UserId: userId}
+	member, exists := m.householdMembers[key]
+	if !exists {
+		return sql.ErrNoRows
+	}
+	member.Role = role
+	m.householdMembers[key] = member
+	return nil
+}
+
+func (m *MemoryStore) RemoveHouseholdMember(householdId int64, userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.householdMembers, householdMemberKey{HouseholdId: householdId, UserId: userId})
+	return nil
+}
+
+func (m *MemoryStore) CreateHouseholdInvitation(householdId int64, userId int64, invitedBy int64) (data.HouseholdInvitation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	household, exists := m.households[householdId]
+	if !exists {
+		return data.HouseholdInvitation{}, errors.New("household does not exist")
+	}
+	if _, err := m.getUser(userId); err != nil {
+		return data.HouseholdInvitation{}, errors.New("invited user does not exist")
+	}
+	if m.isHouseholdMember(householdId, userId) {
+		return data.HouseholdInvitation{}, errors.New("user is already a member")
+	}
+	key := householdMemberKey{HouseholdId: householdId, UserId: userId}
+	if _, exists := m.householdInvitations[key]; exists {
+		return data.HouseholdInvitation{}, fmt.Errorf("duplicate invitation of %d into household %d", userId, householdId)
+	}
+	invitation := data.HouseholdInvitation{
+		HouseholdId:   householdId,
+		HouseholdName: household.Name,
+		UserId:        userId,
+		InvitedBy:     invitedBy,
+		Created:       time.Now().UTC(),
+	}
+	m.householdInvitations[key] = invitation
+	return invitation, nil
+}
+
+func (m *MemoryStore) GetHouseholdInvitationsForUser(userId int64) ([]data.HouseholdInvitation, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	invitations := make([]data.HouseholdInvitation, 0)
+	for key, invitation := range m.householdInvitations {
+		if key.UserId == userId {
+			invitation.HouseholdName = m.households[key.HouseholdId].Name
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].HouseholdId < invitations[j].HouseholdId })
+	return invitations, nil
+}
+
+func (m *MemoryStore) AcceptHouseholdInvitation(householdId int64, userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := householdMemberKey{HouseholdId: householdId, UserId: userId}
+	if _, exists := m.householdInvitations[key]; !exists {
+		return sql.ErrNoRows
+	}
+	delete(m.householdInvitations, key)
+	m.householdMembers[key] = data.HouseholdMember{UserId: userId, Role: data.HouseholdRoleMember, Joined: time.Now().UTC()}
+	return nil
+}
+
+func (m *MemoryStore) DeleteHouseholdInvitation(householdId int64, userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.householdInvitations, householdMemberKey{HouseholdId: householdId, UserId: userId})
+	return nil
+}
+
+func (m *MemoryStore) ShareListWithHousehold(listId int64, createdBy int64, householdId int64, permission string) error {
+	if !data.IsGrantablePermission(permission) {
+		return fmt.Errorf("invalid permission '%s'", permission)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.lists[data.ListPK{ListID: listId, CreatedBy: createdBy}]; !exists {
+		return errors.New("shared list does not exist")
+	}
+	if _, exists := m.households[householdId]; !exists {
+		return errors.New("household does not exist")
+	}
+	m.householdLists[listHouseholdKey{ListId: listId, CreatedBy: createdBy, HouseholdId: householdId}] = permission
+	return nil
+}
+
+func (m *MemoryStore) GetListsSharedWithHousehold(householdId int64) ([]data.ListPK, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	lists := make([]data.ListPK, 0)
+	for key := range m.householdLists {
+		if key.HouseholdId == householdId {
+			lists = append(lists, data.ListPK{ListID: key.ListId, CreatedBy: key.CreatedBy})
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].CreatedBy != lists[j].CreatedBy {
+			return lists[i].CreatedBy < lists[j].CreatedBy
+		}
+		return lists[i].ListID < lists[j].ListID
+	})
+	return lists, nil
+}
+
+func (m *MemoryStore) ShareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := recipeHouseholdKey{RecipeId: recipeId, CreatedBy: createdBy, HouseholdId: householdId}
+	if m.householdRecipes[key] {
+		return fmt.Errorf("duplicate sharing of recipe %d from %d with household %d", recipeId, createdBy, householdId)
+	}
+	if _, exists := m.recipes[data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy}]; !exists {
+		return fmt.Errorf("recipe %d from %d does not exist", recipeId, createdBy)
+	}
+	if _, exists := m.households[householdId]; !exists {
+		return errors.New("household does not exist")
+	}
+	m.householdRecipes[key] = true
+	return nil
+}
+
+func (m *MemoryStore) UnshareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.householdRecipes, recipeHouseholdKey{RecipeId: recipeId, CreatedBy: createdBy, HouseholdId: householdId})
+	return nil
+}
+
+// ------------------------------------------------------------
+// Invite links
+// ------------------------------------------------------------
+
+func inviteUsable(invite data.Invite, now time.Time) bool {
+	return invite.ValidUntil.After(now) && (invite.MaxUses == 0 || invite.Uses < invite.MaxUses)
+}
+
+func (m *MemoryStore) CreateInvite(invite data.Invite) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.invites[invite.InviteId]; exists {
+		return fmt.Errorf("duplicate invite %s", invite.InviteId)
+	}
+	if _, err := m.getUser(invite.InvitedBy); err != nil {
+		log.Printf("Failed to create invite for %s %d: %s", invite.Type, invite.ResourceId, err)
+		return err
+	}
+	invite.Token = ""
+	m.invites[invite.InviteId] = invite
+	return nil
+}
+
+func (m *MemoryStore) GetInvite(inviteId string) (data.Invite, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	invite, exists := m.invites[inviteId]
+	if !exists {
+		return data.Invite{}, sql.ErrNoRows
+	}
+	return invite, nil
+}
+
+func (m *MemoryStore) GetPendingInvites(invitedBy int64, now time.Time) ([]data.Invite, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	invites := make([]data.Invite, 0)
+	for _, invite := range m.invites {
+		if invite.InvitedBy == invitedBy && inviteUsable(invite, now) {
+			invites = append(invites, invite)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		if invites[i].Created.Equal(invites[j].Created) {
+			return invites[i].InviteId < invites[j].InviteId
+		}
+		return invites[i].Created.Before(invites[j].Created)
+	})
+	return invites, nil
+}
+
+func (m *MemoryStore) RedeemInvite(invite data.Invite, userId int64, now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stored, exists := m.invites[invite.InviteId]
+	if !exists || !inviteUsable(stored, now) {
+		return sql.ErrNoRows
+	}
+	if !m.inviterMayShare(invite) {
+		return ErrInviterNotAllowed
+	}
+	var err error
+	switch invite.Type {
+	case data.InviteTypeList:
+		err = m.redeemListInvite(invite, userId)
+	case data.InviteTypeRecipe:
+		err = m.redeemRecipeInvite(invite, userId)
+	case data.InviteTypeHousehold:
+		err = m.redeemHouseholdInvite(invite, userId, now)
+	default:
+		err = fmt.Errorf("unknown invite type '%s'", invite.Type)
+	}
+	if err != nil {
+		return err
+	}
+	stored.Uses++
+	m.invites[invite.InviteId] = stored
+	return nil
+}
+
+// inviterMayShare repeats the permission check of the invite creation
+func (m *MemoryStore) inviterMayShare(invite data.Invite) bool {
+	switch invite.Type {
+	case data.InviteTypeList:
+		if invite.InvitedBy == invite.CreatedBy {
+			return true
+		}
+		permission, err := m.getSharePermission(invite.ResourceId, invite.CreatedBy, invite.InvitedBy)
+		return err == nil && data.PermissionAllows(permission, data.PermissionCoOwner)
+	case data.InviteTypeRecipe:
+		return invite.InvitedBy == invite.CreatedBy
+	case data.InviteTypeHousehold:
+		member, exists := m.householdMembers[householdMemberKey{HouseholdId: invite.ResourceId, UserId: invite.InvitedBy}]
+		return exists && data.HouseholdRoleAllows(member.Role, data.HouseholdRoleAdmin)
+	}
+	return false
+}
+
+// redeemListInvite accepts the share, never lowering an existing permission
+func (m *MemoryStore) redeemListInvite(invite data.Invite, userId int64) error {
+	key := listSharedKey{ListId: invite.ResourceId, CreatedBy: invite.CreatedBy, SharedWithId: userId}
+	if existing, exists := m.sharedLists[key]; exists {
+		if existing.Status == data.ShareStatusAccepted {
+			existing.Permission = data.HigherPermission(existing.Permission, invite.Permission)
+		} else {
+			existing.Permission = invite.Permission
+		}
+		existing.Status = data.ShareStatusAccepted
+		m.sharedLists[key] = existing
+		return nil
+	}
+	if err := m.checkUserAndListExist(invite.ResourceId, invite.CreatedBy, userId); err != nil {
+		return err
+	}
+	m.sharedLists[key] = data.ListShared{ListId: invite.ResourceId, CreatedBy: invite.CreatedBy, SharedWithId: userId, Created: time.Now(), Permission: invite.Permission, Status: data.ShareStatusAccepted}
+	return nil
+}
+
+func (m *MemoryStore) redeemRecipeInvite(invite data.Invite, userId int64) error {
+	key := recipeSharedKey{RecipeId: invite.ResourceId, CreatedBy: invite.CreatedBy, SharedWith: userId}
+	if m.sharedRecipes[key] {
+		return nil
+	}
+	if _, exists := m.recipes[data.RecipePK{RecipeId: invite.ResourceId, CreatedBy: invite.CreatedBy}]; !exists {
+		return fmt.Errorf("recipe %d from %d does not exist", invite.ResourceId, invite.CreatedBy)
+	}
+	if _, err := m.getUser(userId); err != nil {
+		return fmt.Errorf("user %d to share with does not exist", userId)
+	}
+	m.sharedRecipes[key] = true
+	return nil
+}
+
+// redeemHouseholdInvite accepts an existing invitation of the user as well
+func (m *MemoryStore) redeemHouseholdInvite(invite data.Invite, userId int64, now time.Time) error {
+	if m.isHouseholdMember(invite.ResourceId, userId) {
+		return nil
+	}
+	if _, exists := m.households[invite.ResourceId]; !exists {
+		return errors.New("household does not exist")
+	}
+	if _, err := m.getUser(userId); err != nil {
+		return errors.New("invited user does not exist")
+	}
+	key := householdMemberKey{HouseholdId: invite.ResourceId, UserId: userId}
+	delete(m.householdInvitations, key)
+	m.householdMembers[key] = data.HouseholdMember{UserId: userId, Role: data.HouseholdRoleMember, Joined: now}
+	return nil
+}
+
+func (m *MemoryStore) DeleteInvite(inviteId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.invites, inviteId)
+	return nil
+}
+
+// ------------------------------------------------------------
+// Image handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) StoreRecipeImageFilenames(filenames []string, recipePK data.RecipePK) ([]string, error) {
+	if len(filenames) == 0 {
+		log.Printf("No images for recipe %d found", recipePK.RecipeId)
+		return []string{}, nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.recipes[recipePK]; !exists {
+		return filenames, fmt.Errorf("recipe %d from %d does not exist", recipePK.RecipeId, recipePK.CreatedBy)
+	}
+	existing := make(map[string]bool)
+	for _, filename := range m.recipeImages[recipePK] {
+		existing[filename] = true
+	}
+	for _, filename := range filenames {
+		if existing[filename] {
+			return filenames, fmt.Errorf("duplicate image '%s'", filename)
+		}
+		existing[filename] = true
+	}
+	m.recipeImages[recipePK] = append(m.recipeImages[recipePK], filenames...)
+	return filenames, nil
+}
+
+func (m *MemoryStore) GetImageNamesForRecipe(recipeId int64, createdBy int64) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	filenames := make([]string, 0)
+	filenames = append(filenames, m.recipeImages[data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy}]...)
+	return filenames, nil
+}
+
+func (m *MemoryStore) RemoveImagesForRecipe(recipeId int64, createdBy int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.recipeImages, data.RecipePK{RecipeId: recipeId, CreatedBy: createdBy})
+	return nil
+}
+
+// ------------------------------------------------------------
+// Token handling
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreateSession(session data.Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.sessions[session.SessionId]; exists {
+		return errors.New("duplicate session")
+	}
+	if _, err := m.getUser(session.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", session.UserId)
+	}
+	m.sessions[session.SessionId] = session
+	return nil
+}
+
+func (m *MemoryStore) GetSession(sessionId string) (data.Session, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	session, exists := m.sessions[sessionId]
+	if !exists {
+		return data.Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (m *MemoryStore) GetSessionsForUser(userId int64) ([]data.Session, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	sessions := make([]data.Session, 0)
+	for _, session := range m.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeen.Equal(sessions[j].LastSeen) {
+			return sessions[i].LastSeen.After(sessions[j].LastSeen)
+		}
+		return sessions[i].Created.After(sessions[j].Created)
+	})
+	return sessions, nil
+}
+
+func (m *MemoryStore) TouchSession(sessionId string, ip string, seen time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	session, exists := m.sessions[sessionId]
+	if !exists {
+		return nil
+	}
+	if session.LastSeen.Before(seen.Add(-sessionTouchInterval)) || session.IP != ip {
+		session.LastSeen = seen
+		session.IP = ip
+		m.sessions[sessionId] = session
+	}
+	return nil
+}
+
+// deleteSessions removes the matching sessions together with their tokens
+func (m *MemoryStore) deleteSessions(matches func(session data.Session) bool) int64 {
+	var removed int64
+	for sessionId, session := range m.sessions {
+		if matches(session) {
+			delete(m.sessions, sessionId)
+			m.deleteTokens(func(token data.TokenData) bool { return token.SessionId == sessionId })
+			m.deleteRefreshTokens(func(token data.RefreshToken) bool { return token.FamilyId == sessionId })
+			removed++
+		}
+	}
+	return removed
+}
+
+func (m *MemoryStore) DeleteSession(sessionId string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteSessions(func(session data.Session) bool { return session.SessionId == sessionId }), nil
+}
+
+func (m *MemoryStore) DeleteSessionsForUser(userId int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteSessions(func(session data.Session) bool { return session.UserId == userId }), nil
+}
+
+func (m *MemoryStore) InsertToken(token data.TokenData) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.tokens[token.TokenId]; exists {
+		return fmt.Errorf("duplicate token for user %d", token.UserId)
+	}
+	if _, err := m.getUser(token.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", token.UserId)
+	}
+	if _, exists := m.sessions[token.SessionId]; !exists {
+		return errors.New("session does not exist")
+	}
+	m.tokens[token.TokenId] = token
+	return nil
+}
+
+func (m *MemoryStore) GetToken(tokenId string) (data.TokenData, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	token, exists := m.tokens[tokenId]
+	if !exists {
+		return data.TokenData{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func (m *MemoryStore) deleteTokens(matches func(token data.TokenData) bool) int64 {
+	var removed int64
+	for tokenId, token := range m.tokens {
+		if matches(token) {
+			delete(m.tokens, tokenId)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (m *MemoryStore) DeleteToken(tokenId string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteTokens(func(token data.TokenData) bool { return token.TokenId == tokenId }), nil
+}
+
+func (m *MemoryStore) DeleteTokensForSession(sessionId string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteTokens(func(token data.TokenData) bool { return token.SessionId == sessionId }), nil
+}
+
+func (m *MemoryStore) DeleteTokensForUser(userId int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteTokens(func(token data.TokenData) bool { return token.UserId == userId }), nil
+}
+
+func (m *MemoryStore) DeleteExpiredTokens(before time.Time) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteTokens(func(token data.TokenData) bool { return token.ValidUntil.Before(before) }), nil
+}
+
+func (m *MemoryStore) GetTokensForUser(userId int64) ([]data.TokenData, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	tokens := make([]data.TokenData, 0)
+	for _, token := range m.tokens {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ValidUntil.After(tokens[j].ValidUntil) })
+	return tokens, nil
+}
+
+func (m *MemoryStore) InsertRefreshToken(token data.RefreshToken) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.refreshTokens[token.TokenHash]; exists {
+		return errors.New("duplicate refresh token")
+	}
+	if _, err := m.getUser(token.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", token.UserId)
+	}
+	if _, exists := m.sessions[token.FamilyId]; !exists {
+		return errors.New("session does not exist")
+	}
+	m.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *MemoryStore) GetRefreshToken(tokenHash string) (data.RefreshToken, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	token, exists := m.refreshTokens[tokenHash]
+	if !exists {
+		return data.RefreshToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func (m *MemoryStore) UseRefreshToken(tokenHash string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	token, exists := m.refreshTokens[tokenHash]
+	if !exists || token.Used {
+		return sql.ErrNoRows
+	}
+	token.Used = true
+	m.refreshTokens[tokenHash] = token
+	return nil
+}
+
+func (m *MemoryStore) deleteRefreshTokens(matches func(token data.RefreshToken) bool) int64 {
+	var removed int64
+	for tokenHash, token := range m.refreshTokens {
+		if matches(token) {
+			delete(m.refreshTokens, tokenHash)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (m *MemoryStore) DeleteRefreshTokensForUser(userId int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteRefreshTokens(func(token data.RefreshToken) bool { return token.UserId == userId }), nil
+}
+
+func (m *MemoryStore) DeleteExpiredRefreshTokens(before time.Time) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.deleteRefreshTokens(func(token data.RefreshToken) bool { return token.ValidUntil.Before(before) }), nil
+}
+
+// ------------------------------------------------------------
+// Pending password resets
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreatePasswordReset(reset data.PasswordReset) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(reset.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", reset.UserId)
+	}
+	m.passwordResets[reset.UserId] = reset
+	return nil
+}
+
+func (m *MemoryStore) GetPasswordReset(userId int64) (data.PasswordReset, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	reset, exists := m.passwordResets[userId]
+	if !exists {
+		return data.PasswordReset{}, sql.ErrNoRows
+	}
+	return reset, nil
+}
+
+func (m *MemoryStore) IncreasePasswordResetAttempts(userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if reset, exists := m.passwordResets[userId]; exists {
+		reset.Attempts++
+		m.passwordResets[userId] = reset
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeletePasswordReset(userId int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.passwordResets[userId]; !exists {
+		return 0, nil
+	}
+	delete(m.passwordResets, userId)
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteExpiredPasswordResets(before time.Time) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var removed int64
+	for userId, reset := range m.passwordResets {
+		if reset.ValidUntil.Before(before) {
+			delete(m.passwordResets, userId)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ------------------------------------------------------------
+// Second factor and recovery codes
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreateTOTP(totp data.TOTP) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(totp.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", totp.UserId)
+	}
+	m.totps[totp.UserId] = totp
+	delete(m.recoveryCodes, totp.UserId)
+	return nil
+}
+
+func (m *MemoryStore) GetTOTP(userId int64) (data.TOTP, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	totp, exists := m.totps[userId]
+	if !exists {
+		return data.TOTP{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+func (m *MemoryStore) EnableTOTP(userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	totp, exists := m.totps[userId]
+	if !exists {
+		return sql.ErrNoRows
+	}
+	totp.Enabled = true
+	m.totps[userId] = totp
+	return nil
+}
+
+func (m *MemoryStore) UseTOTPStep(userId int64, step int64) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	totp, exists := m.totps[userId]
+	if !exists || totp.LastUsedStep >= step {
+		return 0, nil
+	}
+	totp.LastUsedStep = step
+	m.totps[userId] = totp
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteTOTP(userId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.totps, userId)
+	delete(m.recoveryCodes, userId)
+	return nil
+}
+
+func (m *MemoryStore) ReplaceRecoveryCodes(userId int64, codeHashes []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(userId); err != nil {
+		return fmt.Errorf("user %d does not exist", userId)
+	}
+	codes := make(map[string]bool, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes[codeHash] = true
+	}
+	m.recoveryCodes[userId] = codes
+	return nil
+}
+
+func (m *MemoryStore) UseRecoveryCode(userId int64, codeHash string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.recoveryCodes[userId][codeHash] {
+		return 0, nil
+	}
+	delete(m.recoveryCodes[userId], codeHash)
+	return 1, nil
+}
+
+func (m *MemoryStore) CountRecoveryCodes(userId int64) (int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.recoveryCodes[userId]), nil
+}
+
+// ------------------------------------------------------------
+// Accounts of OpenID Connect providers
+// ------------------------------------------------------------
+
+func (m *MemoryStore) CreateOIDCIdentity(identity data.OIDCIdentity) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, err := m.getUser(identity.UserId); err != nil {
+		return fmt.Errorf("user %d does not exist", identity.UserId)
+	}
+	key := oidcIdentityKey{issuer: identity.Issuer, subject: identity.Subject}
+	if _, exists := m.oidcIdentities[key]; exists {
+		return fmt.Errorf("identity %s of %s is already linked", identity.Subject, identity.Issuer)
+	}
+	m.oidcIdentities[key] = identity
+	return nil
+}
+
+func (m *MemoryStore) GetOIDCIdentity(issuer string, subject string) (data.OIDCIdentity, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	identity, exists := m.oidcIdentities[oidcIdentityKey{issuer: issuer, subject: subject}]
+	if !exists {
+		return data.OIDCIdentity{}, sql.ErrNoRows
+	}
+	return identity, nil
+}
+
+// ------------------------------------------------------------
+// Debug printout and functionality
+// ------------------------------------------------------------
+
+func (m *MemoryStore) PrintUserTable(tableName string) {
+	users, _ := m.GetAllUsers()
+	log.Print("------------- User Table -------------")
+	for _, user := range users {
+		log.Printf("%v", user)
+	}
+	log.Print("---------------------------------------")
+}
+
+func (m *MemoryStore) PrintShoppingListTable() {
+	lists, _ := m.GetAllRawShoppingLists()
+	log.Print("------------- Shopping List Table -------------")
+	for _, list := range lists {
+		log.Printf("%v", list)
+	}
+	log.Print("---------------------------------------")
+}
+
+func (m *MemoryStore) PrintItemTable() {
+	items, _ := m.GetAllItems()
+	log.Print("------------- Item Table -------------")
+	for _, item := range items {
+		log.Printf("%v", item)
+	}
+	log.Print("---------------------------------------")
+}
+
+func (m *MemoryStore) PrintItemPerListTable() {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	log.Print("------------- Item Table -------------")
+	for _, mapping := range m.listItems {
+		log.Printf("%v", mapping)
+	}
+	log.Print("---------------------------------------")
+}
+
+func (m *MemoryStore) PrintSharingTable() {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	log.Print("------------- Sharing Table -------------")
+	for _, sharing := range m.sharedLists {
+		log.Printf("%v", sharing)
+	}
+	log.Print("---------------------------------------")
+}
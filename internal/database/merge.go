@@ -0,0 +1,176 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Merging concurrent list updates
+// ------------------------------------------------------------
+
+// listItemFromWire converts an item of the list into the mapping stored per list
+func listItemFromWire(list data.List, item data.ItemWire, itemId int64, position int64) data.ListItem {
+	mapping := data.ListItem{
+		ListId:    list.ListId,
+		ItemId:    itemId,
+		Quantity:  item.Quantity,
+		Checked:   item.Checked,
+		CreatedBy: list.CreatedBy.ID,
+		AddedBy:   item.AddedBy,
+		Position:  position,
+	}
+	if item.Updated != nil {
+		mapping.QuantityUpdated = item.Updated.Quantity
+		mapping.CheckedUpdated = item.Updated.Checked
+	}
+	return mapping
+}
+
+// withEditTimes sets the edit times that are not known to now
+func withEditTimes(mapping data.ListItem, now time.Time) data.ListItem {
+	if mapping.QuantityUpdated.IsZero() {
+		mapping.QuantityUpdated = now
+	}
+	if mapping.CheckedUpdated.IsZero() {
+		mapping.CheckedUpdated = now
+	}
+	return mapping
+}
+
+func itemEditTimes(item data.ItemWire, fallback time.Time) data.ItemUpdated {
+	updated := data.ItemUpdated{}
+	if item.Updated != nil {
+		updated = *item.Updated
+	}
+	if updated.Quantity.IsZero() {
+		updated.Quantity = fallback
+	}
+	if updated.Checked.IsZero() {
+		updated.Checked = fallback
+	}
+	return updated
+}
+
+// mergeShoppingList merges the list sent by a client into the stored list (including its items).
+// If the client knew the stored version its list is taken as is. Otherwise, items are matched
+// by name and per field the later change wins. On equal times the stored value is kept, so the
+// result does not depend on the order in which concurrent updates arrive.
+// Items only existing on the server are kept, because they might have been added concurrently,
+// unless the client removed them and they were not changed on the server afterwards.
+// The items sent by the client keep their index, so that failing items can be reported.
+func mergeShoppingList(stored data.List, incoming data.List) (data.List, []data.ListConflict) {
+	conflicts := make([]data.ListConflict, 0)
+	merged := incoming
+	merged.RemovedItems = nil
+	merged.Version = max(stored.Version+1, incoming.Version)
+	if incoming.Version > stored.Version {
+		return merged, conflicts
+	}
+
+	if incoming.Title != stored.Title {
+		conflict := data.ListConflict{
+			Field:       data.ConflictFieldTitle,
+			ServerValue: stored.Title,
+			ClientValue: incoming.Title,
+			Resolution:  data.ResolutionClient,
+		}
+		if !incoming.LastUpdated.After(stored.LastUpdated) {
+			merged.Title = stored.Title
+			conflict.Resolution = data.ResolutionServer
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	storedItems := make(map[string]data.ItemWire)
+	for _, item := range stored.Items {
+		storedItems[strings.TrimSpace(item.Name)] = item
+	}
+	removed := make(map[string]bool)
+	for _, name := range incoming.RemovedItems {
+		removed[strings.TrimSpace(name)] = true
+	}
+	merged.Items = make([]data.ItemWire, 0, len(incoming.Items)+len(stored.Items))
+	for _, item := range incoming.Items {
+		name := strings.TrimSpace(item.Name)
+		storedItem, exists := storedItems[name]
+		if !exists {
+			merged.Items = append(merged.Items, item)
+			continue
+		}
+		delete(storedItems, name)
+		mergedItem, itemConflicts := mergeItem(storedItem, item, stored.LastUpdated, incoming.LastUpdated)
+		merged.Items = append(merged.Items, mergedItem)
+		conflicts = append(conflicts, itemConflicts...)
+	}
+	for _, item := range stored.Items {
+		name := strings.TrimSpace(item.Name)
+		if _, onlyStored := storedItems[name]; !onlyStored {
+			continue
+		}
+		delete(storedItems, name)
+		if removed[name] && !itemChangedAfter(item, stored.LastUpdated, incoming.LastUpdated) {
+			continue
+		}
+		merged.Items = append(merged.Items, item)
+		conflicts = append(conflicts, data.ListConflict{
+			Item:        name,
+			Field:       data.ConflictFieldItem,
+			ServerValue: true,
+			ClientValue: false,
+			Resolution:  data.ResolutionServer,
+		})
+	}
+	return merged, conflicts
+}
+
+// itemChangedAfter tells whether the item was edited on the server after the client removed it
+func itemChangedAfter(item data.ItemWire, storedListUpdated time.Time, removedAt time.Time) bool {
+	times := itemEditTimes(item, storedListUpdated)
+	return times.Quantity.After(removedAt) || times.Checked.After(removedAt)
+}
+
+// mergeItem merges the quantity and checked flag independently. The person that
+// added the item first is kept. Missing edit times default to the last change of the list.
+func mergeItem(stored data.ItemWire, incoming data.ItemWire, storedListUpdated time.Time, incomingListUpdated time.Time) (data.ItemWire, []data.ListConflict) {
+	storedTimes := itemEditTimes(stored, storedListUpdated)
+	incomingTimes := itemEditTimes(incoming, incomingListUpdated)
+	name := strings.TrimSpace(incoming.Name)
+	conflicts := make([]data.ListConflict, 0)
+
+	merged := incoming
+	merged.AddedBy = stored.AddedBy
+	if merged.AddedBy == 0 {
+		merged.AddedBy = incoming.AddedBy
+	}
+	mergedTimes := incomingTimes
+
+	if stored.Quantity != incoming.Quantity {
+		conflict := data.ListConflict{Item: name, Field: data.ConflictFieldQuantity, ServerValue: stored.Quantity, ClientValue: incoming.Quantity, Resolution: data.ResolutionClient}
+		if !incomingTimes.Quantity.After(storedTimes.Quantity) {
+			merged.Quantity = stored.Quantity
+			mergedTimes.Quantity = storedTimes.Quantity
+			conflict.Resolution = data.ResolutionServer
+		}
+		conflicts = append(conflicts, conflict)
+	} else if storedTimes.Quantity.After(incomingTimes.Quantity) {
+		mergedTimes.Quantity = storedTimes.Quantity
+	}
+
+	if stored.Checked != incoming.Checked {
+		conflict := data.ListConflict{Item: name, Field: data.ConflictFieldChecked, ServerValue: stored.Checked, ClientValue: incoming.Checked, Resolution: data.ResolutionClient}
+		if !incomingTimes.Checked.After(storedTimes.Checked) {
+			merged.Checked = stored.Checked
+			mergedTimes.Checked = storedTimes.Checked
+			conflict.Resolution = data.ResolutionServer
+		}
+		conflicts = append(conflicts, conflict)
+	} else if storedTimes.Checked.After(incomingTimes.Checked) {
+		mergedTimes.Checked = storedTimes.Checked
+	}
+
+	merged.Updated = &mergedTimes
+	return merged, conflicts
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func editedAt(quantity time.Time, checked time.Time) *data.ItemUpdated {
+	return &data.ItemUpdated{Quantity: quantity, Checked: checked}
+}
+
+func TestMergeKnownVersionIsTakenAsIs(t *testing.T) {
+	now := time.Now().UTC()
+	stored := createListBase("stored", 1)
+	stored.Version = 3
+	stored.Items = []data.ItemWire{{Name: "Milk", Quantity: 1, AddedBy: 1, Updated: editedAt(now, now)}}
+	incoming := createListBase("incoming", 1)
+	incoming.Title = "Renamed"
+	incoming.Version = 4
+	incoming.Items = []data.ItemWire{{Name: "Bread", Quantity: 2, AddedBy: 1}}
+
+	merged, conflicts := mergeShoppingList(stored, incoming)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, incoming, merged)
+}
+
+func TestMergeConcurrentItemChanges(t *testing.T) {
+	before := time.Now().UTC().Add(-time.Hour)
+	earlier := before.Add(10 * time.Minute)
+	later := before.Add(20 * time.Minute)
+	stored := createListBase("stored", 1)
+	stored.Version = 5
+	stored.LastUpdated = later
+	stored.Items = []data.ItemWire{
+		{ItemId: 1, Name: "Milk", Quantity: 2, Checked: true, AddedBy: 1, Updated: editedAt(earlier, later)},
+		{ItemId: 2, Name: "Eggs", Quantity: 6, AddedBy: 2, Updated: editedAt(later, before)},
+		{ItemId: 3, Name: "Flour", Quantity: 1, AddedBy: 2, Updated: editedAt(before, before)},
+	}
+	incoming := createListBase("incoming", 1)
+	incoming.Title = "Renamed"
+	incoming.Version = 5
+	incoming.LastUpdated = earlier
+	incoming.Items = []data.ItemWire{
+		// Quantity changed later by the client, checked later on the server
+		{Name: "Milk ", Quantity: 3, Checked: false, AddedBy: 3, Updated: editedAt(later, earlier)},
+		// Same time on both sides keeps the server value
+		{Name: "Eggs", Quantity: 12, AddedBy: 3, Updated: editedAt(later, before)},
+		{Name: "Butter", Quantity: 1, AddedBy: 3},
+	}
+
+	merged, conflicts := mergeShoppingList(stored, incoming)
+	assert.Equal(t, int64(6), merged.Version)
+	assert.Equal(t, stored.Title, merged.Title)
+	assert.Equal(t, 4, len(merged.Items))
+
+	milk := merged.Items[0]
+	assert.Equal(t, int64(3), milk.Quantity)
+	assert.True(t, milk.Checked)
+	assert.Equal(t, int64(1), milk.AddedBy)
+	assert.Equal(t, editedAt(later, later), milk.Updated)
+	assert.Equal(t, int64(6), merged.Items[1].Quantity)
+	assert.Equal(t, "Butter", merged.Items[2].Name)
+	assert.Equal(t, "Flour", merged.Items[3].Name)
+
+	assert.Equal(t, []data.ListConflict{
+		{Field: data.ConflictFieldTitle, ServerValue: stored.Title, ClientValue: incoming.Title, Resolution: data.ResolutionServer},
+		{Item: "Milk", Field: data.ConflictFieldQuantity, ServerValue: int64(2), ClientValue: int64(3), Resolution: data.ResolutionClient},
+		{Item: "Milk", Field: data.ConflictFieldChecked, ServerValue: true, ClientValue: false, Resolution: data.ResolutionServer},
+		{Item: "Eggs", Field: data.ConflictFieldQuantity, ServerValue: int64(6), ClientValue: int64(12), Resolution: data.ResolutionServer},
+		{Item: "Flour", Field: data.ConflictFieldItem, ServerValue: true, ClientValue: false, Resolution: data.ResolutionServer},
+	}, conflicts)
+}
+
+func TestMergeIsIndependentOfOrder(t *testing.T) {
+	edited := time.Now().UTC()
+	stored := createListBase("stored", 1)
+	stored.Version = 2
+	first := createListBase("first", 1)
+	first.Version = 3
+	first.Items = []data.ItemWire{{Name: "Milk", Quantity: 1, AddedBy: 1, Updated: editedAt(edited, edited)}}
+	second := createListBase("second", 1)
+	second.Version = 3
+	second.Items = []data.ItemWire{{Name: "Milk", Quantity: 2, AddedBy: 2, Updated: editedAt(edited.Add(time.Second), edited)}}
+
+	afterFirst, _ := mergeShoppingList(stored, first)
+	resultFirstThenSecond, _ := mergeShoppingList(afterFirst, second)
+	afterSecond, _ := mergeShoppingList(stored, second)
+	resultSecondThenFirst, _ := mergeShoppingList(afterSecond, first)
+	assert.Equal(t, int64(2), resultFirstThenSecond.Items[0].Quantity)
+	assert.Equal(t, resultFirstThenSecond.Items[0].Quantity, resultSecondThenFirst.Items[0].Quantity)
+}
+
+func TestMergeRemovedItems(t *testing.T) {
+	before := time.Now().UTC().Add(-time.Hour)
+	removedAt := before.Add(10 * time.Minute)
+	stored := createListBase("stored", 1)
+	stored.Version = 4
+	stored.LastUpdated = removedAt.Add(5 * time.Minute)
+	stored.Items = []data.ItemWire{
+		{ItemId: 1, Name: "Milk", Quantity: 1, AddedBy: 1, Updated: editedAt(before, before)},
+		{ItemId: 2, Name: "Eggs", Quantity: 6, AddedBy: 2, Updated: editedAt(before, before)},
+		{ItemId: 3, Name: "Flour", Quantity: 2, AddedBy: 2, Updated: editedAt(before, removedAt.Add(time.Minute))},
+		{ItemId: 4, Name: "Butter", Quantity: 1, AddedBy: 2, Updated: editedAt(removedAt.Add(time.Minute), removedAt.Add(time.Minute))},
+	}
+	// The client removed the eggs and the flour, the butter was added on the server in the meantime
+	incoming := createListBase("stored", 1)
+	incoming.Version = 4
+	incoming.LastUpdated = removedAt
+	incoming.Items = []data.ItemWire{{Name: "Milk", Quantity: 1, AddedBy: 1, Updated: editedAt(before, before)}}
+	incoming.RemovedItems = []string{"Eggs", "Flour "}
+
+	merged, conflicts := mergeShoppingList(stored, incoming)
+	assert.Nil(t, merged.RemovedItems)
+	assert.Equal(t, 3, len(merged.Items))
+	assert.Equal(t, "Milk", merged.Items[0].Name)
+	// Checked on the server after the removal
+	assert.Equal(t, "Flour", merged.Items[1].Name)
+	assert.Equal(t, "Butter", merged.Items[2].Name)
+	assert.Equal(t, []data.ListConflict{
+		{Item: "Flour", Field: data.ConflictFieldItem, ServerValue: true, ClientValue: false, Resolution: data.ResolutionServer},
+		{Item: "Butter", Field: data.ConflictFieldItem, ServerValue: true, ClientValue: false, Resolution: data.ResolutionServer},
+	}, conflicts)
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ------------------------------------------------------------
+// Versioned schema migrations
+// ------------------------------------------------------------
+
+// The migrations are stored per dialect as <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Both dialects must contain the same versions.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const createSchemaVersionTableQuery = "CREATE TABLE IF NOT EXISTS schema_version (version INT NOT NULL, name VARCHAR(256) NOT NULL, appliedAt DATETIME NOT NULL, PRIMARY KEY (version))"
+const getSchemaVersionsQuery = "SELECT version, appliedAt FROM schema_version"
+const insertSchemaVersionQuery = "INSERT INTO schema_version (version, name, appliedAt) VALUES (?, ?, ?)"
+const deleteSchemaVersionQuery = "DELETE FROM schema_version WHERE version = ?"
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect '%s': %w", dialect, err)
+	}
+	migrations := make(map[int]*Migration)
+	for _, entry := range entries {
+		filename := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(filename, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(filename, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(filename, "."+direction+".sql")
+		strVersion, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("migration '%s' not in format <version>_<name>", filename)
+		}
+		version, err := strconv.Atoi(strVersion)
+		if err != nil {
+			return nil, fmt.Errorf("migration '%s' has no valid version: %w", filename, err)
+		}
+		content, err := migrationFiles.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		migration, exists := migrations[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			migrations[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+	ordered := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		ordered = append(ordered, *migration)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Version < ordered[j].Version })
+	return ordered, nil
+}
+
+// splitStatements splits a migration file into single statements because
+// the MySQL driver does not execute multiple statements at once
+func splitStatements(content string) []string {
+	var withoutComments strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		withoutComments.WriteString(line)
+		withoutComments.WriteString("\n")
+	}
+	statements := make([]string, 0)
+	for _, statement := range strings.Split(withoutComments.String(), ";") {
+		statement = strings.TrimSpace(statement)
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+func (s *SQLStore) appliedMigrations() (map[int]time.Time, error) {
+	if _, err := s.db.Exec(createSchemaVersionTableQuery); err != nil {
+		return nil, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	rows, err := s.db.Query(getSchemaVersionsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s *SQLStore) runMigration(migration Migration, content string, record func(tx *sql.Tx) error) error {
+	// Using a single transaction keeps all statements on the same connection
+	// (required for SET FOREIGN_KEY_CHECKS) and makes the migration atomic where the dialect allows it
+	return s.inTransaction(func(tx *sql.Tx) error {
+		for _, statement := range splitStatements(content) {
+			if _, err := tx.Exec(statement); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+		}
+		return record(tx)
+	})
+}
+
+// MigrateUp applies all migrations that are not yet applied in order
+func (s *SQLStore) MigrateUp() error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if _, exists := applied[migration.Version]; exists {
+			continue
+		}
+		log.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+		err := s.runMigration(migration, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(insertSchemaVersionQuery, migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the given number of the latest applied migrations
+func (s *SQLStore) MigrateDown(steps int) error {
+	if steps <= 0 {
+		return errors.New("number of migrations to revert must be positive")
+	}
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if _, exists := applied[migration.Version]; !exists {
+			continue
+		}
+		log.Printf("Reverting migration %d_%s", migration.Version, migration.Name)
+		err := s.runMigration(migration, migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(deleteSchemaVersionQuery, migration.Version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus lists all known migrations and if they are applied
+func (s *SQLStore) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		appliedAt, exists := applied[migration.Version]
+		states = append(states, MigrationState{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   exists,
+			AppliedAt: appliedAt,
+		})
+	}
+	return states, nil
+}
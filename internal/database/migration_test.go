@@ -0,0 +1,81 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+// ------------------------------------------------------------
+// Testing the schema migrations against the SQLite backend
+// ------------------------------------------------------------
+
+func TestMigrationsHaveUpAndDown(t *testing.T) {
+	for _, dialect := range []string{configuration.DriverMySQL, configuration.DriverSQLite} {
+		migrations, err := loadMigrations(dialect)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, migrations)
+		for i, migration := range migrations {
+			assert.Equal(t, i+1, migration.Version, "migrations of %s must be numbered without gaps", dialect)
+			assert.NotEmpty(t, migration.Up, "%s migration %d has no up", dialect, migration.Version)
+			assert.NotEmpty(t, migration.Down, "%s migration %d has no down", dialect, migration.Version)
+		}
+	}
+	mysqlMigrations, _ := loadMigrations(configuration.DriverMySQL)
+	sqliteMigrations, _ := loadMigrations(configuration.DriverSQLite)
+	assert.Equal(t, len(mysqlMigrations), len(sqliteMigrations))
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("-- comment; with semicolon\nCREATE TABLE a (id INT);\n\nDROP TABLE b;\n")
+	assert.Equal(t, []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}, statements)
+}
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	config := configuration.DatabaseConfig{
+		Driver: configuration.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "migrate.db"),
+	}
+	sqliteStore, err := ConnectSQLiteDatabase(config)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	defer sqliteStore.Close()
+
+	states, err := sqliteStore.MigrationStatus()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, states)
+	for _, state := range states {
+		assert.False(t, state.Applied)
+	}
+
+	assert.Nil(t, sqliteStore.MigrateUp())
+	// Applying twice must not fail
+	assert.Nil(t, sqliteStore.MigrateUp())
+	states, err = sqliteStore.MigrationStatus()
+	assert.Nil(t, err)
+	for _, state := range states {
+		assert.True(t, state.Applied)
+	}
+	_, err = sqliteStore.CreateUserAccountInDatabase("migrated user", "password")
+	assert.Nil(t, err)
+
+	assert.Nil(t, sqliteStore.MigrateDown(1))
+	states, err = sqliteStore.MigrationStatus()
+	assert.Nil(t, err)
+	assert.False(t, states[len(states)-1].Applied)
+
+	// Reverting everything removes the tables
+	assert.Nil(t, sqliteStore.MigrateDown(len(states)))
+	_, err = sqliteStore.GetAllUsers()
+	assert.NotNil(t, err)
+	assert.NotNil(t, sqliteStore.MigrateDown(0))
+
+	assert.Nil(t, sqliteStore.MigrateUp())
+	users, err := sqliteStore.GetAllUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+}
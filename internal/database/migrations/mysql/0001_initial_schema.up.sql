@@ -0,0 +1,150 @@
+-- The initial schema as created by setup/create_mysql_db.sql
+-- IF NOT EXISTS allows to adopt databases that were set up by hand before
+
+-- Table for AUTHENTICATION + AUTHORIZATION (mapping what lists / items can be seen)
+
+CREATE TABLE IF NOT EXISTS shoppers
+(
+    id        BIGINT       NOT NULL,
+    username  VARCHAR(128) NOT NULL,
+    passwd    VARCHAR(512) NOT NULL,
+    created   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastLogin DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS role
+(
+    user_id BIGINT     NOT NULL,
+    role    VARCHAR(2) NOT NULL DEFAULT 'US',
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Table for Items that can be shopped. Shared among all users because currently only shared via name
+
+CREATE TABLE IF NOT EXISTS items
+(
+    id   BIGINT AUTO_INCREMENT NOT NULL,
+    name VARCHAR(256)          NOT NULL,
+    icon VARCHAR(256)          NOT NULL,
+    PRIMARY KEY (id)
+);
+
+-- Table holding the list information + the mapping of items to lists
+
+CREATE TABLE IF NOT EXISTS shopping_list
+(
+    listId     BIGINT       NOT NULL,
+    createdBy  BIGINT       NOT NULL,
+    name       VARCHAR(256) NOT NULL,
+    created    DATETIME     NOT NULL,
+    lastEdited DATETIME     NOT NULL,
+    version    BIGINT       NOT NULL DEFAULT 1,
+    PRIMARY KEY (listId, createdBy),
+    FOREIGN KEY (createdBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS items_per_list
+(
+    listId    BIGINT  NOT NULL,
+    createdBy BIGINT  NOT NULL,
+    itemId    BIGINT  NOT NULL,
+    quantity  INT     NOT NULL,
+    checked   BOOLEAN NOT NULL,
+    addedBy   BIGINT,
+    PRIMARY KEY (listId, createdBy, itemId),
+    FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (itemId) REFERENCES items (id) ON DELETE CASCADE,
+    FOREIGN KEY (addedBy) REFERENCES shoppers (id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS shared_list
+(
+    listId       BIGINT   NOT NULL,
+    createdBy    BIGINT   NOT NULL,
+    sharedWithId BIGINT   NOT NULL,
+    created      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (listId, createdBy, sharedWithId),
+    FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (sharedWithId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Table holding recipes + mapping of items per recipe
+
+CREATE TABLE IF NOT EXISTS recipe
+(
+    recipeId       INT          NOT NULL,
+    createdBy      BIGINT       NOT NULL,
+    name           VARCHAR(256) NOT NULL,
+    createdAt      DATETIME     NOT NULL,
+    lastUpdate     DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version        INT          NOT NULL DEFAULT 1,
+    defaultPortion INT          NOT NULL,
+    PRIMARY KEY (recipeId, createdBy),
+    FOREIGN KEY (createdBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ingredient_per_recipe
+(
+    recipeId     INT         NOT NULL,
+    createdBy    BIGINT      NOT NULL,
+    itemId       BIGINT      NOT NULL,
+    quantity     INT         NOT NULL,
+    quantityType VARCHAR(32) NOT NULL DEFAULT 'PCS',
+    PRIMARY KEY (recipeId, createdBy, itemId),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (itemId) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS description_per_recipe
+(
+    recipeId         INT           NOT NULL,
+    createdBy        BIGINT        NOT NULL,
+    description      VARCHAR(1000) NOT NULL,
+    descriptionOrder INT           NOT NULL,
+    PRIMARY KEY (recipeId, createdBy, descriptionOrder),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS images_per_recipe
+(
+    recipeId  INT         NOT NULL,
+    createdBy BIGINT      NOT NULL,
+    filename  VARCHAR(50) NOT NULL,
+    PRIMARY KEY (recipeId, createdBy, filename),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS shared_recipe
+(
+    recipeId   INT    NOT NULL,
+    createdBy  BIGINT NOT NULL,
+    sharedWith BIGINT NOT NULL,
+    PRIMARY KEY (recipeId, createdBy, sharedWith),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (sharedWith) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- JWT Token Storage
+CREATE TABLE IF NOT EXISTS token
+(
+    userId     BIGINT        NOT NULL,
+    token      VARCHAR(300) NOT NULL,
+    validUntil DATETIME      NOT NULL,
+    PRIMARY KEY (userId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Keeping track of the shopping history to suggest items
+
+CREATE TABLE IF NOT EXISTS history
+(
+    id            BIGINT AUTO_INCREMENT NOT NULL,
+    itemId        BIGINT                NOT NULL,
+    totalQuantity INT                   NOT NULL,
+    since         DATETIME              NOT NULL,
+    weeklyUse     INT                   NOT NULL,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (itemId) REFERENCES items (id) ON DELETE CASCADE
+);
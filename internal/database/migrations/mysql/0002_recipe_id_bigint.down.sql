@@ -0,0 +1,7 @@
+SET FOREIGN_KEY_CHECKS = 0;
+ALTER TABLE recipe MODIFY recipeId INT NOT NULL;
+ALTER TABLE ingredient_per_recipe MODIFY recipeId INT NOT NULL;
+ALTER TABLE description_per_recipe MODIFY recipeId INT NOT NULL;
+ALTER TABLE images_per_recipe MODIFY recipeId INT NOT NULL;
+ALTER TABLE shared_recipe MODIFY recipeId INT NOT NULL;
+SET FOREIGN_KEY_CHECKS = 1;
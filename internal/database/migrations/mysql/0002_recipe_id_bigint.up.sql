@@ -0,0 +1,10 @@
+-- data.Recipe uses int64 for the recipeId, the INT columns truncate larger ids
+-- The foreign keys reference the recipeId, therefore the checks are disabled while changing the type
+
+SET FOREIGN_KEY_CHECKS = 0;
+ALTER TABLE recipe MODIFY recipeId BIGINT NOT NULL;
+ALTER TABLE ingredient_per_recipe MODIFY recipeId BIGINT NOT NULL;
+ALTER TABLE description_per_recipe MODIFY recipeId BIGINT NOT NULL;
+ALTER TABLE images_per_recipe MODIFY recipeId BIGINT NOT NULL;
+ALTER TABLE shared_recipe MODIFY recipeId BIGINT NOT NULL;
+SET FOREIGN_KEY_CHECKS = 1;
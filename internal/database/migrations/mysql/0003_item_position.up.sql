@@ -0,0 +1,2 @@
+-- Keeps the order of the items in a list, see the item level list API
+ALTER TABLE items_per_list ADD COLUMN position INT NOT NULL DEFAULT 0;
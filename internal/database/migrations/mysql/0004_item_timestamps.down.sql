@@ -0,0 +1 @@
+ALTER TABLE items_per_list DROP COLUMN quantityEdited, DROP COLUMN checkedEdited;
@@ -0,0 +1,2 @@
+-- Time of the last change per field, used to merge concurrent list updates
+ALTER TABLE items_per_list ADD COLUMN quantityEdited DATETIME(3) NULL, ADD COLUMN checkedEdited DATETIME(3) NULL;
@@ -0,0 +1 @@
+ALTER TABLE shared_list DROP COLUMN permission;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS shared_recipe_household;
+DROP TABLE IF EXISTS shared_list_household;
+DROP TABLE IF EXISTS household_invitations;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
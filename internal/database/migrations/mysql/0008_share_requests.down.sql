@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blocked_users;
+ALTER TABLE shared_list DROP COLUMN status;
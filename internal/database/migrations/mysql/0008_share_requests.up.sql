@@ -0,0 +1,13 @@
+-- Shares start as requests the recipient has to accept, existing shares stay accepted
+ALTER TABLE shared_list ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'accepted';
+
+-- Users blocked from sending share requests and invitations
+CREATE TABLE IF NOT EXISTS blocked_users
+(
+    userId    BIGINT   NOT NULL,
+    blockedId BIGINT   NOT NULL,
+    created   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (userId, blockedId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (blockedId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
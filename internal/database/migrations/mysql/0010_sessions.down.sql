@@ -0,0 +1,26 @@
+DROP TABLE IF EXISTS refresh_token;
+DROP TABLE IF EXISTS token;
+DROP TABLE IF EXISTS user_session;
+
+CREATE TABLE IF NOT EXISTS token
+(
+    userId     BIGINT       NOT NULL,
+    token      VARCHAR(300) NOT NULL,
+    validUntil DATETIME     NOT NULL,
+    PRIMARY KEY (userId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS refresh_token
+(
+    tokenHash  VARCHAR(64) NOT NULL,
+    familyId   VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (tokenHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_token_family ON refresh_token (familyId);
@@ -0,0 +1,44 @@
+-- Every login starts a session, so users can stay logged in on several devices.
+-- The access token and the refresh token family belong to the session.
+CREATE TABLE IF NOT EXISTS user_session
+(
+    sessionId  VARCHAR(64)  NOT NULL,
+    userId     BIGINT       NOT NULL,
+    deviceName VARCHAR(100) NOT NULL DEFAULT '',
+    ip         VARCHAR(64)  NOT NULL DEFAULT '',
+    created    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastSeen   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sessionId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_session_user ON user_session (userId);
+
+-- Existing tokens belong to no session, their users have to log in again
+DROP TABLE IF EXISTS token;
+CREATE TABLE IF NOT EXISTS token
+(
+    sessionId  VARCHAR(64)  NOT NULL,
+    userId     BIGINT       NOT NULL,
+    token      VARCHAR(300) NOT NULL,
+    validUntil DATETIME     NOT NULL,
+    PRIMARY KEY (sessionId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (sessionId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
+
+DROP TABLE IF EXISTS refresh_token;
+CREATE TABLE IF NOT EXISTS refresh_token
+(
+    tokenHash  VARCHAR(64) NOT NULL,
+    familyId   VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (tokenHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (familyId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_token_family ON refresh_token (familyId);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS token;
+CREATE TABLE IF NOT EXISTS token
+(
+    sessionId  VARCHAR(64)  NOT NULL,
+    userId     BIGINT       NOT NULL,
+    token      VARCHAR(300) NOT NULL,
+    validUntil DATETIME     NOT NULL,
+    PRIMARY KEY (sessionId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (sessionId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- Only the id (jti claim) of issued access tokens is stored instead of the signed token.
+-- Existing tokens cannot be converted, their sessions refresh them or log in again.
+DROP TABLE IF EXISTS token;
+CREATE TABLE IF NOT EXISTS token
+(
+    tokenId    VARCHAR(64) NOT NULL,
+    sessionId  VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    PRIMARY KEY (tokenId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (sessionId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
+
+CREATE INDEX token_session ON token (sessionId);
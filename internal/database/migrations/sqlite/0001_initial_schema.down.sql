@@ -0,0 +1,15 @@
+-- Removes all tables and therefore ALL DATA. CANNOT BE REVERTED!
+
+DROP TABLE IF EXISTS history;
+DROP TABLE IF EXISTS token;
+DROP TABLE IF EXISTS shared_recipe;
+DROP TABLE IF EXISTS images_per_recipe;
+DROP TABLE IF EXISTS description_per_recipe;
+DROP TABLE IF EXISTS ingredient_per_recipe;
+DROP TABLE IF EXISTS recipe;
+DROP TABLE IF EXISTS shared_list;
+DROP TABLE IF EXISTS items_per_list;
+DROP TABLE IF EXISTS shopping_list;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS role;
+DROP TABLE IF EXISTS shoppers;
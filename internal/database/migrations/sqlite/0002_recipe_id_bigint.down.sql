@@ -0,0 +1,2 @@
+-- INT and BIGINT columns both store 64 bit integers in SQLite, nothing to change.
+-- Kept so that both dialects share the same schema versions.
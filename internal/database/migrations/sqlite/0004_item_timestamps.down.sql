@@ -0,0 +1,2 @@
+ALTER TABLE items_per_list DROP COLUMN quantityEdited;
+ALTER TABLE items_per_list DROP COLUMN checkedEdited;
@@ -0,0 +1,3 @@
+-- Time of the last change per field, used to merge concurrent list updates
+ALTER TABLE items_per_list ADD COLUMN quantityEdited DATETIME;
+ALTER TABLE items_per_list ADD COLUMN checkedEdited DATETIME;
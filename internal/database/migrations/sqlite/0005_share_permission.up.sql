@@ -0,0 +1,2 @@
+-- Permission of the user the list is shared with, existing shares keep full edit rights
+ALTER TABLE shared_list ADD COLUMN permission VARCHAR(16) NOT NULL DEFAULT 'editor';
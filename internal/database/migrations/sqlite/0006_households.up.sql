@@ -0,0 +1,56 @@
+-- Households group users, lists and recipes shared with a household are visible to all members
+
+CREATE TABLE IF NOT EXISTS households
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    name      VARCHAR(256)                      NOT NULL,
+    createdBy BIGINT                            NOT NULL,
+    created   DATETIME                          NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (createdBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS household_members
+(
+    householdId BIGINT      NOT NULL,
+    userId      BIGINT      NOT NULL,
+    role        VARCHAR(16) NOT NULL DEFAULT 'member',
+    joined      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (householdId, userId),
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS household_invitations
+(
+    householdId BIGINT   NOT NULL,
+    userId      BIGINT   NOT NULL,
+    invitedBy   BIGINT   NOT NULL,
+    created     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (householdId, userId),
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (invitedBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS shared_list_household
+(
+    listId      BIGINT      NOT NULL,
+    createdBy   BIGINT      NOT NULL,
+    householdId BIGINT      NOT NULL,
+    permission  VARCHAR(16) NOT NULL DEFAULT 'editor',
+    created     DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (listId, createdBy, householdId),
+    FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS shared_recipe_household
+(
+    recipeId    BIGINT   NOT NULL,
+    createdBy   BIGINT   NOT NULL,
+    householdId BIGINT   NOT NULL,
+    created     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recipeId, createdBy, householdId),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE
+);
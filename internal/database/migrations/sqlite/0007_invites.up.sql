@@ -0,0 +1,17 @@
+-- Invite links for lists, recipes and households. The link carries a signed token
+-- naming the invite, the row counts the uses and is removed when the invite is revoked
+CREATE TABLE IF NOT EXISTS invites
+(
+    inviteId   VARCHAR(64) NOT NULL,
+    type       VARCHAR(16) NOT NULL,
+    resourceId BIGINT      NOT NULL,
+    createdBy  BIGINT      NOT NULL,
+    invitedBy  BIGINT      NOT NULL,
+    permission VARCHAR(16) NOT NULL DEFAULT '',
+    maxUses    INT         NOT NULL DEFAULT 1,
+    uses       INT         NOT NULL DEFAULT 0,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (inviteId),
+    FOREIGN KEY (invitedBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
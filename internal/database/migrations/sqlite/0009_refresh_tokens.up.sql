@@ -0,0 +1,15 @@
+-- Refresh tokens are only stored hashed. Every refresh replaces the token by a new one
+-- of the same family, reusing a replaced token revokes the whole family.
+CREATE TABLE IF NOT EXISTS refresh_token
+(
+    tokenHash  VARCHAR(64) NOT NULL,
+    familyId   VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (tokenHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_token_family ON refresh_token (familyId);
@@ -0,0 +1,11 @@
+-- A single pending reset code per user, a new request replaces the previous code
+CREATE TABLE IF NOT EXISTS password_reset
+(
+    userId     BIGINT      NOT NULL,
+    codeHash   VARCHAR(64) NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL,
+    attempts   INT         NOT NULL DEFAULT 0,
+    PRIMARY KEY (userId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+-- The second factor of a user, enabled once the first code was verified
+CREATE TABLE IF NOT EXISTS totp
+(
+    userId       BIGINT      NOT NULL,
+    secret       VARCHAR(64) NOT NULL,
+    enabled      BOOLEAN     NOT NULL DEFAULT FALSE,
+    lastUsedStep BIGINT      NOT NULL DEFAULT 0,
+    created      DATETIME    NOT NULL,
+    PRIMARY KEY (userId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Single use codes replacing the authenticator app, only their hash is stored
+CREATE TABLE IF NOT EXISTS recovery_code
+(
+    userId   BIGINT      NOT NULL,
+    codeHash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (userId, codeHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+-- Accounts of external OpenID Connect providers linked to the users
+CREATE TABLE IF NOT EXISTS oidc_identity
+(
+    issuer  VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    userId  BIGINT       NOT NULL,
+    created DATETIME     NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
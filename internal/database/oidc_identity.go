@@ -0,0 +1,24 @@
+package database
+
+import (
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Accounts of OpenID Connect providers
+// ------------------------------------------------------------
+
+const insertOIDCIdentityQuery = "INSERT INTO oidc_identity (issuer, subject, userId, created) VALUES (?, ?, ?, ?)"
+
+func (s *SQLStore) CreateOIDCIdentity(identity data.OIDCIdentity) error {
+	_, err := s.db.Exec(insertOIDCIdentityQuery, identity.Issuer, identity.Subject, identity.UserId, identity.Created)
+	return err
+}
+
+const selectOIDCIdentityQuery = "SELECT issuer, subject, userId, created FROM oidc_identity WHERE issuer = ? AND subject = ?"
+
+func (s *SQLStore) GetOIDCIdentity(issuer string, subject string) (data.OIDCIdentity, error) {
+	var identity data.OIDCIdentity
+	err := s.db.QueryRow(selectOIDCIdentityQuery, issuer, subject).Scan(&identity.Issuer, &identity.Subject, &identity.UserId, &identity.Created)
+	return identity, err
+}
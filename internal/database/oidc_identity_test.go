@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkOIDCIdentities runs against every backend, an identity is linked to a single user
+func checkOIDCIdentities(t *testing.T, identityStore Store) {
+	user, err := identityStore.CreateUserAccountInDatabase("oidc user", "password")
+	assert.Nil(t, err)
+	other, err := identityStore.CreateUserAccountInDatabase("other oidc user", "password")
+	assert.Nil(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = identityStore.GetOIDCIdentity("https://idp.example", "subject")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	identity := data.OIDCIdentity{Issuer: "https://idp.example", Subject: "subject", UserId: user.OnlineID, Created: now}
+	assert.Nil(t, identityStore.CreateOIDCIdentity(identity))
+	stored, err := identityStore.GetOIDCIdentity("https://idp.example", "subject")
+	assert.Nil(t, err)
+	assert.Equal(t, user.OnlineID, stored.UserId)
+	assert.Equal(t, now.Unix(), stored.Created.Unix())
+	identity.UserId = other.OnlineID
+	assert.NotNil(t, identityStore.CreateOIDCIdentity(identity))
+	// The same subject of another provider is a different account
+	_, err = identityStore.GetOIDCIdentity("https://other.example", "subject")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Nil(t, identityStore.DeleteUserAccount(user.OnlineID))
+	_, err = identityStore.GetOIDCIdentity("https://idp.example", "subject")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, identityStore.DeleteUserAccount(other.OnlineID))
+}
+
+func TestOIDCIdentities(t *testing.T) {
+	connectDatabase()
+	checkOIDCIdentities(t, store)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Pending password resets
+// ------------------------------------------------------------
+
+// REPLACE is understood by MySQL and SQLite alike
+const replacePasswordResetQuery = "REPLACE INTO password_reset (userId, codeHash, validUntil, created, attempts) VALUES (?, ?, ?, ?, ?)"
+
+func (s *SQLStore) CreatePasswordReset(reset data.PasswordReset) error {
+	_, err := s.db.Exec(replacePasswordResetQuery, reset.UserId, reset.CodeHash, reset.ValidUntil, reset.Created, reset.Attempts)
+	return err
+}
+
+const selectPasswordResetQuery = "SELECT userId, codeHash, validUntil, created, attempts FROM password_reset WHERE userId = ?"
+
+func (s *SQLStore) GetPasswordReset(userId int64) (data.PasswordReset, error) {
+	var reset data.PasswordReset
+	err := s.db.QueryRow(selectPasswordResetQuery, userId).Scan(&reset.UserId, &reset.CodeHash, &reset.ValidUntil, &reset.Created, &reset.Attempts)
+	return reset, err
+}
+
+const increasePasswordResetAttemptsQuery = "UPDATE password_reset SET attempts = attempts + 1 WHERE userId = ?"
+
+func (s *SQLStore) IncreasePasswordResetAttempts(userId int64) error {
+	_, err := s.db.Exec(increasePasswordResetAttemptsQuery, userId)
+	return err
+}
+
+func (s *SQLStore) deletePasswordResets(query string, arg any) (int64, error) {
+	res, err := s.db.Exec(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+const deletePasswordResetQuery = "DELETE FROM password_reset WHERE userId = ?"
+
+func (s *SQLStore) DeletePasswordReset(userId int64) (int64, error) {
+	return s.deletePasswordResets(deletePasswordResetQuery, userId)
+}
+
+const deleteExpiredPasswordResetsQuery = "DELETE FROM password_reset WHERE validUntil < ?"
+
+func (s *SQLStore) DeleteExpiredPasswordResets(before time.Time) (int64, error) {
+	return s.deletePasswordResets(deleteExpiredPasswordResetsQuery, before)
+}
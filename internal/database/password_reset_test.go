@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkPasswordResets runs against every backend, a user has at most one pending reset
+func checkPasswordResets(t *testing.T, resetStore Store) {
+	user, err := resetStore.CreateUserAccountInDatabase("reset user", "password")
+	assert.Nil(t, err)
+	other, err := resetStore.CreateUserAccountInDatabase("other reset user", "password")
+	assert.Nil(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = resetStore.GetPasswordReset(user.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	reset := data.PasswordReset{UserId: user.OnlineID, CodeHash: "first", ValidUntil: now.Add(time.Hour), Created: now}
+	assert.Nil(t, resetStore.CreatePasswordReset(reset))
+	assert.Nil(t, resetStore.IncreasePasswordResetAttempts(user.OnlineID))
+	stored, err := resetStore.GetPasswordReset(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", stored.CodeHash)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Equal(t, reset.ValidUntil.Unix(), stored.ValidUntil.Unix())
+
+	// A new code replaces the pending one including its attempts
+	reset.CodeHash = "second"
+	assert.Nil(t, resetStore.CreatePasswordReset(reset))
+	stored, err = resetStore.GetPasswordReset(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", stored.CodeHash)
+	assert.Equal(t, 0, stored.Attempts)
+	assert.NotNil(t, resetStore.CreatePasswordReset(data.PasswordReset{UserId: other.OnlineID + 100, CodeHash: "unknown", ValidUntil: now, Created: now}))
+
+	assert.Nil(t, resetStore.CreatePasswordReset(data.PasswordReset{UserId: other.OnlineID, CodeHash: "expired", ValidUntil: now.Add(-time.Minute), Created: now}))
+	removed, err := resetStore.DeleteExpiredPasswordResets(now)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	removed, err = resetStore.DeletePasswordReset(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	removed, err = resetStore.DeletePasswordReset(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), removed)
+
+	// Deleting the user removes the pending reset
+	assert.Nil(t, resetStore.CreatePasswordReset(reset))
+	assert.Nil(t, resetStore.DeleteUserAccount(user.OnlineID))
+	_, err = resetStore.GetPasswordReset(user.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestPasswordResets(t *testing.T) {
+	connectDatabase()
+	checkPasswordResets(t, store)
+}
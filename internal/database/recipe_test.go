@@ -10,12 +10,16 @@ import (
 
 func TestCreatingRecipe(t *testing.T) {
 	connectDatabase()
-	ResetRecipeTables()
+	store.ResetRecipeTables()
+	creator, err := createUserDb("creator")
+	if err != nil {
+		t.FailNow()
+	}
 	log.Print("Testing creating a new recipe")
 	recipe := data.Recipe{
 		RecipeId:       0,
 		Name:           "new recipe",
-		CreatedBy:      data.ListCreator{ID: 1234, Name: "creator"},
+		CreatedBy:      data.ListCreator{ID: creator.OnlineID, Name: "creator"},
 		CreatedAt:      time.Now(),
 		LastUpdate:     time.Now(),
 		DefaultPortion: 2,
@@ -48,13 +52,13 @@ func TestCreatingRecipe(t *testing.T) {
 			},
 		},
 	}
-	if err := CreateRecipe(recipe); err != nil {
+	if err := store.CreateRecipe(recipe, nil); err != nil {
 		log.Printf("Failed to create recipe: %s", err)
 		t.FailNow()
 	}
 	log.Printf("Recipe created")
 	// Now checking again by reading the recipe
-	dbRecipe, err := GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
+	dbRecipe, err := store.GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to read created recipe: %s", err)
 		t.FailNow()
@@ -70,11 +74,15 @@ func TestCreatingRecipe(t *testing.T) {
 func TestUpdateRecipe(t *testing.T) {
 	log.Printf("Testing updating recipe")
 	connectDatabase()
-	ResetRecipeTables()
+	store.ResetRecipeTables()
+	creator, err := createUserDb("creator")
+	if err != nil {
+		t.FailNow()
+	}
 	recipe := data.Recipe{
 		RecipeId:       0,
 		Name:           "new recipe",
-		CreatedBy:      data.ListCreator{ID: 12345, Name: "creator"},
+		CreatedBy:      data.ListCreator{ID: creator.OnlineID, Name: "creator"},
 		CreatedAt:      time.Now(),
 		LastUpdate:     time.Now(),
 		DefaultPortion: 2,
@@ -107,13 +115,14 @@ func TestUpdateRecipe(t *testing.T) {
 			},
 		},
 	}
-	if err := CreateRecipe(recipe); err != nil {
+	if err := store.CreateRecipe(recipe, nil); err != nil {
 		log.Printf("Failed to create recipe: %s", err)
 		t.FailNow()
 	}
 	log.Printf("Recipe created")
 	time.Sleep(time.Duration(1 * time.Second))
 	recipe.Name = "new recipe name"
+	recipe.Version = recipe.Version + 1
 	recipe.LastUpdate = time.Now()
 	recipe.Ingredients = append(recipe.Ingredients, data.Ingredient{
 		Name:         "ingredient 3",
@@ -125,11 +134,11 @@ func TestUpdateRecipe(t *testing.T) {
 	recipe.Description = []data.RecipeDescription{
 		recipe.Description[0],
 	}
-	if err := UpdateRecipe(recipe); err != nil {
+	if err := store.UpdateRecipe(recipe, nil); err != nil {
 		log.Printf("Failed to update recipe: %s", err)
 		t.FailNow()
 	}
-	dbRecipe, err := GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
+	dbRecipe, err := store.GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID)
 	if err != nil {
 		log.Printf("Failed to get recipe: %s", err)
 		t.FailNow()
@@ -146,11 +155,15 @@ func TestUpdateRecipe(t *testing.T) {
 func TestDeleteRecipe(t *testing.T) {
 	log.Print("Testing deleting a recipe")
 	connectDatabase()
-	ResetRecipeTables()
+	store.ResetRecipeTables()
+	creator, err := createUserDb("creator")
+	if err != nil {
+		t.FailNow()
+	}
 	recipe := data.Recipe{
 		RecipeId:       0,
 		Name:           "new recipe",
-		CreatedBy:      data.ListCreator{ID: 12345, Name: "creator"},
+		CreatedBy:      data.ListCreator{ID: creator.OnlineID, Name: "creator"},
 		CreatedAt:      time.Now(),
 		LastUpdate:     time.Now(),
 		DefaultPortion: 2,
@@ -183,16 +196,16 @@ func TestDeleteRecipe(t *testing.T) {
 			},
 		},
 	}
-	if err := CreateRecipe(recipe); err != nil {
+	if err := store.CreateRecipe(recipe, nil); err != nil {
 		log.Printf("Failed to create recipe: %s", err)
 		t.FailNow()
 	}
 	log.Printf("Recipe created")
-	if err := DeleteRecipe(recipe.RecipeId, recipe.CreatedBy.ID); err != nil {
+	if err := store.DeleteRecipe(recipe.RecipeId, recipe.CreatedBy.ID); err != nil {
 		log.Printf("Failed to delete recipe: %s", err)
 		t.FailNow()
 	}
-	if _, err := GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID); err == nil {
+	if _, err := store.GetRecipe(recipe.RecipeId, recipe.CreatedBy.ID); err == nil {
 		log.Print("Recipe can be retrieved after deletion")
 		t.FailNow()
 	}
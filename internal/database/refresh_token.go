@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Refresh token handling
+// ------------------------------------------------------------
+
+const insertRefreshTokenQuery = "INSERT INTO refresh_token (tokenHash, familyId, userId, validUntil, created, used) VALUES (?, ?, ?, ?, ?, ?)"
+
+func (s *SQLStore) InsertRefreshToken(token data.RefreshToken) error {
+	_, err := s.db.Exec(insertRefreshTokenQuery, token.TokenHash, token.FamilyId, token.UserId, token.ValidUntil, token.Created, token.Used)
+	return err
+}
+
+const selectRefreshTokenQuery = "SELECT tokenHash, familyId, userId, validUntil, created, used FROM refresh_token WHERE tokenHash = ?"
+
+func (s *SQLStore) GetRefreshToken(tokenHash string) (data.RefreshToken, error) {
+	var token data.RefreshToken
+	err := s.db.QueryRow(selectRefreshTokenQuery, tokenHash).Scan(&token.TokenHash, &token.FamilyId, &token.UserId, &token.ValidUntil, &token.Created, &token.Used)
+	return token, err
+}
+
+// Only a single concurrent refresh can mark the token as used
+const useRefreshTokenQuery = "UPDATE refresh_token SET used = TRUE WHERE tokenHash = ? AND used = FALSE"
+
+func (s *SQLStore) UseRefreshToken(tokenHash string) error {
+	res, err := s.db.Exec(useRefreshTokenQuery, tokenHash)
+	if err != nil {
+		return err
+	}
+	if used, err := res.RowsAffected(); err != nil || used == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLStore) deleteRefreshTokens(query string, arg any) (int64, error) {
+	res, err := s.db.Exec(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+const deleteUserRefreshTokensQuery = "DELETE FROM refresh_token WHERE userId = ?"
+
+func (s *SQLStore) DeleteRefreshTokensForUser(userId int64) (int64, error) {
+	return s.deleteRefreshTokens(deleteUserRefreshTokensQuery, userId)
+}
+
+const deleteExpiredRefreshTokensQuery = "DELETE FROM refresh_token WHERE validUntil < ?"
+
+func (s *SQLStore) DeleteExpiredRefreshTokens(before time.Time) (int64, error) {
+	return s.deleteRefreshTokens(deleteExpiredRefreshTokensQuery, before)
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkRefreshTokens runs against every backend, a refresh token can only be used once
+func checkRefreshTokens(t *testing.T, tokenStore Store) {
+	user, err := tokenStore.CreateUserAccountInDatabase("refresh user", "password")
+	assert.Nil(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, sessionId := range []string{"family", "other"} {
+		assert.Nil(t, tokenStore.CreateSession(data.Session{SessionId: sessionId, UserId: user.OnlineID, Created: now, LastSeen: now}))
+	}
+	first := data.RefreshToken{TokenHash: "first", FamilyId: "family", UserId: user.OnlineID, ValidUntil: now.Add(time.Hour), Created: now}
+	assert.Nil(t, tokenStore.InsertRefreshToken(first))
+	assert.NotNil(t, tokenStore.InsertRefreshToken(first))
+	second := first
+	second.TokenHash = "second"
+	assert.Nil(t, tokenStore.InsertRefreshToken(second))
+	expired := data.RefreshToken{TokenHash: "expired", FamilyId: "other", UserId: user.OnlineID, ValidUntil: now.Add(-time.Hour), Created: now}
+	assert.Nil(t, tokenStore.InsertRefreshToken(expired))
+
+	stored, err := tokenStore.GetRefreshToken("first")
+	assert.Nil(t, err)
+	assert.Equal(t, "family", stored.FamilyId)
+	assert.Equal(t, user.OnlineID, stored.UserId)
+	assert.Equal(t, first.ValidUntil.Unix(), stored.ValidUntil.Unix())
+	assert.False(t, stored.Used)
+
+	assert.Nil(t, tokenStore.UseRefreshToken("first"))
+	assert.Equal(t, sql.ErrNoRows, tokenStore.UseRefreshToken("first"))
+	assert.Equal(t, sql.ErrNoRows, tokenStore.UseRefreshToken("unknown"))
+	stored, err = tokenStore.GetRefreshToken("first")
+	assert.Nil(t, err)
+	assert.True(t, stored.Used)
+
+	removed, err := tokenStore.DeleteExpiredRefreshTokens(now)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	// Revoking the session revokes its refresh tokens
+	removed, err = tokenStore.DeleteSession("family")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	_, err = tokenStore.GetRefreshToken("second")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.NotNil(t, tokenStore.InsertRefreshToken(first))
+	first.FamilyId = "other"
+	assert.Nil(t, tokenStore.InsertRefreshToken(first))
+	removed, err = tokenStore.DeleteRefreshTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+}
+
+func TestRefreshTokens(t *testing.T) {
+	connectDatabase()
+	checkRefreshTokens(t, store)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Sessions of users logged in on several devices
+// ------------------------------------------------------------
+
+// The last seen time is only written once per interval instead of on every request
+const sessionTouchInterval = time.Minute
+
+const insertSessionQuery = "INSERT INTO user_session (sessionId, userId, deviceName, ip, created, lastSeen) VALUES (?, ?, ?, ?, ?, ?)"
+
+func (s *SQLStore) CreateSession(session data.Session) error {
+	_, err := s.db.Exec(insertSessionQuery, session.SessionId, session.UserId, session.DeviceName, session.IP, session.Created, session.LastSeen)
+	return err
+}
+
+const sessionColumns = "sessionId, userId, deviceName, ip, created, lastSeen"
+
+const selectSessionQuery = "SELECT " + sessionColumns + " FROM user_session WHERE sessionId = ?"
+
+func (s *SQLStore) GetSession(sessionId string) (data.Session, error) {
+	var session data.Session
+	err := s.db.QueryRow(selectSessionQuery, sessionId).Scan(&session.SessionId, &session.UserId, &session.DeviceName, &session.IP, &session.Created, &session.LastSeen)
+	return session, err
+}
+
+const selectUserSessionsQuery = "SELECT " + sessionColumns + " FROM user_session WHERE userId = ? ORDER BY lastSeen DESC, created DESC"
+
+func (s *SQLStore) GetSessionsForUser(userId int64) ([]data.Session, error) {
+	rows, err := s.db.Query(selectUserSessionsQuery, userId)
+	if err != nil {
+		return []data.Session{}, err
+	}
+	defer rows.Close()
+	sessions := make([]data.Session, 0)
+	for rows.Next() {
+		var session data.Session
+		if err := rows.Scan(&session.SessionId, &session.UserId, &session.DeviceName, &session.IP, &session.Created, &session.LastSeen); err != nil {
+			return []data.Session{}, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+const touchSessionQuery = "UPDATE user_session SET lastSeen = ?, ip = ? WHERE sessionId = ? AND (lastSeen < ? OR ip <> ?)"
+
+func (s *SQLStore) TouchSession(sessionId string, ip string, seen time.Time) error {
+	_, err := s.db.Exec(touchSessionQuery, seen, ip, sessionId, seen.Add(-sessionTouchInterval), ip)
+	return err
+}
+
+func (s *SQLStore) deleteSessions(query string, arg any) (int64, error) {
+	res, err := s.db.Exec(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+// The tokens of the session are removed by the foreign keys
+const deleteSessionQuery = "DELETE FROM user_session WHERE sessionId = ?"
+
+func (s *SQLStore) DeleteSession(sessionId string) (int64, error) {
+	return s.deleteSessions(deleteSessionQuery, sessionId)
+}
+
+const deleteUserSessionsQuery = "DELETE FROM user_session WHERE userId = ?"
+
+func (s *SQLStore) DeleteSessionsForUser(userId int64) (int64, error) {
+	return s.deleteSessions(deleteUserSessionsQuery, userId)
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkSessions runs against every backend, every session has its own token
+func checkSessions(t *testing.T, sessionStore Store) {
+	user, err := sessionStore.CreateUserAccountInDatabase("session user", "password")
+	assert.Nil(t, err)
+	other, err := sessionStore.CreateUserAccountInDatabase("other session user", "password")
+	assert.Nil(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	phone := data.Session{SessionId: "phone", UserId: user.OnlineID, DeviceName: "Phone", IP: "10.0.0.1", Created: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour)}
+	tablet := data.Session{SessionId: "tablet", UserId: user.OnlineID, DeviceName: "Tablet", IP: "10.0.0.2", Created: now, LastSeen: now}
+	assert.Nil(t, sessionStore.CreateSession(phone))
+	assert.NotNil(t, sessionStore.CreateSession(phone))
+	assert.Nil(t, sessionStore.CreateSession(tablet))
+	assert.Nil(t, sessionStore.CreateSession(data.Session{SessionId: "other", UserId: other.OnlineID, Created: now, LastSeen: now}))
+
+	// Both sessions keep their own token
+	validUntil := now.Add(time.Hour)
+	for _, sessionId := range []string{"phone", "tablet"} {
+		assert.Nil(t, sessionStore.InsertToken(data.TokenData{TokenId: sessionId + "-token", SessionId: sessionId, UserId: user.OnlineID, ValidUntil: validUntil}))
+	}
+	assert.NotNil(t, sessionStore.InsertToken(data.TokenData{TokenId: "unknown-token", SessionId: "unknown", UserId: user.OnlineID, ValidUntil: validUntil}))
+	token, err := sessionStore.GetToken("phone-token")
+	assert.Nil(t, err)
+	assert.Equal(t, "phone", token.SessionId)
+	tokens, err := sessionStore.GetTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens))
+
+	sessions, err := sessionStore.GetSessionsForUser(user.OnlineID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(sessions)) {
+		assert.Equal(t, "tablet", sessions[0].SessionId)
+		assert.Equal(t, "Phone", sessions[1].DeviceName)
+		assert.Equal(t, "10.0.0.1", sessions[1].IP)
+	}
+
+	// Recent activity is only written once per interval or on a new address
+	assert.Nil(t, sessionStore.TouchSession("phone", "10.0.0.1", now))
+	assert.Nil(t, sessionStore.TouchSession("tablet", "10.0.0.2", now.Add(time.Second)))
+	assert.Nil(t, sessionStore.TouchSession("unknown", "10.0.0.1", now))
+	stored, err := sessionStore.GetSession("phone")
+	assert.Nil(t, err)
+	assert.Equal(t, now.Unix(), stored.LastSeen.Unix())
+	stored, err = sessionStore.GetSession("tablet")
+	assert.Nil(t, err)
+	assert.Equal(t, now.Unix(), stored.LastSeen.Unix())
+	assert.Nil(t, sessionStore.TouchSession("tablet", "10.0.0.3", now.Add(time.Second)))
+	stored, err = sessionStore.GetSession("tablet")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.3", stored.IP)
+
+	// Revoking a session removes its token only
+	removed, err := sessionStore.DeleteSession("phone")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	_, err = sessionStore.GetSession("phone")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = sessionStore.GetToken("phone-token")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = sessionStore.GetToken("tablet-token")
+	assert.Nil(t, err)
+
+	removed, err = sessionStore.DeleteTokensForSession("tablet")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	removed, err = sessionStore.DeleteSessionsForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	sessions, err = sessionStore.GetSessionsForUser(other.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sessions))
+
+	// Deleting the user removes the sessions
+	assert.Nil(t, sessionStore.DeleteUserAccount(other.OnlineID))
+	_, err = sessionStore.GetSession("other")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestSessions(t *testing.T) {
+	connectDatabase()
+	checkSessions(t, store)
+}
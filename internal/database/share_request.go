@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Share requests and blocked users
+// ------------------------------------------------------------
+
+const getShareStatusQuery = "SELECT status FROM shared_list WHERE listId = ? AND createdBy = ? AND sharedWithId = ?"
+
+func (s *SQLStore) getShareStatus(listId int64, createdBy int64, sharedWith int64) (string, error) {
+	var status string
+	err := s.db.QueryRow(getShareStatusQuery, listId, createdBy, sharedWith).Scan(&status)
+	return status, err
+}
+
+const acceptShareRequestQuery = "UPDATE shared_list SET status = 'accepted' WHERE listId = ? AND createdBy = ? AND sharedWithId = ? AND status = 'pending'"
+
+func (s *SQLStore) AcceptShareRequest(listId int64, createdBy int64, userId int64) error {
+	result, err := s.db.Exec(acceptShareRequestQuery, listId, createdBy, userId)
+	if err != nil {
+		log.Printf("Failed to accept sharing of list %d from %d for %d: %s", listId, createdBy, userId, err)
+		return err
+	}
+	if accepted, err := result.RowsAffected(); err != nil || accepted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const shareColumns = "listId,createdBy,sharedWithId,created,permission,status"
+
+func (s *SQLStore) queryShares(query string, args ...any) ([]data.ListShared, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return []data.ListShared{}, err
+	}
+	defer rows.Close()
+	shares := make([]data.ListShared, 0)
+	for rows.Next() {
+		var shared data.ListShared
+		if err := rows.Scan(&shared.ListId, &shared.CreatedBy, &shared.SharedWithId, &shared.Created, &shared.Permission, &shared.Status); err != nil {
+			return []data.ListShared{}, err
+		}
+		shares = append(shares, shared)
+	}
+	return shares, rows.Err()
+}
+
+const getSharesOfListQuery = "SELECT " + shareColumns + " FROM shared_list WHERE listId = ? AND createdBy = ? ORDER BY sharedWithId"
+
+func (s *SQLStore) GetSharesOfList(listId int64, createdBy int64) ([]data.ListShared, error) {
+	return s.queryShares(getSharesOfListQuery, listId, createdBy)
+}
+
+const getIncomingShareRequestsQuery = "SELECT " + shareColumns + " FROM shared_list WHERE sharedWithId = ? AND status = 'pending' ORDER BY createdBy, listId"
+
+func (s *SQLStore) GetIncomingShareRequests(userId int64) ([]data.ListShared, error) {
+	return s.queryShares(getIncomingShareRequestsQuery, userId)
+}
+
+const getOutgoingShareRequestsQuery = "SELECT " + shareColumns + " FROM shared_list WHERE createdBy = ? AND status = 'pending' ORDER BY listId, sharedWithId"
+
+func (s *SQLStore) GetOutgoingShareRequests(createdBy int64) ([]data.ListShared, error) {
+	return s.queryShares(getOutgoingShareRequestsQuery, createdBy)
+}
+
+const countBlockedUserQuery = "SELECT COUNT(*) FROM blocked_users WHERE userId = ? AND blockedId = ?"
+const blockUserQuery = "INSERT INTO blocked_users (userId,blockedId,created) VALUES (?, ?, ?)"
+const deletePendingRequestsOfUserQuery = "DELETE FROM shared_list WHERE createdBy = ? AND sharedWithId = ? AND status = 'pending'"
+const deleteHouseholdInvitationsOfUserQuery = "DELETE FROM household_invitations WHERE invitedBy = ? AND userId = ?"
+
+func (s *SQLStore) BlockUser(userId int64, blockedId int64) error {
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRow(countBlockedUserQuery, userId, blockedId).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			if _, err := tx.Exec(blockUserQuery, userId, blockedId, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(deletePendingRequestsOfUserQuery, blockedId, userId); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteHouseholdInvitationsOfUserQuery, blockedId, userId)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to block user %d for %d: %s", blockedId, userId, err)
+	}
+	return err
+}
+
+const unblockUserQuery = "DELETE FROM blocked_users WHERE userId = ? AND blockedId = ?"
+
+func (s *SQLStore) UnblockUser(userId int64, blockedId int64) error {
+	_, err := s.db.Exec(unblockUserQuery, userId, blockedId)
+	return err
+}
+
+const getBlockedUsersQuery = "SELECT b.blockedId,s.username,b.created FROM blocked_users b INNER JOIN shoppers s ON b.blockedId = s.id WHERE b.userId = ? ORDER BY b.blockedId"
+
+func (s *SQLStore) GetBlockedUsers(userId int64) ([]data.BlockedUser, error) {
+	rows, err := s.db.Query(getBlockedUsersQuery, userId)
+	if err != nil {
+		return []data.BlockedUser{}, err
+	}
+	defer rows.Close()
+	blocked := make([]data.BlockedUser, 0)
+	for rows.Next() {
+		var user data.BlockedUser
+		if err := rows.Scan(&user.UserId, &user.Username, &user.Created); err != nil {
+			return []data.BlockedUser{}, err
+		}
+		blocked = append(blocked, user)
+	}
+	return blocked, rows.Err()
+}
+
+func (s *SQLStore) IsUserBlocked(userId int64, blockedId int64) (bool, error) {
+	var count int
+	if err := s.db.QueryRow(countBlockedUserQuery, userId, blockedId).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkShareRequests runs against every backend, pending shares must not give access
+func checkShareRequests(t *testing.T, requestStore Store) {
+	owner, err := requestStore.CreateUserAccountInDatabase("requesting owner", "password")
+	assert.Nil(t, err)
+	recipient, err := requestStore.CreateUserAccountInDatabase("recipient", "password")
+	assert.Nil(t, err)
+	list := createListBase("requested list", owner.OnlineID)
+	assert.Nil(t, requestStore.CreateOrUpdateShoppingList(list))
+
+	shared, err := requestStore.CreateShareRequest(list.ListId, owner.OnlineID, recipient.OnlineID, data.PermissionChecker)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ShareStatusPending, shared.Status)
+	sharedIds, err := requestStore.GetListIdsSharedWithUser(recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sharedIds))
+	assert.NotNil(t, requestStore.IsListSharedWithUser(list.ListId, owner.OnlineID, recipient.OnlineID))
+	_, err = requestStore.GetSharePermission(list.ListId, owner.OnlineID, recipient.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	users, err := requestStore.GetUsersSharingList(list.ListId, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+
+	incoming, err := requestStore.GetIncomingShareRequests(recipient.OnlineID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(incoming)) {
+		assert.Equal(t, list.ListId, incoming[0].ListId)
+		assert.Equal(t, data.PermissionChecker, incoming[0].Permission)
+	}
+	outgoing, err := requestStore.GetOutgoingShareRequests(owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(outgoing))
+
+	// Accepting gives access, requests for accepted shares only change the permission
+	assert.Nil(t, requestStore.AcceptShareRequest(list.ListId, owner.OnlineID, recipient.OnlineID))
+	assert.Equal(t, sql.ErrNoRows, requestStore.AcceptShareRequest(list.ListId, owner.OnlineID, recipient.OnlineID))
+	assert.Nil(t, requestStore.IsListSharedWithUser(list.ListId, owner.OnlineID, recipient.OnlineID))
+	shared, err = requestStore.CreateShareRequest(list.ListId, owner.OnlineID, recipient.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ShareStatusAccepted, shared.Status)
+	permission, err := requestStore.GetSharePermission(list.ListId, owner.OnlineID, recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionEditor, permission)
+	shares, err := requestStore.GetSharesOfList(list.ListId, owner.OnlineID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(shares)) {
+		assert.Equal(t, data.ShareStatusAccepted, shares[0].Status)
+	}
+	incoming, err = requestStore.GetIncomingShareRequests(recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(incoming))
+
+	// Blocking removes pending requests of the blocked user but keeps accepted shares
+	otherList := createListBase("other list", owner.OnlineID)
+	otherList.ListId = list.ListId + 1
+	assert.Nil(t, requestStore.CreateOrUpdateShoppingList(otherList))
+	_, err = requestStore.CreateShareRequest(otherList.ListId, owner.OnlineID, recipient.OnlineID, data.PermissionViewer)
+	assert.Nil(t, err)
+	assert.Nil(t, requestStore.BlockUser(recipient.OnlineID, owner.OnlineID))
+	assert.Nil(t, requestStore.BlockUser(recipient.OnlineID, owner.OnlineID))
+	blocked, err := requestStore.IsUserBlocked(recipient.OnlineID, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.True(t, blocked)
+	blocked, err = requestStore.IsUserBlocked(owner.OnlineID, recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.False(t, blocked)
+	blockedUsers, err := requestStore.GetBlockedUsers(recipient.OnlineID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(blockedUsers)) {
+		assert.Equal(t, owner.OnlineID, blockedUsers[0].UserId)
+		assert.Equal(t, owner.Username, blockedUsers[0].Username)
+	}
+	incoming, err = requestStore.GetIncomingShareRequests(recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(incoming))
+	assert.Nil(t, requestStore.IsListSharedWithUser(list.ListId, owner.OnlineID, recipient.OnlineID))
+
+	assert.Nil(t, requestStore.UnblockUser(recipient.OnlineID, owner.OnlineID))
+	blockedUsers, err = requestStore.GetBlockedUsers(recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(blockedUsers))
+}
+
+func TestShareRequests(t *testing.T) {
+	connectDatabase()
+	checkShareRequests(t, store)
+}
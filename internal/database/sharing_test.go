@@ -5,15 +5,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
 func createDefaultSharing() data.ListShared {
 	return data.ListShared{
-		ID:           0,
 		ListId:       1,
 		CreatedBy:    1234,
-		SharedWithId: []int64{2222},
+		SharedWithId: 2222,
 		Created:      time.Now().Local(),
 	}
 }
@@ -21,35 +22,35 @@ func createDefaultSharing() data.ListShared {
 func TestCreateSharing(t *testing.T) {
 	connectDatabase()
 	// Creating a user
-	user, err := CreateUserAccountInDatabase("test", "bla")
+	user, err := store.CreateUserAccountInDatabase("test", "bla")
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		t.FailNow()
 	}
-	sharedUser, err := CreateUserAccountInDatabase("shared user", "bla")
+	sharedUser, err := store.CreateUserAccountInDatabase("shared user", "bla")
 	if err != nil {
 		log.Printf("Failed to create shared user: %s", err)
 		t.FailNow()
 	}
 	listBase := createListBase("test", user.OnlineID)
-	err = CreateOrUpdateShoppingList(listBase)
+	err = store.CreateOrUpdateShoppingList(listBase)
 	if err != nil {
 		log.Printf("Failed to create list for sharing: %s", err)
 		t.FailNow()
 	}
 	shared := createDefaultSharing()
 	shared.CreatedBy = user.OnlineID
-	shared.SharedWithId = []int64{sharedUser.OnlineID}
-	sharedWith, err := CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId[0])
+	shared.SharedWithId = sharedUser.OnlineID
+	sharedWith, err := store.CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId, data.PermissionEditor)
 	if err != nil {
 		log.Printf("Failed to create list sharing")
 		t.FailNow()
 	}
-	if shared.ListId != sharedWith.ListId || shared.CreatedBy != sharedWith.CreatedBy || shared.SharedWithId[0] != sharedWith.SharedWithId[0] {
+	if shared.ListId != sharedWith.ListId || shared.CreatedBy != sharedWith.CreatedBy || shared.SharedWithId != sharedWith.SharedWithId {
 		log.Printf("Incorrectly inserted")
 		t.FailNow()
 	}
-	getSharing, err := GetSharedListFromListId(shared.ListId)
+	getSharing, err := store.GetListIdsSharedWithUser(shared.SharedWithId)
 	if err != nil {
 		log.Printf("Expected sharing but got none: %s", err)
 		t.FailNow()
@@ -60,66 +61,69 @@ func TestCreateSharing(t *testing.T) {
 	}
 	onlySharing := getSharing[0]
 	log.Printf("onlySharing: %v", onlySharing)
-	if onlySharing.ListId != shared.ListId || onlySharing.CreatedBy != shared.CreatedBy || onlySharing.SharedWithId[0] != shared.SharedWithId[0] {
+	if onlySharing.ListID != shared.ListId || onlySharing.CreatedBy != shared.CreatedBy {
 		log.Printf("Incorrectly inserted")
 		t.FailNow()
 	}
-	PrintSharingTable()
+	sharingUsers, err := store.GetUsersSharingList(shared.ListId, shared.CreatedBy)
+	if err != nil || len(sharingUsers) != 1 || sharingUsers[0] != shared.SharedWithId {
+		log.Printf("Expected list to be shared with %d but got %v: %v", shared.SharedWithId, sharingUsers, err)
+		t.FailNow()
+	}
+	store.PrintSharingTable()
 	log.Printf("TestCreateSharing successful")
-	ResetSharedListTable()
+	store.ResetSharedListTable()
 }
 
 func TestCreateSharingWithoutUser(t *testing.T) {
 	connectDatabase()
 	shared := createDefaultSharing()
-	if _, err := CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId[0]); err == nil {
+	if _, err := store.CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId, data.PermissionEditor); err == nil {
 		log.Printf("Should fail because of non-existing user")
 		t.FailNow()
 	}
-	if lists, err := GetSharedListFromListId(shared.ListId); err == nil && len(lists) > 0 {
+	if lists, err := store.GetListIdsSharedWithUser(shared.SharedWithId); err == nil && len(lists) > 0 {
 		log.Printf("Expected no sharing but got some")
 		t.FailNow()
 	}
-	PrintSharingTable()
+	store.PrintSharingTable()
 	log.Printf("TestCreateSharing successful")
-	ResetSharedListTable()
+	store.ResetSharedListTable()
 }
 
 func TestCreatingMultipleSharings(t *testing.T) {
 	connectDatabase()
 	// Creating a user
-	user, err := CreateUserAccountInDatabase("test", "bla")
+	user, err := store.CreateUserAccountInDatabase("test", "bla")
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		t.FailNow()
 	}
-	sharedUser, err := CreateUserAccountInDatabase("shared user", "bla")
+	sharedUser, err := store.CreateUserAccountInDatabase("shared user", "bla")
 	if err != nil {
 		log.Printf("Failed to create shared user: %s", err)
 		t.FailNow()
 	}
 	listBase := createListBase("test", user.OnlineID)
-	err = CreateOrUpdateShoppingList(listBase)
+	err = store.CreateOrUpdateShoppingList(listBase)
 	if err != nil {
 		log.Printf("Failed to create list for sharing: %s", err)
 		t.FailNow()
 	}
 	shared := createDefaultSharing()
 	shared.CreatedBy = user.OnlineID
-	sharingList := make([]int64, 0)
-	sharingList = append(sharingList, sharedUser.OnlineID)
-	shared.SharedWithId = sharingList
+	shared.SharedWithId = sharedUser.OnlineID
 	for i := 0; i < 3; i++ {
-		sharedWith, err := CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId[0])
+		sharedWith, err := store.CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId, data.PermissionEditor)
 		if err != nil {
 			log.Printf("Failed to create list sharing")
 			t.FailNow()
 		}
-		if shared.ListId != sharedWith.ListId || shared.CreatedBy != sharedWith.CreatedBy || shared.SharedWithId[0] != sharedWith.SharedWithId[0] {
+		if shared.ListId != sharedWith.ListId || shared.CreatedBy != sharedWith.CreatedBy || shared.SharedWithId != sharedWith.SharedWithId {
 			log.Printf("Incorrectly inserted")
 			t.FailNow()
 		}
-		getSharing, err := GetSharedListFromListId(shared.ListId)
+		getSharing, err := store.GetListIdsSharedWithUser(shared.SharedWithId)
 		if err != nil {
 			log.Printf("Expected sharing but got none: %s", err)
 			t.FailNow()
@@ -129,12 +133,12 @@ func TestCreatingMultipleSharings(t *testing.T) {
 			t.FailNow()
 		}
 		onlySharing := getSharing[0]
-		if onlySharing.ListId != shared.ListId || onlySharing.CreatedBy != shared.CreatedBy || onlySharing.SharedWithId[0] != shared.SharedWithId[0] {
+		if onlySharing.ListID != shared.ListId || onlySharing.CreatedBy != shared.CreatedBy {
 			log.Printf("Incorrectly inserted")
 			t.FailNow()
 		}
 	}
-	sharings, err := GetSharedListFromListId(shared.ListId)
+	sharings, err := store.GetListIdsSharedWithUser(shared.SharedWithId)
 	if err != nil {
 		log.Printf("Failed to get shared list")
 		t.FailNow()
@@ -143,46 +147,44 @@ func TestCreatingMultipleSharings(t *testing.T) {
 		log.Printf("Expected only single sharing but got %d", len(sharings))
 		t.FailNow()
 	}
-	PrintSharingTable()
+	store.PrintSharingTable()
 	log.Printf("TestCreateMapping successful")
-	ResetSharedListTable()
+	store.ResetSharedListTable()
 }
 
 func TestDeleteSharing(t *testing.T) {
 	connectDatabase()
 	// Creating a user
-	user, err := CreateUserAccountInDatabase("test", "bla")
+	user, err := store.CreateUserAccountInDatabase("test", "bla")
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		t.FailNow()
 	}
-	sharedUser, err := CreateUserAccountInDatabase("shared user", "bla")
+	sharedUser, err := store.CreateUserAccountInDatabase("shared user", "bla")
 	if err != nil {
 		log.Printf("Failed to create shared user: %s", err)
 		t.FailNow()
 	}
 	listBase := createListBase("test", user.OnlineID)
-	err = CreateOrUpdateShoppingList(listBase)
+	err = store.CreateOrUpdateShoppingList(listBase)
 	if err != nil {
 		log.Printf("Failed to create list for sharing: %s", err)
 		t.FailNow()
 	}
 	shared := createDefaultSharing()
 	shared.CreatedBy = user.OnlineID
-	sharingList := make([]int64, 0)
-	sharingList = append(sharingList, sharedUser.OnlineID)
-	shared.SharedWithId = sharingList
-	_, err = CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId[0])
+	shared.SharedWithId = sharedUser.OnlineID
+	_, err = store.CreateOrUpdateSharedList(shared.ListId, shared.CreatedBy, shared.SharedWithId, data.PermissionEditor)
 	if err != nil {
 		log.Printf("Failed to create list sharing")
 		t.FailNow()
 	}
-	err = DeleteSharingForUser(shared.ListId, shared.CreatedBy, shared.SharedWithId[0])
+	err = store.DeleteSharingForUser(shared.ListId, shared.CreatedBy, shared.SharedWithId)
 	if err != nil {
 		log.Printf("Failed to delete sharing: %s", err)
 		t.FailNow()
 	}
-	getSharing, err := GetSharedListFromListId(shared.ListId)
+	getSharing, err := store.GetListIdsSharedWithUser(shared.SharedWithId)
 	if err != nil {
 		log.Printf("Expected no error but got some: %s", err)
 		t.FailNow()
@@ -191,7 +193,37 @@ func TestDeleteSharing(t *testing.T) {
 		log.Printf("Expected only single sharing but got more (%d)", len(getSharing))
 		t.FailNow()
 	}
-	PrintSharingTable()
+	store.PrintSharingTable()
 	log.Printf("TestCreateMapping successful")
-	ResetSharedListTable()
+	store.ResetSharedListTable()
+}
+
+func TestSharePermission(t *testing.T) {
+	connectDatabase()
+	user, err := store.CreateUserAccountInDatabase("test", "bla")
+	assert.Nil(t, err)
+	sharedUser, err := store.CreateUserAccountInDatabase("shared user", "bla")
+	assert.Nil(t, err)
+	listBase := createListBase("test", user.OnlineID)
+	assert.Nil(t, store.CreateOrUpdateShoppingList(listBase))
+
+	_, err = store.CreateOrUpdateSharedList(listBase.ListId, user.OnlineID, sharedUser.OnlineID, data.PermissionOwner)
+	assert.NotNil(t, err)
+	_, err = store.GetSharePermission(listBase.ListId, user.OnlineID, sharedUser.OnlineID)
+	assert.NotNil(t, err)
+
+	shared, err := store.CreateOrUpdateSharedList(listBase.ListId, user.OnlineID, sharedUser.OnlineID, data.PermissionViewer)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, shared.Permission)
+	permission, err := store.GetSharePermission(listBase.ListId, user.OnlineID, sharedUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+
+	// Sharing again changes the permission
+	_, err = store.CreateOrUpdateSharedList(listBase.ListId, user.OnlineID, sharedUser.OnlineID, data.PermissionCoOwner)
+	assert.Nil(t, err)
+	permission, err = store.GetSharePermission(listBase.ListId, user.OnlineID, sharedUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionCoOwner, permission)
+	store.ResetSharedListTable()
 }
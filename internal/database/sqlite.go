@@ -0,0 +1,55 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+)
+
+// SQLite allows running the server without a separate database server,
+// e.g. on a Raspberry Pi for a single household
+
+func sqliteDSN(path string) string {
+	pragmas := url.Values{}
+	// Foreign keys are disabled by default and must be enabled per connection
+	pragmas.Add("_pragma", "foreign_keys(1)")
+	pragmas.Add("_pragma", "busy_timeout(5000)")
+	pragmas.Add("_pragma", "journal_mode(WAL)")
+	return "file:" + path + "?" + pragmas.Encode()
+}
+
+// OpenSQLiteDatabase opens the database file and applies all pending migrations
+func OpenSQLiteDatabase(config configuration.DatabaseConfig) (*SQLStore, error) {
+	store, err := ConnectSQLiteDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.MigrateUp(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return store, nil
+}
+
+// ConnectSQLiteDatabase opens the database file without touching the schema
+func ConnectSQLiteDatabase(config configuration.DatabaseConfig) (*SQLStore, error) {
+	if config.Path == "" {
+		return nil, errors.New("no sqlite database file given")
+	}
+	db, err := sql.Open("sqlite", sqliteDSN(config.Path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database not responding: %w", err)
+	}
+	log.Printf("Opened sqlite database '%s'", config.Path)
+	return NewSQLStore(db, configuration.DriverSQLite), nil
+}
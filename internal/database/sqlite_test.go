@@ -0,0 +1,324 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Testing the queries against the SQLite backend
+// ------------------------------------------------------------
+
+func openSQLiteStore(t *testing.T) *SQLStore {
+	config := configuration.DatabaseConfig{
+		Driver: configuration.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "test.db"),
+	}
+	sqliteStore, err := OpenSQLiteDatabase(config)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+	return sqliteStore
+}
+
+func TestSQLiteListsAndItems(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("sqlite user", "password")
+	assert.Nil(t, err)
+	sharedWith, err := sqliteStore.CreateUserAccountInDatabase("shared user", "password")
+	assert.Nil(t, err)
+
+	list := createListBase("sqlite list", user.OnlineID)
+	list.Items = []data.ItemWire{
+		{Name: "Milk", Icon: "ic_milk", Quantity: 1, AddedBy: user.OnlineID},
+		{Name: "Bread", Icon: "ic_bread", Quantity: 2, Checked: true, AddedBy: user.OnlineID},
+	}
+	assert.Nil(t, sqliteStore.CreateOrUpdateShoppingList(list))
+
+	stored, err := sqliteStore.GetRawShoppingListWithId(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Title, stored.Title)
+	assert.Equal(t, user.Username, stored.CreatedBy.Name)
+	assert.Equal(t, list.CreatedAt.Unix(), stored.CreatedAt.Unix())
+
+	items, err := sqliteStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(items))
+
+	// Existing items must be reused instead of inserted again
+	milk, err := sqliteStore.InsertItem("Milk", "ic_milk")
+	assert.Nil(t, err)
+	allItems, err := sqliteStore.GetAllItems()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(allItems))
+	mapping, err := sqliteStore.IsItemInList(list.ListId, user.OnlineID, milk.ItemId)
+	assert.Nil(t, err)
+	assert.Equal(t, milk.ItemId, mapping.ItemId)
+
+	// Updating with an outdated version must fail
+	list.Title = "updated sqlite list"
+	assert.NotNil(t, sqliteStore.CreateOrUpdateShoppingList(list))
+	list.Version++
+	assert.Nil(t, sqliteStore.CreateOrUpdateShoppingList(list))
+
+	_, err = sqliteStore.CreateOrUpdateSharedList(list.ListId, user.OnlineID, sharedWith.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+	sharedIds, err := sqliteStore.GetListIdsSharedWithUser(sharedWith.OnlineID)
+	assert.Nil(t, err)
+	sharedLists, err := sqliteStore.GetRawShoppingListsByIDs(sharedIds)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sharedLists))
+	assert.Equal(t, "updated sqlite list", sharedLists[0].Title)
+	_, err = sqliteStore.CreateOrUpdateSharedList(list.ListId, user.OnlineID, sharedWith.OnlineID, data.PermissionChecker)
+	assert.Nil(t, err)
+	permission, err := sqliteStore.GetSharePermission(list.ListId, user.OnlineID, sharedWith.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionChecker, permission)
+
+	// Deleting the user must cascade to the list, the items in the list and the sharing
+	assert.Nil(t, sqliteStore.DeleteUserAccount(user.OnlineID))
+	_, err = sqliteStore.GetRawShoppingListWithId(list.ListId, user.OnlineID)
+	assert.NotNil(t, err)
+	sharedIds, err = sqliteStore.GetListIdsSharedWithUser(sharedWith.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sharedIds))
+}
+
+func TestSQLiteRecipes(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("recipe user", "password")
+	assert.Nil(t, err)
+
+	recipe := data.Recipe{
+		RecipeId:       1,
+		Name:           "sqlite recipe",
+		CreatedBy:      data.ListCreator{ID: user.OnlineID},
+		CreatedAt:      time.Now().UTC(),
+		LastUpdate:     time.Now().UTC(),
+		Version:        1,
+		DefaultPortion: 2,
+		Ingredients: []data.Ingredient{
+			{Name: "Flour", Icon: "ic_flour", Quantity: 500, QuantityType: "g"},
+			{Name: "Water", Icon: "ic_water", Quantity: 300, QuantityType: "ml"},
+		},
+		Description: []data.RecipeDescription{
+			{Order: 1, Step: "Mix"},
+			{Order: 2, Step: "Bake"},
+		},
+	}
+	assert.Nil(t, sqliteStore.CreateRecipe(recipe, nil))
+
+	stored, err := sqliteStore.GetRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(stored.Ingredients))
+	assert.Equal(t, 2, len(stored.Description))
+
+	recipe.Version++
+	recipe.Description = recipe.Description[:1]
+	assert.Nil(t, sqliteStore.UpdateRecipe(recipe, nil))
+	stored, err = sqliteStore.GetRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stored.Description))
+
+	recipePK := data.RecipePK{RecipeId: recipe.RecipeId, CreatedBy: user.OnlineID}
+	_, err = sqliteStore.StoreRecipeImageFilenames([]string{"1_a.jpg", "1_b.jpg"}, recipePK)
+	assert.Nil(t, err)
+	images, err := sqliteStore.GetImageNamesForRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(images))
+
+	assert.Nil(t, sqliteStore.DeleteRecipe(recipe.RecipeId, user.OnlineID))
+	images, err = sqliteStore.GetImageNamesForRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(images))
+}
+
+func TestSQLiteTokens(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("token user", "password")
+	assert.Nil(t, err)
+
+	validUntil := time.Now().UTC().Add(time.Hour)
+	assert.Nil(t, sqliteStore.CreateSession(data.Session{SessionId: "session", UserId: user.OnlineID}))
+	assert.Nil(t, sqliteStore.InsertToken(data.TokenData{TokenId: "token", SessionId: "session", UserId: user.OnlineID, ValidUntil: validUntil}))
+	assert.Nil(t, sqliteStore.InsertToken(data.TokenData{TokenId: "expired", SessionId: "session", UserId: user.OnlineID, ValidUntil: validUntil.Add(-2 * time.Hour)}))
+	tokens, err := sqliteStore.GetTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(tokens))
+	assert.Equal(t, validUntil.Unix(), tokens[0].ValidUntil.Unix())
+
+	removed, err := sqliteStore.DeleteExpiredTokens(time.Now().UTC())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Nil(t, sqliteStore.InsertToken(data.TokenData{TokenId: "revoked", SessionId: "session", UserId: user.OnlineID, ValidUntil: validUntil}))
+	removed, err = sqliteStore.DeleteToken("revoked")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+	_, err = sqliteStore.GetToken("revoked")
+	assert.Equal(t, sql.ErrNoRows, err)
+	removed, err = sqliteStore.DeleteTokensForUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), removed)
+}
+
+func TestSQLiteListWriteIsAtomic(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("atomic user", "password")
+	assert.Nil(t, err)
+	checkListWriteIsAtomic(t, sqliteStore, user)
+}
+
+func TestSQLiteListMerge(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("merge user", "password")
+	assert.Nil(t, err)
+	checkListMerge(t, sqliteStore, user)
+}
+
+func TestSQLiteConcurrentMerges(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("concurrent user", "password")
+	assert.Nil(t, err)
+	list := createListBase("concurrent list", user.OnlineID)
+	list.Items = []data.ItemWire{{Name: "Milk", Quantity: 1, AddedBy: user.OnlineID}}
+	assert.Nil(t, sqliteStore.CreateOrUpdateShoppingList(list))
+
+	// Every client adds its own item based on the same version, none of them may get lost
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			update := list
+			update.Version++
+			update.LastUpdated = time.Now().UTC()
+			update.Items = []data.ItemWire{list.Items[0], {Name: fmt.Sprintf("Item %d", i), Quantity: 1, AddedBy: user.OnlineID}}
+			_, err := sqliteStore.MergeShoppingList(update)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wait.Wait()
+	items, err := sqliteStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(items))
+}
+
+func TestSQLiteRecipeWriteIsAtomic(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("recipe user", "password")
+	assert.Nil(t, err)
+
+	recipe := data.Recipe{
+		RecipeId:    1,
+		Name:        "atomic recipe",
+		CreatedBy:   data.ListCreator{ID: user.OnlineID},
+		CreatedAt:   time.Now().UTC(),
+		LastUpdate:  time.Now().UTC(),
+		Version:     1,
+		Ingredients: []data.Ingredient{{Name: "Flour", Icon: "ic_flour", Quantity: 500, QuantityType: "g"}},
+		Description: []data.RecipeDescription{{Order: 1, Step: "Mix"}},
+	}
+	// Duplicate image filenames violate the primary key, so nothing must be stored
+	assert.NotNil(t, sqliteStore.CreateRecipe(recipe, []string{"1_a.jpg", "1_a.jpg"}))
+	_, err = sqliteStore.GetRecipe(recipe.RecipeId, user.OnlineID)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, sqliteStore.CreateRecipe(recipe, []string{"1_a.jpg"}))
+	recipe.Version++
+	recipe.Name = "must not be stored"
+	recipe.Description = []data.RecipeDescription{{Order: 1, Step: "Mix"}, {Order: 1, Step: "Bake"}}
+	assert.NotNil(t, sqliteStore.UpdateRecipe(recipe, []string{"1_b.jpg"}))
+	stored, err := sqliteStore.GetRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "atomic recipe", stored.Name)
+	assert.Equal(t, 1, stored.Version)
+	assert.Equal(t, 1, len(stored.Description))
+	images, err := sqliteStore.GetImageNamesForRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1_a.jpg"}, images)
+
+	recipe.Description = recipe.Description[:1]
+	assert.Nil(t, sqliteStore.UpdateRecipe(recipe, []string{"1_b.jpg"}))
+	images, err = sqliteStore.GetImageNamesForRecipe(recipe.RecipeId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1_b.jpg"}, images)
+}
+
+func TestSQLiteItemOrderAndVersion(t *testing.T) {
+	sqliteStore := openSQLiteStore(t)
+	user, err := sqliteStore.CreateUserAccountInDatabase("order user", "password")
+	assert.Nil(t, err)
+	list := createListBase("order list", user.OnlineID)
+	list.Items = []data.ItemWire{
+		{Name: "Zucchini", Quantity: 1, AddedBy: user.OnlineID},
+		{Name: "Apple", Quantity: 1, AddedBy: user.OnlineID},
+	}
+	assert.Nil(t, sqliteStore.CreateOrUpdateShoppingList(list))
+
+	// The order of the list is kept, not the order of the itemIds
+	items, err := sqliteStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Zucchini", items[0].Name)
+	assert.NotZero(t, items[0].ItemId)
+
+	_, err = sqliteStore.ReorderItemsInList(list.ListId, user.OnlineID, []int64{items[1].ItemId, items[1].ItemId})
+	assert.NotNil(t, err)
+	version, err := sqliteStore.ReorderItemsInList(list.ListId, user.OnlineID, []int64{items[1].ItemId, items[0].ItemId})
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+1, version)
+	items, err = sqliteStore.GetItemsInList(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Apple", items[0].Name)
+
+	version, err = sqliteStore.BumpListVersion(list.ListId, user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+2, version)
+	_, err = sqliteStore.BumpListVersion(list.ListId+1, user.OnlineID)
+	assert.NotNil(t, err)
+}
+
+func TestSQLiteHouseholds(t *testing.T) {
+	checkHouseholds(t, openSQLiteStore(t))
+}
+
+func TestSQLiteInvites(t *testing.T) {
+	checkInvites(t, openSQLiteStore(t))
+}
+
+func TestSQLiteShareRequests(t *testing.T) {
+	checkShareRequests(t, openSQLiteStore(t))
+}
+
+func TestSQLiteRefreshTokens(t *testing.T) {
+	checkRefreshTokens(t, openSQLiteStore(t))
+}
+
+func TestSQLiteSessions(t *testing.T) {
+	checkSessions(t, openSQLiteStore(t))
+}
+
+func TestSQLitePasswordResets(t *testing.T) {
+	checkPasswordResets(t, openSQLiteStore(t))
+}
+
+func TestSQLiteUserRoles(t *testing.T) {
+	checkUserRoles(t, openSQLiteStore(t))
+}
+
+func TestSQLiteTOTP(t *testing.T) {
+	checkTOTP(t, openSQLiteStore(t))
+}
+
+func TestSQLiteOIDCIdentities(t *testing.T) {
+	checkOIDCIdentities(t, openSQLiteStore(t))
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// Store is the storage abstraction used by the server and the authentication.
+// Every backend (MySQL, SQLite, memory, ...) implements this interface so that the handlers
+// do not depend on a concrete database or any package level state.
+type Store interface {
+	UserStore
+	ListStore
+	SharingStore
+	HouseholdStore
+	InviteStore
+	BlockingStore
+	ItemStore
+	RecipeStore
+	ImageStore
+	TokenStore
+	TOTPStore
+	IdentityStore
+
+	// ResetDatabase removes all content from the storage. CANNOT BE REVERTED!
+	ResetDatabase()
+	Close() error
+}
+
+// NewStore creates the storage backend selected in the configuration
+func NewStore(config configuration.DatabaseConfig) (Store, error) {
+	switch config.Driver {
+	case "", configuration.DriverMySQL:
+		store, err := CheckDatabaseOnline(config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case configuration.DriverSQLite:
+		store, err := OpenSQLiteDatabase(config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case configuration.DriverMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver '%s'", config.Driver)
+	}
+}
+
+// OpenSQLStore connects to the SQL database without applying migrations,
+// used to manage the schema manually
+func OpenSQLStore(config configuration.DatabaseConfig) (*SQLStore, error) {
+	switch config.Driver {
+	case "", configuration.DriverMySQL:
+		return ConnectMySQLDatabase(config)
+	case configuration.DriverSQLite:
+		return ConnectSQLiteDatabase(config)
+	default:
+		return nil, fmt.Errorf("database driver '%s' has no schema migrations", config.Driver)
+	}
+}
+
+type UserStore interface {
+	GetUser(id int64) (data.User, error)
+	GetAllUsers() ([]data.User, error)
+	GetUserFromMatchingUsername(name string) ([]data.User, error)
+	CreateUserAccountInDatabase(username string, passwd string) (data.User, error)
+	ModifyLastLogin(id int64) (data.User, error)
+	ModifyUserAccountName(id int64, newUsername string) (data.User, error)
+	ModifyUserAccountPassword(id int64, password string) (data.User, error)
+	// SetUserRole replaces the server wide role of the user
+	SetUserRole(id int64, role string) error
+	GetUsersWithRole(role string) ([]data.User, error)
+	DeleteUserAccount(id int64) error
+	DropUserTable()
+}
+
+type ListStore interface {
+	GetRawShoppingListWithId(listId int64, createdBy int64) (data.List, error)
+	GetRawShoppingListsForUserId(id int64) ([]data.List, error)
+	GetRawShoppingListsByIDs(listIds []data.ListPK) ([]data.List, error)
+	GetAllRawShoppingLists() ([]data.List, error)
+	GetShoppingListsFromSharedListIds(sharedLists []data.ListShared) ([]data.List, error)
+	// CreateOrUpdateShoppingList writes the list and its items atomically,
+	// failing items are reported as *ItemsError
+	CreateOrUpdateShoppingList(list data.List) error
+	// MergeShoppingList merges concurrent changes instead of rejecting outdated versions
+	MergeShoppingList(list data.List) (data.ListMergeResult, error)
+	BumpListVersion(listId int64, createdBy int64) (int64, error)
+	DeleteShoppingList(id int64, createdBy int64) error
+	DeleteShoppingListFrom(createdBy int64) error
+	DropShoppingListTable()
+}
+
+type SharingStore interface {
+	GetListIdsSharedWithUser(userId int64) ([]data.ListPK, error)
+	// GetUsersSharingList returns the ids of all users the list is shared with, -1 meaning everybody
+	GetUsersSharingList(listId int64, createdBy int64) ([]int64, error)
+	IsListSharedWithUser(listId int64, createdBy int64, userId int64) error
+	// GetSharePermission returns the permission of the user the list is shared with
+	GetSharePermission(listId int64, createdBy int64, userId int64) (string, error)
+	IsListCreatedBy(listId int64, userId int64) error
+	CheckUserAndListExist(listId int64, createdBy int64, sharedWith int64) error
+	// CreateOrUpdateSharedList shares the list right away, accepting a pending request
+	CreateOrUpdateSharedList(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error)
+	// CreateShareRequest creates a pending share, existing shares only get the new permission
+	CreateShareRequest(listId int64, createdBy int64, sharedWith int64, permission string) (data.ListShared, error)
+	// AcceptShareRequest returns sql.ErrNoRows if there is no pending request
+	AcceptShareRequest(listId int64, createdBy int64, userId int64) error
+	// GetSharesOfList returns the direct shares with users including pending requests
+	GetSharesOfList(listId int64, createdBy int64) ([]data.ListShared, error)
+	GetIncomingShareRequests(userId int64) ([]data.ListShared, error)
+	// GetOutgoingShareRequests returns the pending requests of lists created by the user
+	GetOutgoingShareRequests(createdBy int64) ([]data.ListShared, error)
+	DeleteSharingOfList(listId int64, createdBy int64) error
+	DeleteSharingForUser(listId int64, createdBy int64, userId int64) error
+	ResetSharedListTable()
+}
+
+// HouseholdStore groups users, lists and recipes shared with a household are visible to
+// the current members. The sharing queries of lists and recipes include these shares.
+type HouseholdStore interface {
+	// CreateHousehold creates the household with the creator as owner
+	CreateHousehold(name string, createdBy int64) (data.Household, error)
+	// GetHousehold returns the household including its members
+	GetHousehold(householdId int64) (data.Household, error)
+	GetHouseholdsForUser(userId int64) ([]data.Household, error)
+	RenameHousehold(householdId int64, name string) error
+	DeleteHousehold(householdId int64) error
+	// GetHouseholdRole returns sql.ErrNoRows if the user is no member
+	GetHouseholdRole(householdId int64, userId int64) (string, error)
+	SetHouseholdRole(householdId int64, userId int64, role string) error
+	RemoveHouseholdMember(householdId int64, userId int64) error
+
+	CreateHouseholdInvitation(householdId int64, userId int64, invitedBy int64) (data.HouseholdInvitation, error)
+	GetHouseholdInvitationsForUser(userId int64) ([]data.HouseholdInvitation, error)
+	// AcceptHouseholdInvitation adds the user as member, sql.ErrNoRows if not invited
+	AcceptHouseholdInvitation(householdId int64, userId int64) error
+	DeleteHouseholdInvitation(householdId int64, userId int64) error
+
+	ShareListWithHousehold(listId int64, createdBy int64, householdId int64, permission string) error
+	GetListsSharedWithHousehold(householdId int64) ([]data.ListPK, error)
+	ShareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error
+	UnshareRecipeWithHousehold(recipeId int64, createdBy int64, householdId int64) error
+}
+
+type BlockingStore interface {
+	// BlockUser also removes the pending share requests of the blocked user
+	BlockUser(userId int64, blockedId int64) error
+	UnblockUser(userId int64, blockedId int64) error
+	GetBlockedUsers(userId int64) ([]data.BlockedUser, error)
+	IsUserBlocked(userId int64, blockedId int64) (bool, error)
+}
+
+type InviteStore interface {
+	CreateInvite(invite data.Invite) error
+	GetInvite(inviteId string) (data.Invite, error)
+	// GetPendingInvites returns the invites of the user that are neither expired nor used up
+	GetPendingInvites(invitedBy int64, now time.Time) ([]data.Invite, error)
+	// RedeemInvite counts a use and grants the invited access to the user, sql.ErrNoRows if the
+	// invite is expired, used up or revoked and ErrInviterNotAllowed if the inviting user may no longer share
+	RedeemInvite(invite data.Invite, userId int64, now time.Time) error
+	DeleteInvite(inviteId string) error
+}
+
+type ItemStore interface {
+	IsItemInList(listId int64, createdBy int64, itemId int64) (data.ListItem, error)
+	GetItemsInList(listId int64, createdBy int64) ([]data.ItemWire, error)
+	InsertOrUpdateItemInList(mapping data.ListItem) (data.ListItem, error)
+	// ChangeItemInList, RemoveItemFromList and ReorderItemsInList bump the version of the list
+	// together with the change of the items and return the new version
+	ChangeItemInList(mapping data.ListItem) (data.ListItem, int64, error)
+	DeleteItemInList(listId int64, createdBy int64, itemId int64) error
+	RemoveItemFromList(listId int64, createdBy int64, itemId int64) (int64, error)
+	DeleteAllItemsInList(listId int64, createdBy int64) error
+	ReorderItemsInList(listId int64, createdBy int64, itemIds []int64) (int64, error)
+	ResetItemPerListTable()
+
+	GetItem(id int64) (data.Item, error)
+	GetAllItems() ([]data.Item, error)
+	GetAllItemsFromName(name string) ([]data.Item, error)
+	InsertItem(name string, icon string) (data.Item, error)
+	InsertItemStruct(item data.Item) (data.Item, error)
+	ModifyItem(id int64, name string, icon string) (data.Item, error)
+	DeleteItem(id int64) error
+	ResetItemTable()
+}
+
+type RecipeStore interface {
+	// CreateRecipe and UpdateRecipe store the recipe together with its image filenames atomically
+	CreateRecipe(recipe data.Recipe, imageFilenames []string) error
+	GetIngredientsForRecipe(recipeId int64, createdBy int64) ([]data.Ingredient, error)
+	GetDescriptionsForRecipe(recipeId int64, createdBy int64) ([]data.RecipeDescription, error)
+	GetRecipe(recipeId int64, createdBy int64) (data.Recipe, error)
+	GetRecipeForUserId(userId int64) ([]int64, error)
+	GetRecipeIdsSharedWithUserId(userId int64) ([]int64, []int64, error)
+	IsRecipeSharedWithUser(userId int64, recipeId int64, createdBy int64) error
+	GetAllRecipes() ([]data.Recipe, error)
+	UpdateRecipe(recipe data.Recipe, imageFilenames []string) error
+	UpdateRecipeWithoutComparingVersion(recipeToUpdate data.Recipe) error
+	DeleteRecipe(recipeId int64, createdBy int64) error
+	ResetRecipeTables()
+
+	CreateRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error
+	DeleteRecipeSharing(recipeId int64, createdBy int64, sharedWith int64) error
+	DeleteAllSharingForRecipe(recipeId int64, createdBy int64) error
+}
+
+// ImageStore only keeps track of the image filenames, the image content itself
+// is stored on disk (see StoreImagesForRecipe)
+type ImageStore interface {
+	StoreRecipeImageFilenames(filenames []string, recipePK data.RecipePK) ([]string, error)
+	GetImageNamesForRecipe(recipeId int64, createdBy int64) ([]string, error)
+	RemoveImagesForRecipe(recipeId int64, createdBy int64) error
+}
+
+type TokenStore interface {
+	CreateSession(session data.Session) error
+	GetSession(sessionId string) (data.Session, error)
+	// GetSessionsForUser returns the sessions of the user, most recently seen first
+	GetSessionsForUser(userId int64) ([]data.Session, error)
+	// TouchSession updates the last seen time and address of the session
+	TouchSession(sessionId string, ip string, seen time.Time) error
+	// DeleteSession removes the session including its tokens
+	DeleteSession(sessionId string) (int64, error)
+	DeleteSessionsForUser(userId int64) (int64, error)
+
+	InsertToken(token data.TokenData) error
+	GetToken(tokenId string) (data.TokenData, error)
+	DeleteToken(tokenId string) (int64, error)
+	DeleteTokensForSession(sessionId string) (int64, error)
+	DeleteTokensForUser(userId int64) (int64, error)
+	DeleteExpiredTokens(before time.Time) (int64, error)
+	// GetTokensForUser returns the tokens of all sessions of the user, newest first
+	GetTokensForUser(userId int64) ([]data.TokenData, error)
+
+	InsertRefreshToken(token data.RefreshToken) error
+	GetRefreshToken(tokenHash string) (data.RefreshToken, error)
+	// UseRefreshToken marks the token as replaced, sql.ErrNoRows if it was already used
+	UseRefreshToken(tokenHash string) error
+	DeleteRefreshTokensForUser(userId int64) (int64, error)
+	DeleteExpiredRefreshTokens(before time.Time) (int64, error)
+
+	// CreatePasswordReset replaces a pending reset of the user
+	CreatePasswordReset(reset data.PasswordReset) error
+	GetPasswordReset(userId int64) (data.PasswordReset, error)
+	IncreasePasswordResetAttempts(userId int64) error
+	// DeletePasswordReset returns 0 if the reset was already removed, e.g. by a concurrent use
+	DeletePasswordReset(userId int64) (int64, error)
+	DeleteExpiredPasswordResets(before time.Time) (int64, error)
+}
+
+// TOTPStore keeps the second factor of the users, recovery codes are only stored hashed
+type TOTPStore interface {
+	// CreateTOTP replaces the TOTP of the user including its recovery codes
+	CreateTOTP(totp data.TOTP) error
+	GetTOTP(userId int64) (data.TOTP, error)
+	EnableTOTP(userId int64) error
+	// UseTOTPStep stores the time step of an accepted code, returns 0 if the step or a later one was used before
+	UseTOTPStep(userId int64, step int64) (int64, error)
+	// DeleteTOTP removes the TOTP including its recovery codes
+	DeleteTOTP(userId int64) error
+
+	ReplaceRecoveryCodes(userId int64, codeHashes []string) error
+	// UseRecoveryCode removes the code, returns 0 if the code does not exist or was used concurrently
+	UseRecoveryCode(userId int64, codeHash string) (int64, error)
+	CountRecoveryCodes(userId int64) (int, error)
+}
+
+// IdentityStore links the users to the accounts of external OpenID Connect providers
+type IdentityStore interface {
+	// CreateOIDCIdentity fails if the account is already linked
+	CreateOIDCIdentity(identity data.OIDCIdentity) error
+	GetOIDCIdentity(issuer string, subject string) (data.OIDCIdentity, error)
+}
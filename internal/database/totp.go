@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Second factor and recovery codes
+// ------------------------------------------------------------
+
+const deleteRecoveryCodesQuery = "DELETE FROM recovery_code WHERE userId = ?"
+
+// REPLACE is understood by MySQL and SQLite alike
+const replaceTOTPQuery = "REPLACE INTO totp (userId, secret, enabled, lastUsedStep, created) VALUES (?, ?, ?, ?, ?)"
+
+func (s *SQLStore) CreateTOTP(totp data.TOTP) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteRecoveryCodesQuery, totp.UserId); err != nil {
+			return err
+		}
+		_, err := tx.Exec(replaceTOTPQuery, totp.UserId, totp.Secret, totp.Enabled, totp.LastUsedStep, totp.Created)
+		return err
+	})
+}
+
+const selectTOTPQuery = "SELECT userId, secret, enabled, lastUsedStep, created FROM totp WHERE userId = ?"
+
+func (s *SQLStore) GetTOTP(userId int64) (data.TOTP, error) {
+	var totp data.TOTP
+	err := s.db.QueryRow(selectTOTPQuery, userId).Scan(&totp.UserId, &totp.Secret, &totp.Enabled, &totp.LastUsedStep, &totp.Created)
+	return totp, err
+}
+
+const enableTOTPQuery = "UPDATE totp SET enabled = TRUE WHERE userId = ?"
+
+func (s *SQLStore) EnableTOTP(userId int64) error {
+	res, err := s.db.Exec(enableTOTPQuery, userId)
+	if err != nil {
+		return err
+	}
+	if affectedRows, _ := res.RowsAffected(); affectedRows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Only a later step is stored, so concurrent logins cannot use the same code
+const useTOTPStepQuery = "UPDATE totp SET lastUsedStep = ? WHERE userId = ? AND lastUsedStep < ?"
+
+func (s *SQLStore) UseTOTPStep(userId int64, step int64) (int64, error) {
+	res, err := s.db.Exec(useTOTPStepQuery, step, userId, step)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+const deleteTOTPQuery = "DELETE FROM totp WHERE userId = ?"
+
+func (s *SQLStore) DeleteTOTP(userId int64) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteRecoveryCodesQuery, userId); err != nil {
+			return err
+		}
+		_, err := tx.Exec(deleteTOTPQuery, userId)
+		return err
+	})
+}
+
+const insertRecoveryCodeQuery = "INSERT INTO recovery_code (userId, codeHash) VALUES (?, ?)"
+
+func (s *SQLStore) ReplaceRecoveryCodes(userId int64, codeHashes []string) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteRecoveryCodesQuery, userId); err != nil {
+			return err
+		}
+		for _, codeHash := range codeHashes {
+			if _, err := tx.Exec(insertRecoveryCodeQuery, userId, codeHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const deleteRecoveryCodeQuery = "DELETE FROM recovery_code WHERE userId = ? AND codeHash = ?"
+
+func (s *SQLStore) UseRecoveryCode(userId int64, codeHash string) (int64, error) {
+	res, err := s.db.Exec(deleteRecoveryCodeQuery, userId, codeHash)
+	if err != nil {
+		return 0, err
+	}
+	affectedRows, _ := res.RowsAffected()
+	return affectedRows, nil
+}
+
+const countRecoveryCodesQuery = "SELECT COUNT(*) FROM recovery_code WHERE userId = ?"
+
+func (s *SQLStore) CountRecoveryCodes(userId int64) (int, error) {
+	var count int
+	err := s.db.QueryRow(countRecoveryCodesQuery, userId).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// checkTOTP runs against every backend, codes and steps can only be used once
+func checkTOTP(t *testing.T, totpStore Store) {
+	user, err := totpStore.CreateUserAccountInDatabase("totp user", "password")
+	assert.Nil(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = totpStore.GetTOTP(user.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, totpStore.EnableTOTP(user.OnlineID))
+
+	assert.Nil(t, totpStore.CreateTOTP(data.TOTP{UserId: user.OnlineID, Secret: "SECRET", Created: now}))
+	assert.Nil(t, totpStore.EnableTOTP(user.OnlineID))
+	stored, err := totpStore.GetTOTP(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, "SECRET", stored.Secret)
+	assert.True(t, stored.Enabled)
+	assert.Equal(t, now.Unix(), stored.Created.Unix())
+
+	used, err := totpStore.UseTOTPStep(user.OnlineID, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), used)
+	for _, step := range []int64{10, 9} {
+		used, err = totpStore.UseTOTPStep(user.OnlineID, step)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), used)
+	}
+
+	assert.Nil(t, totpStore.ReplaceRecoveryCodes(user.OnlineID, []string{"first", "second"}))
+	count, err := totpStore.CountRecoveryCodes(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	used, err = totpStore.UseRecoveryCode(user.OnlineID, "first")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), used)
+	used, err = totpStore.UseRecoveryCode(user.OnlineID, "first")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), used)
+	assert.Nil(t, totpStore.ReplaceRecoveryCodes(user.OnlineID, []string{"third"}))
+	used, err = totpStore.UseRecoveryCode(user.OnlineID, "second")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), used)
+
+	// A new enrollment starts without recovery codes
+	assert.Nil(t, totpStore.CreateTOTP(data.TOTP{UserId: user.OnlineID, Secret: "NEW", Created: now}))
+	stored, err = totpStore.GetTOTP(user.OnlineID)
+	assert.Nil(t, err)
+	assert.False(t, stored.Enabled)
+	assert.Equal(t, int64(0), stored.LastUsedStep)
+	count, err = totpStore.CountRecoveryCodes(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	assert.Nil(t, totpStore.ReplaceRecoveryCodes(user.OnlineID, []string{"fourth"}))
+	assert.Nil(t, totpStore.DeleteTOTP(user.OnlineID))
+	_, err = totpStore.GetTOTP(user.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	count, err = totpStore.CountRecoveryCodes(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	// Deleting the user removes the second factor
+	assert.Nil(t, totpStore.CreateTOTP(data.TOTP{UserId: user.OnlineID, Secret: "SECRET", Created: now}))
+	assert.Nil(t, totpStore.DeleteUserAccount(user.OnlineID))
+	_, err = totpStore.GetTOTP(user.OnlineID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestTOTP(t *testing.T) {
+	connectDatabase()
+	checkTOTP(t, store)
+}
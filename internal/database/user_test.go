@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/alexedwards/argon2id"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
 // ------------------------------------------------------------
@@ -20,7 +23,7 @@ func TestCreatingUser(t *testing.T) {
 	connectDatabase()
 	username := "test user 123 🐧"
 	password := "password is secure"
-	user, err := createUser(username, password)
+	user, err := createUser(1234, username, password)
 	if err != nil {
 		log.Printf("User creation failed: %s", err)
 		t.FailNow()
@@ -55,7 +58,7 @@ func TestCreatingIncorrectUser(t *testing.T) {
 	connectDatabase()
 	username := "test user 123 🐧"
 	password := "password is secure"
-	user, err := createUser("", password)
+	user, err := createUser(1234, "", password)
 	if err == nil {
 		log.Printf("Expected error but got none")
 		t.FailNow()
@@ -64,7 +67,7 @@ func TestCreatingIncorrectUser(t *testing.T) {
 		log.Printf("Expected empty user but got: %v", user)
 		t.FailNow()
 	}
-	user, err = createUser(username, "")
+	user, err = createUser(1234, username, "")
 	if err == nil {
 		log.Printf("Expected error but got none")
 		t.FailNow()
@@ -78,22 +81,22 @@ func TestCreatingIncorrectUser(t *testing.T) {
 
 func TestInsertUser(t *testing.T) {
 	connectDatabase()
-	newUser, _ := createUser("new user", "new secure password")
-	_, err := CreateUserAccountInDatabase(newUser.Username, newUser.Password)
+	newUser, _ := createUser(1234, "new user", "new secure password")
+	_, err := store.CreateUserAccountInDatabase(newUser.Username, newUser.Password)
 	if err != nil {
 		log.Printf("Failed to insert user into database: %s", err)
 		t.FailNow()
 	}
 	log.Print("InsertUser successfully completed")
-	PrintUserTable("shoppers")
-	ResetUserTable()
+	store.PrintUserTable("shoppers")
+	store.DropUserTable()
 }
 
 func TestDeletingUser(t *testing.T) {
 	connectDatabase()
 	password := "password"
-	user, _ := createUser("username", password)
-	createdUser, err := CreateUserAccountInDatabase(user.Username, password)
+	user, _ := createUser(1234, "username", password)
+	createdUser, err := store.CreateUserAccountInDatabase(user.Username, password)
 	if err != nil {
 		log.Printf("Failed to insert user into database: %s", err)
 		t.FailNow()
@@ -107,27 +110,27 @@ func TestDeletingUser(t *testing.T) {
 		log.Printf("User not correctly inserted")
 		t.FailNow()
 	}
-	PrintUserTable("shoppers")
-	err = DeleteUserAccount(createdUser.OnlineID)
+	store.PrintUserTable("shoppers")
+	err = store.DeleteUserAccount(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to delete user with id %d from database", createdUser.OnlineID)
 		t.FailNow()
 	}
-	deletedUser, err := GetUser(createdUser.OnlineID)
+	deletedUser, err := store.GetUser(createdUser.OnlineID)
 	if err == nil || deletedUser.OnlineID != 0 {
 		log.Print("Could retrieve user from database after deleting!")
 		t.FailNow()
 	}
 	log.Print("DeleteUser successfully completed")
-	PrintUserTable("shoppers")
-	ResetUserTable()
+	store.PrintUserTable("shoppers")
+	store.DropUserTable()
 }
 
 func TestUserLogin(t *testing.T) {
 	connectDatabase()
 	password := "very secure password"
-	user, _ := createUser("test user login", password)
-	createdUser, err := CreateUserAccountInDatabase(user.Username, password)
+	user, _ := createUser(1234, "test user login", password)
+	createdUser, err := store.CreateUserAccountInDatabase(user.Username, password)
 	if err != nil {
 		log.Printf("Failed to insert user into database: %s", err)
 		t.FailNow()
@@ -141,8 +144,8 @@ func TestUserLogin(t *testing.T) {
 		log.Printf("User not correctly inserted")
 		t.FailNow()
 	}
-	PrintUserTable("shoppers")
-	checkLoginUser, err := GetUser(createdUser.OnlineID)
+	store.PrintUserTable("shoppers")
+	checkLoginUser, err := store.GetUser(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get newly created user for login check: %s", err)
 		t.FailNow()
@@ -162,19 +165,19 @@ func TestUserLogin(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("TestLoginUser successfully completed")
-	ResetUserTable()
+	store.DropUserTable()
 }
 
 func TestModifyUsername(t *testing.T) {
 	connectDatabase()
 	password := "very secure password"
-	user, _ := createUser("modify username user", password)
-	createdUser, err := CreateUserAccountInDatabase(user.Username, password)
+	user, _ := createUser(1234, "modify username user", password)
+	createdUser, err := store.CreateUserAccountInDatabase(user.Username, password)
 	if err != nil {
 		log.Printf("Failed to insert user into database: %s", err)
 		t.FailNow()
 	}
-	checkOldUsername, err := GetUser(createdUser.OnlineID)
+	checkOldUsername, err := store.GetUser(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get newly created user for modify check: %s", err)
 		t.FailNow()
@@ -183,17 +186,17 @@ func TestModifyUsername(t *testing.T) {
 		log.Print("Usernames do not match before checking!")
 		t.FailNow()
 	}
-	updatedUsername, err := ModifyUserAccountName(createdUser.OnlineID, user.Username+" - Updated")
+	updatedUsername, err := store.ModifyUserAccountName(createdUser.OnlineID, user.Username+" - Updated")
 	if err != nil {
 		log.Printf("Failed to update username: %s", err)
 		t.FailNow()
 	}
-	PrintUserTable("shoppers")
+	store.PrintUserTable("shoppers")
 	if updatedUsername.Username == checkOldUsername.Username {
 		log.Print("The updated username is still the same!")
 		t.FailNow()
 	}
-	checkNewUsername, err := GetUser(createdUser.OnlineID)
+	checkNewUsername, err := store.GetUser(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get updated user: %s", err)
 		t.FailNow()
@@ -203,19 +206,19 @@ func TestModifyUsername(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("TestModifyUsername successfully completed")
-	ResetUserTable()
+	store.DropUserTable()
 }
 
 func TestModifyUserPassword(t *testing.T) {
 	connectDatabase()
 	password := "very secure password"
-	user, _ := createUser("modify password user", password)
-	createdUser, err := CreateUserAccountInDatabase(user.Username, password)
+	user, _ := createUser(1234, "modify password user", password)
+	createdUser, err := store.CreateUserAccountInDatabase(user.Username, password)
 	if err != nil {
 		log.Printf("Failed to insert user into database: %s", err)
 		t.FailNow()
 	}
-	checkOldPassword, err := GetUser(createdUser.OnlineID)
+	checkOldPassword, err := store.GetUser(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get newly created user for modify check: %s", err)
 		t.FailNow()
@@ -224,18 +227,18 @@ func TestModifyUserPassword(t *testing.T) {
 		log.Print("Password do not match before update!")
 		t.FailNow()
 	}
-	updatedUser, err := ModifyUserAccountPassword(createdUser.OnlineID, "New Password")
+	updatedUser, err := store.ModifyUserAccountPassword(createdUser.OnlineID, "New Password")
 	if err != nil {
 		log.Printf("Failed to update password: %s", err)
 		t.FailNow()
 	}
-	PrintUserTable("shoppers")
+	store.PrintUserTable("shoppers")
 	match, err := argon2id.ComparePasswordAndHash("New Password", updatedUser.Password)
 	if err != nil || !match {
 		log.Print("The password was not correctly updated!")
 		t.FailNow()
 	}
-	checkNewPassword, err := GetUser(createdUser.OnlineID)
+	checkNewPassword, err := store.GetUser(createdUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to get updated user: %s", err)
 		t.FailNow()
@@ -246,5 +249,43 @@ func TestModifyUserPassword(t *testing.T) {
 		t.FailNow()
 	}
 	log.Print("TestModifyUserPassword successfully completed")
-	ResetUserTable()
+	store.DropUserTable()
+}
+
+// checkUserRoles runs against every backend, users are created without admin rights
+func checkUserRoles(t *testing.T, roleStore Store) {
+	user, err := roleStore.CreateUserAccountInDatabase("role user", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, data.USER, user.Role)
+	other, err := roleStore.CreateUserAccountInDatabase("other role user", "password")
+	assert.Nil(t, err)
+	admins, err := roleStore.GetUsersWithRole(data.ADMIN)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(admins))
+
+	assert.Nil(t, roleStore.SetUserRole(user.OnlineID, data.ADMIN))
+	assert.NotNil(t, roleStore.SetUserRole(user.OnlineID, "SU"))
+	assert.NotNil(t, roleStore.SetUserRole(other.OnlineID+user.OnlineID, data.ADMIN))
+	stored, err := roleStore.GetUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ADMIN, stored.Role)
+	admins, err = roleStore.GetUsersWithRole(data.ADMIN)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(admins)) {
+		assert.Equal(t, user.OnlineID, admins[0].OnlineID)
+		assert.Equal(t, "", admins[0].Password)
+	}
+
+	assert.Nil(t, roleStore.SetUserRole(user.OnlineID, data.USER))
+	stored, err = roleStore.GetUser(user.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.USER, stored.Role)
+	users, err := roleStore.GetUsersWithRole(data.USER)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+}
+
+func TestUserRoles(t *testing.T) {
+	connectDatabase()
+	checkUserRoles(t, store)
 }
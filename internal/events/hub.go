@@ -0,0 +1,99 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// Everybody as recipient delivers the event to all subscribers,
+// matching the sharedWithId -1 of lists shared with everybody
+const Everybody int64 = -1
+
+// Number of events buffered per subscriber before events are dropped
+const subscriberBufferSize = 32
+
+// Hub distributes list events to the subscribed users.
+// The in-process MemoryHub only reaches clients connected to this instance,
+// multi-instance deployments can replace it with e.g. a Redis or database backed implementation.
+type Hub interface {
+	Publish(event data.ListEvent, userIds []int64)
+	// Subscribe returns the channel receiving the events for the user and
+	// the function to cancel the subscription, which closes the channel
+	Subscribe(userId int64) (<-chan data.ListEvent, func())
+}
+
+type subscriber struct {
+	userId int64
+	events chan data.ListEvent
+}
+
+type MemoryHub struct {
+	mutex       sync.RWMutex
+	subscribers map[int64]map[*subscriber]struct{}
+}
+
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{
+		subscribers: make(map[int64]map[*subscriber]struct{}),
+	}
+}
+
+func (h *MemoryHub) Subscribe(userId int64) (<-chan data.ListEvent, func()) {
+	sub := &subscriber{
+		userId: userId,
+		events: make(chan data.ListEvent, subscriberBufferSize),
+	}
+	h.mutex.Lock()
+	if _, exists := h.subscribers[userId]; !exists {
+		h.subscribers[userId] = make(map[*subscriber]struct{})
+	}
+	h.subscribers[userId][sub] = struct{}{}
+	h.mutex.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mutex.Lock()
+			defer h.mutex.Unlock()
+			delete(h.subscribers[userId], sub)
+			if len(h.subscribers[userId]) == 0 {
+				delete(h.subscribers, userId)
+			}
+			close(sub.events)
+		})
+	}
+	return sub.events, unsubscribe
+}
+
+// Publish never blocks, events for subscribers that do not keep up are dropped.
+// Clients sync the lists after reconnecting, so no change is lost.
+func (h *MemoryHub) Publish(event data.ListEvent, userIds []int64) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	delivered := make(map[*subscriber]bool)
+	for _, userId := range userIds {
+		if userId == Everybody {
+			for _, subs := range h.subscribers {
+				h.deliver(event, subs, delivered)
+			}
+			continue
+		}
+		h.deliver(event, h.subscribers[userId], delivered)
+	}
+}
+
+func (h *MemoryHub) deliver(event data.ListEvent, subs map[*subscriber]struct{}, delivered map[*subscriber]bool) {
+	for sub := range subs {
+		if delivered[sub] {
+			continue
+		}
+		delivered[sub] = true
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Dropping %s event of list %d for user %d, subscriber is too slow", event.Type, event.ListId, sub.userId)
+		}
+	}
+}
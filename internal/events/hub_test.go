@@ -0,0 +1,68 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func receive(t *testing.T, events <-chan data.ListEvent) []data.ListEvent {
+	var received []data.ListEvent
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("Channel closed unexpectedly")
+			}
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestPublishOnlyReachesRecipients(t *testing.T) {
+	hub := NewMemoryHub()
+	owner, cancelOwner := hub.Subscribe(1)
+	defer cancelOwner()
+	ownerSecondDevice, cancelSecondDevice := hub.Subscribe(1)
+	defer cancelSecondDevice()
+	other, cancelOther := hub.Subscribe(2)
+	defer cancelOther()
+
+	event := data.ListEvent{Type: data.ListEventUpdated, ListId: 3, CreatedBy: 1, Version: 2}
+	// Duplicate recipients must not lead to duplicate events
+	hub.Publish(event, []int64{1, 1, 5})
+
+	assert.Equal(t, []data.ListEvent{event}, receive(t, owner))
+	assert.Equal(t, []data.ListEvent{event}, receive(t, ownerSecondDevice))
+	assert.Empty(t, receive(t, other))
+
+	hub.Publish(event, []int64{1, Everybody})
+	assert.Equal(t, []data.ListEvent{event}, receive(t, owner))
+	assert.Equal(t, []data.ListEvent{event}, receive(t, other))
+}
+
+func TestUnsubscribeClosesChannel(t *testing.T) {
+	hub := NewMemoryHub()
+	events, cancel := hub.Subscribe(1)
+	cancel()
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+	// Publishing without subscribers must not block or panic
+	hub.Publish(data.ListEvent{Type: data.ListEventDeleted, ListId: 1, CreatedBy: 1}, []int64{1})
+	assert.Empty(t, hub.subscribers)
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	hub := NewMemoryHub()
+	events, cancel := hub.Subscribe(1)
+	defer cancel()
+	for i := 0; i < subscriberBufferSize+10; i++ {
+		hub.Publish(data.ListEvent{Type: data.ListEventUpdated, ListId: 1, CreatedBy: 1, Version: int64(i)}, []int64{1})
+	}
+	assert.Equal(t, subscriberBufferSize, len(receive(t, events)))
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+)
+
+// IPAccessMiddleware rejects clients whose address is not allowed to use the route group.
+// The address is only taken from proxy headers of trusted proxies.
+func IPAccessMiddleware(lists *authentication.IPAccessLists, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if !lists.Allowed(group, ip) {
+			log.Printf("Access to %s from %s not allowed", group, ip)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "request from IP not allowed"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/ratelimit"
+)
+
+// RateLimitMiddleware limits the requests of every client to the route group.
+// Groups keyed by user must be added after the authentication.
+func RateLimitMiddleware(limiter ratelimit.Limiter, group string, config configuration.RateLimit) gin.HandlerFunc {
+	limit := ratelimit.Limit{
+		Requests: config.Requests,
+		Interval: time.Duration(config.IntervalSeconds) * time.Second,
+	}
+	return func(c *gin.Context) {
+		key := group + ":" + rateLimitKey(c, config.Key)
+		wait, err := limiter.Allow(key, limit)
+		if err != nil {
+			// An unavailable limiter should not take the whole server down with it
+			log.Printf("Failed to check the rate limit of %s: %s", key, err)
+			c.Next()
+			return
+		}
+		if wait > 0 {
+			log.Printf("Rate limit of %s exceeded", key)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func rateLimitKey(c *gin.Context, key string) string {
+	if key == configuration.RateLimitByAPIKey {
+		if apiKey := c.GetHeader("x-api-key"); apiKey != "" {
+			hash := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(hash[:8])
+		}
+	}
+	if key == configuration.RateLimitByUser || key == configuration.RateLimitByAPIKey {
+		if userId := c.GetInt64("userId"); userId != 0 {
+			return fmt.Sprintf("user:%d", userId)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
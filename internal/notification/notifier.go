@@ -0,0 +1,113 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// Notifier delivers messages to users outside of the app, e.g. the codes of password resets.
+// The log and file implementations are meant for running the server locally,
+// deployments can add e.g. a mail or push implementation.
+type Notifier interface {
+	SendPasswordResetCode(user data.User, code string, validUntil time.Time) error
+}
+
+// The kinds of messages sent by the notifiers
+const (
+	MessagePasswordReset = "passwordReset"
+)
+
+// Message is the content of a notification as written by the FileNotifier
+type Message struct {
+	Kind       string    `json:"kind"`
+	UserId     int64     `json:"userId"`
+	Username   string    `json:"username"`
+	Code       string    `json:"code"`
+	ValidUntil time.Time `json:"validUntil"`
+	Created    time.Time `json:"created"`
+}
+
+// NewNotifier creates the notifier selected in the configuration. Production servers
+// refuse the log notifier, otherwise everyone reading the log could reset passwords.
+func NewNotifier(config configuration.NotifierConfig, production bool) (Notifier, error) {
+	switch config.Type {
+	case "", configuration.NotifierLog:
+		if production {
+			return nil, errors.New("the log notifier prints the password reset codes and cannot be used in production, configure a notifier")
+		}
+		return LogNotifier{}, nil
+	case configuration.NotifierFile:
+		if config.File == "" {
+			return nil, fmt.Errorf("notifier '%s' requires a file", config.Type)
+		}
+		return NewFileNotifier(config.File), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier '%s'", config.Type)
+	}
+}
+
+func passwordResetMessage(user data.User, code string, validUntil time.Time) Message {
+	return Message{
+		Kind:       MessagePasswordReset,
+		UserId:     user.OnlineID,
+		Username:   user.Username,
+		Code:       code,
+		ValidUntil: validUntil,
+		Created:    time.Now().UTC(),
+	}
+}
+
+// ------------------------------------------------------------
+// Log notifier, prints the messages to the server log
+// ------------------------------------------------------------
+
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordResetCode(user data.User, code string, validUntil time.Time) error {
+	log.Printf("Password reset code for user %d (%s): %s, valid until %s", user.OnlineID, user.Username, code, validUntil.Format(time.RFC3339))
+	return nil
+}
+
+// ------------------------------------------------------------
+// File notifier, appends the messages as JSON lines
+// ------------------------------------------------------------
+
+type FileNotifier struct {
+	mutex    sync.Mutex
+	filename string
+}
+
+func NewFileNotifier(filename string) *FileNotifier {
+	return &FileNotifier{filename: filename}
+}
+
+func (f *FileNotifier) SendPasswordResetCode(user data.User, code string, validUntil time.Time) error {
+	return f.write(passwordResetMessage(user, code, validUntil))
+}
+
+func (f *FileNotifier) write(message Message) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// The codes allow taking over accounts, therefore only the server user may read the file
+	file, err := os.OpenFile(f.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(encoded, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+func TestNewNotifier(t *testing.T) {
+	notifier, err := NewNotifier(configuration.NotifierConfig{}, false)
+	assert.Nil(t, err)
+	assert.IsType(t, LogNotifier{}, notifier)
+	_, err = NewNotifier(configuration.NotifierConfig{Type: configuration.NotifierFile}, false)
+	assert.NotNil(t, err)
+	_, err = NewNotifier(configuration.NotifierConfig{Type: "pigeon"}, false)
+	assert.NotNil(t, err)
+	// The codes must not end up in the log of production servers
+	_, err = NewNotifier(configuration.NotifierConfig{}, true)
+	assert.NotNil(t, err)
+	_, err = NewNotifier(configuration.NotifierConfig{Type: configuration.NotifierLog}, true)
+	assert.NotNil(t, err)
+	_, err = NewNotifier(configuration.NotifierConfig{Type: configuration.NotifierFile, File: filepath.Join(t.TempDir(), "notifications.jsonl")}, true)
+	assert.Nil(t, err)
+	assert.Nil(t, LogNotifier{}.SendPasswordResetCode(data.User{OnlineID: 1, Username: "user"}, "12345678", time.Now()))
+}
+
+func TestFileNotifier(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "notifications.jsonl")
+	notifier, err := NewNotifier(configuration.NotifierConfig{Type: configuration.NotifierFile, File: filename}, false)
+	assert.Nil(t, err)
+	validUntil := time.Now().UTC().Add(time.Minute).Truncate(time.Second)
+	user := data.User{OnlineID: 1, Username: "user"}
+	assert.Nil(t, notifier.SendPasswordResetCode(user, "first", validUntil))
+	assert.Nil(t, notifier.SendPasswordResetCode(user, "second", validUntil))
+
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	file, err := os.Open(filename)
+	assert.Nil(t, err)
+	defer file.Close()
+	messages := make([]Message, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message Message
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &message))
+		messages = append(messages, message)
+	}
+	if assert.Equal(t, 2, len(messages)) {
+		assert.Equal(t, MessagePasswordReset, messages[0].Kind)
+		assert.Equal(t, "first", messages[0].Code)
+		assert.Equal(t, "second", messages[1].Code)
+		assert.Equal(t, user.OnlineID, messages[1].UserId)
+		assert.True(t, validUntil.Equal(messages[1].ValidUntil))
+	}
+}
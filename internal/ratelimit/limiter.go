@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// How often the MemoryLimiter removes full buckets
+const DefaultPruneInterval = time.Minute
+
+// Limit allows Requests at once, the bucket refills completely within the Interval
+type Limit struct {
+	Requests int
+	Interval time.Duration
+}
+
+func (l Limit) tokensPerSecond() float64 {
+	return float64(l.Requests) / l.Interval.Seconds()
+}
+
+// Limiter keeps a token bucket for every key, e.g. the address or user of a route group.
+// The in-process MemoryLimiter only limits the requests to this instance, multi-instance
+// deployments can replace it with e.g. a Redis backed implementation.
+type Limiter interface {
+	// Allow takes a token from the bucket of the key. Returns how long to wait for
+	// the next token if the bucket is empty, 0 if the request is allowed.
+	Allow(key string, limit Limit) (time.Duration, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit // Of the last request, tells when the bucket is full again
+}
+
+type MemoryLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(key string, limit Limit) (time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.now()
+	b, exists := m.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Requests), updated: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now, limit)
+	if b.tokens < 1 {
+		missing := (1 - b.tokens) / limit.tokensPerSecond()
+		return time.Duration(missing * float64(time.Second)), nil
+	}
+	b.tokens--
+	return 0, nil
+}
+
+func (b *bucket) refill(now time.Time, limit Limit) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = min(float64(limit.Requests), b.tokens+elapsed*limit.tokensPerSecond())
+	b.updated = now
+}
+
+// StartPruning periodically removes the full buckets until the returned function is called
+func (m *MemoryLimiter) StartPruning(interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.prune()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// prune removes the buckets that are full again, they do not differ from new ones.
+// Every bucket refills at the rate of its own limit.
+func (m *MemoryLimiter) prune() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.now()
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) >= b.limit.Interval {
+			delete(m.buckets, key)
+		}
+	}
+}
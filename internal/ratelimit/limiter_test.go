@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Interval: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		wait, err := limiter.Allow("10.0.0.1", limit)
+		assert.Nil(t, err)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+	wait, _ := limiter.Allow("10.0.0.1", limit)
+	assert.Equal(t, time.Second, wait)
+	// Other keys have their own bucket
+	wait, _ = limiter.Allow("10.0.0.2", limit)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// One token per second refills
+	now = now.Add(500 * time.Millisecond)
+	wait, _ = limiter.Allow("10.0.0.1", limit)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	now = now.Add(500 * time.Millisecond)
+	wait, _ = limiter.Allow("10.0.0.1", limit)
+	assert.Equal(t, time.Duration(0), wait)
+	wait, _ = limiter.Allow("10.0.0.1", limit)
+	assert.Equal(t, time.Second, wait)
+
+	// The bucket never holds more than the limit
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		wait, _ = limiter.Allow("10.0.0.1", limit)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+	wait, _ = limiter.Allow("10.0.0.1", limit)
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestMemoryLimiterPrune(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	accounts := Limit{Requests: 1, Interval: time.Hour}
+	login := Limit{Requests: 1, Interval: time.Minute}
+
+	_, err := limiter.Allow("accounts:10.0.0.1", accounts)
+	assert.Nil(t, err)
+	_, err = limiter.Allow("login:10.0.0.1", login)
+	assert.Nil(t, err)
+
+	// Only the buckets that refilled within their own interval are removed
+	now = now.Add(2 * time.Minute)
+	limiter.prune()
+	assert.Equal(t, 1, len(limiter.buckets))
+	wait, _ := limiter.Allow("accounts:10.0.0.1", accounts)
+	assert.Equal(t, 58*time.Minute, wait)
+
+	now = now.Add(time.Hour)
+	limiter.prune()
+	assert.Equal(t, 0, len(limiter.buckets))
+}
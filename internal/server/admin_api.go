@@ -3,14 +3,15 @@ package server
 import (
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
 )
 
-func getAllUsers(c *gin.Context) {
-	users, err := database.GetAllUsers()
+func (s *Server) getAllUsers(c *gin.Context) {
+	users, err := s.store.GetAllUsers()
 	if err != nil {
 		log.Printf("Failed to get all users: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -19,8 +20,8 @@ func getAllUsers(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, users)
 }
 
-func getAllLists(c *gin.Context) {
-	lists, err := database.GetAllRawShoppingLists()
+func (s *Server) getAllLists(c *gin.Context) {
+	lists, err := s.store.GetAllRawShoppingLists()
 	if err != nil {
 		log.Printf("Failed to get all lists: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -29,8 +30,8 @@ func getAllLists(c *gin.Context) {
 	c.JSON(http.StatusOK, lists)
 }
 
-func getAllRecipes(c *gin.Context) {
-	recipes, err := database.GetAllRecipes()
+func (s *Server) getAllRecipes(c *gin.Context) {
+	recipes, err := s.store.GetAllRecipes()
 	if err != nil {
 		log.Printf("Failed to get all recipes: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -38,3 +39,144 @@ func getAllRecipes(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, recipes)
 }
+
+// ------------------------------------------------------------
+// Managing users, roles and content as admin
+// ------------------------------------------------------------
+
+func (s *Server) getRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, data.Roles())
+}
+
+// isLastAdmin prevents locking everybody out of the admin routes
+func (s *Server) isLastAdmin(user data.User) (bool, error) {
+	if user.Role != data.ADMIN {
+		return false, nil
+	}
+	admins, err := s.store.GetUsersWithRole(data.ADMIN)
+	if err != nil {
+		return false, err
+	}
+	return len(admins) <= 1, nil
+}
+
+// adminTargetUser loads the user named in the path, aborting the request if not found
+func (s *Server) adminTargetUser(c *gin.Context) (data.User, bool) {
+	sUserId := c.Param("userId")
+	userId, err := strconv.ParseInt(sUserId, 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse given userId: %s: %s", sUserId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return data.User{}, false
+	}
+	user, err := s.store.GetUser(userId)
+	if err != nil {
+		log.Printf("User %d not found: %s", userId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return data.User{}, false
+	}
+	return user, true
+}
+
+func (s *Server) setUserRole(c *gin.Context) {
+	user, ok := s.adminTargetUser(c)
+	if !ok {
+		return
+	}
+	var role data.Role
+	if err := c.ShouldBindJSON(&role); err != nil || !data.IsValidRole(role.Role) {
+		log.Printf("Invalid role for user %d: %v", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if role.Role != data.ADMIN {
+		lastAdmin, err := s.isLastAdmin(user)
+		if err != nil {
+			log.Printf("Failed to get admins: %s", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if lastAdmin {
+			log.Printf("Cannot remove the role of the last admin %d", user.OnlineID)
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+	}
+	if err := s.store.SetUserRole(user.OnlineID, role.Role); err != nil {
+		log.Printf("Failed to set role of user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d changed the role of %d to %s", c.GetInt64("userId"), user.OnlineID, role.Role)
+	c.JSON(http.StatusOK, data.Role{UserID: user.OnlineID, Role: role.Role})
+}
+
+func (s *Server) deleteUser(c *gin.Context) {
+	user, ok := s.adminTargetUser(c)
+	if !ok {
+		return
+	}
+	lastAdmin, err := s.isLastAdmin(user)
+	if err != nil {
+		log.Printf("Failed to get admins: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if lastAdmin {
+		log.Printf("Cannot delete the last admin %d", user.OnlineID)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	if err := s.store.DeleteUserAccount(user.OnlineID); err != nil {
+		log.Printf("Failed to delete user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d deleted user %d", c.GetInt64("userId"), user.OnlineID)
+	c.Status(http.StatusOK)
+}
+
+// unlockUser ends the lockout after too many failed logins
+func (s *Server) unlockUser(c *gin.Context) {
+	user, ok := s.adminTargetUser(c)
+	if !ok {
+		return
+	}
+	if !s.logins.Unlock(user.OnlineID) {
+		log.Printf("User %d is not locked", user.OnlineID)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	log.Printf("User %d unlocked user %d", c.GetInt64("userId"), user.OnlineID)
+	c.Status(http.StatusOK)
+}
+
+// moderateRecipe removes the recipe of any user, including its images
+func (s *Server) moderateRecipe(c *gin.Context) {
+	sRecipeId := c.Param("recipeId")
+	recipeId, err := strconv.ParseInt(sRecipeId, 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse given recipeId: %s: %s", sRecipeId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	sCreatedBy := c.Query("createdBy")
+	createdBy, err := strconv.ParseInt(sCreatedBy, 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse given createdBy: %s: %s", sCreatedBy, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.GetRecipe(recipeId, createdBy); err != nil {
+		log.Printf("Recipe %d of %d not found: %s", recipeId, createdBy, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err := s.deleteRecipeWithImages(recipeId, createdBy); err != nil {
+		log.Printf("Failed to delete recipe %d of %d: %s", recipeId, createdBy, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d removed recipe %d of %d", c.GetInt64("userId"), recipeId, createdBy)
+	c.Status(http.StatusOK)
+}
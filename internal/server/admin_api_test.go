@@ -0,0 +1,211 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the admin routes
+// ------------------------------------------------------------
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	token := loginOnDevice(t, "Phone")
+
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/admin/users", "").Code)
+	assert.Equal(t, http.StatusForbidden, sendSessionRequest("GET", "/v1/admin/users", token).Code)
+
+	// The stored role applies to tokens issued before the change
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.ADMIN))
+	w := sendSessionRequest("GET", "/v1/admin/users", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var users []data.User
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &users))
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, http.StatusOK, sendSessionRequest("GET", "/v1/admin/lists", token).Code)
+
+	// New tokens name the role
+	claims := authentication.Claims{}
+	_, _, err := jwt.NewParser().ParseUnverified(loginOnDevice(t, "Laptop"), &claims)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ADMIN, claims.Role)
+
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.USER))
+	assert.Equal(t, http.StatusForbidden, sendSessionRequest("GET", "/v1/admin/users", token).Code)
+	DeleteTestUser(t)
+}
+
+func TestFormerAdminLoginRejected(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	reader, err := loadUserAndSetupFields(0, "admin", "12345")
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	DeleteTestUser(t)
+}
+
+func TestPermissionsOfRoles(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	token := loginOnDevice(t, "Phone")
+	other, err := store.CreateUserAccountInDatabase("other admin user", "password")
+	assert.Nil(t, err)
+	otherPath := fmt.Sprintf("/v1/admin/users/%d", other.OnlineID)
+
+	// Moderators read everything and moderate recipes but cannot manage users
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.MODERATOR))
+	for _, path := range []string{"/v1/admin/users", "/v1/admin/lists", "/v1/admin/recipes"} {
+		assert.Equal(t, http.StatusOK, sendSessionRequest("GET", path, token).Code, path)
+	}
+	assert.Equal(t, http.StatusForbidden, sendSessionRequest("GET", "/metrics", token).Code)
+	assert.Equal(t, http.StatusForbidden, sendSessionRequest("DELETE", otherPath, token).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "PUT", otherPath+"/role", token, data.Role{Role: data.ADMIN}).Code)
+	assert.Equal(t, http.StatusNotFound, sendSessionRequest("DELETE", "/v1/admin/recipes/1?createdBy=1", token).Code)
+	assert.Equal(t, http.StatusBadRequest, sendSessionRequest("DELETE", "/v1/admin/recipes/1", token).Code)
+
+	// Monitoring accounts only read the metrics
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.MONITORING))
+	assert.Equal(t, http.StatusOK, sendSessionRequest("GET", "/metrics", token).Code)
+	assert.Equal(t, http.StatusForbidden, sendSessionRequest("GET", "/v1/admin/users", token).Code)
+
+	// Admins assign the roles
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.ADMIN))
+	w := sendSessionRequest("GET", "/v1/admin/roles", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles []data.RoleInfo
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &roles))
+	assert.Equal(t, 4, len(roles))
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "PUT", otherPath+"/role", token, data.Role{Role: "SU"}).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "PUT", "/v1/admin/users/1/role", token, data.Role{Role: data.MODERATOR}).Code)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "PUT", otherPath+"/role", token, data.Role{Role: data.MODERATOR}).Code)
+	stored, err := store.GetUser(other.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.MODERATOR, stored.Role)
+
+	// The last admin can neither be demoted nor deleted
+	ownPath := fmt.Sprintf("/v1/admin/users/%d", testUser.OnlineID)
+	assert.Equal(t, http.StatusConflict, sendJSONRequest(t, "PUT", ownPath+"/role", token, data.Role{Role: data.USER}).Code)
+	assert.Equal(t, http.StatusConflict, sendSessionRequest("DELETE", ownPath, token).Code)
+	assert.Equal(t, http.StatusOK, sendSessionRequest("DELETE", otherPath, token).Code)
+	_, err = store.GetUser(other.OnlineID)
+	assert.NotNil(t, err)
+	DeleteTestUser(t)
+}
+
+func signApiKey(t *testing.T, apiKey authentication.ApiKey) string {
+	keys, err := authentication.LoadKeySet(cfg.JWT.SigningKeys)
+	assert.Nil(t, err)
+	signed, err := keys.Sign(apiKey)
+	assert.Nil(t, err)
+	return signed
+}
+
+func TestMetricsWithApiKey(t *testing.T) {
+	connectDatabase()
+	config := cfg
+	config.API.Key = "metrics key"
+	sendWithApiKey := func(path string, apiKey string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Add("x-api-key", apiKey)
+		server.SetupRouter(store, config).ServeHTTP(w, req)
+		return w.Code
+	}
+	validUntil := time.Now().Add(time.Hour)
+
+	metricsKey := signApiKey(t, authentication.ApiKey{Key: "metrics key", ValidUntil: validUntil, Permissions: []string{data.PermissionMetricsRead}})
+	assert.Equal(t, http.StatusOK, sendWithApiKey("/metrics", metricsKey))
+	assert.Equal(t, http.StatusForbidden, sendWithApiKey("/v1/admin/users", metricsKey))
+
+	// Keys of the former all-powerful kind only read the metrics
+	legacyKey := signApiKey(t, authentication.ApiKey{Key: "metrics key", ValidUntil: validUntil, Admin: true})
+	assert.Equal(t, http.StatusOK, sendWithApiKey("/metrics", legacyKey))
+	assert.Equal(t, http.StatusForbidden, sendWithApiKey("/v1/admin/lists", legacyKey))
+
+	wrongKey := signApiKey(t, authentication.ApiKey{Key: "other key", ValidUntil: validUntil, Permissions: []string{data.PermissionMetricsRead}})
+	assert.Equal(t, http.StatusUnauthorized, sendWithApiKey("/metrics", wrongKey))
+	expiredKey := signApiKey(t, authentication.ApiKey{Key: "metrics key", ValidUntil: validUntil.Add(-2 * time.Hour), Permissions: []string{data.PermissionMetricsRead}})
+	assert.Equal(t, http.StatusUnauthorized, sendWithApiKey("/metrics", expiredKey))
+	assert.Equal(t, http.StatusUnauthorized, sendWithApiKey("/metrics", ""))
+}
+
+func TestLoginLockoutAndUnlock(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	token := loginOnDevice(t, "Phone")
+	assert.Nil(t, store.SetUserRole(testUser.OnlineID, data.ADMIN))
+	locked, err := store.CreateUserAccountInDatabase("locked user", "password")
+	assert.Nil(t, err)
+
+	// The failures are only known to the router counting them
+	config := cfg
+	config.JWT.MaxLoginAttempts = 3
+	router := server.SetupRouter(store, config)
+	login := func(password string, remoteAddr string) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(data.User{OnlineID: locked.OnlineID, Username: locked.Username, Password: password})
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", loginPath(locked.OnlineID), bytes.NewReader(raw))
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("wrong", "10.0.0.2:40000").Code)
+	}
+	// Even the correct password from another address is rejected during the lockout
+	w := login("password", "10.0.0.3:40000")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1800", w.Header().Get("Retry-After"))
+
+	unlock := func(userId int64) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/v1/admin/users/%d/lockout", userId), nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, unlock(testUser.OnlineID))
+	assert.Equal(t, http.StatusOK, unlock(locked.OnlineID))
+	assert.Equal(t, http.StatusOK, login("password", "10.0.0.3:40000").Code)
+
+	assert.Nil(t, store.DeleteUserAccount(locked.OnlineID))
+	DeleteTestUser(t)
+}
+
+func TestLoginThrottleIgnoresForwardedAddresses(t *testing.T) {
+	connectDatabase()
+	router := server.SetupRouter(store, cfg)
+	login := func(forwardedFor string) int {
+		raw, err := json.Marshal(data.User{OnlineID: 4242, Username: "unknown", Password: "wrong"})
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", loginPath(4242), bytes.NewReader(raw))
+		req.RemoteAddr = "10.0.0.4:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Without trusted proxies a new forwarded address per attempt does not reset the failures
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login(fmt.Sprintf("192.0.2.%d", i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login("192.0.2.100"))
+}
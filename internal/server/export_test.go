@@ -0,0 +1,11 @@
+package server
+
+import "time"
+
+// SetEventKeepAliveInterval shortens the keep-alive interval of the list events
+// and returns a function restoring the previous one
+func SetEventKeepAliveInterval(interval time.Duration) func() {
+	previous := eventKeepAliveInterval
+	eventKeepAliveInterval = interval
+	return func() { eventKeepAliveInterval = previous }
+}
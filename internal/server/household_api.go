@@ -0,0 +1,389 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Households sharing lists and recipes with all members
+// ------------------------------------------------------------
+
+// householdForOperation parses the householdId parameter and checks that the
+// user is a member of the household with at least the required role
+func (s *Server) householdForOperation(c *gin.Context, required string) (int64, int64, string, bool) {
+	strHouseholdId := c.Param("householdId")
+	householdId, err := strconv.Atoi(strHouseholdId)
+	if err != nil {
+		log.Printf("Failed to parse given householdId: %s: %s", strHouseholdId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, 0, "", false
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return 0, 0, "", false
+	}
+	role, err := s.store.GetHouseholdRole(int64(householdId), userId)
+	if err != nil {
+		log.Printf("User %d is no member of household %d", userId, householdId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return 0, 0, "", false
+	}
+	if !data.HouseholdRoleAllows(role, required) {
+		log.Printf("User %d with role %s in household %d requires %s", userId, role, householdId, required)
+		c.AbortWithStatus(http.StatusForbidden)
+		return 0, 0, "", false
+	}
+	return int64(householdId), userId, role, true
+}
+
+// isListSharedThroughHousehold tells whether one of the households of the user has access to the list
+func (s *Server) isListSharedThroughHousehold(listId int64, createdBy int64, userId int64) (bool, error) {
+	households, err := s.store.GetHouseholdsForUser(userId)
+	if err != nil {
+		return false, err
+	}
+	for _, household := range households {
+		lists, err := s.store.GetListsSharedWithHousehold(household.HouseholdId)
+		if err != nil {
+			return false, err
+		}
+		for _, list := range lists {
+			if list.ListID == listId && list.CreatedBy == createdBy {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// publishHouseholdListsChange informs users that joined or left a household about the
+// lists shared with it. Users keeping access through another sharing get a share event.
+func (s *Server) publishHouseholdListsChange(lists []data.ListPK, userIds []int64) {
+	for _, list := range lists {
+		for _, userId := range userIds {
+			if list.CreatedBy == userId {
+				continue
+			}
+			eventType := data.ListEventShared
+			if err := s.store.IsListSharedWithUser(list.ListID, list.CreatedBy, userId); err != nil {
+				eventType = data.ListEventUnshared
+			}
+			s.publishListEvent(eventType, list.ListID, list.CreatedBy, []int64{userId})
+		}
+	}
+}
+
+func (s *Server) createHousehold(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var household data.Household
+	if err := c.BindJSON(&household); err != nil {
+		log.Printf("Failed to convert given data to household: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	created, err := s.store.CreateHousehold(household.Name, userId)
+	if err != nil {
+		log.Printf("Failed to create household: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) getHouseholds(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	households, err := s.store.GetHouseholdsForUser(userId)
+	if err != nil {
+		log.Printf("Failed to get households of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, households)
+}
+
+func (s *Server) getHousehold(c *gin.Context) {
+	householdId, _, _, ok := s.householdForOperation(c, data.HouseholdRoleMember)
+	if !ok {
+		return
+	}
+	household, err := s.store.GetHousehold(householdId)
+	if err != nil {
+		log.Printf("Failed to get household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, household)
+}
+
+func (s *Server) renameHousehold(c *gin.Context) {
+	householdId, _, _, ok := s.householdForOperation(c, data.HouseholdRoleAdmin)
+	if !ok {
+		return
+	}
+	var household data.Household
+	if err := c.BindJSON(&household); err != nil {
+		log.Printf("Failed to convert given data to household: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err := s.store.RenameHousehold(householdId, household.Name); err != nil {
+		log.Printf("Failed to rename household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) deleteHousehold(c *gin.Context) {
+	householdId, _, _, ok := s.householdForOperation(c, data.HouseholdRoleOwner)
+	if !ok {
+		return
+	}
+	household, err := s.store.GetHousehold(householdId)
+	if err != nil {
+		log.Printf("Failed to get household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	lists, err := s.store.GetListsSharedWithHousehold(householdId)
+	if err != nil {
+		log.Printf("Failed to get lists of household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.DeleteHousehold(householdId); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	members := make([]int64, 0, len(household.Members))
+	for _, member := range household.Members {
+		members = append(members, member.UserId)
+	}
+	s.publishHouseholdListsChange(lists, members)
+	c.Status(http.StatusOK)
+}
+
+// ------------------------------------------------------------
+// Members and invitations
+// ------------------------------------------------------------
+
+func (s *Server) inviteIntoHousehold(c *gin.Context) {
+	householdId, userId, _, ok := s.householdForOperation(c, data.HouseholdRoleAdmin)
+	if !ok {
+		return
+	}
+	var invitation data.HouseholdInvitation
+	if err := c.BindJSON(&invitation); err != nil {
+		log.Printf("Failed to convert given data to invitation: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if s.isBlockedBy(invitation.UserId, userId) {
+		log.Printf("User %d blocked invitations from %d", invitation.UserId, userId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	created, err := s.store.CreateHouseholdInvitation(householdId, invitation.UserId, userId)
+	if err != nil {
+		log.Printf("Failed to invite user %d into household %d: %s", invitation.UserId, householdId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) getHouseholdInvitations(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	invitations, err := s.store.GetHouseholdInvitationsForUser(userId)
+	if err != nil {
+		log.Printf("Failed to get household invitations of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// joinHousehold accepts the invitation of the user into the household
+func (s *Server) joinHousehold(c *gin.Context) {
+	strHouseholdId := c.Param("householdId")
+	householdId, err := strconv.Atoi(strHouseholdId)
+	if err != nil {
+		log.Printf("Failed to parse given householdId: %s: %s", strHouseholdId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if err := s.store.AcceptHouseholdInvitation(int64(householdId), userId); err != nil {
+		log.Printf("User %d cannot join household %d: %s", userId, householdId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	household, err := s.store.GetHousehold(int64(householdId))
+	if err != nil {
+		log.Printf("Failed to get household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if lists, err := s.store.GetListsSharedWithHousehold(household.HouseholdId); err == nil {
+		s.publishHouseholdListsChange(lists, []int64{userId})
+	}
+	c.JSON(http.StatusOK, household)
+}
+
+// deleteHouseholdInvitation lets the invited user decline and admins revoke the invitation
+func (s *Server) deleteHouseholdInvitation(c *gin.Context) {
+	strHouseholdId := c.Param("householdId")
+	householdId, err := strconv.Atoi(strHouseholdId)
+	if err != nil {
+		log.Printf("Failed to parse given householdId: %s: %s", strHouseholdId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	strInvitedId := c.Param("userId")
+	invitedId, err := strconv.Atoi(strInvitedId)
+	if err != nil {
+		log.Printf("Failed to parse given userId: %s: %s", strInvitedId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if int64(invitedId) != userId {
+		role, err := s.store.GetHouseholdRole(int64(householdId), userId)
+		if err != nil || !data.HouseholdRoleAllows(role, data.HouseholdRoleAdmin) {
+			log.Printf("User %d is not allowed to revoke invitations of household %d", userId, householdId)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+	if err := s.store.DeleteHouseholdInvitation(int64(householdId), int64(invitedId)); err != nil {
+		log.Printf("Failed to delete invitation of %d into household %d: %s", invitedId, householdId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func memberIdFromParam(c *gin.Context) (int64, bool) {
+	strMemberId := c.Param("userId")
+	memberId, err := strconv.Atoi(strMemberId)
+	if err != nil {
+		log.Printf("Failed to parse given userId: %s: %s", strMemberId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	return int64(memberId), true
+}
+
+// updateHouseholdMember changes the role of a member, only the owner can do this
+func (s *Server) updateHouseholdMember(c *gin.Context) {
+	householdId, _, _, ok := s.householdForOperation(c, data.HouseholdRoleOwner)
+	if !ok {
+		return
+	}
+	memberId, ok := memberIdFromParam(c)
+	if !ok {
+		return
+	}
+	var member data.HouseholdMember
+	if err := c.BindJSON(&member); err != nil {
+		log.Printf("Failed to convert given data to household member: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if !data.IsGrantableHouseholdRole(member.Role) {
+		log.Printf("Invalid household role '%s'", member.Role)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	memberRole, err := s.store.GetHouseholdRole(householdId, memberId)
+	if err != nil {
+		log.Printf("User %d is no member of household %d", memberId, householdId)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	// The owner cannot give up the role, the household has to be deleted instead
+	if memberRole == data.HouseholdRoleOwner {
+		log.Printf("The owner of household %d cannot change the own role", householdId)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err := s.store.SetHouseholdRole(householdId, memberId, member.Role); err != nil {
+		log.Printf("Failed to set role of %d in household %d: %s", memberId, householdId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// removeHouseholdMember lets members leave and admins remove members with a lower role
+func (s *Server) removeHouseholdMember(c *gin.Context) {
+	householdId, userId, role, ok := s.householdForOperation(c, data.HouseholdRoleMember)
+	if !ok {
+		return
+	}
+	memberId, ok := memberIdFromParam(c)
+	if !ok {
+		return
+	}
+	memberRole, err := s.store.GetHouseholdRole(householdId, memberId)
+	if err != nil {
+		log.Printf("User %d is no member of household %d", memberId, householdId)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if memberRole == data.HouseholdRoleOwner {
+		log.Printf("The owner cannot leave household %d, it has to be deleted", householdId)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if memberId != userId && (!data.HouseholdRoleAllows(role, data.HouseholdRoleAdmin) || data.HouseholdRoleAllows(memberRole, role)) {
+		log.Printf("User %d with role %s cannot remove %d with role %s from household %d", userId, role, memberId, memberRole, householdId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	lists, err := s.store.GetListsSharedWithHousehold(householdId)
+	if err != nil {
+		log.Printf("Failed to get lists of household %d: %s", householdId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.RemoveHouseholdMember(householdId, memberId); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	s.publishHouseholdListsChange(lists, []int64{memberId})
+	c.Status(http.StatusOK)
+}
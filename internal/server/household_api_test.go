@@ -0,0 +1,137 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Testing households sharing lists and recipes
+// ------------------------------------------------------------
+
+func TestCreateHousehold(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+
+	w := sendJSONRequest(t, "POST", "/v1/households", testToken, data.Household{Name: "Family"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var household data.Household
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &household))
+	assert.Equal(t, "Family", household.Name)
+	assert.Equal(t, testUser.OnlineID, household.CreatedBy)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/households", testToken, data.Household{}).Code)
+
+	householdPath := fmt.Sprintf("/v1/households/%d", household.HouseholdId)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "PUT", householdPath, testToken, data.Household{Name: "Home"}).Code)
+	w = sendJSONRequest(t, "GET", "/v1/households", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var households []data.Household
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &households))
+	if assert.Equal(t, 1, len(households)) {
+		assert.Equal(t, "Home", households[0].Name)
+	}
+
+	// The owner cannot leave, only delete the household
+	memberPath := fmt.Sprintf("%s/members/%d", householdPath, testUser.OnlineID)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "DELETE", memberPath, testToken, nil).Code)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", householdPath, testToken, nil).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "GET", householdPath, testToken, nil).Code)
+}
+
+func TestHouseholdSharing(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("household owner", "password")
+	assert.Nil(t, err)
+	thirdUser, err := store.CreateUserAccountInDatabase("third", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+
+	household, err := store.CreateHousehold("Family", owner.OnlineID)
+	assert.Nil(t, err)
+	list, err := createListOffline("household list", owner.OnlineID, createItemsWire("Item", 1))
+	assert.Nil(t, err)
+	assert.Nil(t, store.ShareListWithHousehold(list.ListId, owner.OnlineID, household.HouseholdId, data.PermissionEditor))
+	householdPath := fmt.Sprintf("/v1/households/%d", household.HouseholdId)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "GET", householdPath, testToken, nil).Code)
+	assert.Equal(t, 0, len(getAllLists(t)))
+
+	// Joining requires an invitation
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "POST", householdPath+"/join", testToken, nil).Code)
+	_, err = store.CreateHouseholdInvitation(household.HouseholdId, testUser.OnlineID, owner.OnlineID)
+	assert.Nil(t, err)
+	w := sendJSONRequest(t, "GET", "/v1/households/invitations", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var invitations []data.HouseholdInvitation
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &invitations))
+	assert.Equal(t, 1, len(invitations))
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "POST", householdPath+"/join", testToken, nil).Code)
+
+	// Lists shared with the household are visible to new members
+	lists := getAllLists(t)
+	if assert.Equal(t, 1, len(lists)) {
+		assert.Equal(t, list.ListId, lists[0].ListId)
+	}
+	list.Title = "updated by member"
+	list.Version++
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "PUT", fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, owner.OnlineID), testToken, list).Code)
+	// Leaving the list is refused without touching a direct share while the household has access
+	_, err = store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, testUser.OnlineID, data.PermissionViewer)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusConflict, sendJSONRequest(t, "DELETE", fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, owner.OnlineID), testToken, nil).Code)
+	shares, err := store.GetSharesOfList(list.ListId, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(shares))
+	assert.Nil(t, store.DeleteSharingForUser(list.ListId, owner.OnlineID, testUser.OnlineID))
+
+	// Members share their own lists and recipes with the household
+	ownList, err := createListOffline("own list", testUser.OnlineID, nil)
+	assert.Nil(t, err)
+	share := data.ListSharedWire{Households: []int64{household.HouseholdId}, Permission: data.PermissionViewer}
+	assert.Equal(t, http.StatusCreated, sendJSONRequest(t, "POST", fmt.Sprintf("/v1/share/%d", ownList.ListId), testToken, share).Code)
+	permission, err := store.GetSharePermission(ownList.ListId, testUser.OnlineID, owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+	share.Households = []int64{household.HouseholdId + 1}
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "POST", fmt.Sprintf("/v1/share/%d", ownList.ListId), testToken, share).Code)
+	recipe := data.Recipe{
+		RecipeId:   1,
+		Name:       "household recipe",
+		CreatedBy:  data.ListCreator{ID: testUser.OnlineID},
+		CreatedAt:  time.Now().UTC(),
+		LastUpdate: time.Now().UTC(),
+		Version:    1,
+	}
+	assert.Nil(t, store.CreateRecipe(recipe, nil))
+	recipeSharePath := fmt.Sprintf("/v1/recipe/share/%d?household=%d", recipe.RecipeId, household.HouseholdId)
+	assert.Equal(t, http.StatusCreated, sendJSONRequest(t, "POST", recipeSharePath, testToken, nil).Code)
+	assert.Nil(t, store.IsRecipeSharedWithUser(owner.OnlineID, recipe.RecipeId, testUser.OnlineID))
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", recipeSharePath, testToken, nil).Code)
+	assert.NotNil(t, store.IsRecipeSharedWithUser(owner.OnlineID, recipe.RecipeId, testUser.OnlineID))
+
+	// Only admins invite, only the owner changes roles
+	invitation := data.HouseholdInvitation{UserId: thirdUser.OnlineID}
+	memberPath := fmt.Sprintf("%s/members/%d", householdPath, testUser.OnlineID)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "POST", householdPath+"/invitations", testToken, invitation).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "PUT", memberPath, testToken, data.HouseholdMember{Role: data.HouseholdRoleAdmin}).Code)
+	assert.Nil(t, store.SetHouseholdRole(household.HouseholdId, testUser.OnlineID, data.HouseholdRoleAdmin))
+	assert.Equal(t, http.StatusCreated, sendJSONRequest(t, "POST", householdPath+"/invitations", testToken, invitation).Code)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", fmt.Sprintf("%s/invitations/%d", householdPath, thirdUser.OnlineID), testToken, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "DELETE", fmt.Sprintf("%s/members/%d", householdPath, owner.OnlineID), testToken, nil).Code)
+
+	// Leaving the household removes the access again
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", memberPath, testToken, nil).Code)
+	lists = getAllLists(t)
+	if assert.Equal(t, 1, len(lists)) {
+		assert.Equal(t, ownList.ListId, lists[0].ListId)
+	}
+	assert.NotNil(t, store.IsListSharedWithUser(list.ListId, owner.OnlineID, testUser.OnlineID))
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+// ------------------------------------------------------------
+// Invite links sharing lists, recipes and households by token
+// ------------------------------------------------------------
+
+const (
+	defaultInviteValidity = 7 * 24 * time.Hour
+	maxInviteValidity     = 30 * 24 * time.Hour
+)
+
+func newInviteId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// checkInviteResource verifies that the user may share the resource of the invite
+// and fills in the creator of the resource
+func (s *Server) checkInviteResource(c *gin.Context, invite *data.Invite, userId int64) bool {
+	switch invite.Type {
+	case data.InviteTypeList:
+		if invite.CreatedBy == 0 {
+			invite.CreatedBy = userId
+		}
+		if _, err := s.store.GetRawShoppingListWithId(invite.ResourceId, invite.CreatedBy); err != nil {
+			log.Printf("List %d from %d to invite to not found: %s", invite.ResourceId, invite.CreatedBy, err)
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+		permission, err := s.listPermission(invite.ResourceId, invite.CreatedBy, userId)
+		if err != nil || !data.PermissionAllows(permission, data.PermissionCoOwner) {
+			log.Printf("User %d is not allowed to invite to list %d from %d", userId, invite.ResourceId, invite.CreatedBy)
+			c.AbortWithStatus(http.StatusForbidden)
+			return false
+		}
+		if invite.Permission == "" {
+			invite.Permission = data.PermissionEditor
+		}
+		if !data.IsGrantablePermission(invite.Permission) {
+			log.Printf("Invalid invite permission '%s'", invite.Permission)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return false
+		}
+	case data.InviteTypeRecipe:
+		if _, err := s.store.GetRecipe(invite.ResourceId, userId); err != nil {
+			log.Printf("Recipe %d from %d to invite to not found: %s", invite.ResourceId, userId, err)
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+		invite.CreatedBy = userId
+		invite.Permission = ""
+	case data.InviteTypeHousehold:
+		role, err := s.store.GetHouseholdRole(invite.ResourceId, userId)
+		if err != nil || !data.HouseholdRoleAllows(role, data.HouseholdRoleAdmin) {
+			log.Printf("User %d is not allowed to invite to household %d", userId, invite.ResourceId)
+			c.AbortWithStatus(http.StatusForbidden)
+			return false
+		}
+		household, err := s.store.GetHousehold(invite.ResourceId)
+		if err != nil {
+			log.Printf("Failed to get household %d: %s", invite.ResourceId, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return false
+		}
+		invite.CreatedBy = household.CreatedBy
+		invite.Permission = ""
+	default:
+		log.Printf("Invalid invite type '%s'", invite.Type)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) createInvite(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var invite data.Invite
+	if err := c.BindJSON(&invite); err != nil {
+		log.Printf("Failed to convert given data to invite: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if invite.MaxUses < 0 {
+		log.Printf("Invalid maximum uses %d of invite", invite.MaxUses)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if !s.checkInviteResource(c, &invite, userId) {
+		return
+	}
+	now := time.Now().UTC()
+	if invite.ValidUntil.IsZero() {
+		invite.ValidUntil = now.Add(defaultInviteValidity)
+	}
+	if !invite.ValidUntil.After(now) || invite.ValidUntil.After(now.Add(maxInviteValidity)) {
+		log.Printf("Invite validity %s is not within %s", invite.ValidUntil, maxInviteValidity)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	inviteId, err := newInviteId()
+	if err != nil {
+		log.Printf("Failed to create invite id: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	invite.InviteId = inviteId
+	invite.InvitedBy = userId
+	invite.Uses = 0
+	invite.ValidUntil = invite.ValidUntil.UTC().Truncate(time.Second)
+	invite.Created = now.Truncate(time.Second)
+	token, err := s.tokens.GenerateInviteToken(invite.InviteId, invite.ValidUntil)
+	if err != nil {
+		log.Printf("Failed to sign invite token: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := s.store.CreateInvite(invite); err != nil {
+		log.Printf("Failed to store invite: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	invite.Token = token
+	c.JSON(http.StatusCreated, invite)
+}
+
+func (s *Server) getPendingInvites(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	invites, err := s.store.GetPendingInvites(userId, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to get invites of %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+func (s *Server) revokeInvite(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	invite, err := s.store.GetInvite(c.Param("inviteId"))
+	if err != nil {
+		log.Printf("Invite to revoke not found: %s", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if invite.InvitedBy != userId {
+		log.Printf("User %d is not allowed to revoke invite from %d", userId, invite.InvitedBy)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if err := s.store.DeleteInvite(invite.InviteId); err != nil {
+		log.Printf("Failed to delete invite %s: %s", invite.InviteId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// redeemInvite grants the redeeming user access to the resource of the invite
+func (s *Server) redeemInvite(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var redemption data.InviteRedemption
+	if err := c.BindJSON(&redemption); err != nil {
+		log.Printf("Failed to convert given data to invite redemption: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	inviteId, err := s.tokens.ParseInviteToken(redemption.Token)
+	if errors.Is(err, authentication.ErrInviteExpired) {
+		log.Printf("Invite token expired")
+		c.AbortWithStatus(http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Invalid invite token: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	invite, err := s.store.GetInvite(inviteId)
+	if err != nil {
+		log.Printf("Invite %s not found: %s", inviteId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if invite.CreatedBy == userId || invite.InvitedBy == userId {
+		log.Printf("User %d cannot redeem the own invite %s", userId, inviteId)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err := s.inviteResourceExists(invite); err != nil {
+		log.Printf("Resource of invite %s no longer exists: %s", inviteId, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	err = s.store.RedeemInvite(invite, userId, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Invite %s is expired or used up", inviteId)
+		c.AbortWithStatus(http.StatusGone)
+		return
+	}
+	if errors.Is(err, database.ErrInviterNotAllowed) {
+		log.Printf("User %d may no longer share the resource of invite %s", invite.InvitedBy, inviteId)
+		c.AbortWithStatus(http.StatusGone)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to redeem invite %s for %d: %s", inviteId, userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	switch invite.Type {
+	case data.InviteTypeList:
+		s.publishListEvent(data.ListEventShared, invite.ResourceId, invite.CreatedBy, s.listRecipients(invite.ResourceId, invite.CreatedBy))
+	case data.InviteTypeHousehold:
+		if lists, err := s.store.GetListsSharedWithHousehold(invite.ResourceId); err == nil {
+			s.publishHouseholdListsChange(lists, []int64{userId})
+		}
+	}
+	invite.Uses++
+	c.JSON(http.StatusOK, invite)
+}
+
+func (s *Server) inviteResourceExists(invite data.Invite) error {
+	var err error
+	switch invite.Type {
+	case data.InviteTypeList:
+		_, err = s.store.GetRawShoppingListWithId(invite.ResourceId, invite.CreatedBy)
+	case data.InviteTypeRecipe:
+		_, err = s.store.GetRecipe(invite.ResourceId, invite.CreatedBy)
+	case data.InviteTypeHousehold:
+		_, err = s.store.GetHousehold(invite.ResourceId)
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Testing invite links
+// ------------------------------------------------------------
+
+// createStoredInvite creates an invite of another user directly in the store
+func createStoredInvite(t *testing.T, invite data.Invite) string {
+	invite.Created = time.Now().UTC()
+	if invite.ValidUntil.IsZero() {
+		invite.ValidUntil = time.Now().UTC().Add(time.Hour)
+	}
+	assert.Nil(t, store.CreateInvite(invite))
+	keys, err := authentication.LoadKeySet(cfg.JWT.SigningKeys)
+	assert.Nil(t, err)
+	token, err := authentication.NewTokenHandler(store, cfg.JWT, keys).GenerateInviteToken(invite.InviteId, invite.ValidUntil)
+	assert.Nil(t, err)
+	return token
+}
+
+func redeemInvite(t *testing.T, token string) int {
+	return sendJSONRequest(t, "POST", "/v1/invites/redeem", testToken, data.InviteRedemption{Token: token}).Code
+}
+
+func TestCreateAndRevokeInvite(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+	list, err := createListOffline("invite list", testUser.OnlineID, nil)
+	assert.Nil(t, err)
+
+	invite := data.Invite{Type: data.InviteTypeList, ResourceId: list.ListId, Permission: data.PermissionChecker, MaxUses: 2}
+	w := sendJSONRequest(t, "POST", "/v1/invites", testToken, invite)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created data.Invite
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEqual(t, "", created.Token)
+	assert.Equal(t, testUser.OnlineID, created.CreatedBy)
+	assert.True(t, created.ValidUntil.After(time.Now().Add(6*24*time.Hour)))
+
+	// Invalid permissions, validity and foreign resources are rejected
+	invite.Permission = data.PermissionOwner
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/invites", testToken, invite).Code)
+	invite.Permission = ""
+	invite.ValidUntil = time.Now().Add(60 * 24 * time.Hour)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/invites", testToken, invite).Code)
+	invite.ValidUntil = time.Time{}
+	invite.ResourceId = list.ListId + 1
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "POST", "/v1/invites", testToken, invite).Code)
+	invite.Type = "unknown"
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/invites", testToken, invite).Code)
+
+	w = sendJSONRequest(t, "GET", "/v1/invites", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var pending []data.Invite
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	if assert.Equal(t, 1, len(pending)) {
+		assert.Equal(t, created.InviteId, pending[0].InviteId)
+		assert.Equal(t, "", pending[0].Token)
+	}
+	// The own invite cannot be redeemed
+	assert.Equal(t, http.StatusBadRequest, redeemInvite(t, created.Token))
+
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", "/v1/invites/"+created.InviteId, testToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "DELETE", "/v1/invites/"+created.InviteId, testToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, redeemInvite(t, created.Token))
+}
+
+func TestRedeemInvites(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("inviting owner", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+
+	list, err := createListOffline("invite list", owner.OnlineID, nil)
+	assert.Nil(t, err)
+	listToken := createStoredInvite(t, data.Invite{
+		InviteId:   "list",
+		Type:       data.InviteTypeList,
+		ResourceId: list.ListId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  owner.OnlineID,
+		Permission: data.PermissionViewer,
+		MaxUses:    1,
+	})
+	assert.Equal(t, http.StatusBadRequest, redeemInvite(t, listToken+"x"))
+	assert.Equal(t, http.StatusOK, redeemInvite(t, listToken))
+	permission, err := store.GetSharePermission(list.ListId, owner.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+	assert.Equal(t, http.StatusGone, redeemInvite(t, listToken))
+
+	// Redeeming does not lower an existing permission
+	_, err = store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, testUser.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+	unlimitedToken := createStoredInvite(t, data.Invite{
+		InviteId:   "unlimited",
+		Type:       data.InviteTypeList,
+		ResourceId: list.ListId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  owner.OnlineID,
+		Permission: data.PermissionViewer,
+	})
+	assert.Equal(t, http.StatusOK, redeemInvite(t, unlimitedToken))
+	assert.Equal(t, http.StatusOK, redeemInvite(t, unlimitedToken))
+	permission, err = store.GetSharePermission(list.ListId, owner.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionEditor, permission)
+
+	expiredToken := createStoredInvite(t, data.Invite{
+		InviteId:   "expired",
+		Type:       data.InviteTypeList,
+		ResourceId: list.ListId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  owner.OnlineID,
+		ValidUntil: time.Now().UTC().Add(-time.Minute),
+	})
+	assert.Equal(t, http.StatusGone, redeemInvite(t, expiredToken))
+
+	recipe := data.Recipe{
+		RecipeId:   1,
+		Name:       "invite recipe",
+		CreatedBy:  data.ListCreator{ID: owner.OnlineID},
+		CreatedAt:  time.Now().UTC(),
+		LastUpdate: time.Now().UTC(),
+		Version:    1,
+	}
+	assert.Nil(t, store.CreateRecipe(recipe, nil))
+	recipeToken := createStoredInvite(t, data.Invite{
+		InviteId:   "recipe",
+		Type:       data.InviteTypeRecipe,
+		ResourceId: recipe.RecipeId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  owner.OnlineID,
+		MaxUses:    2,
+	})
+	assert.Equal(t, http.StatusOK, redeemInvite(t, recipeToken))
+	assert.Equal(t, http.StatusOK, redeemInvite(t, recipeToken))
+	assert.Nil(t, store.IsRecipeSharedWithUser(testUser.OnlineID, recipe.RecipeId, owner.OnlineID))
+
+	household, err := store.CreateHousehold("Family", owner.OnlineID)
+	assert.Nil(t, err)
+	householdToken := createStoredInvite(t, data.Invite{
+		InviteId:   "household",
+		Type:       data.InviteTypeHousehold,
+		ResourceId: household.HouseholdId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  owner.OnlineID,
+	})
+	assert.Equal(t, http.StatusOK, redeemInvite(t, householdToken))
+	role, err := store.GetHouseholdRole(household.HouseholdId, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.HouseholdRoleMember, role)
+
+	// Invites to deleted resources cannot be redeemed
+	assert.Nil(t, store.DeleteHousehold(household.HouseholdId))
+	assert.Equal(t, http.StatusNotFound, redeemInvite(t, householdToken))
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "POST", "/v1/invites", testToken, data.Invite{Type: data.InviteTypeRecipe, ResourceId: recipe.RecipeId}).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "DELETE", fmt.Sprintf("/v1/invites/%s", "recipe"), testToken, nil).Code)
+}
+
+func TestRedeemInviteAfterPermissionLoss(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("inviting owner", "password")
+	assert.Nil(t, err)
+	coOwner, err := store.CreateUserAccountInDatabase("inviting co-owner", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+
+	list, err := createListOffline("invite list", owner.OnlineID, nil)
+	assert.Nil(t, err)
+	_, err = store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, coOwner.OnlineID, data.PermissionCoOwner)
+	assert.Nil(t, err)
+	token := createStoredInvite(t, data.Invite{
+		InviteId:   "co-owner",
+		Type:       data.InviteTypeList,
+		ResourceId: list.ListId,
+		CreatedBy:  owner.OnlineID,
+		InvitedBy:  coOwner.OnlineID,
+		Permission: data.PermissionEditor,
+	})
+
+	// The invite stops working once the co-owner was demoted
+	_, err = store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, coOwner.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusGone, redeemInvite(t, token))
+	_, err = store.GetSharePermission(list.ListId, owner.OnlineID, testUser.OnlineID)
+	assert.NotNil(t, err)
+	invite, err := store.GetInvite("co-owner")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, invite.Uses)
+
+	_, err = store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, coOwner.OnlineID, data.PermissionCoOwner)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, redeemInvite(t, token))
+}
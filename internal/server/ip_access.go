@@ -0,0 +1,44 @@
+package server
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/middleware"
+)
+
+// ------------------------------------------------------------
+// Client addresses allowed to use the route groups
+// ------------------------------------------------------------
+
+// allowIPs returns the middleware checking the address against the current rules of the group
+func (s *Server) allowIPs(group string) gin.HandlerFunc {
+	return middleware.IPAccessMiddleware(s.ipAccess, group)
+}
+
+// reloadIPAccessOnHangup reloads the IP access lists on SIGHUP until stopped
+func (s *Server) reloadIPAccessOnHangup() (stop func()) {
+	hangup := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				if err := s.ipAccess.Reload(); err != nil {
+					log.Printf("Failed to reload the IP access lists, keeping the current ones: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hangup)
+		close(done)
+	}
+}
@@ -0,0 +1,51 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the IP access lists of the route groups
+// ------------------------------------------------------------
+
+func TestIPAccessAdminRoutes(t *testing.T) {
+	connectDatabase()
+	file := filepath.Join(t.TempDir(), "ip_access.json")
+	rules := `{"admin": {"Allow": ["10.0.0.0/8", "fd00::/8"], "Deny": ["10.0.5.0/24"]}}`
+	assert.Nil(t, os.WriteFile(file, []byte(rules), 0600))
+	config := cfg
+	config.IPAccess.File = file
+	config.Server.TrustedProxies = []string{"127.0.0.1"}
+	router := server.SetupRouter(store, config)
+	request := func(path string, remoteAddr string, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Allowed addresses still have to log in
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/admin/users", "10.0.0.1:40000", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/admin/users", "[fd00::1]:40000", ""))
+	assert.Equal(t, http.StatusForbidden, request("/v1/admin/users", "10.0.5.1:40000", ""))
+	assert.Equal(t, http.StatusForbidden, request("/v1/admin/users", "192.168.1.1:40000", ""))
+	// Other groups are not restricted
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/lists", "192.168.1.1:40000", ""))
+
+	// Only trusted proxies name the client
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/admin/users", "127.0.0.1:40000", "10.0.0.1"))
+	assert.Equal(t, http.StatusForbidden, request("/v1/admin/users", "127.0.0.1:40000", "192.168.1.1"))
+	assert.Equal(t, http.StatusForbidden, request("/v1/admin/users", "192.168.1.1:40000", "10.0.0.1"))
+}
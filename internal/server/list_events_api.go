@@ -0,0 +1,111 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Pushing list changes to the clients
+// ------------------------------------------------------------
+
+// Clients keep the events stream open and sync the list mentioned in an event.
+// Proxies tend to close idle connections, therefore a comment is sent regularly.
+var eventKeepAliveInterval = 30 * time.Second
+
+// listRecipients returns the owner and all users the list is shared with
+func (s *Server) listRecipients(listId int64, createdBy int64) []int64 {
+	recipients := []int64{createdBy}
+	sharedWith, err := s.store.GetUsersSharingList(listId, createdBy)
+	if err != nil {
+		log.Printf("Failed to get users sharing list %d from %d: %s", listId, createdBy, err)
+		return recipients
+	}
+	return append(recipients, sharedWith...)
+}
+
+func (s *Server) publishListEvent(eventType string, listId int64, createdBy int64, recipients []int64) {
+	event := data.ListEvent{
+		Type:      eventType,
+		ListId:    listId,
+		CreatedBy: createdBy,
+		Time:      time.Now().UTC(),
+	}
+	if eventType != data.ListEventDeleted {
+		list, err := s.store.GetRawShoppingListWithId(listId, createdBy)
+		if err != nil {
+			log.Printf("Failed to load list %d from %d for event: %s", listId, createdBy, err)
+		} else {
+			event.Version = list.Version
+		}
+	}
+	s.hub.Publish(event, recipients)
+}
+
+// publishListUpdate informs everybody with access to the list about a change
+func (s *Server) publishListUpdate(listId int64, createdBy int64) {
+	s.publishListEvent(data.ListEventUpdated, listId, createdBy, s.listRecipients(listId, createdBy))
+}
+
+func (s *Server) streamListEvents(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	sessionId := c.GetString("sessionId")
+	tokenId := c.GetString("tokenId")
+	events, unsubscribe := s.hub.Subscribe(userId)
+	defer unsubscribe()
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+	// The stream ends with the token, clients reconnect with a refreshed one
+	var expired <-chan time.Time
+	if expires := c.GetTime("tokenExpires"); !expires.IsZero() {
+		expiry := time.NewTimer(time.Until(expires))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	log.Printf("User %d subscribed to list events", userId)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-expired:
+			log.Printf("Token of user %d expired, closing list events", userId)
+			return false
+		case <-keepAlive.C:
+			// Revoked sessions stop receiving events
+			if err := s.tokens.IsTokenValid(userId, sessionId, tokenId); err != nil {
+				log.Printf("Token of user %d is no longer valid, closing list events: %s", userId, err)
+				return false
+			}
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return false
+			}
+			return true
+		}
+	})
+	log.Printf("User %d unsubscribed from list events", userId)
+}
@@ -0,0 +1,172 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/events"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the pushed list events
+// ------------------------------------------------------------
+
+// subscribeToListEvents opens the event stream and forwards the received events
+func subscribeToListEvents(t *testing.T, url string) (<-chan data.ListEvent, func()) {
+	req, _ := http.NewRequest("GET", url+"/v1/lists/events", nil)
+	req.Header.Add("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"))
+
+	received := make(chan data.ListEvent, 10)
+	go func() {
+		defer close(received)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			var event data.ListEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				continue
+			}
+			received <- event
+		}
+	}()
+	return received, func() { resp.Body.Close() }
+}
+
+func nextListEvent(t *testing.T, received <-chan data.ListEvent) data.ListEvent {
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Did not receive list event in time")
+	}
+	return data.ListEvent{}
+}
+
+func TestListEventsForSharedList(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("owner", "password")
+	assert.Nil(t, err)
+	list, err := createListOffline("pushed list", owner.OnlineID, createItemsWire("Item", 1))
+	if err != nil {
+		t.Fatalf("Failed to create list: %s", err)
+	}
+	CreateTestUser(t)
+	login(t)
+	_, err = createListSharing(list.ListId, owner.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+
+	router := server.SetupRouterWithHub(store, events.NewMemoryHub(), cfg)
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+	received, cancel := subscribeToListEvents(t, httpServer.URL)
+	defer cancel()
+
+	sendRequest := func(method string, path string, body any) int {
+		encoded, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewReader(encoded))
+		req.Header.Add("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	code := sendRequest("POST", fmt.Sprintf("/v1/lists/%d/items?createdBy=%d", list.ListId, owner.OnlineID), data.ItemWire{Name: "Milk", Quantity: 1})
+	assert.Equal(t, http.StatusCreated, code)
+	event := nextListEvent(t, received)
+	assert.Equal(t, data.ListEventUpdated, event.Type)
+	assert.Equal(t, list.ListId, event.ListId)
+	assert.Equal(t, owner.OnlineID, event.CreatedBy)
+	assert.Equal(t, list.Version+1, event.Version)
+
+	// Leaving the shared list only removes the sharing
+	code = sendRequest("DELETE", fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, owner.OnlineID), nil)
+	assert.Equal(t, http.StatusOK, code)
+	event = nextListEvent(t, received)
+	assert.Equal(t, data.ListEventUnshared, event.Type)
+	assert.Equal(t, list.ListId, event.ListId)
+
+	DeleteTestUser(t)
+}
+
+func waitForStreamEnd(t *testing.T, received <-chan data.ListEvent, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-received:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("Event stream was not closed in time")
+			return
+		}
+	}
+}
+
+func TestListEventsStopWhenSessionIsRevoked(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+	defer server.SetEventKeepAliveInterval(100 * time.Millisecond)()
+
+	httpServer := httptest.NewServer(server.SetupRouterWithHub(store, events.NewMemoryHub(), cfg))
+	defer httpServer.Close()
+	received, cancel := subscribeToListEvents(t, httpServer.URL)
+	defer cancel()
+
+	sessions, err := store.GetSessionsForUser(testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sessions))
+	_, err = store.DeleteSession(sessions[0].SessionId)
+	assert.Nil(t, err)
+	waitForStreamEnd(t, received, 2*time.Second)
+
+	DeleteTestUser(t)
+}
+
+func TestListEventsStopWhenTokenExpires(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	testConfiguration := cfg
+	// The expiry is stored in seconds, so a shorter timeout may have passed already
+	testConfiguration.JWT.KeyTimeoutMs = 2000
+
+	reader, err := loadUserAndSetupFields(0, "", "")
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
+	server.SetupRouter(store, testConfiguration).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var token authentication.Token
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &token))
+	testToken = token.Token
+
+	httpServer := httptest.NewServer(server.SetupRouterWithHub(store, events.NewMemoryHub(), testConfiguration))
+	defer httpServer.Close()
+	received, cancel := subscribeToListEvents(t, httpServer.URL)
+	defer cancel()
+	waitForStreamEnd(t, received, 4*time.Second)
+
+	DeleteTestUser(t)
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+)
+
+// ------------------------------------------------------------
+// Item level operations on a list
+// ------------------------------------------------------------
+
+// Instead of sending the whole list for every change, these endpoints modify
+// single items and bump the list version so other clients notice the change
+
+// listForItemOperation loads the list from the listId parameter and the createdBy query parameter.
+// Like updateShoppingList, lists of other users are only accessible if they are shared
+// with at least the required permission.
+func (s *Server) listForItemOperation(c *gin.Context, required string) (data.List, int64, bool) {
+	strListId := c.Param("listId")
+	listId, err := strconv.Atoi(strListId)
+	if err != nil {
+		log.Printf("Failed to parse given listId: %s: %s", strListId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return data.List{}, 0, false
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return data.List{}, 0, false
+	}
+	createdBy := userId
+	strCreatedBy := c.Query("createdBy")
+	if strCreatedBy != "" {
+		queryCreatedBy, err := strconv.Atoi(strCreatedBy)
+		if err != nil {
+			log.Printf("given createdBy parameter is not an integer: %s", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return data.List{}, 0, false
+		}
+		createdBy = int64(queryCreatedBy)
+	}
+	if createdBy != userId {
+		permission, err := s.listPermission(int64(listId), createdBy, userId)
+		if err != nil {
+			log.Printf("List %d from %d is not shared with user %d", listId, createdBy, userId)
+			c.AbortWithStatus(http.StatusForbidden)
+			return data.List{}, 0, false
+		}
+		if !data.PermissionAllows(permission, required) {
+			log.Printf("User %d with permission %s of list %d from %d requires %s", userId, permission, listId, createdBy, required)
+			c.AbortWithStatus(http.StatusForbidden)
+			return data.List{}, 0, false
+		}
+	}
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), createdBy)
+	if err != nil {
+		log.Printf("List %d from %d not found: %s", listId, createdBy, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return data.List{}, 0, false
+	}
+	return list, userId, true
+}
+
+func (s *Server) itemInListFromParam(c *gin.Context, list data.List) (data.ListItem, bool) {
+	strItemId := c.Param("itemId")
+	itemId, err := strconv.Atoi(strItemId)
+	if err != nil {
+		log.Printf("Failed to parse given itemId: %s: %s", strItemId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return data.ListItem{}, false
+	}
+	mapping, err := s.store.IsItemInList(list.ListId, list.CreatedBy.ID, int64(itemId))
+	if err != nil {
+		log.Printf("Item %d is not in list %d from %d: %s", itemId, list.ListId, list.CreatedBy.ID, err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return data.ListItem{}, false
+	}
+	return mapping, true
+}
+
+// respondWithItemChange publishes the new version of the list and answers with the changed item
+func (s *Server) respondWithItemChange(c *gin.Context, status int, list data.List, mapping *data.ListItem, version int64) {
+	s.publishListUpdate(list.ListId, list.CreatedBy.ID)
+	change := data.ListItemChange{
+		ListId:    list.ListId,
+		CreatedBy: list.CreatedBy.ID,
+		Version:   version,
+	}
+	if mapping != nil {
+		item, err := s.store.GetItem(mapping.ItemId)
+		if err != nil {
+			log.Printf("Failed to load item %d: %s", mapping.ItemId, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		change.Item = &data.ItemWire{
+			ItemId:   item.ItemId,
+			Name:     item.Name,
+			Icon:     item.Icon,
+			Quantity: mapping.Quantity,
+			Checked:  mapping.Checked,
+			AddedBy:  mapping.AddedBy,
+			Updated:  &data.ItemUpdated{Quantity: mapping.QuantityUpdated, Checked: mapping.CheckedUpdated},
+		}
+	}
+	c.JSON(status, change)
+}
+
+func (s *Server) addItemToList(c *gin.Context) {
+	list, userId, ok := s.listForItemOperation(c, data.PermissionEditor)
+	if !ok {
+		return
+	}
+	var itemToAdd data.ItemWire
+	if err := c.BindJSON(&itemToAdd); err != nil {
+		log.Printf("Failed to convert given data to item: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	conv, err := database.CheckItemCorrect(itemToAdd)
+	if err != nil {
+		log.Printf("Item '%s' not in correct format: %s", itemToAdd.Name, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	item, err := s.store.InsertItemStruct(conv)
+	if err != nil {
+		log.Printf("Failed to insert item '%s': %s", conv.Name, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if _, err := s.store.IsItemInList(list.ListId, list.CreatedBy.ID, item.ItemId); err == nil {
+		log.Printf("Item '%s' is already in list %d, use PATCH to modify it", item.Name, list.ListId)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	itemsInList, err := s.store.GetItemsInList(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		log.Printf("Failed to get items in list %d: %s", list.ListId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	mapping := data.ListItem{
+		ListId:    list.ListId,
+		CreatedBy: list.CreatedBy.ID,
+		ItemId:    item.ItemId,
+		Quantity:  itemToAdd.Quantity,
+		Checked:   itemToAdd.Checked,
+		AddedBy:   userId,
+		Position:  int64(len(itemsInList)),
+	}
+	mapping, version, err := s.store.ChangeItemInList(mapping)
+	if err != nil {
+		log.Printf("Failed to add item '%s' to list %d: %s", item.Name, list.ListId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	s.respondWithItemChange(c, http.StatusCreated, list, &mapping, version)
+}
+
+func (s *Server) updateItemInList(c *gin.Context) {
+	list, userId, ok := s.listForItemOperation(c, data.PermissionChecker)
+	if !ok {
+		return
+	}
+	mapping, ok := s.itemInListFromParam(c, list)
+	if !ok {
+		return
+	}
+	var patch data.ListItemPatch
+	if err := c.BindJSON(&patch); err != nil {
+		log.Printf("Failed to convert given data to item patch: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	// The edit times allow merging concurrent full list updates
+	now := time.Now().UTC()
+	if patch.Quantity != nil {
+		if permission, err := s.listPermission(list.ListId, list.CreatedBy.ID, userId); err != nil || !data.PermissionAllows(permission, data.PermissionEditor) {
+			log.Printf("User %d may only check items of list %d from %d", userId, list.ListId, list.CreatedBy.ID)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if *patch.Quantity <= 0 {
+			log.Printf("Invalid quantity %d for item %d", *patch.Quantity, mapping.ItemId)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		mapping.Quantity = *patch.Quantity
+		mapping.QuantityUpdated = now
+	}
+	if patch.Checked != nil {
+		mapping.Checked = *patch.Checked
+		mapping.CheckedUpdated = now
+	}
+	mapping, version, err := s.store.ChangeItemInList(mapping)
+	if err != nil {
+		log.Printf("Failed to update item %d in list %d: %s", mapping.ItemId, list.ListId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	s.respondWithItemChange(c, http.StatusOK, list, &mapping, version)
+}
+
+func (s *Server) removeItemFromList(c *gin.Context) {
+	list, _, ok := s.listForItemOperation(c, data.PermissionEditor)
+	if !ok {
+		return
+	}
+	mapping, ok := s.itemInListFromParam(c, list)
+	if !ok {
+		return
+	}
+	version, err := s.store.RemoveItemFromList(list.ListId, list.CreatedBy.ID, mapping.ItemId)
+	if err != nil {
+		log.Printf("Failed to remove item %d from list %d: %s", mapping.ItemId, list.ListId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	s.respondWithItemChange(c, http.StatusOK, list, nil, version)
+}
+
+func (s *Server) reorderItemsInList(c *gin.Context) {
+	list, _, ok := s.listForItemOperation(c, data.PermissionEditor)
+	if !ok {
+		return
+	}
+	var order data.ListItemOrder
+	if err := c.BindJSON(&order); err != nil {
+		log.Printf("Failed to convert given data to item order: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	version, err := s.store.ReorderItemsInList(list.ListId, list.CreatedBy.ID, order.ItemIds)
+	if err != nil {
+		log.Printf("Failed to reorder items in list %d: %s", list.ListId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	s.respondWithItemChange(c, http.StatusOK, list, nil, version)
+}
@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the item level list operations
+// ------------------------------------------------------------
+
+func itemRequest(t *testing.T, method string, path string, body any) (*httptest.ResponseRecorder, data.ListItemChange) {
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to encode body: %s", err)
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Add("Authorization", "Bearer "+testToken)
+	router.ServeHTTP(w, req)
+	var change data.ListItemChange
+	if w.Code == http.StatusOK || w.Code == http.StatusCreated {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &change))
+	}
+	return w, change
+}
+
+func TestItemLevelListOperations(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+
+	list, err := createListOffline("item list", testUser.OnlineID, createItemsWire("Item", 2))
+	if err != nil {
+		t.Fatalf("Failed to create list: %s", err)
+	}
+	itemsPath := fmt.Sprintf("/v1/lists/%d/items", list.ListId)
+
+	w, change := itemRequest(t, "POST", itemsPath, data.ItemWire{Name: " Eggs ", Icon: "ic_egg", Quantity: 6})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, list.Version+1, change.Version)
+	assert.Equal(t, "Eggs", change.Item.Name)
+	assert.Equal(t, testUser.OnlineID, change.Item.AddedBy)
+	eggsId := change.Item.ItemId
+
+	w, _ = itemRequest(t, "POST", itemsPath, data.ItemWire{Name: "Eggs", Quantity: 1})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w, _ = itemRequest(t, "POST", itemsPath, data.ItemWire{Name: "Nothing", Quantity: 0})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	checked := true
+	quantity := int64(12)
+	w, change = itemRequest(t, "PATCH", fmt.Sprintf("%s/%d", itemsPath, eggsId), data.ListItemPatch{Checked: &checked, Quantity: &quantity})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, list.Version+2, change.Version)
+	assert.True(t, change.Item.Checked)
+	assert.Equal(t, quantity, change.Item.Quantity)
+	w, _ = itemRequest(t, "PATCH", fmt.Sprintf("%s/%d", itemsPath, 424242), data.ListItemPatch{Checked: &checked})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	items, err := store.GetItemsInList(list.ListId, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, "Eggs", items[2].Name)
+	order := data.ListItemOrder{ItemIds: []int64{items[2].ItemId, items[1].ItemId, items[0].ItemId}}
+	w, change = itemRequest(t, "PUT", itemsPath+"/order", order)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, list.Version+3, change.Version)
+	reordered, err := store.GetItemsInList(list.ListId, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{items[2].Name, items[1].Name, items[0].Name}, []string{reordered[0].Name, reordered[1].Name, reordered[2].Name})
+	w, _ = itemRequest(t, "PUT", itemsPath+"/order", data.ListItemOrder{ItemIds: order.ItemIds[:2]})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, change = itemRequest(t, "DELETE", fmt.Sprintf("%s/%d", itemsPath, eggsId), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, list.Version+4, change.Version)
+	w, _ = itemRequest(t, "DELETE", fmt.Sprintf("%s/%d", itemsPath, eggsId), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	stored, err := store.GetRawShoppingListWithId(list.ListId, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, list.Version+4, stored.Version)
+
+	DeleteTestUser(t)
+}
+
+func TestItemLevelOperationsOnSharedList(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("owner", "password")
+	assert.Nil(t, err)
+	list, err := createListOffline("shared item list", owner.OnlineID, createItemsWire("Item", 1))
+	if err != nil {
+		t.Fatalf("Failed to create list: %s", err)
+	}
+	CreateTestUser(t)
+	login(t)
+
+	itemsPath := fmt.Sprintf("/v1/lists/%d/items?createdBy=%d", list.ListId, owner.OnlineID)
+	w, _ := itemRequest(t, "POST", itemsPath, data.ItemWire{Name: "Milk", Quantity: 1})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	// Without createdBy the own (not existing) list is addressed
+	w, _ = itemRequest(t, "POST", fmt.Sprintf("/v1/lists/%d/items", list.ListId), data.ItemWire{Name: "Milk", Quantity: 1})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	_, err = createListSharing(list.ListId, owner.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+	w, change := itemRequest(t, "POST", itemsPath, data.ItemWire{Name: "Milk", Quantity: 1})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, owner.OnlineID, change.CreatedBy)
+	assert.Equal(t, testUser.OnlineID, change.Item.AddedBy)
+
+	DeleteTestUser(t)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Delta synchronization of lists
+// ------------------------------------------------------------
+
+// The client sends the versions of the lists it knows and only receives
+// the lists that changed, were added (own or shared) or are no longer accessible.
+// The items are only loaded for lists that are part of the answer.
+
+func (s *Server) accessibleListsForUser(userId int64) ([]data.List, error) {
+	ownLists, err := s.store.GetRawShoppingListsForUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	sharedListIds, err := s.store.GetListIdsSharedWithUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	sharedLists, err := s.store.GetRawShoppingListsByIDs(sharedListIds)
+	if err != nil {
+		return nil, err
+	}
+	return append(ownLists, sharedLists...), nil
+}
+
+func (s *Server) withItems(list data.List) data.List {
+	items, err := s.store.GetItemsInList(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		log.Printf("Failed to get items for list %d: %s", list.ListId, err)
+		items = []data.ItemWire{}
+	}
+	list.Items = items
+	return list
+}
+
+func (s *Server) syncShoppingLists(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var request data.ListSyncRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.Printf("Failed to convert given data to sync request: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	lists, err := s.accessibleListsForUser(userId)
+	if err != nil {
+		log.Printf("Failed to load lists for user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	known := make(map[data.ListPK]data.ListVersion)
+	for _, version := range request.Lists {
+		known[data.ListPK{ListID: version.ListId, CreatedBy: version.CreatedBy}] = version
+	}
+	response := data.ListSyncResponse{
+		Changed: []data.List{},
+		Added:   []data.List{},
+		Removed: []data.ListVersion{},
+	}
+	for _, list := range lists {
+		pk := data.ListPK{ListID: list.ListId, CreatedBy: list.CreatedBy.ID}
+		knownVersion, isKnown := known[pk]
+		if !isKnown {
+			response.Added = append(response.Added, s.withItems(list))
+			continue
+		}
+		delete(known, pk)
+		// A newer version on the client must be pushed by the client instead
+		if list.Version > knownVersion.Version {
+			response.Changed = append(response.Changed, s.withItems(list))
+		}
+	}
+	// Everything left is known to the client but no longer accessible
+	for _, version := range request.Lists {
+		pk := data.ListPK{ListID: version.ListId, CreatedBy: version.CreatedBy}
+		if _, removed := known[pk]; removed {
+			response.Removed = append(response.Removed, version)
+			delete(known, pk)
+		}
+	}
+	log.Printf("Sync for user %d: %d changed, %d added, %d removed", userId, len(response.Changed), len(response.Added), len(response.Removed))
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the delta synchronization of lists
+// ------------------------------------------------------------
+
+func syncLists(t *testing.T, known []data.ListVersion) data.ListSyncResponse {
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	encoded, err := json.Marshal(data.ListSyncRequest{Lists: known})
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("POST", "/v1/lists/sync", bytes.NewReader(encoded))
+	req.Header.Add("Authorization", "Bearer "+testToken)
+	router.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		t.FailNow()
+	}
+	var response data.ListSyncResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func versionOf(list data.List) data.ListVersion {
+	return data.ListVersion{ListId: list.ListId, CreatedBy: list.CreatedBy.ID, Version: list.Version}
+}
+
+func TestSyncLists(t *testing.T) {
+	connectDatabase()
+	other, err := store.CreateUserAccountInDatabase("other user", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+
+	unchanged, err := createListOffline("unchanged", testUser.OnlineID, createItemsWire("Item", 1))
+	assert.Nil(t, err)
+	changed, err := createListOffline("changed", testUser.OnlineID, createItemsWire("Item", 2))
+	assert.Nil(t, err)
+	deleted, err := createListOffline("deleted", testUser.OnlineID, nil)
+	assert.Nil(t, err)
+	unshared, err := createListOffline("unshared", other.OnlineID, nil)
+	assert.Nil(t, err)
+	_, err = createListSharing(unshared.ListId, other.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+
+	// Nothing known, everything is new
+	response := syncLists(t, nil)
+	assert.Equal(t, 4, len(response.Added))
+	assert.Equal(t, 0, len(response.Changed))
+	assert.Equal(t, 0, len(response.Removed))
+
+	known := []data.ListVersion{versionOf(unchanged), versionOf(changed), versionOf(deleted), versionOf(unshared)}
+	response = syncLists(t, known)
+	assert.Equal(t, 0, len(response.Added)+len(response.Changed)+len(response.Removed))
+
+	_, err = store.BumpListVersion(changed.ListId, testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Nil(t, store.DeleteShoppingList(deleted.ListId, testUser.OnlineID))
+	assert.Nil(t, store.DeleteSharingForUser(unshared.ListId, other.OnlineID, testUser.OnlineID))
+	shared, err := createListOffline("new share", other.OnlineID, createItemsWire("Shared", 1))
+	assert.Nil(t, err)
+	_, err = createListSharing(shared.ListId, other.OnlineID, testUser.OnlineID)
+	assert.Nil(t, err)
+
+	response = syncLists(t, known)
+	if assert.Equal(t, 1, len(response.Changed)) {
+		assert.Equal(t, changed.ListId, response.Changed[0].ListId)
+		assert.Equal(t, changed.Version+1, response.Changed[0].Version)
+		assert.Equal(t, 2, len(response.Changed[0].Items))
+	}
+	if assert.Equal(t, 1, len(response.Added)) {
+		assert.Equal(t, shared.ListId, response.Added[0].ListId)
+		assert.Equal(t, other.OnlineID, response.Added[0].CreatedBy.ID)
+		assert.Equal(t, 1, len(response.Added[0].Items))
+	}
+	assert.ElementsMatch(t, []data.ListVersion{versionOf(deleted), versionOf(unshared)}, response.Removed)
+
+	DeleteTestUser(t)
+}
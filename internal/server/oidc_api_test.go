@@ -0,0 +1,144 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication/oidctest"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the login with OpenID Connect
+// ------------------------------------------------------------
+
+// startOIDCLogin runs the login through the provider and returns the callback together
+// with the cookies set by the login
+func startOIDCLogin(t *testing.T, router *gin.Engine) (string, []*http.Cookie) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/users/oidc/login?device=Browser", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// The provider logs in immediately and redirects back to the callback
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(w.Header().Get("Location"))
+	assert.Nil(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+	callback, err := url.Parse(response.Header.Get("Location"))
+	assert.Nil(t, err)
+	return callback.RequestURI(), w.Result().Cookies()
+}
+
+func sendOIDCCallback(router *gin.Engine, callback string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", callback, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// oidcLogin runs the login through the provider and returns the answer of the callback
+func oidcLogin(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	callback, cookies := startOIDCLogin(t, router)
+	return sendOIDCCallback(router, callback, cookies)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	connectDatabase()
+	provider, err := oidctest.NewProvider("shopping", "secret")
+	assert.Nil(t, err)
+	defer provider.Close()
+	provider.SetUser("42", "oidc user")
+	oidcCfg := cfg
+	oidcCfg.OIDC = provider.Config("http://localhost/v1/users/oidc/callback")
+	// Started logins are kept by the router, so all requests go to the same one
+	router := server.SetupRouter(store, oidcCfg)
+
+	// The first login creates the account
+	w := oidcLogin(t, router)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var token authentication.Token
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &token))
+	assert.NotEmpty(t, token.RefreshToken)
+	identity, err := store.GetOIDCIdentity(provider.Issuer(), "42")
+	assert.Nil(t, err)
+	user, err := store.GetUser(identity.UserId)
+	assert.Nil(t, err)
+	assert.Equal(t, "oidc user", user.Username)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/ping", nil)
+	req.Header.Add("Authorization", "Bearer "+token.Token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Later logins use the linked account
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	users, err := store.GetAllUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(users))
+	provider.SetUser("43", "second user")
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	users, err = store.GetAllUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+
+	// The callback only completes the login in the browser that started it
+	callback, cookies := startOIDCLogin(t, router)
+	assert.Equal(t, http.StatusUnauthorized, sendOIDCCallback(router, callback, nil).Code)
+	forged := &http.Cookie{Name: cookies[0].Name, Value: "forged"}
+	assert.Equal(t, http.StatusUnauthorized, sendOIDCCallback(router, callback, []*http.Cookie{forged}).Code)
+	assert.Equal(t, http.StatusOK, sendOIDCCallback(router, callback, cookies).Code)
+
+	// Unknown states and denied logins are rejected
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/users/oidc/callback?state=unknown&code=abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/users/oidc/callback?error=access_denied", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOIDCLoginWithSecondFactor(t *testing.T) {
+	connectDatabase()
+	provider, err := oidctest.NewProvider("shopping", "secret")
+	assert.Nil(t, err)
+	defer provider.Close()
+	provider.SetUser("42", "oidc user")
+	oidcCfg := cfg
+	oidcCfg.OIDC = provider.Config("http://localhost/v1/users/oidc/callback")
+	router := server.SetupRouter(store, oidcCfg)
+	assert.Equal(t, http.StatusOK, oidcLogin(t, router).Code)
+	identity, err := store.GetOIDCIdentity(provider.Issuer(), "42")
+	assert.Nil(t, err)
+
+	// The callback cannot ask for the code, so the password login has to be used
+	assert.Nil(t, store.CreateTOTP(data.TOTP{UserId: identity.UserId, Secret: "JBSWY3DPEHPK3PXP", Created: time.Now().UTC()}))
+	assert.Nil(t, store.EnableTOTP(identity.UserId))
+	assert.Equal(t, http.StatusForbidden, oidcLogin(t, router).Code)
+}
+
+func TestOIDCLoginDisabled(t *testing.T) {
+	connectDatabase()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/users/oidc/login", nil)
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
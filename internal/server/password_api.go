@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Changing and resetting passwords
+// ------------------------------------------------------------
+
+// changePassword requires the current password and logs out all other devices
+func (s *Server) changePassword(c *gin.Context) {
+	sId := c.Param("userId")
+	id, err := strconv.ParseInt(sId, 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse given userId: %s: %s", sId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 || userId != id {
+		log.Printf("User %d cannot change the password of user %d", userId, id)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var change data.PasswordChange
+	if err := c.ShouldBindJSON(&change); err != nil || change.NewPassword == "" {
+		log.Printf("Password change does not contain the new password: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	user, err := s.store.GetUser(userId)
+	if err != nil {
+		log.Printf("User %d not found: %s", userId, err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	// Forbidden instead of unauthorized, the token itself is still valid
+	if err := authentication.VerifyPassword(user, change.CurrentPassword); err != nil {
+		log.Printf("Current password of user %d does not match: %s", userId, err)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if _, err := s.store.ModifyUserAccountPassword(userId, change.NewPassword); err != nil {
+		log.Printf("Failed to change password of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := s.revokeOtherSessions(userId, c.GetString("sessionId")); err != nil {
+		log.Printf("Failed to revoke sessions of %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// requestPasswordReset sends a one-time code through the notifier. The answer is the
+// same for unknown users, so the endpoint cannot be used to find existing accounts.
+func (s *Server) requestPasswordReset(c *gin.Context) {
+	var request data.PasswordResetRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.OnlineID == 0 {
+		log.Printf("Password reset does not contain the user: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	user, err := s.store.GetUser(request.OnlineID)
+	if err != nil || user.Username != request.Username {
+		log.Printf("Password reset for unknown user %d", request.OnlineID)
+		c.Status(http.StatusAccepted)
+		return
+	}
+	code, reset, err := s.tokens.CreatePasswordResetCode(user.OnlineID)
+	if err != nil {
+		log.Printf("Failed to create password reset of user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := s.notifier.SendPasswordResetCode(user, code, reset.ValidUntil); err != nil {
+		log.Printf("Failed to send password reset code to user %d: %s", user.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// confirmPasswordReset sets the new password and logs out all devices
+func (s *Server) confirmPasswordReset(c *gin.Context) {
+	var confirm data.PasswordResetConfirm
+	if err := c.ShouldBindJSON(&confirm); err != nil || confirm.OnlineID == 0 || confirm.Code == "" || confirm.NewPassword == "" {
+		log.Printf("Password reset confirmation is incomplete: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err := s.tokens.RedeemPasswordResetCode(confirm.OnlineID, confirm.Code); err != nil {
+		log.Printf("Failed to reset password of user %d: %s", confirm.OnlineID, err)
+		if errors.Is(err, authentication.ErrInvalidResetCode) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		} else {
+			c.AbortWithStatus(http.StatusInternalServerError)
+		}
+		return
+	}
+	if _, err := s.store.ModifyUserAccountPassword(confirm.OnlineID, confirm.NewPassword); err != nil {
+		log.Printf("Failed to reset password of user %d: %s", confirm.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if _, err := s.store.DeleteSessionsForUser(confirm.OnlineID); err != nil {
+		log.Printf("Failed to revoke sessions of %d: %s", confirm.OnlineID, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,122 @@
+package server_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/notification"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing password changes and resets
+// ------------------------------------------------------------
+
+// The reset codes are written to a file instead of the log to read them in the tests
+// useNotifierConfig writes the notifications of the test into a file
+func useNotifierConfig(t *testing.T) configuration.Config {
+	previous := cfg
+	t.Cleanup(func() { cfg = previous })
+	cfg.Notifier = configuration.NotifierConfig{
+		Type: configuration.NotifierFile,
+		File: filepath.Join(t.TempDir(), "notifications.jsonl"),
+	}
+	return cfg
+}
+
+func loginWithPassword(t *testing.T, password string) int {
+	reader, err := loadUserAndSetupFields(0, "", password)
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	return w.Code
+}
+
+func sentResetCodes(t *testing.T, config configuration.Config) []string {
+	file, err := os.Open(config.Notifier.File)
+	if os.IsNotExist(err) {
+		return []string{}
+	}
+	assert.Nil(t, err)
+	defer file.Close()
+	codes := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message notification.Message
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &message))
+		assert.Equal(t, testUser.OnlineID, message.UserId)
+		codes = append(codes, message.Code)
+	}
+	return codes
+}
+
+func TestChangePassword(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	phone := loginOnDevice(t, "Phone")
+	tablet := loginOnDevice(t, "Tablet")
+	path := fmt.Sprintf("/v1/users/%d/password", testUser.OnlineID)
+
+	wrong := data.PasswordChange{CurrentPassword: "wrong", NewPassword: "new password"}
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "PUT", path, phone, wrong).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "PUT", path, phone, data.PasswordChange{CurrentPassword: PASSWORD}).Code)
+	other := fmt.Sprintf("/v1/users/%d/password", testUser.OnlineID+1)
+	change := data.PasswordChange{CurrentPassword: PASSWORD, NewPassword: "new password"}
+	assert.Equal(t, http.StatusUnauthorized, sendJSONRequest(t, "PUT", other, phone, change).Code)
+	assert.Equal(t, http.StatusOK, loginWithPassword(t, PASSWORD))
+
+	// Only the device changing the password stays logged in
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "PUT", path, phone, change).Code)
+	assert.Equal(t, http.StatusOK, sendSessionRequest("GET", "/v1/test/auth", phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", tablet).Code)
+	assert.Equal(t, 1, len(getSessions(t, phone)))
+	assert.Equal(t, http.StatusUnauthorized, loginWithPassword(t, PASSWORD))
+	assert.Equal(t, http.StatusOK, loginWithPassword(t, "new password"))
+	DeleteTestUser(t)
+}
+
+func TestPasswordReset(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	config := useNotifierConfig(t)
+	phone := loginOnDevice(t, "Phone")
+
+	// Unknown users get the same answer but no code
+	unknown := data.PasswordResetRequest{OnlineID: testUser.OnlineID, Username: "someone else"}
+	assert.Equal(t, http.StatusAccepted, sendJSONRequest(t, "POST", "/v1/users/password/reset", "", unknown).Code)
+	assert.Equal(t, 0, len(sentResetCodes(t, config)))
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/users/password/reset", "", data.PasswordResetRequest{}).Code)
+
+	request := data.PasswordResetRequest{OnlineID: testUser.OnlineID, Username: testUser.Username}
+	assert.Equal(t, http.StatusAccepted, sendJSONRequest(t, "POST", "/v1/users/password/reset", "", request).Code)
+	codes := sentResetCodes(t, config)
+	if !assert.Equal(t, 1, len(codes)) {
+		return
+	}
+
+	confirm := data.PasswordResetConfirm{OnlineID: testUser.OnlineID, Code: "wrong", NewPassword: "reset password"}
+	assert.Equal(t, http.StatusUnauthorized, sendJSONRequest(t, "POST", "/v1/users/password/reset/confirm", "", confirm).Code)
+	confirm.Code = codes[0]
+	confirm.NewPassword = ""
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", "/v1/users/password/reset/confirm", "", confirm).Code)
+
+	// The reset logs out all devices and the code can only be used once
+	confirm.NewPassword = "reset password"
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "POST", "/v1/users/password/reset/confirm", "", confirm).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendJSONRequest(t, "POST", "/v1/users/password/reset/confirm", "", confirm).Code)
+	assert.Equal(t, http.StatusUnauthorized, loginWithPassword(t, PASSWORD))
+	assert.Equal(t, http.StatusOK, loginWithPassword(t, "reset password"))
+	DeleteTestUser(t)
+}
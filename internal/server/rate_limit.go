@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/middleware"
+)
+
+// ------------------------------------------------------------
+// Rate limits of the route groups
+// ------------------------------------------------------------
+
+// The route groups are limited and restricted to addresses separately
+const (
+	groupAccounts = "accounts" // Creating accounts and resetting passwords
+	groupLogin    = "login"
+	groupAPI      = "api"
+	groupAdmin    = "admin"
+	groupMetrics  = "metrics"
+)
+
+// Limits of the route groups that are not configured
+var defaultRateLimits = map[string]configuration.RateLimit{
+	groupAccounts: {Requests: 10, IntervalSeconds: 3600, Key: configuration.RateLimitByIP},
+	groupLogin:    {Requests: 30, IntervalSeconds: 60, Key: configuration.RateLimitByIP},
+	groupAPI:      {Requests: 300, IntervalSeconds: 60, Key: configuration.RateLimitByUser},
+	groupAdmin:    {Requests: 60, IntervalSeconds: 60, Key: configuration.RateLimitByUser},
+	groupMetrics:  {Requests: 30, IntervalSeconds: 60, Key: configuration.RateLimitByAPIKey},
+}
+
+func noRateLimit(c *gin.Context) {
+	c.Next()
+}
+
+// rateLimit returns the middleware limiting the group, configured limits without requests disable it
+func (s *Server) rateLimit(group string) gin.HandlerFunc {
+	limit, enabled := s.groupRateLimit(group)
+	if !enabled {
+		return noRateLimit
+	}
+	return middleware.RateLimitMiddleware(s.limiter, group, limit)
+}
+
+// rateLimitAddress limits the group per address in its own buckets. Added before the
+// authentication of groups keyed by user or API key, so that failed attempts are limited too.
+func (s *Server) rateLimitAddress(group string) gin.HandlerFunc {
+	limit, enabled := s.groupRateLimit(group)
+	if !enabled {
+		return noRateLimit
+	}
+	limit.Key = configuration.RateLimitByIP
+	return middleware.RateLimitMiddleware(s.limiter, group+"-address", limit)
+}
+
+func (s *Server) groupRateLimit(group string) (configuration.RateLimit, bool) {
+	if s.config.RateLimit.Disabled {
+		return configuration.RateLimit{}, false
+	}
+	limit, configured := s.config.RateLimit.Groups[group]
+	if !configured {
+		limit = defaultRateLimits[group]
+	}
+	return limit, limit.Requests > 0 && limit.IntervalSeconds > 0
+}
@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the rate limits of the route groups
+// ------------------------------------------------------------
+
+func TestRateLimitAccountCreation(t *testing.T) {
+	connectDatabase()
+	config := cfg
+	config.RateLimit.Groups = map[string]configuration.RateLimit{
+		"accounts": {Requests: 2, IntervalSeconds: 60},
+	}
+	// The limits are only known to the router counting the requests
+	router := server.SetupRouter(store, config)
+	createAccount := func(remoteAddr string) *httptest.ResponseRecorder {
+		raw, err := json.Marshal(data.User{Username: "rate limited user", Password: "password"})
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/users", bytes.NewReader(raw))
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusCreated, createAccount("10.0.0.1:40000").Code)
+	assert.Equal(t, http.StatusCreated, createAccount("10.0.0.1:40001").Code)
+	w := createAccount("10.0.0.1:40002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	// Other addresses and route groups have their own limit
+	assert.Equal(t, http.StatusCreated, createAccount("10.0.0.2:40000").Code)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test/unauth", nil)
+	req.RemoteAddr = "10.0.0.1:40003"
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	config.RateLimit.Disabled = true
+	router = server.SetupRouter(store, config)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusCreated, createAccount("10.0.0.1:40000").Code)
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	token := loginOnDevice(t, "Phone")
+	config := cfg
+	config.RateLimit.Groups = map[string]configuration.RateLimit{
+		"api": {Requests: 1, IntervalSeconds: 60, Key: configuration.RateLimitByUser},
+	}
+	router := server.SetupRouter(store, config)
+	ping := func(remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/ping", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, ping("10.0.0.1:40000"))
+	// Changing the address does not help the same user
+	assert.Equal(t, http.StatusTooManyRequests, ping("10.0.0.2:40000"))
+	DeleteTestUser(t)
+}
+
+func TestRateLimitFailedApiKeys(t *testing.T) {
+	connectDatabase()
+	config := cfg
+	config.RateLimit.Groups = map[string]configuration.RateLimit{
+		"metrics": {Requests: 2, IntervalSeconds: 60, Key: configuration.RateLimitByAPIKey},
+	}
+	router := server.SetupRouter(store, config)
+	metrics := func(apiKey string, remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("x-api-key", apiKey)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// A new invalid key per request still counts against the address
+	assert.Equal(t, http.StatusUnauthorized, metrics("first guess", "10.0.0.1:40000"))
+	assert.Equal(t, http.StatusUnauthorized, metrics("second guess", "10.0.0.1:40000"))
+	assert.Equal(t, http.StatusTooManyRequests, metrics("third guess", "10.0.0.1:40000"))
+	assert.Equal(t, http.StatusUnauthorized, metrics("third guess", "10.0.0.2:40000"))
+}
@@ -17,7 +17,7 @@ import (
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 )
 
-func createRecipe(c *gin.Context) {
+func (s *Server) createRecipe(c *gin.Context) {
 	_, err := c.MultipartForm()
 	if err != nil {
 		log.Printf("Wrong request format: No multipart form data found!")
@@ -42,31 +42,28 @@ func createRecipe(c *gin.Context) {
 		return
 	}
 	log.Printf("Creating new recipe '%d' with name '%s'", recipeToCreate.RecipeId, recipeToCreate.Name)
-	if err := IsUserAllowedToHandleData(recipeToCreate, userId, false); err != nil {
+	if err := s.IsUserAllowedToHandleData(recipeToCreate, userId, false); err != nil {
 		log.Printf("Failed to create recipe '%d': %s", recipeToCreate.RecipeId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	// The user can specify his own id, therefore we don't return anything
-	if err := database.CreateRecipe(recipeToCreate); err != nil {
-		log.Printf("Failed to create recipe: %s", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
 	recipePk := data.RecipePK{
 		RecipeId:  recipeToCreate.RecipeId,
 		CreatedBy: recipeToCreate.CreatedBy.ID,
 	}
-	if _, err := database.StoreImagesForRecipe(c, recipePk); err != nil {
-		// If the creation of the images failed, delete the recipe
-		_ = database.DeleteRecipe(recipeToCreate.RecipeId, recipeToCreate.CreatedBy.ID)
+	// The user can specify his own id, therefore we don't return anything
+	err = database.StoreImagesForRecipe(c, recipePk, func(filenames []string) error {
+		return s.store.CreateRecipe(recipeToCreate, filenames)
+	})
+	if err != nil {
+		log.Printf("Failed to create recipe: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 	c.Status(http.StatusCreated)
 }
 
-func getRecipe(c *gin.Context) {
+func (s *Server) getRecipe(c *gin.Context) {
 	log.Print("Reading recipe")
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
@@ -81,7 +78,7 @@ func getRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	recipe, err := database.GetRecipe(int64(recipeId), userId)
+	recipe, err := s.store.GetRecipe(int64(recipeId), userId)
 	if err != nil {
 		log.Printf("Failed to read recipe %d from %d from database: %s", recipeId, userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -90,7 +87,7 @@ func getRecipe(c *gin.Context) {
 	c.JSON(http.StatusOK, recipe)
 }
 
-func getRecipeImages(c *gin.Context) {
+func (s *Server) getRecipeImages(c *gin.Context) {
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
 	if err != nil {
@@ -104,7 +101,7 @@ func getRecipeImages(c *gin.Context) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	imageFilepaths, err := database.GetImageNamesForRecipe(int64(recipeId), userId)
+	imageFilepaths, err := s.store.GetImageNamesForRecipe(int64(recipeId), userId)
 	if err != nil {
 		log.Printf("Failed to load images for recipe %d from %d: %s", recipeId, userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -124,13 +121,13 @@ func getRecipeImages(c *gin.Context) {
 	c.Data(http.StatusOK, "application/media", flattendedImages)
 }
 
-func loadRecipeWithImages(recipeId int64, createdBy int64) (data.Recipe, [][]byte, []string, error) {
+func (s *Server) loadRecipeWithImages(recipeId int64, createdBy int64) (data.Recipe, [][]byte, []string, error) {
 	log.Printf("Loading recipe %d from user %d", recipeId, createdBy)
-	recipe, err := database.GetRecipe(int64(recipeId), createdBy)
+	recipe, err := s.store.GetRecipe(int64(recipeId), createdBy)
 	if err != nil {
 		return data.Recipe{}, nil, []string{}, err
 	}
-	imageFilePaths, err := database.GetImageNamesForRecipe(recipeId, createdBy)
+	imageFilePaths, err := s.store.GetImageNamesForRecipe(recipeId, createdBy)
 	if err != nil {
 		return data.Recipe{}, nil, []string{}, err
 	}
@@ -198,7 +195,7 @@ func sendResponseInMultiformData(writer gin.ResponseWriter, recipes []data.Recip
 	return nil
 }
 
-func getRecipeWithImages(c *gin.Context) {
+func (s *Server) getRecipeWithImages(c *gin.Context) {
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
 	if err != nil {
@@ -221,7 +218,7 @@ func getRecipeWithImages(c *gin.Context) {
 		}
 		userId = int64(parsedCreatedBy)
 	}
-	recipe, imageData, imageFilePaths, err := loadRecipeWithImages(int64(recipeId), userId)
+	recipe, imageData, imageFilePaths, err := s.loadRecipeWithImages(int64(recipeId), userId)
 	if err != nil {
 		log.Printf("Failed to load recipe %d: %s", recipeId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -240,7 +237,7 @@ func getRecipeWithImages(c *gin.Context) {
 	// Since we wrote directly into the stream, we are done here
 }
 
-func getOwnAndSharedRecipesWithImages(c *gin.Context) {
+func (s *Server) getOwnAndSharedRecipesWithImages(c *gin.Context) {
 	userId := c.GetInt64("userId")
 	if userId == 0 {
 		log.Printf("User not authenticated")
@@ -248,13 +245,13 @@ func getOwnAndSharedRecipesWithImages(c *gin.Context) {
 		return
 	}
 
-	ownRecipeIds, err := database.GetRecipeForUserId(userId)
+	ownRecipeIds, err := s.store.GetRecipeForUserId(userId)
 	if err != nil {
 		log.Printf("Failed to get recipes for user %d: %s", userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	sharedWithRecipeIds, sharedWithRecipeCreatedBy, err := database.GetRecipeIdsSharedWithUserId(userId)
+	sharedWithRecipeIds, sharedWithRecipeCreatedBy, err := s.store.GetRecipeIdsSharedWithUserId(userId)
 	if err != nil {
 		log.Printf("Failed to get shared recipes for user %d: %s", userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -271,13 +268,13 @@ func getOwnAndSharedRecipesWithImages(c *gin.Context) {
 		if index >= len(ownRecipeIds) {
 			recipeCreatedBy = sharedWithRecipeCreatedBy[index-len(ownRecipeIds)]
 		}
-		recipe, imageData, imageFilePaths, err := loadRecipeWithImages(recipeId, recipeCreatedBy)
+		recipe, imageData, imageFilePaths, err := s.loadRecipeWithImages(recipeId, recipeCreatedBy)
 		if err != nil {
 			log.Printf("Failed to load recipe %d: %s", recipeId, err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		recipeCreator, err := database.GetUser(recipeCreatedBy)
+		recipeCreator, err := s.store.GetUser(recipeCreatedBy)
 		if err != nil {
 			log.Printf("Failed to get recipe creator for recipe %d: %s", recipeId, err)
 			c.AbortWithStatus(http.StatusBadRequest)
@@ -298,7 +295,7 @@ func getOwnAndSharedRecipesWithImages(c *gin.Context) {
 	log.Printf("Successfully send %d recipes for user %d", len(allRawRecipes), userId)
 }
 
-func updateRecipe(c *gin.Context) {
+func (s *Server) updateRecipe(c *gin.Context) {
 	log.Print("Updating recipe")
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
@@ -329,37 +326,27 @@ func updateRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	if err = IsUserAllowedToHandleData(recipeToUpdate, userId, true); err != nil {
+	if err = s.IsUserAllowedToHandleData(recipeToUpdate, userId, true); err != nil {
 		log.Printf("User is not allowed to update recipe: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	oldRecipe, err := database.GetRecipe(recipeToUpdate.RecipeId, recipeToUpdate.CreatedBy.ID)
-	if err != nil {
-		// Internal error but don't inform user
-		log.Printf("Failed to get recipe for rollback operation %d: %s", recipeToUpdate.RecipeId, err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-	if err := database.UpdateRecipe(recipeToUpdate); err != nil {
-		log.Printf("Failed to update recipe: %s", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
 	recipePk := data.RecipePK{
 		RecipeId:  recipeToUpdate.RecipeId,
 		CreatedBy: recipeToUpdate.CreatedBy.ID,
 	}
-	if err := database.UpdateAndReplaceImagesForRecipe(c, recipePk); err != nil {
-		// Restore the state before the update and ignore errors
-		_ = database.UpdateRecipeWithoutComparingVersion(oldRecipe)
+	err = database.UpdateAndReplaceImagesForRecipe(s.store, c, recipePk, func(filenames []string) error {
+		return s.store.UpdateRecipe(recipeToUpdate, filenames)
+	})
+	if err != nil {
+		log.Printf("Failed to update recipe: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 	c.Status(http.StatusOK)
 }
 
-func IsUserAllowedToHandleData(recipe data.Recipe, userId int64, update bool) error {
+func (s *Server) IsUserAllowedToHandleData(recipe data.Recipe, userId int64, update bool) error {
 	if userId == recipe.CreatedBy.ID {
 		return nil
 	}
@@ -367,14 +354,14 @@ func IsUserAllowedToHandleData(recipe data.Recipe, userId int64, update bool) er
 		log.Printf("UserId %d does not match recipe createdBy %d", userId, recipe.CreatedBy.ID)
 		return errors.New("user creating recipe different from user in recipe")
 	}
-	if err := database.IsRecipeSharedWithUser(userId, recipe.RecipeId, recipe.CreatedBy.ID); err != nil {
+	if err := s.store.IsRecipeSharedWithUser(userId, recipe.RecipeId, recipe.CreatedBy.ID); err != nil {
 		log.Printf("Recipe %d from %d to update is not shared with user %d", recipe.RecipeId, recipe.CreatedBy.ID, userId)
 		return errors.New("recipe is not shared with user")
 	}
 	return nil
 }
 
-func deleteRecipe(c *gin.Context) {
+func (s *Server) deleteRecipe(c *gin.Context) {
 	log.Print("Deleting recipe")
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
@@ -389,43 +376,43 @@ func deleteRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	recipeToDelete, err := database.GetRecipe(int64(recipeId), userId)
+	recipeToDelete, err := s.store.GetRecipe(int64(recipeId), userId)
 	if err != nil {
 		log.Printf("Failed to get recipe %d: %s", recipeId, err)
 		c.AbortWithStatus(http.StatusOK)
 		return
 	}
-	if err := IsUserAllowedToHandleData(recipeToDelete, userId, false); err != nil {
+	if err := s.IsUserAllowedToHandleData(recipeToDelete, userId, false); err != nil {
 		log.Printf("User is not allowed to delete recipe %d: %s", recipeId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	filepaths, err := database.GetImageNamesForRecipe(int64(recipeId), userId)
-	if err != nil {
-		log.Printf("Failed to load image names for recipe: %s", err)
+	if err := s.deleteRecipeWithImages(int64(recipeId), userId); err != nil {
+		log.Printf("Failed to delete recipe %d from %d: %s", recipeId, userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	log.Printf("Deleting %d image(s) stored for recipe", len(filepaths))
-	err = database.DeleteImagesFromFilepaths("recipes", filepaths)
+	c.Status(http.StatusOK)
+}
+
+// deleteRecipeWithImages removes the stored images before the recipe itself
+func (s *Server) deleteRecipeWithImages(recipeId int64, createdBy int64) error {
+	filepaths, err := s.store.GetImageNamesForRecipe(recipeId, createdBy)
 	if err != nil {
-		log.Printf("Failed to delete image names for recipe: %s", err)
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+		return fmt.Errorf("failed to load image names: %w", err)
 	}
-	if err := database.DeleteRecipe(int64(recipeId), userId); err != nil {
-		log.Printf("Failed to delete recipe %d from %d: %s", recipeId, userId, err)
-		c.Copy().AbortWithStatus(http.StatusBadRequest)
-		return
+	log.Printf("Deleting %d image(s) stored for recipe", len(filepaths))
+	if err := database.DeleteImagesFromFilepaths("recipes", filepaths); err != nil {
+		return fmt.Errorf("failed to delete images: %w", err)
 	}
-	c.Status(http.StatusOK)
+	return s.store.DeleteRecipe(recipeId, createdBy)
 }
 
 // ----------------------------------------
 // Recipe sharing
 // ----------------------------------------
 
-func createShareRecipe(c *gin.Context) {
+func (s *Server) createShareRecipe(c *gin.Context) {
 	log.Print("Creating recipe sharing")
 	strRecipeId := c.Param("recipeId")
 	recipeId, err := strconv.Atoi(strRecipeId)
@@ -440,7 +427,7 @@ func createShareRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	recipe, err := database.GetRecipe(int64(recipeId), userId)
+	recipe, err := s.store.GetRecipe(int64(recipeId), userId)
 	if err != nil {
 		log.Printf("Recipe to share does not exist")
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -451,6 +438,10 @@ func createShareRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
+	if strHouseholdId, exists := c.GetQuery("household"); exists {
+		s.shareRecipeWithHousehold(c, recipe, strHouseholdId, userId)
+		return
+	}
 	strSharedWithId, exists := c.GetQuery("sharedWith")
 	if !exists {
 		log.Printf("Query parameter sharedWith not found")
@@ -463,13 +454,18 @@ func createShareRecipe(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	_, err = database.GetUser(int64(sharedWith))
+	_, err = s.store.GetUser(int64(sharedWith))
 	if err != nil {
 		log.Printf("User %d to share with does not exist", sharedWith)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	if err := database.CreateRecipeSharing(int64(recipeId), userId, int64(sharedWith)); err != nil {
+	if s.isBlockedBy(int64(sharedWith), userId) {
+		log.Printf("User %d blocked sharing recipes from %d", sharedWith, userId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if err := s.store.CreateRecipeSharing(int64(recipeId), userId, int64(sharedWith)); err != nil {
 		log.Printf("Failed to create recipe sharing: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -477,15 +473,36 @@ func createShareRecipe(c *gin.Context) {
 	c.Status(http.StatusCreated)
 }
 
-func isUserAllowedToUnshare(recipeId int64, createdBy int64, userId int64) error {
+// shareRecipeWithHousehold shares the recipe with a household the user is a member of
+func (s *Server) shareRecipeWithHousehold(c *gin.Context, recipe data.Recipe, strHouseholdId string, userId int64) {
+	householdId, err := strconv.Atoi(strHouseholdId)
+	if err != nil {
+		log.Printf("Failed to parse household parameter: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if _, err := s.store.GetHouseholdRole(int64(householdId), userId); err != nil {
+		log.Printf("User %d cannot share recipe %d with household %d without being a member", userId, recipe.RecipeId, householdId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if err := s.store.ShareRecipeWithHousehold(recipe.RecipeId, userId, int64(householdId)); err != nil {
+		log.Printf("Failed to create recipe sharing: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+func (s *Server) isUserAllowedToUnshare(recipeId int64, createdBy int64, userId int64) error {
 	if createdBy == userId {
 		return nil
 	}
-	err := database.IsRecipeSharedWithUser(userId, recipeId, createdBy)
+	err := s.store.IsRecipeSharedWithUser(userId, recipeId, createdBy)
 	return err
 }
 
-func deleteShareRecipe(c *gin.Context) {
+func (s *Server) deleteShareRecipe(c *gin.Context) {
 	log.Print("Deleting recipe sharing")
 	strRecipeId := c.Param("recipeId")
 	convertedRecipeId, err := strconv.Atoi(strRecipeId)
@@ -513,19 +530,34 @@ func deleteShareRecipe(c *gin.Context) {
 		createdBy = int64(convertedCreatedBy)
 	}
 
-	if err := isUserAllowedToUnshare(recipeId, createdBy, userId); err != nil {
+	if err := s.isUserAllowedToUnshare(recipeId, createdBy, userId); err != nil {
 		log.Printf("User %d is no allowed to handle recipe %d created by %d", userId, recipeId, createdBy)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	recipe, err := database.GetRecipe(recipeId, createdBy)
+	recipe, err := s.store.GetRecipe(recipeId, createdBy)
 	if err != nil {
 		log.Printf("Recipe to unshare does not exist")
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
+	if strHouseholdId, exists := c.GetQuery("household"); exists {
+		householdId, err := strconv.Atoi(strHouseholdId)
+		if err != nil || recipe.CreatedBy.ID != userId {
+			log.Printf("Only the creator can remove the sharing of recipe %d with household %s", recipeId, strHouseholdId)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := s.store.UnshareRecipeWithHousehold(recipeId, userId, int64(householdId)); err != nil {
+			log.Printf("Failed to delete recipe sharing with household %d: %s", householdId, err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
 	strSharedWithId, exists := c.GetQuery("sharedWith")
 	if !exists {
 		if recipe.CreatedBy.ID != userId {
@@ -533,7 +565,7 @@ func deleteShareRecipe(c *gin.Context) {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := database.DeleteAllSharingForRecipe(recipeId, userId); err != nil {
+		if err := s.store.DeleteAllSharingForRecipe(recipeId, userId); err != nil {
 			log.Printf("Failed to delete all recipe sharings: %s", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
@@ -545,7 +577,7 @@ func deleteShareRecipe(c *gin.Context) {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := database.DeleteRecipeSharing(recipeId, createdBy, int64(sharedWithId)); err != nil {
+		if err := s.store.DeleteRecipeSharing(recipeId, createdBy, int64(sharedWithId)); err != nil {
 			log.Printf("Failed to delete recipe sharing: %s", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
@@ -1,7 +1,6 @@
 package server
 
 import (
-	"database/sql"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -12,9 +11,56 @@ import (
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/configuration"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/events"
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/middleware"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/notification"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/ratelimit"
 )
 
+// Server bundles the state shared by all request handlers
+type Server struct {
+	store    database.Store
+	hub      events.Hub
+	config   configuration.Config
+	tokens   *authentication.TokenHandler
+	notifier notification.Notifier
+	logins   *authentication.LoginThrottle
+	limiter  ratelimit.Limiter
+	oidc     *authentication.OIDCProvider // nil unless configured
+	ipAccess *authentication.IPAccessLists
+}
+
+func NewServer(store database.Store, config configuration.Config) *Server {
+	keys, err := authentication.LoadKeySet(config.JWT.SigningKeys)
+	if err != nil {
+		log.Fatalf("Failed to load the signing keys: %s", err)
+	}
+	notifier, err := notification.NewNotifier(config.Notifier, config.Server.Production)
+	if err != nil {
+		log.Fatalf("Failed to create the notifier: %s", err)
+	}
+	ipAccess, err := authentication.NewIPAccessLists(config.IPAccess)
+	if err != nil {
+		log.Fatalf("Failed to load the IP access lists: %s", err)
+	}
+	var oidc *authentication.OIDCProvider
+	if config.OIDC.Issuer != "" {
+		oidc = authentication.NewOIDCProvider(config.OIDC)
+	}
+	return &Server{
+		store:    store,
+		hub:      events.NewMemoryHub(),
+		config:   config,
+		tokens:   authentication.NewTokenHandler(store, config.JWT, keys),
+		notifier: notifier,
+		logins:   authentication.NewLoginThrottle(config.JWT, prometheusLoginObserver{}),
+		limiter:  ratelimit.NewMemoryLimiter(),
+		oidc:     oidc,
+		ipAccess: ipAccess,
+	}
+}
+
 // ------------------------------------------------------------
 // Debug functionality
 // ------------------------------------------------------------
@@ -48,6 +94,21 @@ func pingTest(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
+// ------------------------------------------------------------
+// Public keys for other services verifying our tokens
+// ------------------------------------------------------------
+
+func (s *Server) getJWKS(c *gin.Context) {
+	keys, err := s.tokens.Keys().JWKS()
+	if err != nil {
+		log.Printf("Failed to export signing keys: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, keys)
+}
+
 // ------------------------------------------------------------
 // The main function
 // ------------------------------------------------------------
@@ -55,17 +116,33 @@ func pingTest(c *gin.Context) {
 func init() {
 	// Register Prometheus metrics
 	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, activeConnections)
+	prometheus.MustRegister(loginFailuresTotal, loginsThrottledTotal, accountLockoutsTotal, accountUnlocksTotal)
+}
+
+func SetupRouter(store database.Store, config configuration.Config) *gin.Engine {
+	return SetupRouterWithHub(store, events.NewMemoryHub(), config)
 }
 
-func SetupRouter(db *sql.DB, config configuration.Config) *gin.Engine {
-	if config.Server.Production {
+// SetupRouterWithHub allows replacing the in-process event hub, e.g. when running multiple instances
+func SetupRouterWithHub(store database.Store, hub events.Hub, config configuration.Config) *gin.Engine {
+	s := NewServer(store, config)
+	s.hub = hub
+	return s.setupRouter()
+}
+
+func (s *Server) setupRouter() *gin.Engine {
+	if s.config.Server.Production {
 		gin.SetMode(gin.ReleaseMode)
 	} else {
 		gin.SetMode(gin.DebugMode)
 	}
 
 	router := gin.Default()
-	auth := authentication.NewAuthenticationHandler(db, config)
+	// Without trusted proxies the client is always the remote address
+	if err := router.SetTrustedProxies(s.config.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %s", err)
+	}
+	auth := authentication.NewAuthenticationHandler(s.store, s.config, s.tokens, s.logins, s.oidc)
 	router.Use(middleware.CorsMiddleware())
 	router.Use(prometheusMiddleware)
 
@@ -73,47 +150,103 @@ func SetupRouter(db *sql.DB, config configuration.Config) *gin.Engine {
 
 	// TODO: Outsource the handling of users into it's own Service
 	// Independent of API version, therefore not in the auth bracket
-	router.POST("/v1/users", CreateAccount)
+	// Every group is limited per client, see defaultRateLimits
+	accounts := router.Group("/v1/users", s.allowIPs(groupAccounts), s.rateLimit(groupAccounts))
+	{
+		accounts.POST("", s.CreateAccount)
+		accounts.POST("/password/reset", s.requestPasswordReset) // Sends a one-time code through the notifier
+		accounts.POST("/password/reset/confirm", s.confirmPasswordReset)
+	}
 	// Server BASED AUTHENTICATION
-	router.POST("/v1/users/login/:userId", auth.Login)
+	logins := router.Group("/v1/users", s.allowIPs(groupLogin), s.rateLimit(groupLogin))
+	{
+		logins.POST("/login/:userId", auth.Login)
+		logins.POST("/refresh", auth.Refresh) // Exchanges the refresh token of the login
+		if s.oidc != nil {
+			logins.GET("/oidc/login", auth.OIDCLogin) // Redirects to the provider, includes device parameter
+			logins.GET("/oidc/callback", auth.OIDCCallback)
+		}
+	}
+	router.GET("/.well-known/jwks.json", s.getJWKS) // Public keys verifying the issued tokens
 
 	// ------------- Handling Routes v1 (API version 1) ---------------
 
 	// Add authentication middleware to v1 router
 	authorized := router.Group("/v1")
-	authorized.Use(auth.AuthMiddleware())
+	authorized.Use(s.allowIPs(groupAPI), auth.AuthMiddleware(), s.rateLimit(groupAPI))
 	{
 		// The structure is similar to the order of operations: create, update, get, delete
 
 		// Notice: The creation of a new user does not require an account and authorization
 		// therefore, it is handled in the unauthorized part above
-		authorized.PUT("/users/:userId", updateUserinfo)
-		authorized.GET("/users/:userId", getUserInfos)
-		authorized.DELETE("/users/:userId", DeleteAccount)
-
-		authorized.GET("/users/name", getMatchingUsers) // Includes search query parameter
-
-		authorized.POST("/lists", createShoppingList)
-		authorized.PUT("/lists/:listId", updateShoppingList) // Includes createBy parameter
-		authorized.GET("/lists/:listId", getShoppingList)    // Includes search query parameter
-		authorized.GET("/lists", getAllShoppingListsForUser)
-		authorized.DELETE("/lists/:listId", deleteShoppingList)
-		authorized.DELETE("/lists", deleteAllOwnShoppingLists)
-
-		authorized.POST("/share/:listId", shareShoppingList)
-		authorized.PUT("/share/:listId", updateShareShoppingList)
-		authorized.DELETE("/share/:listId", unshareShoppingList)
-
-		authorized.POST("/recipe", createRecipe)
-		authorized.GET("/recipe/:recipeId", getRecipe)
-		authorized.GET("/recipe/:recipeId/images", getRecipeImages)
-		authorized.GET("recipe/:recipeId/full", getRecipeWithImages)
-		authorized.GET("/recipe/full", getOwnAndSharedRecipesWithImages)
-		authorized.PUT("/recipe/:recipeId", updateRecipe)
-		authorized.DELETE("/recipe/:recipeId", deleteRecipe)
-
-		authorized.POST("recipe/share/:recipeId", createShareRecipe)
-		authorized.DELETE("recipe/share/:recipeId", deleteShareRecipe)
+		authorized.PUT("/users/:userId", s.updateUserinfo)
+		authorized.GET("/users/:userId", s.getUserInfos)
+		authorized.DELETE("/users/:userId", s.DeleteAccount)
+		authorized.PUT("/users/:userId/password", s.changePassword)
+		authorized.GET("/users/:userId/totp", s.getTOTPStatus)
+		authorized.POST("/users/:userId/totp", s.enrollTOTP)        // Returns the secret and provisioning URI
+		authorized.POST("/users/:userId/totp/verify", s.verifyTOTP) // Enables TOTP and returns the recovery codes
+		authorized.DELETE("/users/:userId/totp", s.disableTOTP)
+		authorized.POST("/users/:userId/totp/recovery", s.renewRecoveryCodes)
+
+		authorized.GET("/users/name", s.getMatchingUsers) // Includes search query parameter
+		authorized.GET("/users/blocked", s.getBlockedUsers)
+		authorized.POST("/users/blocked/:userId", s.blockUser)
+		authorized.DELETE("/users/blocked/:userId", s.unblockUser)
+		authorized.GET("/users/sessions", s.getSessions)
+		authorized.DELETE("/users/sessions", s.revokeAllSessions) // Includes keepCurrent parameter
+		authorized.DELETE("/users/sessions/:sessionId", s.revokeSession)
+
+		authorized.POST("/lists", s.createShoppingList)
+		authorized.PUT("/lists/:listId", s.updateShoppingList) // Includes createBy parameter
+		authorized.GET("/lists/:listId", s.getShoppingList)    // Includes search query parameter
+		authorized.GET("/lists", s.getAllShoppingListsForUser)
+		authorized.POST("/lists/sync", s.syncShoppingLists) // Only returns the differences to the given versions
+		authorized.GET("/lists/events", s.streamListEvents) // Server-Sent Events for changes of own and shared lists
+		authorized.DELETE("/lists/:listId", s.deleteShoppingList)
+		authorized.DELETE("/lists", s.deleteAllOwnShoppingLists)
+
+		// Item level operations, all include the createdBy parameter
+		authorized.POST("/lists/:listId/items", s.addItemToList)
+		authorized.PUT("/lists/:listId/items/order", s.reorderItemsInList)
+		authorized.PATCH("/lists/:listId/items/:itemId", s.updateItemInList)
+		authorized.DELETE("/lists/:listId/items/:itemId", s.removeItemFromList)
+
+		authorized.POST("/share/:listId", s.shareShoppingList)
+		authorized.PUT("/share/:listId", s.updateShareShoppingList)
+		authorized.DELETE("/share/:listId", s.unshareShoppingList)
+		authorized.GET("/share/requests/incoming", s.getIncomingShareRequests)
+		authorized.GET("/share/requests/outgoing", s.getOutgoingShareRequests)
+		authorized.POST("/share/requests/:listId", s.acceptShareRequest)    // Includes createdBy parameter
+		authorized.DELETE("/share/requests/:listId", s.declineShareRequest) // Includes createdBy parameter
+
+		authorized.POST("/recipe", s.createRecipe)
+		authorized.GET("/recipe/:recipeId", s.getRecipe)
+		authorized.GET("/recipe/:recipeId/images", s.getRecipeImages)
+		authorized.GET("recipe/:recipeId/full", s.getRecipeWithImages)
+		authorized.GET("/recipe/full", s.getOwnAndSharedRecipesWithImages)
+		authorized.PUT("/recipe/:recipeId", s.updateRecipe)
+		authorized.DELETE("/recipe/:recipeId", s.deleteRecipe)
+
+		authorized.POST("recipe/share/:recipeId", s.createShareRecipe)
+		authorized.DELETE("recipe/share/:recipeId", s.deleteShareRecipe)
+
+		authorized.POST("/households", s.createHousehold)
+		authorized.GET("/households", s.getHouseholds)
+		authorized.GET("/households/invitations", s.getHouseholdInvitations) // Invitations of the requesting user
+		authorized.GET("/households/:householdId", s.getHousehold)
+		authorized.PUT("/households/:householdId", s.renameHousehold)
+		authorized.DELETE("/households/:householdId", s.deleteHousehold)
+		authorized.POST("/households/:householdId/invitations", s.inviteIntoHousehold)
+		authorized.DELETE("/households/:householdId/invitations/:userId", s.deleteHouseholdInvitation)
+		authorized.POST("/households/:householdId/join", s.joinHousehold) // Accepts the invitation
+		authorized.PUT("/households/:householdId/members/:userId", s.updateHouseholdMember)
+		authorized.DELETE("/households/:householdId/members/:userId", s.removeHouseholdMember)
+
+		authorized.POST("/invites", s.createInvite)
+		authorized.GET("/invites", s.getPendingInvites) // Invites created by the requesting user
+		authorized.POST("/invites/redeem", s.redeemInvite)
+		authorized.DELETE("/invites/:inviteId", s.revokeInvite)
 
 		// DEBUG Purpose: TODO: Disable when no longer testing
 		authorized.GET("/ping", pingTest)
@@ -121,19 +254,40 @@ func SetupRouter(db *sql.DB, config configuration.Config) *gin.Engine {
 		authorized.POST("/test/auth", returnPostTest)
 	}
 
-	admin := router.Group("v1/admin")
-	admin.Use(auth.AdminAuthenticationMiddleware())
+	// ------------- Admin routes, every group requires its permission ---------------
+	// The address is limited before the permission check, so that failed keys count as well
+
+	adminUsers := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionUsersRead), s.rateLimit(groupAdmin))
+	{
+		adminUsers.GET("/users", s.getAllUsers)
+	}
+	adminUserDeletion := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionUsersDelete), s.rateLimit(groupAdmin))
+	{
+		adminUserDeletion.DELETE("/users/:userId", s.deleteUser)
+	}
+	adminUnlock := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionUsersUnlock), s.rateLimit(groupAdmin))
+	{
+		adminUnlock.DELETE("/users/:userId/lockout", s.unlockUser)
+	}
+	adminRoles := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionRolesManage), s.rateLimit(groupAdmin))
+	{
+		adminRoles.GET("/roles", s.getRoles)
+		adminRoles.PUT("/users/:userId/role", s.setUserRole)
+	}
+	adminLists := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionListsReadAll), s.rateLimit(groupAdmin))
 	{
-		admin.GET("/users", getAllUsers)
-		admin.GET("/lists", getAllLists)
-		admin.GET("/recipes", getAllRecipes)
+		adminLists.GET("/lists", s.getAllLists)
+	}
+	adminRecipes := router.Group("/v1/admin", s.allowIPs(groupAdmin), s.rateLimitAddress(groupAdmin), auth.RequirePermission(data.PermissionRecipesModerate), s.rateLimit(groupAdmin))
+	{
+		adminRecipes.GET("/recipes", s.getAllRecipes)
+		adminRecipes.DELETE("/recipes/:recipeId", s.moderateRecipe) // Includes createdBy parameter
 	}
 
-	metrics := router.Group("/v1")
-	metrics.Use(auth.AdminAuthWithoutUserMiddleware())
+	// Prometheus metrics endpoint, scrapers without a user send an API key granting the permission
+	metrics := router.Group("/", s.allowIPs(groupMetrics), s.rateLimitAddress(groupMetrics), auth.RequirePermission(data.PermissionMetricsRead), s.rateLimit(groupMetrics))
 	{
-		// Prometheus metrics endpoint, secured by API Key
-		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		metrics.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	}
 
 	router.GET("/test/unauth", returnUnauth)
@@ -141,8 +295,17 @@ func SetupRouter(db *sql.DB, config configuration.Config) *gin.Engine {
 	return router
 }
 
-func Start(db *sql.DB, config configuration.Config) error {
-	router := SetupRouter(db, config)
+func Start(store database.Store, config configuration.Config) error {
+	s := NewServer(store, config)
+	router := s.setupRouter()
+	stopCleanup := s.tokens.StartCleanup()
+	defer stopCleanup()
+	if limiter, ok := s.limiter.(*ratelimit.MemoryLimiter); ok {
+		stopPruning := limiter.StartPruning(ratelimit.DefaultPruneInterval)
+		defer stopPruning()
+	}
+	stopReload := s.reloadIPAccessOnHangup()
+	defer stopReload()
 
 	serverConfig := config.Server
 	tlsConfig := config.TLS
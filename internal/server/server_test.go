@@ -2,22 +2,26 @@ package server_test
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 
@@ -34,80 +38,65 @@ import (
 
 const USERNAME = "testuser"
 const PASSWORD = "password"
-const TESTING_DIR = "testing/resources/"
-const JWT_FILE = "jwt.token"
-const USER_FILE = "user.json"
 
 var cfg = configuration.Config{
-	ListenAddr:     "0.0.0.0",
-	ListenPort:     "46152",
-	Database:       "../../resources/db.json",
-	TLSCertificate: "../../resources/shoppinglist.crt",
-	TLSKeyfile:     "../../resources/shoppinglist.pem",
-	JWTSecretFile:  "../../resources/jwtSecret.json",
-	JWTTimeout:     1200, // 20 minutes; ONLY for testing
+	Server: configuration.ServerConfig{
+		ListenAddr: "0.0.0.0",
+		ListenPort: "46152",
+	},
+	Database: configuration.DatabaseConfig{
+		Driver: configuration.DriverMemory,
+	},
+	TLS: configuration.TLSConfig{
+		DisableTLS: true,
+	},
+	JWT: configuration.AuthConfig{
+		KeyTimeoutMs: 20 * 60 * 1000, // 20 minutes; ONLY for testing
+	},
 }
 
+// The in-memory store is recreated for every test in connectDatabase
+var store database.Store
+
+// The last created test user (with plain password) and its tokens
+var testUser data.User
+var testToken string
+var testRefreshToken string
+
 // ------------------------------------------------------------
-// Testing helper functions
+// Database helper + setup functions
 // ------------------------------------------------------------
 
-func storeUser(user data.User) error {
-	raw, err := json.Marshal(user)
-	if err != nil {
-		return err
-	}
-	if err = os.MkdirAll(TESTING_DIR, 0777); err != nil {
-		return err
-	}
-	if err = os.WriteFile(TESTING_DIR+USER_FILE, raw, 0660); err != nil {
-		return err
-	}
-	return nil
-}
-
-func readUserFile() (data.User, error) {
-	content, err := os.ReadFile(TESTING_DIR + USER_FILE)
+// TestMain configures a signing key, otherwise every router would sign with its own random key
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "server-test")
 	if err != nil {
-		return data.User{}, err
+		log.Fatalf("Failed to create the key directory: %s", err)
 	}
-	var user data.User
-	err = json.Unmarshal(content, &user)
+	_, private, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
-		return data.User{}, err
+		log.Fatalf("Failed to create the signing key: %s", err)
 	}
-	return user, nil
-}
-
-func storeJwtToFile(jwt string) {
-	log.Print("Storing Server token for testing to file")
-	err := os.MkdirAll(TESTING_DIR, 0777)
+	encoded, err := x509.MarshalPKCS8PrivateKey(private)
 	if err != nil {
-		log.Printf("Failed to create directory: %s", err)
-		return
+		log.Fatalf("Failed to encode the signing key: %s", err)
 	}
-	if err := os.WriteFile(TESTING_DIR+JWT_FILE, []byte(jwt), 0660); err != nil {
-		log.Printf("Failed to write Server token to file: %s", err)
+	keyFile := filepath.Join(dir, "signingKey.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: encoded}), 0600); err != nil {
+		log.Fatalf("Failed to write the signing key: %s", err)
 	}
+	cfg.JWT.SigningKeys = []configuration.SigningKeyConfig{{KeyId: "testing", PrivateKeyFile: keyFile}}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
-func readJwtFromFile() (string, error) {
-	if content, err := os.ReadFile(TESTING_DIR + JWT_FILE); err != nil {
-		return "", err
-	} else {
-		return string(content), nil
-	}
-}
-
-// ------------------------------------------------------------
-// Database helper + setup functions
-// ------------------------------------------------------------
-
 func connectDatabase() {
-	cfg := configuration.Config{
-		Database: "../../resources/db.json",
+	newStore, err := database.NewStore(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to create store: %s", err)
 	}
-	database.CheckDatabaseOnline(cfg)
+	store = newStore
 }
 
 func TestSetupTesting(t *testing.T) {
@@ -119,23 +108,24 @@ func TestSetupTesting(t *testing.T) {
 
 func TestShowUsers(t *testing.T) {
 	connectDatabase()
-	// database.PrintUserTable("")
-	database.PrintShoppingListTable()
-	database.PrintItemPerListTable()
-	database.PrintItemTable()
+	memoryStore := store.(*database.MemoryStore)
+	memoryStore.PrintShoppingListTable()
+	memoryStore.PrintItemPerListTable()
+	memoryStore.PrintItemTable()
 }
 
 func TestResetUserDatabase(t *testing.T) {
 	connectDatabase()
-	database.PrintUserTable("")
-	database.DropUserTable()
-	database.PrintUserTable("")
+	CreateTestUser(t)
+	store.DropUserTable()
+	users, err := store.GetAllUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
 }
 
 func CreateTestUser(t *testing.T) {
 	log.Print("Creating test user")
-	connectDatabase()
-	user, err := database.CreateUserAccountInDatabase(USERNAME, PASSWORD)
+	user, err := store.CreateUserAccountInDatabase(USERNAME, PASSWORD)
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		t.FailNow()
@@ -146,31 +136,17 @@ func CreateTestUser(t *testing.T) {
 	}
 	// We get the hash back but need to store the password
 	user.Password = PASSWORD
-	if err = storeUser(user); err != nil {
-		log.Printf("Failed to store user: %s", err)
-		t.FailNow()
-	}
+	testUser = user
 	log.Print("Test user successfully created")
 }
 
 func DeleteTestUser(t *testing.T) {
 	log.Print("Deleting test user")
-	connectDatabase()
-	user, err := readUserFile()
-	if err != nil {
-		log.Print("Cannot delete nil user")
-		t.FailNow()
-	}
-	err = database.DeleteUserAccount(user.OnlineID)
+	err := store.DeleteUserAccount(testUser.OnlineID)
 	if err != nil {
 		log.Printf("Failed to delete user: %s", err)
 		t.FailNow()
 	}
-	err = os.Remove(TESTING_DIR + USER_FILE)
-	if err != nil {
-		log.Printf("Failed to remove user file: %s", err)
-		t.FailNow()
-	}
 	log.Print("User deleted")
 }
 
@@ -179,9 +155,9 @@ func DeleteTestUser(t *testing.T) {
 // ------------------------------------------------------------
 
 func loadUserAndSetupFields(id int64, name string, password string) (io.Reader, error) {
-	user, err := readUserFile()
-	if err != nil {
-		return nil, err
+	user := testUser
+	if user.OnlineID == 0 {
+		return nil, errors.New("no test user created")
 	}
 	if id != 0 {
 		log.Printf("Set id to %d", id)
@@ -203,13 +179,16 @@ func loadUserAndSetupFields(id int64, name string, password string) (io.Reader,
 	return reader, nil
 }
 
+func loginPath(userId int64) string {
+	return fmt.Sprintf("/v1/users/login/%d", userId)
+}
+
 func TestUserCreation(t *testing.T) {
 	log.Print("Testing creating new user")
 	connectDatabase()
 
-	// router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
-	c, r := gin.CreateTestContext(w)
 
 	newUser := data.User{
 		OnlineID: 0,
@@ -222,15 +201,11 @@ func TestUserCreation(t *testing.T) {
 		t.FailNow()
 	}
 	reader := bytes.NewReader(rawUser)
-	authentication.Setup(cfg)
-	r.POST("/v1/users", server.CreateAccount)
-
-	c.Request, _ = http.NewRequest("POST", "/v1/users", reader)
+	req, _ := http.NewRequest("POST", "/v1/users", reader)
 	// Set a custom IP address for the request
-	c.Request.RemoteAddr = "192.168.1.33:41111"
-	c.Request.Header.Set("X-Real-Ip", "192.168.1.33:41111")
-	log.Printf("Client IP: %s", c.ClientIP())
-	r.ServeHTTP(w, c.Request)
+	req.RemoteAddr = "192.168.1.33:41111"
+	req.Header.Set("X-Real-Ip", "192.168.1.33:41111")
+	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
 
@@ -239,7 +214,7 @@ func TestUserCreation(t *testing.T) {
 		log.Printf("Did not receive a user as answer!")
 		t.FailNow()
 	}
-	assert.NotEqual(t, 0, answeredUser.OnlineID)
+	assert.NotEqual(t, int64(0), answeredUser.OnlineID)
 	assert.Equal(t, answeredUser.Username, newUser.Username)
 	assert.Equal(t, "accepted", answeredUser.Password)
 
@@ -251,16 +226,14 @@ func TestUserCreation(t *testing.T) {
 		t.FailNow()
 	}
 	reader = bytes.NewReader(rawUser)
-	r.POST("/auth/login", authentication.Login)
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
-	r.ServeHTTP(w, req)
+	req, _ = http.NewRequest("POST", loginPath(newUser.OnlineID), reader)
+	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
 func login(t *testing.T) {
-	// Expecting an offline user for this test
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
 	reader, err := loadUserAndSetupFields(0, "", "")
@@ -268,24 +241,24 @@ func login(t *testing.T) {
 		log.Printf("Failed to load user: %s", err)
 		t.FailNow()
 	}
-	req, _ := http.NewRequest("POST", "/v1/users/login/", reader)
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var token authentication.Token
-	if json.Unmarshal(w.Body.Bytes(), &token) != nil {
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
 		log.Printf("Failed to decode answer into token! %s", err)
 		t.FailNow()
 	}
-	storeJwtToFile(token.Token)
-	log.Print("Logged in and stored jwt secret to file")
+	testToken = token.Token
+	testRefreshToken = token.RefreshToken
+	log.Print("Logged in and stored jwt token")
 }
 
 func TestLogin(t *testing.T) {
 	log.Print("Testing login function")
 	connectDatabase()
-	// Creating an offline user for this test
 	CreateTestUser(t)
 	login(t)
 	DeleteTestUser(t)
@@ -296,7 +269,7 @@ func TestLoginIncorrectUsername(t *testing.T) {
 	connectDatabase()
 	CreateTestUser(t)
 
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
 	unknownUserName := "not known"
@@ -306,7 +279,7 @@ func TestLoginIncorrectUsername(t *testing.T) {
 		log.Printf("Failed to load and setup user: %s", err)
 		t.FailNow()
 	}
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
@@ -318,7 +291,7 @@ func TestLoginIncorrectPassword(t *testing.T) {
 	connectDatabase()
 	CreateTestUser(t)
 
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
 	unknownPassword := "empty"
@@ -327,7 +300,7 @@ func TestLoginIncorrectPassword(t *testing.T) {
 		log.Printf("Failed to load and setup user: %s", err)
 		t.FailNow()
 	}
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
@@ -335,35 +308,76 @@ func TestLoginIncorrectPassword(t *testing.T) {
 }
 
 func TestLoginIncorrectId(t *testing.T) {
-	log.Print("Testing login with wrong password")
+	log.Print("Testing login with wrong id")
 	connectDatabase()
 	CreateTestUser(t)
 
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
-	unknownUserId := 12345
-	reader, err := loadUserAndSetupFields(int64(unknownUserId), "", "")
+	unknownUserId := int64(12345)
+	reader, err := loadUserAndSetupFields(unknownUserId, "", "")
 	if err != nil {
 		log.Printf("Failed to load and setup user: %s", err)
 		t.FailNow()
 	}
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
+	req, _ := http.NewRequest("POST", loginPath(unknownUserId), reader)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 	DeleteTestUser(t)
 }
 
+func refreshToken(t *testing.T, refreshToken string) (authentication.Token, int) {
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	raw, err := json.Marshal(authentication.RefreshRequest{RefreshToken: refreshToken})
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("POST", "/v1/users/refresh", bytes.NewReader(raw))
+	router.ServeHTTP(w, req)
+	var token authentication.Token
+	if w.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &token))
+	}
+	return token, w.Code
+}
+
+func TestRefreshToken(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+	assert.NotEqual(t, "", testRefreshToken)
+
+	token, code := refreshToken(t, testRefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, "", token.Token)
+	assert.NotEqual(t, testRefreshToken, token.RefreshToken)
+	testToken = token.Token
+	assert.Equal(t, 0, len(getAllLists(t)))
+
+	// Reusing the replaced token revokes the rotated token as well
+	_, code = refreshToken(t, testRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	_, code = refreshToken(t, token.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	_, code = refreshToken(t, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// A new login starts a new family
+	login(t)
+	_, code = refreshToken(t, testRefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+}
+
 func TestAuthenticationTimeoutedToken(t *testing.T) {
 	log.Print("Testing login with token that timed out")
 	connectDatabase()
 	CreateTestUser(t)
 
 	testConfiguration := cfg
-	testConfiguration.JWTTimeout = 1
+	testConfiguration.JWT.KeyTimeoutMs = 1000
 
-	router := server.SetupRouter(testConfiguration)
+	router := server.SetupRouter(store, testConfiguration)
 	w := httptest.NewRecorder()
 
 	reader, err := loadUserAndSetupFields(0, "", "")
@@ -371,39 +385,20 @@ func TestAuthenticationTimeoutedToken(t *testing.T) {
 		log.Printf("Failed to load and setup user: %s", err)
 		t.FailNow()
 	}
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), reader)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var token authentication.Token
-	if json.Unmarshal(w.Body.Bytes(), &token) != nil {
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
 		log.Printf("Failed to decode answer into token! %s", err)
 		t.FailNow()
 	}
 
-	tkn, err := jwt.Parse(token.Token, func(t *jwt.Token) (interface{}, error) {
-		_, ok := t.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, errors.New("unauthorized")
-		}
-		pwd, _ := os.Getwd()
-		finalJWTFile := filepath.Join(pwd, cfg.JWTSecretFile)
-		data, err := os.ReadFile(finalJWTFile)
-		if err != nil {
-			log.Print("Failed to find Server secret file")
-			return nil, err
-		}
-		var jwtSecret authentication.JWTSecretFile
-		err = json.Unmarshal(data, &jwtSecret)
-		if err != nil {
-			log.Print("Server secret file is in incorrect format")
-			return nil, err
-		}
-		log.Print("Parsed and loaded Server secret file")
-		secretByteKey := []byte(jwtSecret.Secret)
-		return secretByteKey, nil
-	})
+	keys, err := authentication.LoadKeySet(cfg.JWT.SigningKeys)
+	assert.Nil(t, err)
+	tkn, err := jwt.Parse(token.Token, keys.Keyfunc)
 	if err != nil {
 		log.Printf("Failed to parse token: %s", err)
 		t.FailNow()
@@ -415,7 +410,7 @@ func TestAuthenticationTimeoutedToken(t *testing.T) {
 
 	w = httptest.NewRecorder()
 	// Adding the authentication token
-	req, _ = http.NewRequest("GET", "/v1/test/auth", reader)
+	req, _ = http.NewRequest("GET", "/v1/test/auth", nil)
 	bearer := "Bearer " + token.Token
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
@@ -424,52 +419,36 @@ func TestAuthenticationTimeoutedToken(t *testing.T) {
 	DeleteTestUser(t)
 }
 
+// signOwnToken signs the claims with a secret instead of the keys of the server
+func signOwnToken(t *testing.T, claims authentication.Claims) string {
+	ownToken := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	signedToken, err := ownToken.SignedString([]byte("testing secret"))
+	if err != nil {
+		log.Printf("Failed to sign token: %s", err)
+		t.FailNow()
+	}
+	return signedToken
+}
+
 func TestAuthentcationWrongTokenSignature(t *testing.T) {
 	log.Print("Testing login with token that is invalid (wrong signature) wrong username, wrong id)")
 	connectDatabase()
 	CreateTestUser(t)
 
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Failed to read user: %s", err)
-		t.FailNow()
-	}
-
 	expirationTime := time.Now().Add(1 * time.Minute)
 	wrongUsername := authentication.Claims{
-		Id:       int(user.OnlineID),
-		Username: user.Username + "invalid",
+		Id:       testUser.OnlineID,
+		Username: testUser.Username + "invalid",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	ownToken := jwt.NewWithClaims(jwt.SigningMethodHS512, wrongUsername)
-	content, err := os.ReadFile(cfg.JWTSecretFile)
-	if err != nil {
-		log.Printf("Cannot read token secret file! %s", err)
-		t.FailNow()
-	}
-	var jwtSecretFile authentication.JWTSecretFile
-	err = json.Unmarshal(content, &jwtSecretFile)
-	if err != nil {
-		log.Printf("The given jwt secret file is in incorrect format! %s", err)
-		t.FailNow()
-	}
-	signedToken, err := ownToken.SignedString([]byte(jwtSecretFile.Secret))
-	if err != nil {
-		log.Printf("Failed to sign token: %s", err)
-		t.FailNow()
-	}
+	signedToken := signOwnToken(t, wrongUsername)
 
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
-	reader, err := loadUserAndSetupFields(0, "", "")
-	if err != nil {
-		log.Printf("Failed to load and setup user: %s", err)
-		t.FailNow()
-	}
-	req, _ := http.NewRequest("GET", "/v1/test/auth", reader)
+	req, _ := http.NewRequest("GET", "/v1/test/auth", nil)
 	bearer := "Bearer " + signedToken
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
@@ -482,30 +461,16 @@ func TestAuthenticationModifiedToken(t *testing.T) {
 	log.Print("Testing login with token that was modified")
 	connectDatabase()
 	CreateTestUser(t)
+	login(t)
 
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-
-	reader, err := loadUserAndSetupFields(0, "", "")
-	if err != nil {
-		log.Printf("Failed to load and setup user: %s", err)
-		t.FailNow()
-	}
-	req, _ := http.NewRequest("POST", "/auth/login", reader)
-	router.ServeHTTP(w, req)
+	router := server.SetupRouter(store, cfg)
 
-	var token authentication.Token
-	if json.Unmarshal(w.Body.Bytes(), &token) != nil {
-		log.Printf("Failed to decode answer into token! %s", err)
-		t.FailNow()
-	}
-	// log.Printf("Answered Token: %s", token.Token)
 	// Modify the token
-	modifiedToken := strings.ReplaceAll(token.Token, "U", "u")
+	modifiedToken := strings.ReplaceAll(testToken, "U", "u")
 
-	w = httptest.NewRecorder()
+	w := httptest.NewRecorder()
 	// Adding the authentication token
-	req, _ = http.NewRequest("GET", "/v1/test/auth", reader)
+	req, _ := http.NewRequest("GET", "/v1/test/auth", nil)
 	bearer := "Bearer " + modifiedToken
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
@@ -519,47 +484,20 @@ func TestUnissuedToken(t *testing.T) {
 	connectDatabase()
 	CreateTestUser(t)
 
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Failed to read user: %s", err)
-		t.FailNow()
-	}
-
 	expirationTime := time.Now().Add(1 * time.Minute)
 	userToken := authentication.Claims{
-		Id:       int(user.OnlineID),
-		Username: user.Username,
+		Id:       testUser.OnlineID,
+		Username: testUser.Username,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	ownToken := jwt.NewWithClaims(jwt.SigningMethodHS512, userToken)
-	content, err := os.ReadFile(cfg.JWTSecretFile)
-	if err != nil {
-		log.Printf("Cannot read token secret file! %s", err)
-		t.FailNow()
-	}
-	var jwtSecretFile authentication.JWTSecretFile
-	err = json.Unmarshal(content, &jwtSecretFile)
-	if err != nil {
-		log.Printf("The given jwt secret file is in incorrect format! %s", err)
-		t.FailNow()
-	}
-	signedToken, err := ownToken.SignedString([]byte(jwtSecretFile.Secret))
-	if err != nil {
-		log.Printf("Failed to sign token: %s", err)
-		t.FailNow()
-	}
+	signedToken := signOwnToken(t, userToken)
 
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
-	reader, err := loadUserAndSetupFields(0, "", "")
-	if err != nil {
-		log.Printf("Failed to load and setup user: %s", err)
-		t.FailNow()
-	}
-	req, _ := http.NewRequest("GET", "/v1/test/auth", reader)
+	req, _ := http.NewRequest("GET", "/v1/test/auth", nil)
 	bearer := "Bearer " + signedToken
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
@@ -568,25 +506,66 @@ func TestUnissuedToken(t *testing.T) {
 	DeleteTestUser(t)
 }
 
+func TestJWKS(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var jwks authentication.JSONWebKeySet
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	if !assert.Equal(t, 1, len(jwks.Keys)) {
+		return
+	}
+
+	// The published key verifies the issued tokens
+	key := jwks.Keys[0]
+	assert.Equal(t, "OKP", key.KeyType)
+	assert.Equal(t, "EdDSA", key.Algorithm)
+	public, err := base64.RawURLEncoding.DecodeString(key.X)
+	assert.Nil(t, err)
+	token, err := jwt.Parse(testToken, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, key.KeyId, token.Header["kid"])
+		return ed25519.PublicKey(public), nil
+	}, jwt.WithValidMethods([]string{key.Algorithm}))
+	assert.Nil(t, err)
+	assert.True(t, token.Valid)
+	DeleteTestUser(t)
+}
+
 // ------------------------------------------------------------
 // Testing the list methods
 // ------------------------------------------------------------
 
+// Increasing list ids keep the order of the lists returned by the API predictable
+var lastListId atomic.Int64
+
+func nextListId() int64 {
+	return lastListId.Add(1)
+}
+
 func createListOffline(name string, userId int64, items []data.ItemWire) (data.List, error) {
 	creator := data.ListCreator{
 		ID:   userId,
 		Name: USERNAME,
 	}
+	for i := range items {
+		items[i].AddedBy = userId
+	}
 	timeNow := time.Now().UTC()
 	list := data.List{
-		ListId:      rand.Int63(),
+		ListId:      nextListId(),
 		Title:       name,
 		CreatedBy:   creator,
 		CreatedAt:   timeNow,
 		LastUpdated: timeNow,
 		Items:       items,
 	}
-	err := database.CreateOrUpdateShoppingList(list)
+	err := store.CreateOrUpdateShoppingList(list)
 	if err != nil {
 		return data.List{}, err
 	}
@@ -611,7 +590,7 @@ func createItemsWire(name string, numberOfItems int) []data.ItemWire {
 }
 
 func createListSharing(listId int64, createdBy int64, userId int64) (data.ListShared, error) {
-	sharing, err := database.CreateOrUpdateSharedList(listId, createdBy, userId)
+	sharing, err := store.CreateOrUpdateSharedList(listId, createdBy, userId, data.PermissionEditor)
 	if err != nil {
 		return data.ListShared{}, err
 	}
@@ -621,30 +600,15 @@ func createListSharing(listId int64, createdBy int64, userId int64) (data.ListSh
 	return sharing, nil
 }
 
-func TestCreatingList(t *testing.T) {
-	log.Print("Testing creating list")
-	connectDatabase()
-	CreateTestUser(t)
-	login(t)
-
-	// Creating with default configuration
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Failed to read user from file: %s", err)
-		t.FailNow()
-	}
-	listName := "test list"
+func createTestList(user data.User) data.List {
 	creator := data.ListCreator{
 		ID:   user.OnlineID,
 		Name: user.Username,
 	}
 	timeNow := time.Now().UTC()
-	list := data.List{
-		ListId:      rand.Int63(),
-		Title:       listName,
+	return data.List{
+		ListId:      nextListId(),
+		Title:       "test list",
 		CreatedBy:   creator,
 		CreatedAt:   timeNow,
 		LastUpdated: timeNow,
@@ -654,34 +618,116 @@ func TestCreatingList(t *testing.T) {
 				Icon:     "ic_item",
 				Quantity: 1,
 				Checked:  false,
+				AddedBy:  user.OnlineID,
 			},
 		},
 	}
+}
+
+func TestCreatingList(t *testing.T) {
+	log.Print("Testing creating list")
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+
+	// Creating with default configuration
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+
+	list := createTestList(testUser)
 	jsonList, err := json.Marshal(list)
 	if err != nil {
 		log.Printf("Failed to encode list. Error in test")
 		t.FailNow()
 	}
 	reader := bytes.NewReader(jsonList)
-	// Load authentication token
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	req, _ := http.NewRequest("POST", "/v1/list", reader)
+	bearer := "Bearer " + testToken
+	req, _ := http.NewRequest("POST", "/v1/lists", reader)
 	// Adding the authentication
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusCreated, w.Code)
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
-	database.ResetItemTable()
-	database.ResetItemPerListTable()
-	// Should already delete all mappings
+	items, err := store.GetItemsInList(list.ListId, list.CreatedBy.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+
+	// Should already delete all lists and mappings
+	DeleteTestUser(t)
+	_, err = store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	assert.NotNil(t, err)
+}
+
+func TestCreatingListWithInvalidItems(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+
+	list := createTestList(testUser)
+	list.Items = append(list.Items, data.ItemWire{Name: "", Quantity: 1, AddedBy: testUser.OnlineID})
+	jsonList, err := json.Marshal(list)
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("POST", "/v1/lists", bytes.NewReader(jsonList))
+	req.Header.Add("Authorization", "Bearer "+testToken)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var itemsErr database.ItemsError
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &itemsErr))
+	assert.Equal(t, 1, len(itemsErr.Failures))
+	assert.Equal(t, len(list.Items)-1, itemsErr.Failures[0].Index)
+
+	// The list must not have been created at all
+	_, err = store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	assert.NotNil(t, err)
+	DeleteTestUser(t)
+}
+
+func TestMergingConcurrentListUpdate(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	login(t)
+	router := server.SetupRouter(store, cfg)
+
+	list := createTestList(testUser)
+	assert.Nil(t, store.CreateOrUpdateShoppingList(list))
+	concurrent := list
+	concurrent.Version++
+	concurrent.Items = []data.ItemWire{{Name: "Item", Quantity: 5, AddedBy: testUser.OnlineID}}
+	assert.Nil(t, store.CreateOrUpdateShoppingList(concurrent))
+
+	outdated := list
+	outdated.Version++
+	outdated.Items = append(outdated.Items, data.ItemWire{Name: "Second", Quantity: 1, AddedBy: testUser.OnlineID})
+	sendUpdate := func(path string) *httptest.ResponseRecorder {
+		jsonList, err := json.Marshal(outdated)
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", path, bytes.NewReader(jsonList))
+		req.Header.Add("Authorization", "Bearer "+testToken)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// Without merging the outdated version is rejected
+	w := sendUpdate(fmt.Sprintf("/v1/lists/%d", list.ListId))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendUpdate(fmt.Sprintf("/v1/lists/%d?merge=true", list.ListId))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result data.ListMergeResult
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, concurrent.Version+1, result.List.Version)
+	assert.Equal(t, 2, len(result.List.Items))
+	// The quantity was changed later on the server
+	assert.Equal(t, int64(5), result.List.Items[0].Quantity)
+	assert.Equal(t, "Second", result.List.Items[1].Name)
+	assert.Equal(t, 1, len(result.Conflicts))
+	assert.Equal(t, data.ConflictFieldQuantity, result.Conflicts[0].Field)
+	assert.Equal(t, data.ResolutionServer, result.Conflicts[0].Resolution)
 	DeleteTestUser(t)
 }
 
@@ -689,16 +735,30 @@ func roundTime(t time.Time) time.Time {
 	return t.Round(time.Duration(time.Second))
 }
 
+func getAllLists(t *testing.T) []data.List {
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	bearer := "Bearer " + testToken
+	req, _ := http.NewRequest("GET", "/v1/lists", nil)
+	// Adding the authentication
+	req.Header.Add("Authorization", bearer)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var allLists []data.List
+	if err := json.Unmarshal(w.Body.Bytes(), &allLists); err != nil {
+		log.Printf("Failed to parse server answer. Expected lists JSON: %s", err)
+		t.FailNow()
+	}
+	return allLists
+}
+
 func TestGetAllOwnLists(t *testing.T) {
 	log.Print("Testing if all own lists can be obtained")
 	connectDatabase()
 	CreateTestUser(t)
-
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	user := testUser
 
 	// Add two lists for our user behind the curtains
 	var offlineList []data.List
@@ -713,26 +773,7 @@ func TestGetAllOwnLists(t *testing.T) {
 
 	// Now trying if we can get both lists via the API
 	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/lists/%d", user.OnlineID), nil)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	var allOwnLists []data.List
-	if json.Unmarshal(w.Body.Bytes(), &allOwnLists) != nil {
-		log.Printf("Failed to parse server answer. Expected lists JSON: %s", err)
-		t.FailNow()
-	}
+	allOwnLists := getAllLists(t)
 
 	assert.Equal(t, 2, len(allOwnLists))
 	for i := 0; i < 2; i++ {
@@ -744,56 +785,42 @@ func TestGetAllOwnLists(t *testing.T) {
 		assert.Equal(t, offlineList[i].ListId, allOwnLists[i].ListId)
 	}
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
 	DeleteTestUser(t)
 }
 
-func TestGetAllLists(t *testing.T) {
-	log.Print("Testing if all lists can be obtained")
-	connectDatabase()
-
-	CreateTestUser(t)
-	sharedByUser1, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+func createSharedListsForTest(t *testing.T, withItems bool) []data.List {
 	CreateTestUser(t)
-	sharedByUser2, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	sharedByUser := testUser
 
 	CreateTestUser(t)
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	user := testUser
 
 	// Creating two own lists
 	var offlineList []data.List
 	for i := 0; i < 2; i++ {
-		if list, err := createListOffline("own list "+strconv.Itoa(i+1), user.OnlineID, []data.ItemWire{}); err != nil {
+		items := []data.ItemWire{}
+		if withItems {
+			items = createItemsWire("Item", i+1)
+		}
+		if list, err := createListOffline("own list "+strconv.Itoa(i+1), user.OnlineID, items); err != nil {
 			log.Printf("Failed to create list: %s", err)
 			t.FailNow()
 		} else {
 			offlineList = append(offlineList, list)
 		}
 	}
-	// Creating two shared lists from two different IDs
+	// Creating two shared lists from another user
 	for i := 0; i < 2; i++ {
-		sharedByUser := sharedByUser1
-		if i > 1 {
-			sharedByUser = sharedByUser2
+		items := []data.ItemWire{}
+		if withItems {
+			items = createItemsWire("Shared Item", i+1)
 		}
-		list, err := createListOffline("shared list from "+strconv.Itoa(i+1), sharedByUser.OnlineID, []data.ItemWire{})
+		list, err := createListOffline("shared list from "+strconv.Itoa(i+1), sharedByUser.OnlineID, items)
 		if err != nil {
 			log.Printf("Failed to created shared list: %s", err)
 			t.FailNow()
 		}
+		list.CreatedBy.Name = sharedByUser.Username
 		offlineList = append(offlineList, list)
 		// Create the sharing
 		if _, err = createListSharing(list.ListId, list.CreatedBy.ID, user.OnlineID); err != nil {
@@ -801,29 +828,17 @@ func TestGetAllLists(t *testing.T) {
 			t.FailNow()
 		}
 	}
+	return offlineList
+}
 
-	// Now trying if we can get both lists via the API
-	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/lists/%d", user.OnlineID), nil)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
+func TestGetAllLists(t *testing.T) {
+	log.Print("Testing if all lists can be obtained")
+	connectDatabase()
+	offlineList := createSharedListsForTest(t, false)
 
-	var allLists []data.List
-	if json.Unmarshal(w.Body.Bytes(), &allLists) != nil {
-		log.Printf("Failed to parse server answer. Expected lists JSON: %s", err)
-		t.FailNow()
-	}
+	// Now trying if we can get all lists via the API
+	login(t)
+	allLists := getAllLists(t)
 
 	assert.Equal(t, 4, len(allLists))
 	for i := 0; i < 4; i++ {
@@ -834,88 +849,17 @@ func TestGetAllLists(t *testing.T) {
 		assert.Equal(t, offlineList[i].ListId, allLists[i].ListId)
 	}
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
-	database.ResetSharedListTable()
 	DeleteTestUser(t)
 }
 
 func TestGetAllListsWithItems(t *testing.T) {
-	log.Print("Testing if all lists can be obtained")
+	log.Print("Testing if all lists with items can be obtained")
 	connectDatabase()
+	offlineList := createSharedListsForTest(t, true)
 
-	CreateTestUser(t)
-	sharedByUser1, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
-	CreateTestUser(t)
-	sharedByUser2, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
-
-	CreateTestUser(t)
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
-
-	// Creating two own lists
-	var offlineList []data.List
-	for i := 0; i < 2; i++ {
-		items := createItemsWire("Item", i+1)
-		if list, err := createListOffline("own list "+strconv.Itoa(i+1), user.OnlineID, items); err != nil {
-			log.Printf("Failed to create list: %s", err)
-			t.FailNow()
-		} else {
-			offlineList = append(offlineList, list)
-		}
-	}
-	// Creating two shared lists from two different IDs
-	for i := 0; i < 2; i++ {
-		sharedByUser := sharedByUser1
-		if i > 1 {
-			sharedByUser = sharedByUser2
-		}
-		items := createItemsWire("Shared Item", i+1)
-		list, err := createListOffline("shared list from "+strconv.Itoa(i+1), sharedByUser.OnlineID, items)
-		if err != nil {
-			log.Printf("Failed to created shared list: %s", err)
-			t.FailNow()
-		}
-		offlineList = append(offlineList, list)
-		// Create the sharing
-		if _, err = createListSharing(list.ListId, list.CreatedBy.ID, user.OnlineID); err != nil {
-			log.Printf("Failed to create sharing: %s", err)
-			t.FailNow()
-		}
-	}
-	// Now trying if we can get both lists via the API
+	// Now trying if we can get all lists via the API
 	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	req, _ := http.NewRequest("GET", fmt.Sprintf("/v1/lists/%d", user.OnlineID), nil)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	var allLists []data.List
-	if json.Unmarshal(w.Body.Bytes(), &allLists) != nil {
-		log.Printf("Failed to parse server answer. Expected lists JSON: %s", err)
-		t.FailNow()
-	}
+	allLists := getAllLists(t)
 
 	assert.Equal(t, 4, len(allLists))
 	for i := 0; i < 4; i++ {
@@ -924,70 +868,39 @@ func TestGetAllListsWithItems(t *testing.T) {
 		assert.Equal(t, roundTime(offlineList[i].CreatedAt).Format(time.RFC3339), roundTime(allLists[i].CreatedAt).Format(time.RFC3339))
 		assert.Equal(t, offlineList[i].Title, allLists[i].Title)
 		assert.Equal(t, offlineList[i].ListId, allLists[i].ListId)
+		// The server assigns the itemIds used by the item level API and the edit times
+		for j := range allLists[i].Items {
+			assert.NotZero(t, allLists[i].Items[j].ItemId)
+			assert.NotNil(t, allLists[i].Items[j].Updated)
+			allLists[i].Items[j].ItemId = 0
+			allLists[i].Items[j].Updated = nil
+		}
 		assert.Equal(t, offlineList[i].Items, allLists[i].Items)
 		log.Printf("All Lists: %v", allLists[i].Items)
 	}
 
-	database.PrintShoppingListTable()
-	database.PrintItemTable()
-	database.PrintItemPerListTable()
-	database.DropShoppingListTable()
-	database.ResetSharedListTable()
-	database.ResetItemPerListTable()
-	database.ResetItemTable()
 	DeleteTestUser(t)
 }
 
 func TestRemoveList(t *testing.T) {
-	log.Print("Testing if all lists can be removed")
+	log.Print("Testing if lists can be removed")
 	connectDatabase()
 	CreateTestUser(t)
 	login(t)
 
 	// Creating with default configuration
-	router := server.SetupRouter(cfg)
+	router := server.SetupRouter(store, cfg)
 	w := httptest.NewRecorder()
 
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
-	listName := "test list"
-	creator := data.ListCreator{
-		ID:   user.OnlineID,
-		Name: user.Username,
-	}
-	timeNow := time.Now().UTC()
-	list := data.List{
-		ListId:      rand.Int63(),
-		Title:       listName,
-		CreatedBy:   creator,
-		CreatedAt:   timeNow,
-		LastUpdated: timeNow,
-		Items: []data.ItemWire{
-			{
-				Name:     "Item",
-				Icon:     "ic_item",
-				Quantity: 1,
-				Checked:  false,
-			},
-		},
-	}
+	list := createTestList(testUser)
 	jsonList, err := json.Marshal(list)
 	if err != nil {
 		log.Printf("Failed to encode list. Error in test")
 		t.FailNow()
 	}
 	reader := bytes.NewReader(jsonList)
-	// Load authentication token
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	req, _ := http.NewRequest("POST", "/v1/list", reader)
+	bearer := "Bearer " + testToken
+	req, _ := http.NewRequest("POST", "/v1/lists", reader)
 	// Adding the authentication
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
@@ -996,39 +909,63 @@ func TestRemoveList(t *testing.T) {
 
 	// Now delete this list
 	w = httptest.NewRecorder()
-	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/v1/list/%d", list.ListId), nil)
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/v1/lists/%d", list.ListId), nil)
 	req.Header.Add("Authorization", bearer)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	// Check if the list was really deleted
-	_, err = database.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	_, err = store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
 	assert.NotNil(t, err)
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
-	database.ResetItemTable()
-	database.ResetItemPerListTable()
 	DeleteTestUser(t)
 }
 
-func TestCreateSharingWithoutSharedUser(t *testing.T) {
-	log.Print("Testing if all lists can be obtained")
-	connectDatabase()
-	CreateTestUser(t)
-
-	user, err := readUserFile()
+func shareList(t *testing.T, listId int64, sharedWith int64) int {
+	router := server.SetupRouter(store, cfg)
+	w := httptest.NewRecorder()
+	bearer := "Bearer " + testToken
+	shared := data.ListSharedWire{
+		SharedBy:   testUser.OnlineID,
+		SharedWith: []int64{sharedWith},
+		Created:    time.Now().UTC(),
+	}
+	encodedShared, err := json.Marshal(shared)
 	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
+		log.Printf("Failed to encoded data: %s", err)
 		t.FailNow()
 	}
+	reader := bytes.NewReader(encodedShared)
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/share/%d", listId), reader)
+	// Adding the authentication
+	req.Header.Add("Authorization", bearer)
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func sendJSONRequest(t *testing.T, method string, path string, token string, body any) *httptest.ResponseRecorder {
+	encoded, err := json.Marshal(body)
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewReader(encoded))
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateSharingWithoutSharedUser(t *testing.T) {
+	log.Print("Testing sharing with a user that does not exist")
+	connectDatabase()
+	CreateTestUser(t)
 
 	// Creating two own lists and share one with a random user
-	sharedWithUserId := 12345
+	sharedWithUserId := int64(12345)
 	var offlineList []data.List
 	for i := 0; i < 2; i++ {
-		list, err := createListOffline("own list "+strconv.Itoa(i+1), user.OnlineID, []data.ItemWire{})
+		list, err := createListOffline("own list "+strconv.Itoa(i+1), testUser.OnlineID, []data.ItemWire{})
 		if err != nil {
 			log.Printf("Failed to create list: %s", err)
 			t.FailNow()
@@ -1037,64 +974,26 @@ func TestCreateSharingWithoutSharedUser(t *testing.T) {
 		}
 	}
 
-	// Now trying if we can get both lists via the API
 	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	sharedWith := data.ListShared{
-		ListId:       offlineList[0].ListId,
-		CreatedBy:    user.OnlineID,
-		SharedWithId: int64(sharedWithUserId),
-		Created:      time.Now().UTC(),
-	}
-	encodedShared, err := json.Marshal(sharedWith)
-	if err != nil {
-		log.Printf("Failed to encoded data: %s", err)
-		t.FailNow()
-	}
-	reader := bytes.NewReader(encodedShared)
-	req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/share/%d", offlineList[0].ListId), reader)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
+	code := shareList(t, offlineList[0].ListId, sharedWithUserId)
 
 	// we did not create the shared with user and expect this to fail therefore
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusBadRequest, code)
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
-	database.ResetSharedListTable()
-	database.ResetItemPerListTable()
-	database.ResetItemTable()
 	DeleteTestUser(t)
 }
 
 func TestCreateSharing(t *testing.T) {
-	log.Print("Testing if all lists can be obtained")
+	log.Print("Testing sharing a list")
 	connectDatabase()
 
 	CreateTestUser(t)
-	sharedWithUser, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	sharedWithUser := testUser
 
 	CreateTestUser(t)
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	user := testUser
 
-	// Creating two own lists and share one with a random user
-	sharedWithUserId := sharedWithUser.OnlineID
+	// Creating two own lists and share one with another user
 	var offlineList []data.List
 	for i := 0; i < 2; i++ {
 		list, err := createListOffline("own list "+strconv.Itoa(i+1), user.OnlineID, []data.ItemWire{})
@@ -1106,99 +1005,129 @@ func TestCreateSharing(t *testing.T) {
 		}
 	}
 
-	// Now trying if we can get both lists via the API
 	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
+	code := shareList(t, offlineList[0].ListId, sharedWithUser.OnlineID)
+
+	assert.Equal(t, http.StatusCreated, code)
+	// The list is only shared once the recipient accepts the request
+	assert.NotNil(t, store.IsListSharedWithUser(offlineList[0].ListId, user.OnlineID, sharedWithUser.OnlineID))
+	assert.Nil(t, store.AcceptShareRequest(offlineList[0].ListId, user.OnlineID, sharedWithUser.OnlineID))
+
 	sharedWith := data.ListShared{
 		ListId:       offlineList[0].ListId,
 		CreatedBy:    user.OnlineID,
-		SharedWithId: sharedWithUserId,
-		Created:      time.Now().UTC(),
+		SharedWithId: sharedWithUser.OnlineID,
 	}
-	encodedShared, err := json.Marshal(sharedWith)
-	if err != nil {
-		log.Printf("Failed to encoded data: %s", err)
-		t.FailNow()
-	}
-	reader := bytes.NewReader(encodedShared)
-	req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/share/%d", offlineList[0].ListId), reader)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusCreated, w.Code)
-
 	sharedListIds := make([]data.ListShared, 0)
 	sharedListIds = append(sharedListIds, sharedWith)
-	sharedDb, err := database.GetShoppingListsFromSharedListIds(sharedListIds)
+	sharedDb, err := store.GetShoppingListsFromSharedListIds(sharedListIds)
 
 	assert.Equal(t, nil, err)
 	assert.Equal(t, 1, len(sharedDb))
 	assert.Equal(t, sharedWith.ListId, sharedDb[0].ListId)
-	assert.Equal(t, sharedWith.SharedWithId, sharedListIds[0].SharedWithId)
+	assert.Nil(t, store.IsListSharedWithUser(sharedWith.ListId, sharedWith.CreatedBy, sharedWith.SharedWithId))
 
-	database.PrintShoppingListTable()
-	database.DropShoppingListTable()
-	database.ResetSharedListTable()
 	DeleteTestUser(t)
 }
 
 func TestCreateSharingOfUnownedList(t *testing.T) {
-	log.Print("Testing if all lists can be obtained")
+	log.Print("Testing sharing a list that is not owned")
 	connectDatabase()
-	CreateTestUser(t)
 
-	user, err := readUserFile()
-	if err != nil {
-		log.Printf("Cannot read user file: %s", err)
-		t.FailNow()
-	}
+	CreateTestUser(t)
+	owner := testUser
 
 	// Creating a list that WE DO NOT OWN
-	list, err := createListOffline("unowned list 1", user.OnlineID+1, []data.ItemWire{})
+	list, err := createListOffline("unowned list 1", owner.OnlineID, []data.ItemWire{})
 	if err != nil {
 		log.Printf("Failed to create list: %s", err)
 		t.FailNow()
 	}
 
-	// Now trying if we can share the list via the API
+	CreateTestUser(t)
 	login(t)
-	router := server.SetupRouter(cfg)
-	w := httptest.NewRecorder()
-	token, err := readJwtFromFile()
-	if err != nil {
-		log.Printf("Failed to read Server file: %s", err)
-		t.FailNow()
-	}
-	bearer := "Bearer " + token
-	sharedWithUserId := 1234
-	sharedWith := data.ListShared{
-		ListId:       list.ListId,
-		CreatedBy:    user.OnlineID,
-		SharedWithId: int64(sharedWithUserId),
-		Created:      time.Now().UTC(),
-	}
-	encodedShared, err := json.Marshal(sharedWith)
+	code := shareList(t, list.ListId, owner.OnlineID)
+
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	err = store.IsListSharedWithUser(list.ListId, owner.OnlineID, owner.OnlineID)
+	assert.NotNil(t, err)
+}
+
+func TestSharePermissions(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("owner", "password")
+	assert.Nil(t, err)
+	thirdUser, err := store.CreateUserAccountInDatabase("third", "password")
+	assert.Nil(t, err)
+	list, err := createListOffline("permission list", owner.OnlineID, createItemsWire("Item", 2))
 	if err != nil {
-		log.Printf("Failed to encoded data: %s", err)
-		t.FailNow()
+		t.Fatalf("Failed to create list: %s", err)
 	}
-	reader := bytes.NewReader(encodedShared)
-	req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/share/%d", list.ListId), reader)
-	// Adding the authentication
-	req.Header.Add("Authorization", bearer)
-	router.ServeHTTP(w, req)
+	items, err := store.GetItemsInList(list.ListId, owner.OnlineID)
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	sendRequest := func(method string, path string, body any) int {
+		encoded, err := json.Marshal(body)
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(encoded))
+		req.Header.Add("Authorization", "Bearer "+testToken)
+		server.SetupRouter(store, cfg).ServeHTTP(w, req)
+		return w.Code
+	}
+	setPermission := func(permission string) {
+		_, err := store.CreateOrUpdateSharedList(list.ListId, owner.OnlineID, testUser.OnlineID, permission)
+		assert.Nil(t, err)
+	}
+	listPath := fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, owner.OnlineID)
+	itemPath := fmt.Sprintf("/v1/lists/%d/items/%d?createdBy=%d", list.ListId, items[0].ItemId, owner.OnlineID)
+	checked := !items[0].Checked
+	quantity := int64(10)
+	onlyChecked := list
+	onlyChecked.Items = append([]data.ItemWire{}, list.Items...)
+	onlyChecked.Items[0].Checked = checked
+	quantityChanged := list
+	quantityChanged.Items = append([]data.ItemWire{}, list.Items...)
+	quantityChanged.Items[0].Quantity = quantity
+
+	setPermission(data.PermissionViewer)
+	onlyChecked.Version = list.Version + 1
+	assert.Equal(t, http.StatusForbidden, sendRequest("PUT", listPath, onlyChecked))
+	assert.Equal(t, http.StatusForbidden, sendRequest("PATCH", itemPath, data.ListItemPatch{Checked: &checked}))
+
+	setPermission(data.PermissionChecker)
+	assert.Equal(t, http.StatusOK, sendRequest("PATCH", itemPath, data.ListItemPatch{Checked: &checked}))
+	assert.Equal(t, http.StatusForbidden, sendRequest("PATCH", itemPath, data.ListItemPatch{Quantity: &quantity}))
+	assert.Equal(t, http.StatusForbidden, sendRequest("POST", fmt.Sprintf("/v1/lists/%d/items?createdBy=%d", list.ListId, owner.OnlineID), data.ItemWire{Name: "New", Quantity: 1}))
+	quantityChanged.Version = list.Version + 5
+	assert.Equal(t, http.StatusForbidden, sendRequest("PUT", listPath, quantityChanged))
+	onlyChecked.Version = list.Version + 5
+	assert.Equal(t, http.StatusOK, sendRequest("PUT", listPath, onlyChecked))
+	// The given creator must be the creator of the list
+	onlyChecked.Version++
+	assert.Equal(t, http.StatusBadRequest, sendRequest("PUT", fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, thirdUser.OnlineID), onlyChecked))
+
+	// Only co-owners can share the list of somebody else
+	sharePath := fmt.Sprintf("/v1/share/%d?createdBy=%d", list.ListId, owner.OnlineID)
+	share := data.ListSharedWire{SharedWith: []int64{thirdUser.OnlineID}, Permission: data.PermissionViewer}
+	setPermission(data.PermissionEditor)
+	quantityChanged.Version = list.Version + 6
+	assert.Equal(t, http.StatusOK, sendRequest("PUT", listPath, quantityChanged))
+	assert.Equal(t, http.StatusForbidden, sendRequest("POST", sharePath, share))
+
+	setPermission(data.PermissionCoOwner)
+	assert.Equal(t, http.StatusCreated, sendRequest("POST", sharePath, share))
+	assert.Nil(t, store.AcceptShareRequest(list.ListId, owner.OnlineID, thirdUser.OnlineID))
+	permission, err := store.GetSharePermission(list.ListId, owner.OnlineID, thirdUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+	share.Permission = data.PermissionOwner
+	assert.Equal(t, http.StatusBadRequest, sendRequest("POST", sharePath, share))
+	share = data.ListSharedWire{SharedWith: []int64{testUser.OnlineID}, Permission: data.PermissionEditor}
+	assert.Equal(t, http.StatusBadRequest, sendRequest("POST", sharePath, share))
 
-	database.PrintSharingTable()
-	database.DropShoppingListTable()
-	database.ResetSharedListTable()
+	DeleteTestUser(t)
 }
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------
+// Listing and revoking the sessions of the own user
+// ------------------------------------------------------------
+
+func (s *Server) getSessions(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	sessions, err := s.store.GetSessionsForUser(userId)
+	if err != nil {
+		log.Printf("Failed to get sessions of %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	current := c.GetString("sessionId")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionId == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// revokeSession logs out a single device, including the requesting one
+func (s *Server) revokeSession(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	session, err := s.store.GetSession(c.Param("sessionId"))
+	if err != nil || session.UserId != userId {
+		log.Printf("Session to revoke of %d not found", userId)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if _, err := s.store.DeleteSession(session.SessionId); err != nil {
+		log.Printf("Failed to revoke session of %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// revokeAllSessions logs out all devices, with keepCurrent=true all but the requesting one
+func (s *Server) revokeAllSessions(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if c.Query("keepCurrent") != "true" {
+		if _, err := s.store.DeleteSessionsForUser(userId); err != nil {
+			log.Printf("Failed to revoke sessions of %d: %s", userId, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	if err := s.revokeOtherSessions(userId, c.GetString("sessionId")); err != nil {
+		log.Printf("Failed to revoke sessions of %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) revokeOtherSessions(userId int64, current string) error {
+	sessions, err := s.store.GetSessionsForUser(userId)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.SessionId == current {
+			continue
+		}
+		if _, err := s.store.DeleteSession(session.SessionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
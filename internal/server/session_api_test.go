@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing sessions on several devices
+// ------------------------------------------------------------
+
+func loginOnDevice(t *testing.T, device string) string {
+	reader, err := loadUserAndSetupFields(0, "", "")
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID)+"?device="+url.QueryEscape(device), reader)
+	req.RemoteAddr = "10.0.0.1:40000"
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var token authentication.Token
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &token))
+	return token.Token
+}
+
+func sendSessionRequest(method string, path string, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.RemoteAddr = "10.0.0.1:40000"
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	return w
+}
+
+func getSessions(t *testing.T, token string) []data.Session {
+	w := sendSessionRequest("GET", "/v1/users/sessions", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []data.Session
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &sessions))
+	return sessions
+}
+
+func TestSessionsOnSeveralDevices(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+
+	// Logging in on the tablet keeps the phone logged in
+	phone := loginOnDevice(t, "Phone")
+	tablet := loginOnDevice(t, "Tablet")
+	laptop := loginOnDevice(t, "Laptop")
+	assert.Equal(t, http.StatusOK, sendSessionRequest("GET", "/v1/test/auth", phone).Code)
+	assert.Equal(t, http.StatusOK, sendSessionRequest("GET", "/v1/test/auth", tablet).Code)
+
+	sessions := getSessions(t, phone)
+	assert.Equal(t, 3, len(sessions))
+	var tabletSession data.Session
+	for _, session := range sessions {
+		assert.Equal(t, session.DeviceName == "Phone", session.Current)
+		assert.Equal(t, "10.0.0.1", session.IP)
+		if session.DeviceName == "Tablet" {
+			tabletSession = session
+		}
+	}
+
+	// Revoking a single session logs out that device only
+	assert.Equal(t, http.StatusOK, sendSessionRequest("DELETE", "/v1/users/sessions/"+tabletSession.SessionId, phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", tablet).Code)
+	assert.Equal(t, http.StatusNotFound, sendSessionRequest("DELETE", "/v1/users/sessions/"+tabletSession.SessionId, phone).Code)
+	assert.Equal(t, 2, len(getSessions(t, phone)))
+
+	// Sessions of other users cannot be revoked
+	other, err := store.CreateUserAccountInDatabase("other device user", "password")
+	assert.Nil(t, err)
+	assert.Nil(t, store.CreateSession(data.Session{SessionId: "foreign", UserId: other.OnlineID}))
+	assert.Equal(t, http.StatusNotFound, sendSessionRequest("DELETE", "/v1/users/sessions/foreign", phone).Code)
+
+	// Revoking the other sessions keeps the current one
+	assert.Equal(t, http.StatusOK, sendSessionRequest("DELETE", "/v1/users/sessions?keepCurrent=true", phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", laptop).Code)
+	assert.Equal(t, 1, len(getSessions(t, phone)))
+
+	tablet = loginOnDevice(t, "Tablet")
+	assert.Equal(t, http.StatusOK, sendSessionRequest("DELETE", "/v1/users/sessions", phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", phone).Code)
+	assert.Equal(t, http.StatusUnauthorized, sendSessionRequest("GET", "/v1/test/auth", tablet).Code)
+	_, err = store.GetSession("foreign")
+	assert.Nil(t, err)
+}
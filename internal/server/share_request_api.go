@@ -0,0 +1,193 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Accepting shared lists and blocking users
+// ------------------------------------------------------------
+
+// isBlockedBy checks if the recipient blocked any of the given senders
+func (s *Server) isBlockedBy(recipient int64, senders ...int64) bool {
+	for _, sender := range senders {
+		blocked, err := s.store.IsUserBlocked(recipient, sender)
+		if err != nil {
+			log.Printf("Failed to check if %d blocked %d: %s", recipient, sender, err)
+			return true
+		}
+		if blocked {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getIncomingShareRequests(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	requests, err := s.store.GetIncomingShareRequests(userId)
+	if err != nil {
+		log.Printf("Failed to get share requests for %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+func (s *Server) getOutgoingShareRequests(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	requests, err := s.store.GetOutgoingShareRequests(userId)
+	if err != nil {
+		log.Printf("Failed to get share requests from %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// shareRequestFromParams returns the pending request of the user named by the listId and createdBy parameters
+func (s *Server) shareRequestFromParams(c *gin.Context) (data.ListShared, bool) {
+	strListId := c.Param("listId")
+	listId, err := strconv.Atoi(strListId)
+	if err != nil {
+		log.Printf("Failed to parse given list id: %s: %s", strListId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return data.ListShared{}, false
+	}
+	strCreatedBy := c.Query("createdBy")
+	createdBy, err := strconv.Atoi(strCreatedBy)
+	if err != nil {
+		log.Printf("Failed to parse given createdBy: %s: %s", strCreatedBy, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return data.ListShared{}, false
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return data.ListShared{}, false
+	}
+	requests, err := s.store.GetIncomingShareRequests(userId)
+	if err != nil {
+		log.Printf("Failed to get share requests for %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return data.ListShared{}, false
+	}
+	for _, request := range requests {
+		if request.ListId == int64(listId) && request.CreatedBy == int64(createdBy) {
+			return request, true
+		}
+	}
+	log.Printf("No share request of list %d from %d for %d", listId, createdBy, userId)
+	c.AbortWithStatus(http.StatusNotFound)
+	return data.ListShared{}, false
+}
+
+func (s *Server) acceptShareRequest(c *gin.Context) {
+	request, ok := s.shareRequestFromParams(c)
+	if !ok {
+		return
+	}
+	if err := s.store.AcceptShareRequest(request.ListId, request.CreatedBy, request.SharedWithId); err != nil {
+		log.Printf("Failed to accept share request: %s", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	s.publishListEvent(data.ListEventShared, request.ListId, request.CreatedBy, s.listRecipients(request.ListId, request.CreatedBy))
+	request.Status = data.ShareStatusAccepted
+	c.JSON(http.StatusOK, request)
+}
+
+func (s *Server) declineShareRequest(c *gin.Context) {
+	request, ok := s.shareRequestFromParams(c)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteSharingForUser(request.ListId, request.CreatedBy, request.SharedWithId); err != nil {
+		log.Printf("Failed to decline share request: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) getBlockedUsers(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	blocked, err := s.store.GetBlockedUsers(userId)
+	if err != nil {
+		log.Printf("Failed to get users blocked by %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, blocked)
+}
+
+func blockedIdFromParam(c *gin.Context) (int64, int64, bool) {
+	strBlockedId := c.Param("userId")
+	blockedId, err := strconv.Atoi(strBlockedId)
+	if err != nil {
+		log.Printf("Failed to parse given user id: %s: %s", strBlockedId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		log.Printf("User is not correctly authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	if int64(blockedId) == userId {
+		log.Printf("User %d cannot block itself", userId)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return int64(blockedId), userId, true
+}
+
+// blockUser prevents further share requests and invitations, existing shares are kept
+func (s *Server) blockUser(c *gin.Context) {
+	blockedId, userId, ok := blockedIdFromParam(c)
+	if !ok {
+		return
+	}
+	if err := s.store.BlockUser(userId, blockedId); err != nil {
+		log.Printf("Failed to block user %d for %d: %s", blockedId, userId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) unblockUser(c *gin.Context) {
+	blockedId, userId, ok := blockedIdFromParam(c)
+	if !ok {
+		return
+	}
+	if err := s.store.UnblockUser(userId, blockedId); err != nil {
+		log.Printf("Failed to unblock user %d for %d: %s", blockedId, userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,131 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Testing share requests and blocking
+// ------------------------------------------------------------
+
+func TestAcceptAndDeclineShareRequests(t *testing.T) {
+	connectDatabase()
+	owner, err := store.CreateUserAccountInDatabase("requesting owner", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+
+	list, err := createListOffline("requested list", owner.OnlineID, nil)
+	assert.Nil(t, err)
+	declined, err := createListOffline("declined list", owner.OnlineID, nil)
+	assert.Nil(t, err)
+	for _, listId := range []int64{list.ListId, declined.ListId} {
+		_, err = store.CreateShareRequest(listId, owner.OnlineID, testUser.OnlineID, data.PermissionChecker)
+		assert.Nil(t, err)
+	}
+
+	// Pending shares are hidden until accepted
+	assert.Equal(t, 0, len(getAllLists(t)))
+	listPath := fmt.Sprintf("/v1/lists/%d?createdBy=%d", list.ListId, owner.OnlineID)
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "GET", listPath, testToken, nil).Code)
+	w := sendJSONRequest(t, "GET", "/v1/share/requests/incoming", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var requests []data.ListShared
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &requests))
+	assert.Equal(t, 2, len(requests))
+
+	requestPath := fmt.Sprintf("/v1/share/requests/%d?createdBy=%d", list.ListId, owner.OnlineID)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "POST", requestPath, testToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "POST", requestPath, testToken, nil).Code)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "GET", listPath, testToken, nil).Code)
+	declinePath := fmt.Sprintf("/v1/share/requests/%d?createdBy=%d", declined.ListId, owner.OnlineID)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", declinePath, testToken, nil).Code)
+	lists := getAllLists(t)
+	if assert.Equal(t, 1, len(lists)) {
+		assert.Equal(t, list.ListId, lists[0].ListId)
+	}
+	requests, err = store.GetOutgoingShareRequests(owner.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(requests))
+}
+
+func TestShareRequestsOfOwnLists(t *testing.T) {
+	connectDatabase()
+	recipient, err := store.CreateUserAccountInDatabase("recipient", "password")
+	assert.Nil(t, err)
+	blocking, err := store.CreateUserAccountInDatabase("blocking", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+	list, err := createListOffline("own list", testUser.OnlineID, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, http.StatusCreated, shareList(t, list.ListId, recipient.OnlineID))
+	w := sendJSONRequest(t, "GET", "/v1/share/requests/outgoing", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var requests []data.ListShared
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &requests))
+	if assert.Equal(t, 1, len(requests)) {
+		assert.Equal(t, recipient.OnlineID, requests[0].SharedWithId)
+		assert.Equal(t, data.ShareStatusPending, requests[0].Status)
+	}
+
+	// Updating the sharing keeps accepted shares and leaves requests pending
+	assert.Nil(t, store.AcceptShareRequest(list.ListId, testUser.OnlineID, recipient.OnlineID))
+	share := data.ListSharedWire{SharedWith: []int64{recipient.OnlineID}, Permission: data.PermissionViewer}
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "PUT", fmt.Sprintf("/v1/share/%d", list.ListId), testToken, share).Code)
+	permission, err := store.GetSharePermission(list.ListId, testUser.OnlineID, recipient.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.PermissionViewer, permission)
+
+	// Blocked users cannot send requests or invitations
+	assert.Nil(t, store.BlockUser(blocking.OnlineID, testUser.OnlineID))
+	assert.Equal(t, http.StatusForbidden, shareList(t, list.ListId, blocking.OnlineID))
+	share.SharedWith = []int64{recipient.OnlineID, blocking.OnlineID}
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "PUT", fmt.Sprintf("/v1/share/%d", list.ListId), testToken, share).Code)
+	household, err := store.CreateHousehold("Family", testUser.OnlineID)
+	assert.Nil(t, err)
+	invitation := data.HouseholdInvitation{UserId: blocking.OnlineID}
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "POST", fmt.Sprintf("/v1/households/%d/invitations", household.HouseholdId), testToken, invitation).Code)
+	assert.Nil(t, store.UnblockUser(blocking.OnlineID, testUser.OnlineID))
+	assert.Equal(t, http.StatusCreated, shareList(t, list.ListId, blocking.OnlineID))
+}
+
+func TestBlockUsers(t *testing.T) {
+	connectDatabase()
+	blocked, err := store.CreateUserAccountInDatabase("blocked", "password")
+	assert.Nil(t, err)
+	CreateTestUser(t)
+	login(t)
+	list, err := createListOffline("spam", blocked.OnlineID, nil)
+	assert.Nil(t, err)
+	_, err = store.CreateShareRequest(list.ListId, blocked.OnlineID, testUser.OnlineID, data.PermissionEditor)
+	assert.Nil(t, err)
+
+	blockedPath := fmt.Sprintf("/v1/users/blocked/%d", blocked.OnlineID)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "POST", blockedPath, testToken, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "POST", fmt.Sprintf("/v1/users/blocked/%d", testUser.OnlineID), testToken, nil).Code)
+	w := sendJSONRequest(t, "GET", "/v1/users/blocked", testToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var blockedUsers []data.BlockedUser
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &blockedUsers))
+	if assert.Equal(t, 1, len(blockedUsers)) {
+		assert.Equal(t, blocked.OnlineID, blockedUsers[0].UserId)
+	}
+	// The pending request of the blocked user is removed
+	requests, err := store.GetIncomingShareRequests(testUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(requests))
+
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", blockedPath, testToken, nil).Code)
+	isBlocked, err := store.IsUserBlocked(testUser.OnlineID, blocked.OnlineID)
+	assert.Nil(t, err)
+	assert.False(t, isBlocked)
+}
@@ -2,9 +2,11 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,7 +14,7 @@ import (
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 )
 
-func createShoppingList(c *gin.Context) {
+func (s *Server) createShoppingList(c *gin.Context) {
 	var list data.List
 	err := c.BindJSON(&list)
 	if err != nil {
@@ -32,18 +34,39 @@ func createShoppingList(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	err = database.CreateOrUpdateShoppingList(list)
+	err = s.store.CreateOrUpdateShoppingList(list)
 	if err != nil {
 		log.Printf("Failed to create list: %s", err)
-		c.AbortWithStatus(http.StatusBadRequest)
+		abortWithItemsError(c, err)
 		return
 	}
+	s.publishListUpdate(list.ListId, list.CreatedBy.ID)
 	// No more information is gained through an answer because the client
 	// dictates the ID and the server stores the info combined with the userId
 	c.Status(http.StatusCreated)
 }
 
-func isUserAllowedToUpdateList(list data.List, userId int64, updated bool) error {
+// abortWithItemsError tells the client which items of the list could not be stored
+func abortWithItemsError(c *gin.Context, err error) {
+	var itemsErr *database.ItemsError
+	if errors.As(err, &itemsErr) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, itemsErr)
+		return
+	}
+	c.AbortWithStatus(http.StatusBadRequest)
+}
+
+var errPermissionDenied = errors.New("permission of shared list does not allow the operation")
+
+// listPermission returns the permission of the user for the list, the creator is the owner
+func (s *Server) listPermission(listId int64, createdBy int64, userId int64) (string, error) {
+	if createdBy == userId {
+		return data.PermissionOwner, nil
+	}
+	return s.store.GetSharePermission(listId, createdBy, userId)
+}
+
+func (s *Server) isUserAllowedToUpdateList(list data.List, userId int64, updated bool) error {
 	if userId == list.CreatedBy.ID {
 		return nil
 	}
@@ -51,14 +74,57 @@ func isUserAllowedToUpdateList(list data.List, userId int64, updated bool) error
 		log.Printf("UserId %d does not match list createdBy %d", userId, list.CreatedBy.ID)
 		return errors.New("user creating list different from user in list")
 	}
-	if err := database.IsListSharedWithUser(list.ListId, list.CreatedBy.ID, userId); err != nil {
+	permission, err := s.listPermission(list.ListId, list.CreatedBy.ID, userId)
+	if err != nil {
 		log.Printf("List %d from %d to update is not shared with user %d", list.ListId, list.CreatedBy.ID, userId)
 		return errors.New("list is not shared with user")
 	}
+	if data.PermissionAllows(permission, data.PermissionEditor) {
+		return nil
+	}
+	if permission == data.PermissionChecker {
+		err := s.onlyCheckedChanged(list)
+		if err == nil {
+			return nil
+		}
+		log.Printf("User %d may only check items of list %d from %d: %s", userId, list.ListId, list.CreatedBy.ID, err)
+	}
+	return errPermissionDenied
+}
+
+// onlyCheckedChanged compares the updated list with the stored one, ignoring the checked flags
+func (s *Server) onlyCheckedChanged(list data.List) error {
+	stored, err := s.store.GetRawShoppingListWithId(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Title != list.Title {
+		return errors.New("title changed")
+	}
+	storedItems, err := s.store.GetItemsInList(list.ListId, list.CreatedBy.ID)
+	if err != nil {
+		return err
+	}
+	if len(storedItems) != len(list.Items) {
+		return errors.New("items added or removed")
+	}
+	quantities := make(map[string]int64)
+	for _, item := range storedItems {
+		quantities[strings.TrimSpace(item.Name)] = item.Quantity
+	}
+	for _, item := range list.Items {
+		quantity, exists := quantities[strings.TrimSpace(item.Name)]
+		if !exists {
+			return fmt.Errorf("item '%s' added", item.Name)
+		}
+		if quantity != item.Quantity {
+			return fmt.Errorf("quantity of '%s' changed", item.Name)
+		}
+	}
 	return nil
 }
 
-func updateShoppingList(c *gin.Context) {
+func (s *Server) updateShoppingList(c *gin.Context) {
 	// Check the contained listId and createdBy
 	strListId := c.Param("listId")
 	if strListId == "" {
@@ -88,8 +154,7 @@ func updateShoppingList(c *gin.Context) {
 	}
 
 	// Checking access rights, it might be that the list was shared with the user
-	createdBy := updatedList.CreatedBy.ID
-	if createdBy != userId {
+	if updatedList.CreatedBy.ID != userId {
 		log.Printf("Caller and updatedList creator differ, checking access rights")
 		strCreatedBy, exists := c.GetQuery("createdBy")
 		if !exists || strCreatedBy == "" {
@@ -103,23 +168,50 @@ func updateShoppingList(c *gin.Context) {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := isUserAllowedToUpdateList(updatedList, userId, true); err != nil {
+		if int64(queryCreatedBy) != updatedList.CreatedBy.ID {
+			log.Printf("Given creator %d does not match the creator %d of the list", queryCreatedBy, updatedList.CreatedBy.ID)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := s.isUserAllowedToUpdateList(updatedList, userId, true); errors.Is(err, errPermissionDenied) {
+			log.Printf("Failed to update list: %s", err)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		} else if err != nil {
 			log.Printf("Failed to update list: %s", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		createdBy = int64(queryCreatedBy)
 	}
 	// Either the user created the list or it was shared with the user
-	if err = database.CreateOrUpdateShoppingList(updatedList); err != nil {
-		log.Printf("failed to update listId %d from user %d", listId, userId)
-		c.AbortWithStatus(http.StatusBadRequest)
+	if c.Query("merge") == "true" {
+		s.mergeShoppingList(c, updatedList)
+		return
+	}
+	if err = s.store.CreateOrUpdateShoppingList(updatedList); err != nil {
+		log.Printf("failed to update listId %d from user %d: %s", listId, userId, err)
+		abortWithItemsError(c, err)
 		return
 	}
+	s.publishListUpdate(updatedList.ListId, updatedList.CreatedBy.ID)
 	c.Status(http.StatusOK)
 }
 
-func getShoppingList(c *gin.Context) {
+// mergeShoppingList merges concurrent changes into the stored list instead of rejecting
+// outdated versions and answers with the merged list and the conflicts that were resolved
+func (s *Server) mergeShoppingList(c *gin.Context, updatedList data.List) {
+	result, err := s.store.MergeShoppingList(updatedList)
+	if err != nil {
+		log.Printf("failed to merge listId %d from %d: %s", updatedList.ListId, updatedList.CreatedBy.ID, err)
+		abortWithItemsError(c, err)
+		return
+	}
+	log.Printf("Merged list %d from %d with %d conflict(s)", updatedList.ListId, updatedList.CreatedBy.ID, len(result.Conflicts))
+	s.publishListUpdate(updatedList.ListId, updatedList.CreatedBy.ID)
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getShoppingList(c *gin.Context) {
 	strListId := c.Param("listId")
 	if strListId == "" {
 		log.Printf("listId parameter not found or empty")
@@ -153,19 +245,19 @@ func getShoppingList(c *gin.Context) {
 	listIsFromCreator := createdBy == int(userId)
 	if !listIsFromCreator {
 		// Check if the user actually has access to this list
-		if err := database.IsListSharedWithUser(int64(listId), int64(createdBy), int64(userId)); err != nil {
+		if err := s.store.IsListSharedWithUser(int64(listId), int64(createdBy), int64(userId)); err != nil {
 			log.Printf("User %d is not owner of list %d but list is not shared", userId, listId)
 			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
 	}
-	list, err := database.GetRawShoppingListWithId(int64(listId), int64(createdBy))
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), int64(createdBy))
 	if err != nil {
 		log.Printf("Failed to get mapping for id %d: %s", listId, err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-	itemsInList, err := database.GetItemsInList(list.ListId, int64(createdBy))
+	itemsInList, err := s.store.GetItemsInList(list.ListId, int64(createdBy))
 	if err != nil {
 		log.Printf("Failed to get item in list: %s", err)
 		c.AbortWithStatus(http.StatusNotFound)
@@ -175,7 +267,7 @@ func getShoppingList(c *gin.Context) {
 	c.JSON(http.StatusOK, list)
 }
 
-func getAllShoppingListsForUser(c *gin.Context) {
+func (s *Server) getAllShoppingListsForUser(c *gin.Context) {
 	// User MUST be authenticated so it does exist and is allowed to make the request
 	// Check for the lists of the user itself first
 	userId := c.GetInt64("userId")
@@ -185,7 +277,7 @@ func getAllShoppingListsForUser(c *gin.Context) {
 		return
 	}
 
-	ownAndSharedLists, err := database.GetRawShoppingListsForUserId(int64(userId))
+	ownAndSharedLists, err := s.store.GetRawShoppingListsForUserId(int64(userId))
 	if err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -193,7 +285,7 @@ func getAllShoppingListsForUser(c *gin.Context) {
 	log.Printf("Got %d lists for user", len(ownAndSharedLists))
 
 	// Asking the database for all the lists that are shared with the current user
-	sharedListIds, err := database.GetListIdsSharedWithUser(int64(userId))
+	sharedListIds, err := s.store.GetListIdsSharedWithUser(int64(userId))
 	if err != nil {
 		log.Printf("Failed to get shared listIds for user %d: %s", userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -201,7 +293,7 @@ func getAllShoppingListsForUser(c *gin.Context) {
 	}
 	log.Printf("Got %d shared lists for user", len(sharedListIds))
 	// Get full information for the shared lists
-	sharedLists, err := database.GetRawShoppingListsByIDs(sharedListIds)
+	sharedLists, err := s.store.GetRawShoppingListsByIDs(sharedListIds)
 	if err != nil {
 		log.Printf("Failed to load shared lists for user %d: %s", userId, err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -210,7 +302,7 @@ func getAllShoppingListsForUser(c *gin.Context) {
 	ownAndSharedLists = append(ownAndSharedLists, sharedLists...)
 	// Asking DB to get the items in this list
 	for i, list := range ownAndSharedLists {
-		itemsPerList, err := database.GetItemsInList(list.ListId, list.CreatedBy.ID)
+		itemsPerList, err := s.store.GetItemsInList(list.ListId, list.CreatedBy.ID)
 		if err != nil {
 			log.Printf("Failed to get items for list %d: %s", list.ListId, err)
 			ownAndSharedLists[i].Items = []data.ItemWire{}
@@ -221,7 +313,7 @@ func getAllShoppingListsForUser(c *gin.Context) {
 	c.JSON(http.StatusOK, ownAndSharedLists)
 }
 
-func deleteShoppingList(c *gin.Context) {
+func (s *Server) deleteShoppingList(c *gin.Context) {
 	strListId := c.Param("listId")
 	if strListId == "" {
 		log.Printf("Expected listId parameter but did not get anything")
@@ -256,48 +348,77 @@ func deleteShoppingList(c *gin.Context) {
 	}
 	// User can only delete the own lists, therefore check only if the list
 	// is owned by the user
-	list, err := database.GetRawShoppingListWithId(int64(listId), createdBy)
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), createdBy)
 	if err != nil {
 		log.Printf("Failed to get mapping for listId %d: %s", listId, err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
-	// Is list shared? Then delete sharing
+	// Is list shared? Then delete sharing, every permission allows to leave the list
+	// but only the owner can delete it
 	if list.CreatedBy.ID != userId {
-		if err := database.IsListSharedWithUser(list.ListId, list.CreatedBy.ID, userId); err != nil {
+		if err := s.store.IsListSharedWithUser(list.ListId, list.CreatedBy.ID, userId); err != nil {
 			log.Printf("Cannot delete list: User %d did not create list %d from %d and list is not shared", userId, list.ListId, list.CreatedBy.ID)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		err := database.DeleteSharingForUser(list.ListId, list.CreatedBy.ID, userId)
+		// Lists shared with a household stay accessible until the user leaves the household
+		if shared, err := s.isListSharedThroughHousehold(list.ListId, list.CreatedBy.ID, userId); err != nil {
+			log.Printf("Failed to check the households of %d for list %d from %d: %s", userId, list.ListId, list.CreatedBy.ID, err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		} else if shared {
+			log.Printf("List %d from %d is shared with %d through a household", list.ListId, list.CreatedBy.ID, userId)
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		err := s.store.DeleteSharingForUser(list.ListId, list.CreatedBy.ID, userId)
 		if err != nil {
 			log.Printf("Failed to delete sharing of list %d from %d with %d: %s", list.ListId, list.CreatedBy.ID, userId, err)
 			c.AbortWithStatus(http.StatusBadRequest)
+			return
 		}
+		s.publishListEvent(data.ListEventUnshared, list.ListId, list.CreatedBy.ID, []int64{list.CreatedBy.ID, userId})
+		c.Status(http.StatusOK)
 		return
 	}
-	if err := database.DeleteShoppingList(int64(listId), int64(userId)); err != nil {
+	recipients := s.listRecipients(list.ListId, list.CreatedBy.ID)
+	if err := s.store.DeleteShoppingList(int64(listId), int64(userId)); err != nil {
 		log.Printf("Failed to delete list %d", listId)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	s.publishListEvent(data.ListEventDeleted, list.ListId, list.CreatedBy.ID, recipients)
 	log.Printf("Delete list %d", listId)
 	c.Status(http.StatusOK)
 }
 
-func deleteAllOwnShoppingLists(c *gin.Context) {
+func (s *Server) deleteAllOwnShoppingLists(c *gin.Context) {
 	userId := c.GetInt64("userId")
 	if userId == 0 {
 		log.Printf("User is not correctly authenticated")
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
-	err := database.DeleteShoppingListFrom(userId)
+	ownLists, err := s.store.GetRawShoppingListsForUserId(userId)
+	if err != nil {
+		log.Printf("Failed to get own lists: %s", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	recipients := make([][]int64, len(ownLists))
+	for i, list := range ownLists {
+		recipients[i] = s.listRecipients(list.ListId, userId)
+	}
+	err = s.store.DeleteShoppingListFrom(userId)
 	if err != nil {
 		log.Printf("Failed to delete all own lists: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	for i, list := range ownLists {
+		s.publishListEvent(data.ListEventDeleted, list.ListId, userId, recipients[i])
+	}
 	c.Status(http.StatusOK)
 }
 
@@ -305,7 +426,7 @@ func deleteAllOwnShoppingLists(c *gin.Context) {
 // Handling of sharing
 // ------------------------------------------------------------
 
-func shareShoppingList(c *gin.Context) {
+func (s *Server) shareShoppingList(c *gin.Context) {
 	strListId := c.Param("listId")
 	if strListId == "" {
 		log.Printf("listId parameter not found or empty")
@@ -330,10 +451,25 @@ func shareShoppingList(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	permission, ok := sharePermissionFromWire(c, shared)
+	if !ok {
+		return
+	}
+	// Besides the owner, co-owners can share the list by giving the createdBy parameter
+	createdBy := userId
+	if strCreatedBy := c.Query("createdBy"); strCreatedBy != "" {
+		queryCreatedBy, err := strconv.Atoi(strCreatedBy)
+		if err != nil {
+			log.Printf("given createdBy parameter is not an integer: %s", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		createdBy = int64(queryCreatedBy)
+	}
 	// Abort if the user does not own the list
-	list, err := database.GetRawShoppingListWithId(int64(listId), int64(userId))
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), createdBy)
 	if err != nil {
-		log.Printf("listId %d for given user %d not found: %s", listId, userId, err)
+		log.Printf("listId %d for given user %d not found: %s", listId, createdBy, err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
@@ -342,25 +478,78 @@ func shareShoppingList(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	// Should never happen, but who knows
-	if list.CreatedBy.ID != int64(userId) {
-		log.Printf("listId %d was not createdBy %d", listId, userId)
+	userPermission, err := s.listPermission(list.ListId, list.CreatedBy.ID, userId)
+	if err != nil || !data.PermissionAllows(userPermission, data.PermissionCoOwner) {
+		log.Printf("User %d is not allowed to share list %d from %d", userId, listId, createdBy)
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
 	var listShared data.ListShared
+	var requested []int64
 	for _, sharedWith := range shared.SharedWith {
-		listShared, err = database.CreateOrUpdateSharedList(int64(listId), userId, sharedWith)
+		// Co-owners cannot change their own permission
+		if sharedWith == createdBy || sharedWith == userId {
+			log.Printf("Cannot share list %d from %d with %d", listId, createdBy, sharedWith)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if s.isBlockedBy(sharedWith, createdBy, userId) {
+			log.Printf("User %d blocked sharing list %d from %d", sharedWith, listId, createdBy)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		// The recipient has to accept the request before getting access
+		listShared, err = s.store.CreateShareRequest(int64(listId), createdBy, sharedWith, permission)
 		if err != nil {
 			log.Printf("Failed to create sharing: %s", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
+		if listShared.Status == data.ShareStatusPending {
+			requested = append(requested, sharedWith)
+		}
+	}
+	if !s.shareListWithHouseholds(c, list.ListId, createdBy, userId, shared.Households, permission) {
+		return
+	}
+	s.publishListEvent(data.ListEventShared, list.ListId, createdBy, s.listRecipients(list.ListId, createdBy))
+	if len(requested) > 0 {
+		s.publishListEvent(data.ListEventShareRequest, list.ListId, createdBy, requested)
 	}
 	c.JSON(http.StatusCreated, listShared)
 }
 
-func unshareShoppingList(c *gin.Context) {
+// shareListWithHouseholds shares the list with households the user is a member of
+func (s *Server) shareListWithHouseholds(c *gin.Context, listId int64, createdBy int64, userId int64, households []int64, permission string) bool {
+	for _, householdId := range households {
+		if _, err := s.store.GetHouseholdRole(householdId, userId); err != nil {
+			log.Printf("User %d cannot share list %d with household %d without being a member", userId, listId, householdId)
+			c.AbortWithStatus(http.StatusForbidden)
+			return false
+		}
+		if err := s.store.ShareListWithHousehold(listId, createdBy, householdId, permission); err != nil {
+			log.Printf("Failed to share list %d from %d with household %d: %s", listId, createdBy, householdId, err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// sharePermissionFromWire defaults to the editor permission, which was the only one before
+func sharePermissionFromWire(c *gin.Context, shared data.ListSharedWire) (string, bool) {
+	if shared.Permission == "" {
+		return data.PermissionEditor, true
+	}
+	if !data.IsGrantablePermission(shared.Permission) {
+		log.Printf("Invalid share permission '%s'", shared.Permission)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return "", false
+	}
+	return shared.Permission, true
+}
+
+func (s *Server) unshareShoppingList(c *gin.Context) {
 	strListId := c.Param("listId")
 	listId, err := strconv.Atoi(strListId)
 	if err != nil {
@@ -375,7 +564,7 @@ func unshareShoppingList(c *gin.Context) {
 		return
 	}
 	// Check if the user owns the list that should be unshared
-	list, err := database.GetRawShoppingListWithId(int64(listId), int64(userId))
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), int64(userId))
 	if err != nil {
 		log.Printf("listId %d for given user %d not found: %s", listId, userId, err)
 		c.AbortWithStatus(http.StatusForbidden)
@@ -396,15 +585,17 @@ func unshareShoppingList(c *gin.Context) {
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
-	if err = database.DeleteSharingOfList(int64(listId), userId); err != nil {
+	recipients := s.listRecipients(list.ListId, userId)
+	if err = s.store.DeleteSharingOfList(int64(listId), userId); err != nil {
 		log.Printf("failed to delete sharing of list %d for user %d", listId, userId)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	s.publishListEvent(data.ListEventUnshared, list.ListId, userId, recipients)
 	c.Status(http.StatusOK)
 }
 
-func updateShareShoppingList(c *gin.Context) {
+func (s *Server) updateShareShoppingList(c *gin.Context) {
 	strListId := c.Param("listId")
 	listId, err := strconv.Atoi(strListId)
 	if err != nil {
@@ -419,7 +610,7 @@ func updateShareShoppingList(c *gin.Context) {
 		return
 	}
 	// Check if the user owns the list that should be unshared
-	list, err := database.GetRawShoppingListWithId(int64(listId), int64(userId))
+	list, err := s.store.GetRawShoppingListWithId(int64(listId), int64(userId))
 	if err != nil {
 		log.Printf("listId %d for given user %d not found: %s", listId, userId, err)
 		c.AbortWithStatus(http.StatusForbidden)
@@ -431,23 +622,80 @@ func updateShareShoppingList(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	permission, ok := sharePermissionFromWire(c, updatedListShare)
+	if !ok {
+		return
+	}
 	// should not happen, unless my implementation above is bogus, so could be :)
 	if list.CreatedBy.ID != int64(userId) {
 		log.Printf("User ID (%d) does not match created ID (%d)", userId, list.CreatedBy.ID)
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
-	if err = database.DeleteSharingOfList(int64(listId), userId); err != nil {
+	previousRecipients := s.listRecipients(list.ListId, userId)
+	// Accepted shares stay accepted, everybody else gets a new request
+	previousShares, err := s.store.GetSharesOfList(list.ListId, userId)
+	if err != nil {
+		log.Printf("Failed to get sharing of list %d: %s", listId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	accepted := make(map[int64]bool)
+	for _, share := range previousShares {
+		accepted[share.SharedWithId] = share.Status == data.ShareStatusAccepted
+	}
+	for _, shareWithId := range updatedListShare.SharedWith {
+		if !accepted[shareWithId] && s.isBlockedBy(shareWithId, userId) {
+			log.Printf("User %d blocked sharing list %d from %d", shareWithId, listId, userId)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+	if err = s.store.DeleteSharingOfList(int64(listId), userId); err != nil {
 		log.Printf("failed to delete sharing of list %d for user %d", listId, userId)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	defer s.publishSharingChange(list.ListId, userId, previousRecipients)
+	var requested []int64
 	for _, shareWithId := range updatedListShare.SharedWith {
-		if _, err := database.CreateOrUpdateSharedList(int64(listId), userId, shareWithId); err != nil {
+		if accepted[shareWithId] {
+			_, err = s.store.CreateOrUpdateSharedList(int64(listId), userId, shareWithId, permission)
+		} else {
+			_, err = s.store.CreateShareRequest(int64(listId), userId, shareWithId, permission)
+			requested = append(requested, shareWithId)
+		}
+		if err != nil {
 			log.Printf("Failed to create sharing %s", err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 	}
+	if len(requested) > 0 {
+		s.publishListEvent(data.ListEventShareRequest, list.ListId, userId, requested)
+	}
+	if !s.shareListWithHouseholds(c, list.ListId, userId, userId, updatedListShare.Households, permission) {
+		return
+	}
 	c.Status(http.StatusOK)
 }
+
+// publishSharingChange sends the users that lost access an unshare event
+// and everybody with access a share event
+func (s *Server) publishSharingChange(listId int64, createdBy int64, previousRecipients []int64) {
+	recipients := s.listRecipients(listId, createdBy)
+	stillShared := make(map[int64]bool)
+	for _, userId := range recipients {
+		stillShared[userId] = true
+	}
+	var removed []int64
+	for _, userId := range previousRecipients {
+		if !stillShared[userId] {
+			removed = append(removed, userId)
+		}
+	}
+	if len(removed) > 0 {
+		s.publishListEvent(data.ListEventUnshared, listId, createdBy, removed)
+	}
+	s.publishListEvent(data.ListEventShared, listId, createdBy, recipients)
+}
@@ -33,10 +33,60 @@ var (
 			Help: "Number of active connections",
 		},
 	)
+
+	loginFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_failures_total",
+			Help: "Total number of failed logins",
+		},
+		[]string{"reason"},
+	)
+
+	loginsThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "logins_throttled_total",
+			Help: "Total number of logins rejected due to earlier failures of the user or address",
+		},
+		[]string{"scope"},
+	)
+
+	accountLockoutsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "account_lockouts_total",
+			Help: "Total number of accounts locked after too many failed logins",
+		},
+	)
+
+	accountUnlocksTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "account_unlocks_total",
+			Help: "Total number of locked accounts unlocked by an admin",
+		},
+	)
 )
 
 func SetupMonitoring() {
 	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, activeConnections)
+	prometheus.MustRegister(loginFailuresTotal, loginsThrottledTotal, accountLockoutsTotal, accountUnlocksTotal)
+}
+
+// prometheusLoginObserver counts the events of the brute-force protection
+type prometheusLoginObserver struct{}
+
+func (prometheusLoginObserver) LoginFailed(reason string) {
+	loginFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+func (prometheusLoginObserver) LoginThrottled(scope string) {
+	loginsThrottledTotal.WithLabelValues(scope).Inc()
+}
+
+func (prometheusLoginObserver) AccountLocked(userId int64) {
+	accountLockoutsTotal.Inc()
+}
+
+func (prometheusLoginObserver) AccountUnlocked(userId int64) {
+	accountUnlocksTotal.Inc()
 }
 
 // Middleware to track Prometheus metrics
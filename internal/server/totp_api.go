@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+)
+
+// ------------------------------------------------------------
+// Two-factor authentication of the own account
+// ------------------------------------------------------------
+
+// totpUserId returns the user of the path, aborting unless it is the logged in user
+func totpUserId(c *gin.Context) (int64, bool) {
+	sId := c.Param("userId")
+	id, err := strconv.ParseInt(sId, 10, 64)
+	if err != nil {
+		log.Printf("Failed to parse given userId: %s: %s", sId, err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	userId := c.GetInt64("userId")
+	if userId == 0 || userId != id {
+		log.Printf("User %d cannot manage the second factor of user %d", userId, id)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return 0, false
+	}
+	return userId, true
+}
+
+func (s *Server) getTOTPStatus(c *gin.Context) {
+	userId, ok := totpUserId(c)
+	if !ok {
+		return
+	}
+	enabled, err := authentication.SecondFactorRequired(s.store, userId)
+	if err != nil {
+		log.Printf("Failed to get second factor of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	left, err := s.store.CountRecoveryCodes(userId)
+	if err != nil {
+		log.Printf("Failed to count recovery codes of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, data.TOTPStatus{Enabled: enabled, RecoveryCodesLeft: left})
+}
+
+// enrollTOTP requires the password, so a stolen token cannot lock the user out
+func (s *Server) enrollTOTP(c *gin.Context) {
+	userId, ok := totpUserId(c)
+	if !ok {
+		return
+	}
+	var confirmation data.PasswordConfirmation
+	if err := c.ShouldBindJSON(&confirmation); err != nil {
+		log.Printf("TOTP enrollment does not contain the password: %s", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	user, err := s.store.GetUser(userId)
+	if err != nil {
+		log.Printf("User %d not found: %s", userId, err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if err := authentication.VerifyPassword(user, confirmation.Password); err != nil {
+		log.Printf("Password of user %d does not match: %s", userId, err)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	enrollment, err := authentication.EnrollTOTP(s.store, user)
+	if errors.Is(err, authentication.ErrTOTPEnabled) {
+		log.Printf("User %d already enabled TOTP", userId)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Failed to enroll TOTP of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, enrollment)
+}
+
+// verifyTOTP enables TOTP with the first code of the authenticator app
+func (s *Server) verifyTOTP(c *gin.Context) {
+	userId, ok := totpUserId(c)
+	if !ok {
+		return
+	}
+	var factor data.SecondFactor
+	if err := c.ShouldBindJSON(&factor); err != nil || factor.Code == "" {
+		log.Printf("TOTP verification does not contain the code: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	codes, err := authentication.EnableTOTP(s.store, userId, factor.Code)
+	switch {
+	case errors.Is(err, authentication.ErrTOTPNotEnabled):
+		log.Printf("User %d did not enroll TOTP", userId)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	case errors.Is(err, authentication.ErrTOTPEnabled):
+		log.Printf("User %d already enabled TOTP", userId)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	case errors.Is(err, authentication.ErrInvalidSecondFactor):
+		log.Printf("Invalid TOTP code of user %d", userId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Failed to enable TOTP of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, data.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// verifySecondFactor aborts the request unless the body contains a valid code or recovery code
+func (s *Server) verifySecondFactor(c *gin.Context, userId int64) bool {
+	var factor data.SecondFactor
+	if err := c.ShouldBindJSON(&factor); err != nil || (factor.Code == "" && factor.RecoveryCode == "") {
+		log.Printf("Request does not contain the second factor: %v", err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return false
+	}
+	err := authentication.VerifySecondFactor(s.store, userId, factor)
+	switch {
+	case errors.Is(err, authentication.ErrTOTPNotEnabled):
+		log.Printf("User %d did not enable TOTP", userId)
+		c.AbortWithStatus(http.StatusNotFound)
+		return false
+	case errors.Is(err, authentication.ErrInvalidSecondFactor):
+		log.Printf("Invalid second factor of user %d", userId)
+		c.AbortWithStatus(http.StatusForbidden)
+		return false
+	case err != nil:
+		log.Printf("Failed to verify second factor of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (s *Server) disableTOTP(c *gin.Context) {
+	userId, ok := totpUserId(c)
+	if !ok || !s.verifySecondFactor(c, userId) {
+		return
+	}
+	if err := s.store.DeleteTOTP(userId); err != nil {
+		log.Printf("Failed to disable TOTP of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// renewRecoveryCodes replaces all recovery codes, e.g. when running out of them
+func (s *Server) renewRecoveryCodes(c *gin.Context) {
+	userId, ok := totpUserId(c)
+	if !ok || !s.verifySecondFactor(c, userId) {
+		return
+	}
+	codes, err := authentication.NewRecoveryCodes(s.store, userId)
+	if err != nil {
+		log.Printf("Failed to create recovery codes of user %d: %s", userId, err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, data.RecoveryCodes{RecoveryCodes: codes})
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/authentication"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
+	"github.com/JustusvonderBeek/shoppinglist-server/internal/server"
+)
+
+// ------------------------------------------------------------
+// Testing the two-factor authentication
+// ------------------------------------------------------------
+
+func loginWithSecondFactor(t *testing.T, totpCode string, recoveryCode string) int {
+	login := authentication.LoginRequest{User: testUser, TOTPCode: totpCode, RecoveryCode: recoveryCode}
+	login.Password = PASSWORD
+	raw, err := json.Marshal(login)
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", loginPath(testUser.OnlineID), bytes.NewReader(raw))
+	server.SetupRouter(store, cfg).ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestTOTPLogin(t *testing.T) {
+	connectDatabase()
+	CreateTestUser(t)
+	token := loginOnDevice(t, "Phone")
+	path := fmt.Sprintf("/v1/users/%d/totp", testUser.OnlineID)
+
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "POST", path, token, data.PasswordConfirmation{Password: "wrong"}).Code)
+	other := fmt.Sprintf("/v1/users/%d/totp", testUser.OnlineID+1)
+	assert.Equal(t, http.StatusUnauthorized, sendJSONRequest(t, "POST", other, token, data.PasswordConfirmation{Password: PASSWORD}).Code)
+	w := sendJSONRequest(t, "POST", path, token, data.PasswordConfirmation{Password: PASSWORD})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var enrollment data.TOTPEnrollment
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.Contains(t, enrollment.ProvisioningURI, enrollment.Secret)
+
+	// Until the first code is verified the login does not change
+	assert.Equal(t, http.StatusOK, loginWithSecondFactor(t, "", ""))
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "POST", path+"/verify", token, data.SecondFactor{Code: "123456x"}).Code)
+	now := time.Now()
+	code, err := authentication.TOTPCode(enrollment.Secret, now)
+	assert.Nil(t, err)
+	w = sendJSONRequest(t, "POST", path+"/verify", token, data.SecondFactor{Code: code})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var recovery data.RecoveryCodes
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	assert.Equal(t, 10, len(recovery.RecoveryCodes))
+	assert.Equal(t, http.StatusConflict, sendJSONRequest(t, "POST", path, token, data.PasswordConfirmation{Password: PASSWORD}).Code)
+
+	// The password alone is no longer enough and codes cannot be used twice
+	assert.Equal(t, http.StatusUnauthorized, loginWithSecondFactor(t, "", ""))
+	assert.Equal(t, http.StatusUnauthorized, loginWithSecondFactor(t, code, ""))
+	next, err := authentication.TOTPCode(enrollment.Secret, now.Add(30*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, loginWithSecondFactor(t, next, ""))
+	assert.Equal(t, http.StatusOK, loginWithSecondFactor(t, "", recovery.RecoveryCodes[0]))
+	assert.Equal(t, http.StatusUnauthorized, loginWithSecondFactor(t, "", recovery.RecoveryCodes[0]))
+
+	w = sendJSONRequest(t, "GET", path, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status data.TOTPStatus
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, data.TOTPStatus{Enabled: true, RecoveryCodesLeft: 9}, status)
+
+	// New recovery codes replace the old ones, disabling requires a second factor as well
+	w = sendJSONRequest(t, "POST", path+"/recovery", token, data.SecondFactor{RecoveryCode: recovery.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var renewed data.RecoveryCodes
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &renewed))
+	assert.Equal(t, http.StatusForbidden, sendJSONRequest(t, "DELETE", path, token, data.SecondFactor{RecoveryCode: recovery.RecoveryCodes[2]}).Code)
+	assert.Equal(t, http.StatusBadRequest, sendJSONRequest(t, "DELETE", path, token, data.SecondFactor{}).Code)
+	assert.Equal(t, http.StatusOK, sendJSONRequest(t, "DELETE", path, token, data.SecondFactor{RecoveryCode: renewed.RecoveryCodes[0]}).Code)
+	assert.Equal(t, http.StatusOK, loginWithSecondFactor(t, "", ""))
+	assert.Equal(t, http.StatusNotFound, sendJSONRequest(t, "DELETE", path, token, data.SecondFactor{Code: next}).Code)
+	DeleteTestUser(t)
+}
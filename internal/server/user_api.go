@@ -8,10 +8,9 @@ import (
 	"strconv"
 
 	"github.com/JustusvonderBeek/shoppinglist-server/internal/data"
-	"github.com/JustusvonderBeek/shoppinglist-server/internal/database"
 )
 
-func CreateAccount(c *gin.Context) {
+func (s *Server) CreateAccount(c *gin.Context) {
 	// Extracting username and password from request
 	var user data.User
 	err := c.ShouldBindJSON(&user)
@@ -20,7 +19,7 @@ func CreateAccount(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	createdUser, err := validateUserAndCreateAccount(user, c.Request.Header.Get("x-api-key"))
+	createdUser, err := s.validateUserAndCreateAccount(user)
 	if err != nil {
 		log.Printf("Failed to create user: %s", err)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -29,21 +28,15 @@ func CreateAccount(c *gin.Context) {
 	c.JSON(http.StatusCreated, createdUser)
 }
 
-func validateUserAndCreateAccount(user data.User, apiKey string) (data.User, error) {
+// validateUserAndCreateAccount creates a regular user, admins are only created by bootstrap-admin
+func (s *Server) validateUserAndCreateAccount(user data.User) (data.User, error) {
 	if user.OnlineID != 0 {
 		return data.User{}, errors.New("user id already set")
 	}
 	if user.Username == "" || user.Password == "" {
 		return data.User{}, errors.New("invalid username or password")
 	}
-	//if user.Username == "admin" {
-	//	keyValid, err := authentication.ApiKeyValid(apiKey)
-	//	if apiKey == "" || err != nil || keyValid.ValidUntil.Before(time.Now()) {
-	//		log.Printf("api key not valid %s - %s", err, apiKey)
-	//		return data.User{}, errors.New("invalid api key")
-	//	}
-	//}
-	loginUser, err := database.CreateUserAccountInDatabase(user.Username, user.Password)
+	loginUser, err := s.store.CreateUserAccountInDatabase(user.Username, user.Password)
 	if err != nil {
 		return data.User{}, err
 	}
@@ -52,7 +45,7 @@ func validateUserAndCreateAccount(user data.User, apiKey string) (data.User, err
 	return loginUser, nil
 }
 
-func DeleteAccount(c *gin.Context) {
+func (s *Server) DeleteAccount(c *gin.Context) {
 	sId := c.Param("userId")
 	id, err := strconv.Atoi(sId)
 	if err != nil {
@@ -66,7 +59,7 @@ func DeleteAccount(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	if err := database.DeleteUserAccount(int64(userId)); err != nil {
+	if err := s.store.DeleteUserAccount(int64(userId)); err != nil {
 		log.Printf("Failed to delete user account")
 		c.AbortWithStatus(http.StatusGone)
 		return
@@ -74,7 +67,7 @@ func DeleteAccount(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-func updateUserinfo(c *gin.Context) {
+func (s *Server) updateUserinfo(c *gin.Context) {
 	var user data.User
 	err := c.BindJSON(&user)
 	if err != nil {
@@ -95,7 +88,7 @@ func updateUserinfo(c *gin.Context) {
 		return
 	}
 	// User already found in our database. Simply update this stuff
-	user, err = database.ModifyUserAccountName(user.OnlineID, user.Username)
+	user, err = s.store.ModifyUserAccountName(user.OnlineID, user.Username)
 	if err != nil {
 		log.Printf("User %d to update not found: %s", user.OnlineID, err)
 		c.AbortWithStatus(http.StatusNotFound)
@@ -104,7 +97,7 @@ func updateUserinfo(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-func getUserInfos(c *gin.Context) {
+func (s *Server) getUserInfos(c *gin.Context) {
 	sUserId := c.Param("userId")
 	queriedUserId, err := strconv.Atoi(sUserId)
 	if err != nil {
@@ -115,7 +108,7 @@ func getUserInfos(c *gin.Context) {
 	}
 	// Make sure that the format of the user only includes name and other
 	// non critical information, especially passwords
-	user, err := database.GetUser(int64(queriedUserId))
+	user, err := s.store.GetUser(int64(queriedUserId))
 	if err != nil {
 		log.Printf("Queried user %d does not exist", queriedUserId)
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -124,7 +117,7 @@ func getUserInfos(c *gin.Context) {
 	c.JSON(http.StatusOK, user.ToWireFormat())
 }
 
-func getMatchingUsers(c *gin.Context) {
+func (s *Server) getMatchingUsers(c *gin.Context) {
 	// Expecting the searched username in the URL as query parameter
 	// like: users/name?username=xxx
 	queryUsername := c.Query("username")
@@ -133,7 +126,7 @@ func getMatchingUsers(c *gin.Context) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	users, err := database.GetUserFromMatchingUsername(queryUsername)
+	users, err := s.store.GetUserFromMatchingUsername(queryUsername)
 	if err != nil {
 		log.Printf("Failed to retrieve matching users: %s", err)
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -9,39 +9,36 @@ import (
 	"testing"
 )
 
-func connectDatabase() {
-	cfg := configuration.Config{
-		Database: "../../resources/db.json",
-	}
-	database.CheckDatabaseOnline(cfg)
+func createTestServer() *Server {
+	return NewServer(database.NewMemoryStore(), configuration.Config{})
 }
 
 func TestUserCreationWithCorrectData(t *testing.T) {
-	connectDatabase()
+	s := createTestServer()
 	newUser := data.User{
 		OnlineID: 0,
 		Username: "test creation user",
 		Password: "new password",
 	}
-	createdUser, err := validateUserAndCreateAccount(newUser, "")
+	createdUser, err := s.validateUserAndCreateAccount(newUser)
 	if err != nil {
 		log.Printf("Creating user failed: %s", err)
 		t.FailNow()
 	}
 
 	assert.Equal(t, newUser.Username, createdUser.Username)
-	assert.NotEqual(t, 0, createdUser.OnlineID)
+	assert.NotEqual(t, int64(0), createdUser.OnlineID)
 	assert.NotEqual(t, newUser.Password, createdUser.Password)
 }
 
 func TestUserCreationWithWrongData(t *testing.T) {
-	connectDatabase()
+	s := createTestServer()
 	newUser := data.User{
 		OnlineID: 12,
 		Username: "test creation user",
 		Password: "",
 	}
-	_, err := validateUserAndCreateAccount(newUser, "")
+	_, err := s.validateUserAndCreateAccount(newUser)
 	if err == nil {
 		log.Printf("Creating user did not fail with malicious data")
 		t.FailNow()
@@ -50,16 +47,17 @@ func TestUserCreationWithWrongData(t *testing.T) {
 }
 
 func TestCreatingAdminUser(t *testing.T) {
-	connectDatabase()
+	s := createTestServer()
 	newUser := data.User{
 		OnlineID: 0,
 		Username: "admin",
 		Password: "admin_password",
+		Role:     data.ADMIN,
 	}
-	_, err := validateUserAndCreateAccount(newUser, "")
-	if err == nil {
-		log.Printf("Creating admin user without API key did not fail")
-		t.FailNow()
-	}
-	assert.NotNil(t, err)
+	// The name and the requested role do not grant admin rights
+	createdUser, err := s.validateUserAndCreateAccount(newUser)
+	assert.Nil(t, err)
+	stored, err := s.store.GetUser(createdUser.OnlineID)
+	assert.Nil(t, err)
+	assert.Equal(t, data.USER, stored.Role)
 }
@@ -5,26 +5,27 @@ function generateJWT() {
 #  echo "Payload: $payload"
   destination="$2"
 #  echo "Destination: $destination"
-  signingSecretFile="$3"
+  keyIdFile="$3"
 
-  # Construct the header
-  jwt_header=$(echo -n '{"alg":"HS256","typ":"JWT"}' | base64 -w 0 | sed s/\+/-/g | sed 's/\//_/g' | sed -E s/=+$//)
-
-  # Read the secret from the jwtSecret.json file create by the other script
-  if [ ! -f "$signingSecretFile" ]; then
-      echo "JWT secret file not found! Create the jwtSecret first by running 'create_jwt_secret.sh' first."
+  # Read the current signing key created by the other script
+  if [ ! -f "$keyIdFile" ]; then
+      echo "Signing key not found! Create the signing key first by running 'create_signing_key.sh' first."
       exit 1
   fi
-  secret=$(cat "$signingSecretFile" | jq -r .Secret)
+  keyId=$(cat "$keyIdFile")
+  keyFile="$(dirname "$keyIdFile")/signingKey-${keyId}.pem"
 
-  # Convert secret to hex (not base64)
-  hexsecret=$(echo -n "$secret" | xxd -p | paste -sd "")
+  # Construct the header naming the signing key
+  jwt_header=$(echo -n "{\"alg\":\"EdDSA\",\"typ\":\"JWT\",\"kid\":\"$keyId\"}" | base64 -w 0 | sed s/\+/-/g | sed 's/\//_/g' | sed -E s/=+$//)
 
-  # Calculate hmac signature -- note option to pass in the key as hex bytes
-  hmac_signature=$(echo -n "${jwt_header}.${payload}" |  openssl dgst -sha256 -mac HMAC -macopt hexkey:$hexsecret -binary | base64 -w 0 | sed 's/\+/-/g' | sed 's/\//_/g' | sed -E 's/=+$//' )
+  # Ed25519 signs the message itself, not a digest, and cannot read it from a pipe
+  signingInput=$(mktemp)
+  echo -n "${jwt_header}.${payload}" > "$signingInput"
+  signature=$(openssl pkeyutl -sign -rawin -inkey "$keyFile" -in "$signingInput" | base64 -w 0 | sed 's/\+/-/g' | sed 's/\//_/g' | sed -E 's/=+$//' )
+  rm "$signingInput"
 
   # Create the full token
-  jwt="${jwt_header}.${payload}.${hmac_signature}"
+  jwt="${jwt_header}.${payload}.${signature}"
 
   echo "$jwt" > "$destination"
   echo "Wrote API Key into '$destination'"
@@ -32,25 +33,28 @@ function generateJWT() {
 
 echo "Creating new API key..."
 
+# Usage: create_api_key.sh [outputPath] [permissions], the permissions are comma separated
 outputPath="$1"
 if [[ $# -lt 1 ]]; then
   outputPath="./"
 fi
+permissions="${2:-metrics:read}"
+permissionsJson="[\"$(echo -n "$permissions" | sed 's/,/","/g')\"]"
 
 secretFile="${outputPath}apiKey.secret"
 jwtFile="${outputPath}apiKey.jwt"
-signingSecretFile="${outputPath}/jwtSecret.json"
+keyIdFile="${outputPath}signingKey.current"
 randomData=$(openssl rand -base64 32)
 validUntil=$(date -d "90 days" --iso-8601=seconds)
 echo "{\"secret\":\"$randomData\",\"validUntil\":\"$validUntil\"}" > "${secretFile}"
 
-privateClaims=$(echo -n "{\"key\":\"$randomData\",\"validUntil\":\"$validUntil\",\"admin\":true}" )
+privateClaims=$(echo -n "{\"key\":\"$randomData\",\"validUntil\":\"$validUntil\",\"permissions\":$permissionsJson}" )
 #echo "$privateClaims"
 base64PrivateClaims=$(echo "$privateClaims" | base64 -w 0 | sed 's/\+/-/g' | sed 's/\//_/g' |  sed -E 's/=+$//' )
 #echo "Base64: '$base64PrivateClaims'"
 
 # Convert the payload into a JWT token
-generateJWT "$base64PrivateClaims" "$jwtFile" "$signingSecretFile"
+generateJWT "$base64PrivateClaims" "$jwtFile" "$keyIdFile"
 
 echo "Secret stored into '$secretFile'"
-echo "API key successfully created"
\ No newline at end of file
+echo "API key granting $permissionsJson successfully created"
\ No newline at end of file
@@ -4,6 +4,10 @@
 -- source ./create_mysql_db.sql;
 -- OR directly:
 -- sudo mysql < ./create_mysql_db.sql
+--
+-- The server creates and upgrades the tables itself via the migrations in
+-- internal/database/migrations/mysql on startup. The tables below are kept
+-- for reference and match the latest migration.
 
 DROP DATABASE IF EXISTS <database>;
 CREATE DATABASE <database>;
@@ -69,12 +73,15 @@ CREATE TABLE shopping_list
 
 CREATE TABLE items_per_list
 (
-    listId    BIGINT  NOT NULL,
-    createdBy BIGINT  NOT NULL,
-    itemId    BIGINT  NOT NULL,
-    quantity  INT     NOT NULL,
-    checked   BOOLEAN NOT NULL,
-    addedBy   BIGINT,
+    listId         BIGINT      NOT NULL,
+    createdBy      BIGINT      NOT NULL,
+    itemId         BIGINT      NOT NULL,
+    quantity       INT         NOT NULL,
+    checked        BOOLEAN     NOT NULL,
+    addedBy        BIGINT,
+    position       INT         NOT NULL DEFAULT 0,
+    quantityEdited DATETIME(3) NULL,
+    checkedEdited  DATETIME(3) NULL,
     PRIMARY KEY (listId, createdBy, itemId),
     FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
     FOREIGN KEY (itemId) REFERENCES items (id) ON DELETE CASCADE,
@@ -83,10 +90,12 @@ CREATE TABLE items_per_list
 
 CREATE TABLE shared_list
 (
-    listId       BIGINT   NOT NULL,
-    createdBy    BIGINT   NOT NULL,
-    sharedWithId BIGINT   NOT NULL,
-    created      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    listId       BIGINT      NOT NULL,
+    createdBy    BIGINT      NOT NULL,
+    sharedWithId BIGINT      NOT NULL,
+    created      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    permission   VARCHAR(16) NOT NULL DEFAULT 'editor',
+    status       VARCHAR(16) NOT NULL DEFAULT 'accepted',
     PRIMARY KEY (listId, createdBy, sharedWithId),
     FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
     FOREIGN KEY (sharedWithId) REFERENCES shoppers (id) ON DELETE CASCADE
@@ -96,7 +105,7 @@ CREATE TABLE shared_list
 
 CREATE TABLE recipe
 (
-    recipeId       INT          NOT NULL,
+    recipeId       BIGINT       NOT NULL,
     createdBy      BIGINT       NOT NULL,
     name           VARCHAR(256) NOT NULL,
     createdAt      DATETIME     NOT NULL,
@@ -109,7 +118,7 @@ CREATE TABLE recipe
 
 CREATE TABLE ingredient_per_recipe
 (
-    recipeId     INT         NOT NULL,
+    recipeId     BIGINT      NOT NULL,
     createdBy    BIGINT      NOT NULL,
     itemId       BIGINT      NOT NULL,
     quantity     INT         NOT NULL,
@@ -121,7 +130,7 @@ CREATE TABLE ingredient_per_recipe
 
 CREATE TABLE description_per_recipe
 (
-    recipeId         INT           NOT NULL,
+    recipeId         BIGINT        NOT NULL,
     createdBy        BIGINT        NOT NULL,
     description      VARCHAR(1000) NOT NULL,
     descriptionOrder INT           NOT NULL,
@@ -131,7 +140,7 @@ CREATE TABLE description_per_recipe
 
 CREATE TABLE images_per_recipe
 (
-    recipeId  INT         NOT NULL,
+    recipeId  BIGINT      NOT NULL,
     createdBy BIGINT      NOT NULL,
     filename  VARCHAR(50) NOT NULL,
     PRIMARY KEY (recipeId, createdBy, filename),
@@ -140,7 +149,7 @@ CREATE TABLE images_per_recipe
 
 CREATE TABLE shared_recipe
 (
-    recipeId   INT    NOT NULL,
+    recipeId   BIGINT NOT NULL,
     createdBy  BIGINT NOT NULL,
     sharedWith BIGINT NOT NULL,
     PRIMARY KEY (recipeId, createdBy, sharedWith),
@@ -148,16 +157,181 @@ CREATE TABLE shared_recipe
     FOREIGN KEY (sharedWith) REFERENCES shoppers (id) ON DELETE CASCADE
 );
 
--- JWT Token Storage
+-- Households grouping users to share lists and recipes with all members
+
+CREATE TABLE households
+(
+    id        BIGINT AUTO_INCREMENT NOT NULL,
+    name      VARCHAR(256)          NOT NULL,
+    createdBy BIGINT                NOT NULL,
+    created   DATETIME              NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    FOREIGN KEY (createdBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE household_members
+(
+    householdId BIGINT      NOT NULL,
+    userId      BIGINT      NOT NULL,
+    role        VARCHAR(16) NOT NULL DEFAULT 'member',
+    joined      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (householdId, userId),
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE household_invitations
+(
+    householdId BIGINT   NOT NULL,
+    userId      BIGINT   NOT NULL,
+    invitedBy   BIGINT   NOT NULL,
+    created     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (householdId, userId),
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (invitedBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE TABLE shared_list_household
+(
+    listId      BIGINT      NOT NULL,
+    createdBy   BIGINT      NOT NULL,
+    householdId BIGINT      NOT NULL,
+    permission  VARCHAR(16) NOT NULL DEFAULT 'editor',
+    created     DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (listId, createdBy, householdId),
+    FOREIGN KEY (listId, createdBy) REFERENCES shopping_list (listId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE
+);
+
+CREATE TABLE shared_recipe_household
+(
+    recipeId    BIGINT   NOT NULL,
+    createdBy   BIGINT   NOT NULL,
+    householdId BIGINT   NOT NULL,
+    created     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recipeId, createdBy, householdId),
+    FOREIGN KEY (recipeId, createdBy) REFERENCES recipe (recipeId, createdBy) ON DELETE CASCADE,
+    FOREIGN KEY (householdId) REFERENCES households (id) ON DELETE CASCADE
+);
+
+-- Invite links for lists, recipes and households
+CREATE TABLE invites
+(
+    inviteId   VARCHAR(64) NOT NULL,
+    type       VARCHAR(16) NOT NULL,
+    resourceId BIGINT      NOT NULL,
+    createdBy  BIGINT      NOT NULL,
+    invitedBy  BIGINT      NOT NULL,
+    permission VARCHAR(16) NOT NULL DEFAULT '',
+    maxUses    INT         NOT NULL DEFAULT 1,
+    uses       INT         NOT NULL DEFAULT 0,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (inviteId),
+    FOREIGN KEY (invitedBy) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Users blocked from sending share requests and invitations
+CREATE TABLE blocked_users
+(
+    userId    BIGINT   NOT NULL,
+    blockedId BIGINT   NOT NULL,
+    created   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (userId, blockedId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (blockedId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Every login starts a session, so users can stay logged in on several devices
+CREATE TABLE user_session
+(
+    sessionId  VARCHAR(64)  NOT NULL,
+    userId     BIGINT       NOT NULL,
+    deviceName VARCHAR(100) NOT NULL DEFAULT '',
+    ip         VARCHAR(64)  NOT NULL DEFAULT '',
+    created    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastSeen   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sessionId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_session_user ON user_session (userId);
+
+-- JWT Token Storage, only the id (jti claim) of the issued tokens is stored
 CREATE TABLE token
 (
-    userId     BIGINT        NOT NULL,
-    token      VARCHAR(300) NOT NULL,
-    validUntil DATETIME      NOT NULL,
+    tokenId    VARCHAR(64) NOT NULL,
+    sessionId  VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    PRIMARY KEY (tokenId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (sessionId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
+
+CREATE INDEX token_session ON token (sessionId);
+
+-- Refresh tokens are only stored hashed, reusing a replaced token revokes the whole session
+CREATE TABLE refresh_token
+(
+    tokenHash  VARCHAR(64) NOT NULL,
+    familyId   VARCHAR(64) NOT NULL,
+    userId     BIGINT      NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (tokenHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE,
+    FOREIGN KEY (familyId) REFERENCES user_session (sessionId) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_token_family ON refresh_token (familyId);
+
+-- A single pending reset code per user, a new request replaces the previous code
+CREATE TABLE password_reset
+(
+    userId     BIGINT      NOT NULL,
+    codeHash   VARCHAR(64) NOT NULL,
+    validUntil DATETIME    NOT NULL,
+    created    DATETIME    NOT NULL,
+    attempts   INT         NOT NULL DEFAULT 0,
     PRIMARY KEY (userId),
     FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
 );
 
+-- The second factor of a user, enabled once the first code was verified
+CREATE TABLE totp
+(
+    userId       BIGINT      NOT NULL,
+    secret       VARCHAR(64) NOT NULL,
+    enabled      BOOLEAN     NOT NULL DEFAULT FALSE,
+    lastUsedStep BIGINT      NOT NULL DEFAULT 0,
+    created      DATETIME    NOT NULL,
+    PRIMARY KEY (userId),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Single use codes replacing the authenticator app, only their hash is stored
+CREATE TABLE recovery_code
+(
+    userId   BIGINT      NOT NULL,
+    codeHash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (userId, codeHash),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
+-- Accounts of external OpenID Connect providers linked to the users
+CREATE TABLE oidc_identity
+(
+    issuer  VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    userId  BIGINT       NOT NULL,
+    created DATETIME     NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (userId) REFERENCES shoppers (id) ON DELETE CASCADE
+);
+
 -- Keeping track of the shopping history to suggest items
 
 CREATE TABLE history
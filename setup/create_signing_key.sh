@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# Creates a new Ed25519 key signing the tokens. Add it to the 'JWT.SigningKeys' of the
+# configuration, previous keys can stay configured until their tokens expired.
+
+echo "Creating new signing key"
+
+outputPath="$1"
+if [[ $# -lt 1 ]]; then
+  outputPath="./"
+fi
+
+keyId=$(date +%Y%m%d)-$(openssl rand -hex 4)
+keyFile="${outputPath}signingKey-${keyId}.pem"
+openssl genpkey -algorithm ed25519 -out "$keyFile"
+chmod 0600 "$keyFile"
+
+validFrom=$(date --iso-8601=seconds)
+echo "Key stored into '$keyFile', add it to the configuration:"
+echo """{
+	\"KeyId\": \"$keyId\",
+	\"PrivateKeyFile\": \"$keyFile\",
+	\"ValidFrom\": \"$validFrom\"
+}"""
+echo "$keyId" > "${outputPath}signingKey.current"
@@ -18,8 +18,8 @@ read -p "Press enter to continue"
 # Create the tables in the database
 sudo mysql < ./filled_database.sql
 
-# Create the JWT secret
-./create_jwt_secret.sh "$outputDirectory"
+# Create the key signing the tokens
+./create_signing_key.sh "$outputDirectory"
 
 # Create the API key
 ./create_api_key.sh "$outputDirectory"